@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamfiber"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"strconv"
+	"time"
+)
+
+// Access request actions, authorized on the role or resource access is requested to
+const (
+	actionRequestAccess = "iam:RequestAccess"
+	actionApproveAccess = "iam:ApproveAccess"
+)
+
+const (
+	// defaultAccessDuration is how long access is granted for when a request doesn't say
+	defaultAccessDuration = time.Hour
+	// maxAccessDuration is the longest access may be requested for
+	maxAccessDuration = 12 * time.Hour
+)
+
+var (
+	errBadAccessTarget      = errors.New("either role_id or an action and a single resource_name must be requested")
+	errForeignAccessTarget  = errors.New("resource_name must be in the requester's org")
+	errMissingJustification = errors.New("justification is required")
+	errBadDuration          = fmt.Errorf("duration_seconds must be between 1 and %d", int(maxAccessDuration.Seconds()))
+	errSelfApproval         = errors.New("access requests can't be decided by their requester")
+	errNotRequester         = errors.New("access requests can only be cancelled by their requester")
+	errBadAccessStatus      = errors.New("status must be pending, approved, denied, cancelled or expired")
+)
+
+// accessStatuses is the statuses access requests can be listed by
+var accessStatuses = map[string]bool{
+	datastore.AccessPending: true, datastore.AccessApproved: true, datastore.AccessDenied: true,
+	datastore.AccessCancelled: true, datastore.AccessExpired: true,
+}
+
+// roleResourceName returns the NRN of a role, the resource access to it is requested and approved on
+func roleResourceName(orgID int, name string) string {
+	return fmt.Sprintf("oso:%d:role/%s", orgID, name)
+}
+
+// setupAccessRequests configures the routes for requesting temporary access to roles and resources under /iam.
+// Requests are authorized by the handlers, on the role or resource in the request.
+func (s *Server) setupAccessRequests(app *fiber.App) {
+	g := app.Group(adminPrefix + "/access-requests")
+	g.Post("/", s.createAccessRequestRoute)
+	g.Get("/", s.listAccessRequestsRoute)
+	g.Get("/:id", s.getAccessRequestRoute)
+	g.Post("/:id/approve", s.decideAccessRequestRoute(datastore.AccessApproved))
+	g.Post("/:id/deny", s.decideAccessRequestRoute(datastore.AccessDenied))
+	g.Post("/:id/cancel", s.cancelAccessRequestRoute)
+}
+
+// createAccessRequestRoute requests the role or the action on the resource in the body for the requester, who must
+// be allowed to request access to it
+func (s *Server) createAccessRequestRoute(c *fiber.Ctx) error {
+	reqUser, err := iamfiber.User(c)
+	if err != nil {
+		return jsonErrorHandler(c, &iam.Error{Status: fiber.StatusUnauthorized, Err: err})
+	}
+	var body datastore.AccessRequest
+	if err := c.BodyParser(&body); err != nil {
+		return s.adminError(c, err)
+	}
+	// only what's requested is taken from the body
+	r := datastore.AccessRequest{
+		OrgID: reqUser.User.OrgID, UserID: reqUser.User.UserID, RoleID: body.RoleID, Action: body.Action,
+		ResourceName: body.ResourceName, DurationSeconds: body.DurationSeconds, Justification: body.Justification,
+	}
+	if err := validateAccessRequest(&r); err != nil {
+		return s.adminError(c, err)
+	}
+	if r.RoleID != 0 {
+		// only roles of the requester's org can be requested
+		role, err := s.admin.FindRoleByID(context.Background(), r.RoleID)
+		if err != nil || role.OrgID != r.OrgID {
+			return s.adminError(c, errNotFound)
+		}
+	}
+	if err := s.authorizeAccess(c, actionRequestAccess, &r); err != nil {
+		return jsonErrorHandler(c, err)
+	}
+	if err := s.admin.CreateAccessRequest(context.Background(), &r); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(r)
+}
+
+// listAccessRequestsRoute lists the access requests of the requester's org, optionally with the status in the
+// status query param, that the requester made or may decide
+func (s *Server) listAccessRequestsRoute(c *fiber.Ctx) error {
+	reqUser, err := iamfiber.User(c)
+	if err != nil {
+		return jsonErrorHandler(c, &iam.Error{Status: fiber.StatusUnauthorized, Err: err})
+	}
+	status := c.Query("status")
+	if status != "" && !accessStatuses[status] {
+		return s.adminError(c, errBadAccessStatus)
+	}
+	rs, err := s.admin.ListAccessRequests(context.Background(), reqUser.User.OrgID, status)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	res := []*datastore.AccessRequest{}
+	for _, r := range rs {
+		if s.canViewAccessRequest(reqUser, r) {
+			res = append(res, r)
+		}
+	}
+	return c.JSON(res)
+}
+
+func (s *Server) getAccessRequestRoute(c *fiber.Ctx) error {
+	_, r, err := s.accessRequest(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(r)
+}
+
+// decideAccessRequestRoute returns a handler moving an access request to status, with the reason in the body.  The
+// decider must be allowed to approve access to the role or resource requested, and can't be the requester.
+func (s *Server) decideAccessRequestRoute(status string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		reqUser, r, err := s.accessRequest(c)
+		if err != nil {
+			return s.adminError(c, err)
+		}
+		if err := s.authorizeAccess(c, actionApproveAccess, r); err != nil {
+			return jsonErrorHandler(c, err)
+		}
+		if r.UserID == reqUser.User.UserID {
+			return s.adminError(c, errSelfApproval)
+		}
+		d, err := decision(c, status, reqUser.User.UserID)
+		if err != nil {
+			return s.adminError(c, err)
+		}
+		if r, err = s.admin.DecideAccessRequest(context.Background(), r.RequestID, d, time.Now()); err != nil {
+			return s.adminError(c, err)
+		}
+		s.logger.Infow("access request decided", "request", r.RequestID, "status", r.Status, "decider", d.DeciderID)
+		return c.JSON(r)
+	}
+}
+
+// cancelAccessRequestRoute cancels a pending access request of the requester's
+func (s *Server) cancelAccessRequestRoute(c *fiber.Ctx) error {
+	reqUser, r, err := s.accessRequest(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if r.UserID != reqUser.User.UserID {
+		return s.adminError(c, errNotRequester)
+	}
+	d, err := decision(c, datastore.AccessCancelled, reqUser.User.UserID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if r, err = s.admin.DecideAccessRequest(context.Background(), r.RequestID, d, time.Now()); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(r)
+}
+
+// validateAccessRequest returns an error if r doesn't request exactly one role or action on a resource of its org for
+// a valid duration with a justification, defaulting its duration if it has none
+func validateAccessRequest(r *datastore.AccessRequest) error {
+	if r.RoleID != 0 && (r.Action != "" || r.ResourceName != "") {
+		return errBadAccessTarget
+	}
+	if r.RoleID == 0 {
+		// only a single action on a single resource can be requested
+		if roles.ValidateAction(r.Action) != nil || roles.IsActionPattern(r.Action) {
+			return errBadAccessTarget
+		}
+		res, err := roles.NewExternalResource(r.ResourceName, nil)
+		if err != nil || res.Name == "*" {
+			return errBadAccessTarget
+		}
+		if org, _, _ := roles.SplitResourceName(r.ResourceName); org != strconv.Itoa(r.OrgID) {
+			return errForeignAccessTarget
+		}
+		rType, _ := roles.PolicyResourceName(r.ResourceName).GetType()
+		if err := catalog.Default.Validate(rType, r.Action); err != nil {
+			return err
+		}
+	}
+	if r.Justification == "" {
+		return errMissingJustification
+	}
+	if r.DurationSeconds == 0 {
+		r.DurationSeconds = int(defaultAccessDuration.Seconds())
+	}
+	if r.DurationSeconds < 0 || r.DurationSeconds > int(maxAccessDuration.Seconds()) {
+		return errBadDuration
+	}
+	return nil
+}
+
+// decision returns the decision of the user with deciderID to move an access request to status, with the reason in
+// the request body if there is one
+func decision(c *fiber.Ctx, status string, deciderID int) (datastore.AccessDecision, error) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return datastore.AccessDecision{}, err
+		}
+	}
+	return datastore.AccessDecision{Status: status, DeciderID: deciderID, Reason: body.Reason}, nil
+}
+
+// accessRequest finds the access request with the ID in the id route param, which must be one the requester made or
+// may decide
+func (s *Server) accessRequest(c *fiber.Ctx) (*iam.DerivedUser, *datastore.AccessRequest, error) {
+	reqUser, err := iamfiber.User(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.admin.FindAccessRequest(context.Background(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.OrgID != reqUser.User.OrgID || !s.canViewAccessRequest(reqUser, r) {
+		return nil, nil, errNotFound
+	}
+	return reqUser, r, nil
+}
+
+// canViewAccessRequest returns true if u made r or may approve it
+func (s *Server) canViewAccessRequest(u *iam.DerivedUser, r *datastore.AccessRequest) bool {
+	if r.UserID == u.User.UserID {
+		return true
+	}
+	target, err := s.accessTarget(r)
+	if err != nil {
+		return false
+	}
+	allowed, err := s.authz.IsAllowed(u, actionApproveAccess, target)
+	return err == nil && allowed
+}
+
+// authorizeAccess returns the failure to authorize the requester to perform action on the role or resource r
+// requests access to, or nil if they may
+func (s *Server) authorizeAccess(c *fiber.Ctx, action string, r *datastore.AccessRequest) *iam.Error {
+	rType := "role"
+	if r.RoleID == 0 {
+		rType, _ = roles.PolicyResourceName(r.ResourceName).GetType()
+	}
+	target, err := s.accessTarget(r)
+	if err != nil {
+		return &iam.Error{Status: fiber.StatusNotFound, ResourceType: rType, Err: err}
+	}
+	if err := s.newEnforcer().Authorize(c.UserContext(), action, rType, target); err != nil {
+		return &iam.Error{Status: iam.HTTPStatus(err), ResourceType: rType, Err: err}
+	}
+	return nil
+}
+
+// accessTarget returns the role or resource r requests access to, for authorization
+func (s *Server) accessTarget(r *datastore.AccessRequest) (*roles.ExternalResource, error) {
+	if r.RoleID == 0 {
+		return roles.NewExternalResource(r.ResourceName, nil)
+	}
+	role, err := s.admin.FindRoleByID(context.Background(), r.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	return roles.NewExternalResource(roleResourceName(role.OrgID, role.Name), nil)
+}
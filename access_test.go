@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timestamps matches the times in JSON responses, which depend on when a test runs
+var timestamps = regexp.MustCompile(`"\d{4}-\d\d-\d\dT[^"]+"`)
+
+func Test_accessRequestRoutes(t *testing.T) {
+	t.Parallel()
+
+	// steps run in order against the same admin datastore
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		apiKey  string
+		body    string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "request without justification",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"role_id": 1}`,
+			expCode: 400,
+			expBody: `{"error":"justification is required"}`,
+		},
+		{
+			name:    "request role and action",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"role_id": 1, "action": "delete", "resource_name": "oso:0:zone/foo.com", "justification": "on call"}`,
+			expCode: 400,
+			expBody: `{"error":"either role_id or an action and a single resource_name must be requested"}`,
+		},
+		{
+			name:    "request all zones",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"action": "delete", "resource_name": "oso:0:zone/*", "justification": "on call"}`,
+			expCode: 400,
+			expBody: `{"error":"either role_id or an action and a single resource_name must be requested"}`,
+		},
+		{
+			name:    "request action pattern",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"action": "del*", "resource_name": "oso:0:zone/foo.com", "justification": "on call"}`,
+			expCode: 400,
+			expBody: `{"error":"either role_id or an action and a single resource_name must be requested"}`,
+		},
+		{
+			name:    "request resource of other org",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"action": "delete", "resource_name": "oso:1:zone/lambda.com", "justification": "on call"}`,
+			expCode: 400,
+			expBody: `{"error":"resource_name must be in the requester's org"}`,
+		},
+		{
+			name:    "request unknown action",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"action": "destroy", "resource_name": "oso:0:zone/foo.com", "justification": "on call"}`,
+			expCode: 400,
+			expBody: `{"error":"unknown action: \"destroy\" matches no zone action"}`,
+		},
+		{
+			name:    "request too long",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"role_id": 1, "justification": "on call", "duration_seconds": 86400}`,
+			expCode: 400,
+			expBody: `{"error":"duration_seconds must be between 1 and 43200"}`,
+		},
+		{
+			name:    "request role in other org",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"role_id": 2, "justification": "on call"}`,
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "not allowed to request role",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "bob",
+			body:    `{"role_id": 1, "justification": "on call"}`,
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "request role",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"role_id": 1, "justification": "on call", "status": "approved"}`,
+			expCode: 201,
+			expBody: `{"request_id":101,"org_id":0,"user_id":7,"role_id":1,"duration_seconds":3600,"justification":"on call",` +
+				`"status":"pending","created_at":"<time>"}`,
+		},
+		{
+			name:    "request action",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			body:    `{"action": "delete", "resource_name": "oso:0:zone/foo.com", "justification": "cleanup", "duration_seconds": 600}`,
+			expCode: 201,
+			expBody: `{"request_id":102,"org_id":0,"user_id":7,"action":"delete","resource_name":"oso:0:zone/foo.com",` +
+				`"duration_seconds":600,"justification":"cleanup","status":"pending","created_at":"<time>"}`,
+		},
+		{
+			name:    "approver requests action",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "glados",
+			body:    `{"action": "delete", "resource_name": "oso:0:zone/foo.com", "justification": "testing"}`,
+			expCode: 201,
+			expBody: `{"request_id":103,"org_id":0,"user_id":8,"action":"delete","resource_name":"oso:0:zone/foo.com",` +
+				`"duration_seconds":3600,"justification":"testing","status":"pending","created_at":"<time>"}`,
+		},
+		{
+			name:    "approve own request",
+			method:  "POST",
+			route:   "/iam/access-requests/103/approve",
+			apiKey:  "glados",
+			expCode: 403,
+			expBody: `{"error":"access requests can't be decided by their requester"}`,
+		},
+		{
+			name:    "list without requests or approvals",
+			method:  "GET",
+			route:   "/iam/access-requests",
+			apiKey:  "bob",
+			expCode: 200,
+			expBody: `[]`,
+		},
+		{
+			name:    "list own requests",
+			method:  "GET",
+			route:   "/iam/access-requests",
+			apiKey:  "chell",
+			expCode: 200,
+			expBody: `[{"request_id":102,"org_id":0,"user_id":7,"action":"delete","resource_name":"oso:0:zone/foo.com",` +
+				`"duration_seconds":600,"justification":"cleanup","status":"pending","created_at":"<time>"},` +
+				`{"request_id":101,"org_id":0,"user_id":7,"role_id":1,"duration_seconds":3600,"justification":"on call",` +
+				`"status":"pending","created_at":"<time>"}]`,
+		},
+		{
+			name:    "list bad status",
+			method:  "GET",
+			route:   "/iam/access-requests?status=open",
+			apiKey:  "glados",
+			expCode: 400,
+			expBody: `{"error":"status must be pending, approved, denied, cancelled or expired"}`,
+		},
+		{
+			name:    "request hidden from others",
+			method:  "GET",
+			route:   "/iam/access-requests/101",
+			apiKey:  "bob",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "not allowed to approve",
+			method:  "POST",
+			route:   "/iam/access-requests/101/approve",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "approve role",
+			method:  "POST",
+			route:   "/iam/access-requests/101/approve",
+			apiKey:  "glados",
+			body:    `{"reason": "paged"}`,
+			expCode: 200,
+			expBody: `{"request_id":101,"org_id":0,"user_id":7,"role_id":1,"duration_seconds":3600,"justification":"on call",` +
+				`"status":"approved","created_at":"<time>","decided_at":"<time>","decider_id":8,"reason":"paged",` +
+				`"expires_at":"<time>","grant_role_id":1}`,
+		},
+		{
+			name:    "approve twice",
+			method:  "POST",
+			route:   "/iam/access-requests/101/approve",
+			apiKey:  "glados",
+			expCode: 409,
+			expBody: `{"error":"access request can't be decided: it's approved, so it can't be approved"}`,
+		},
+		{
+			name:    "approve action",
+			method:  "POST",
+			route:   "/iam/access-requests/102/approve",
+			apiKey:  "glados",
+			expCode: 200,
+			expBody: `{"request_id":102,"org_id":0,"user_id":7,"action":"delete","resource_name":"oso:0:zone/foo.com",` +
+				`"duration_seconds":600,"justification":"cleanup","status":"approved","created_at":"<time>",` +
+				`"decided_at":"<time>","decider_id":8,"expires_at":"<time>","grant_role_id":106}`,
+		},
+		{
+			name:    "temporary bindings",
+			method:  "GET",
+			route:   "/iam/users/7/roles",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"role_id":1,"name":"viewZonesRole","org_id":0,"user_id":7,"expires_at":"<time>"},` +
+				`{"role_id":106,"name":"access-request-102","org_id":0,"user_id":7,"expires_at":"<time>"}]`,
+		},
+		{
+			name:    "cancel other's request",
+			method:  "POST",
+			route:   "/iam/access-requests/103/cancel",
+			apiKey:  "chell",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "cancel request",
+			method:  "POST",
+			route:   "/iam/access-requests/103/cancel",
+			apiKey:  "glados",
+			expCode: 200,
+			expBody: `{"request_id":103,"org_id":0,"user_id":8,"action":"delete","resource_name":"oso:0:zone/foo.com",` +
+				`"duration_seconds":3600,"justification":"testing","status":"cancelled","created_at":"<time>",` +
+				`"decided_at":"<time>","decider_id":8}`,
+		},
+		{
+			name:    "list pending",
+			method:  "GET",
+			route:   "/iam/access-requests?status=pending",
+			apiKey:  "glados",
+			expCode: 200,
+			expBody: `[]`,
+		},
+		{
+			name:    "decisions audited",
+			method:  "GET",
+			route:   "/iam/audit-events",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"event_id":108,"occurred_at":"<time>","type":"AccessRequestCancelled","org_id":0,"user_id":8,` +
+				`"detail":"access request 103 cancelled"},` +
+				`{"event_id":107,"occurred_at":"<time>","type":"AccessRequestApproved","org_id":0,"user_id":7,"role_id":106,` +
+				`"detail":"access request 102 approved"},` +
+				`{"event_id":104,"occurred_at":"<time>","type":"AccessRequestApproved","org_id":0,"user_id":7,"role_id":1,` +
+				`"detail":"access request 101 approved"}]`,
+		},
+	}
+
+	app := NewServer(newTestAuthorizer(t), &mockDatastore{}, newMemAdmin(), newNopLog(), defaultConfig()).setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", tt.apiKey)
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, timestamps.ReplaceAllString(string(body), `"<time>"`))
+		})
+	}
+}
+
+func Test_expireAccessRequests(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+
+	admin := newMemAdmin()
+	admin.roles[101] = &models.Role{RoleID: 101, Name: "access-request-100", OrgID: 0}
+	admin.policies[102] = &models.Policy{
+		PolicyID: 102, Name: "access-request-100", Effect: "allow", Actions: types.StringArray{"delete"},
+		ResourceName: "oso:0:zone/foo.com", Kind: datastore.PolicyKindInline, OwnerRoleID: 101,
+	}
+	admin.rolePolicies[[2]int{101, 102}] = true
+	admin.userRoles[[2]int{7, 101}] = datastore.Window{ExpiresAt: &before}
+	admin.requests[100] = &datastore.AccessRequest{
+		RequestID: 100, UserID: 7, Action: "delete", ResourceName: "oso:0:zone/foo.com", Status: datastore.AccessApproved,
+		DeciderID: 8, ExpiresAt: &before, GrantRoleID: 101,
+	}
+	admin.nextID = 102
+	s := NewServer(newTestAuthorizer(t), &mockDatastore{}, admin, newNopLog(), defaultConfig())
+	s.sweepExpiredBindings(context.Background(), now)
+	s.expireAccessRequests(context.Background(), now)
+
+	assert.Equal(t, datastore.AccessExpired, admin.requests[100].Status)
+	assert.Equal(t, 8, admin.requests[100].DeciderID)
+	assert.NotContains(t, admin.roles, 101)
+	assert.NotContains(t, admin.policies, 102)
+	assert.Equal(t, map[[2]int]datastore.Window{{1, 1}: {}}, admin.userRoles)
+	require.Len(t, admin.events, 2)
+	assert.Equal(t, datastore.EventRoleBindingExpired, admin.events[0].Type)
+	assert.Equal(t, &datastore.AuditEvent{
+		EventID: 104, OccurredAt: now, Type: datastore.EventAccessRequestExpired, OrgID: 0, UserID: 7, RoleID: 101,
+		Detail: "access request 100 expired",
+	}, admin.events[1])
+}
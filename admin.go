@@ -0,0 +1,964 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamfiber"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"strconv"
+	"time"
+)
+
+// adminPrefix is the path the admin API is served under
+const adminPrefix = "/iam"
+
+// IAM actions, authorized on the requester's org
+const (
+	actionGetOrg          = "iam:GetOrg"
+	actionListUsers       = "iam:ListUsers"
+	actionGetUser         = "iam:GetUser"
+	actionCreateUser      = "iam:CreateUser"
+	actionDeleteUser      = "iam:DeleteUser"
+	actionListRoles       = "iam:ListRoles"
+	actionGetRole         = "iam:GetRole"
+	actionCreateRole      = "iam:CreateRole"
+	actionDeleteRole      = "iam:DeleteRole"
+	actionListPolicies    = "iam:ListPolicies"
+	actionGetPolicy       = "iam:GetPolicy"
+	actionCreatePolicy    = "iam:CreatePolicy"
+	actionDeletePolicy    = "iam:DeletePolicy"
+	actionListConditions  = "iam:ListConditions"
+	actionGetCondition    = "iam:GetCondition"
+	actionCreateCondition = "iam:CreateCondition"
+	actionDeleteCondition = "iam:DeleteCondition"
+	actionBindRole        = "iam:BindRole"
+	actionUnbindRole      = "iam:UnbindRole"
+	actionAttachPolicy    = "iam:AttachPolicy"
+	actionDetachPolicy    = "iam:DetachPolicy"
+	actionAttachCondition = "iam:AttachCondition"
+	actionDetachCondition = "iam:DetachCondition"
+	actionGetPermissions  = "iam:GetPermissions"
+	actionListAuditEvents = "iam:ListAuditEvents"
+
+	actionCreatePolicyVersion     = "iam:CreatePolicyVersion"
+	actionSetDefaultPolicyVersion = "iam:SetDefaultPolicyVersion"
+)
+
+var (
+	errBadID       = errors.New("id must be an integer")
+	errNotFound    = errors.New("not found")
+	errMissingName = errors.New("name is required")
+	errMissingKey  = errors.New("api_key is required")
+	errBadNRN      = errors.New("resource_name must be an NRN of the form oso:<org>:<type>/<id>")
+	errBadEffect   = fmt.Errorf("effect must be %q or %q", iam.EffectAllow, iam.EffectDeny)
+	errMissingType = errors.New("type is required")
+	errBadVersion  = errors.New("version must be an integer")
+	errBadAction   = errors.New("each action must be an action or glob pattern, optionally qualified by a service, e.g. zone:Get*")
+	errBadNotNRN   = errors.New("each not_resource_name must be an NRN of the form oso:<org>:<type>/<id>")
+	errBadVariable = errors.New("policy variables must be one of ${principal.user_id}, ${principal.org_id}, ${principal.name} or ${principal.tag/<key>}")
+	errForeignNRN  = errors.New("resource_name and not_resource_names must be in the requester's org or ${principal.org_id}")
+	errBadKind     = fmt.Errorf("kind must be %q or %q", datastore.PolicyKindOrg, datastore.PolicyKindInline)
+	errManaged     = errors.New("managed policies are read-only")
+	errInline      = errors.New("inline policies can only be attached to the role they belong to, and are deleted rather than detached")
+)
+
+// orgResourceName returns the NRN of org, the resource IAM actions are authorized on
+func orgResourceName(orgID int) string {
+	return fmt.Sprintf("oso:%d:org/%d", orgID, orgID)
+}
+
+// orgLoader loads the requester's org for authorization of IAM actions
+func (s *Server) orgLoader() iam.ResourceLoader[*fiber.Ctx] {
+	return iam.LoaderFunc("org", func(c *fiber.Ctx) (interface{}, error) {
+		reqUser, err := iamfiber.User(c)
+		if err != nil {
+			return nil, err
+		}
+		return roles.NewExternalResource(orgResourceName(reqUser.User.OrgID), nil)
+	})
+}
+
+// jsonErrorHandler responds to authentication and authorization failures with JSON errors
+func jsonErrorHandler(c *fiber.Ctx, err *iam.Error) error {
+	switch err.Status {
+	case fiber.StatusUnauthorized:
+		return c.Status(err.Status).JSON(fiber.Map{"error": err.Error()})
+	case fiber.StatusForbidden:
+		return c.Status(err.Status).JSON(fiber.Map{"error": iam.ErrForbidden.Error()})
+	}
+	return c.Status(err.Status).JSON(fiber.Map{"error": errNotFound.Error()})
+}
+
+// setupAdmin configures the JSON admin API for managing the requester's org under /iam
+func (s *Server) setupAdmin(app *fiber.App) {
+	mw := iamfiber.New(iamfiber.Config{Enforcer: s.newEnforcer(), ErrorHandler: jsonErrorHandler})
+	org := s.orgLoader()
+	g := app.Group(adminPrefix)
+
+	g.Get("/orgs", mw.Require(actionGetOrg, org), s.listOrgsRoute)
+	g.Get("/orgs/:id", mw.Require(actionGetOrg, org), s.getOrgRoute)
+	g.Put("/orgs/:id/parent", mw.Require(actionMoveOrg, org), s.moveOrgRoute)
+	g.Get("/orgs/:id/roles", mw.Require(actionListRoles, org), s.listOrgRolesRoute)
+	g.Put("/orgs/:id/roles/:roleId", mw.Require(actionBindRole, org), s.bindOrgRoleRoute)
+	g.Delete("/orgs/:id/roles/:roleId", mw.Require(actionUnbindRole, org), s.unbindOrgRoleRoute)
+	g.Get("/audit-events", mw.Require(actionListAuditEvents, org), s.listAuditEventsRoute)
+	g.Get("/lint", mw.Require(actionListPolicies, org), s.lintOrgRoute)
+	g.Get("/actions", mw.Require(actionListPolicies, org), s.listActionsRoute)
+	g.Get("/decisions", mw.Require(actionListAuditEvents, org), s.listDecisionsRoute)
+	g.Get("/unused", mw.Require(actionListAuditEvents, org), s.listUnusedRoute)
+
+	g.Get("/users", mw.Require(actionListUsers, org), s.listUsersAdminRoute)
+	g.Post("/users", mw.Require(actionCreateUser, org), s.createUserRoute)
+	g.Get("/users/:id", mw.Require(actionGetUser, org), s.getUserRoute)
+	g.Delete("/users/:id", mw.Require(actionDeleteUser, org), s.deleteUserRoute)
+	g.Get("/users/:id/roles", mw.Require(actionListRoles, org), s.listUserRolesRoute)
+	g.Put("/users/:id/roles/:roleId", mw.Require(actionBindRole, org), s.bindRoleRoute)
+	g.Delete("/users/:id/roles/:roleId", mw.Require(actionUnbindRole, org), s.unbindRoleRoute)
+	g.Get("/users/:id/permissions", mw.Require(actionGetPermissions, org), s.getPermissionsRoute)
+	g.Post("/users/:id/explain", mw.Require(actionGetPermissions, org), s.explainRoute)
+	g.Post("/who-can", mw.Require(actionGetPermissions, org), s.whoCanRoute)
+	g.Get("/users/:id/lint", mw.Require(actionGetPermissions, org), s.lintUserRoute)
+	g.Get("/users/:id/recommendation", mw.Require(actionGetPermissions, org), s.recommendUserRoute)
+
+	g.Get("/roles", mw.Require(actionListRoles, org), s.listRolesRoute)
+	g.Post("/roles", mw.Require(actionCreateRole, org), s.createRoleRoute)
+	g.Get("/roles/:id", mw.Require(actionGetRole, org), s.getRoleRoute)
+	g.Delete("/roles/:id", mw.Require(actionDeleteRole, org), s.deleteRoleRoute)
+	g.Get("/roles/:id/policies", mw.Require(actionListPolicies, org), s.listRolePoliciesRoute)
+	g.Get("/roles/:id/lint", mw.Require(actionListPolicies, org), s.lintRoleRoute)
+	g.Get("/roles/:id/recommendation", mw.Require(actionListPolicies, org), s.recommendRoleRoute)
+	g.Put("/roles/:id/policies/:policyId", mw.Require(actionAttachPolicy, org), s.attachPolicyRoute)
+	g.Delete("/roles/:id/policies/:policyId", mw.Require(actionDetachPolicy, org), s.detachPolicyRoute)
+
+	g.Get("/policies", mw.Require(actionListPolicies, org), s.listPoliciesRoute)
+	g.Post("/policies", mw.Require(actionCreatePolicy, org), s.createPolicyRoute)
+	g.Get("/policies/:id", mw.Require(actionGetPolicy, org), s.getPolicyRoute)
+	g.Get("/policies/:id/usage", mw.Require(actionGetPolicy, org), s.getPolicyUsageRoute)
+	g.Delete("/policies/:id", mw.Require(actionDeletePolicy, org), s.deletePolicyRoute)
+	g.Get("/policies/:id/conditions", mw.Require(actionListConditions, org), s.listPolicyConditionsRoute)
+	g.Put("/policies/:id/conditions/:conditionId", mw.Require(actionAttachCondition, org), s.attachConditionRoute)
+	g.Delete("/policies/:id/conditions/:conditionId", mw.Require(actionDetachCondition, org), s.detachConditionRoute)
+	g.Get("/policies/:id/versions", mw.Require(actionGetPolicy, org), s.listPolicyVersionsRoute)
+	g.Post("/policies/:id/versions", mw.Require(actionCreatePolicyVersion, org), s.createPolicyVersionRoute)
+	g.Get("/policies/:id/versions/:version", mw.Require(actionGetPolicy, org), s.getPolicyVersionRoute)
+	g.Put("/policies/:id/default-version", mw.Require(actionSetDefaultPolicyVersion, org), s.setDefaultPolicyVersionRoute)
+	g.Post("/policies/:id/rollback", mw.Require(actionSetDefaultPolicyVersion, org), s.rollbackPolicyRoute)
+	g.Get("/policies/:id/diff", mw.Require(actionGetPolicy, org), s.diffPolicyVersionsRoute)
+
+	g.Get("/conditions", mw.Require(actionListConditions, org), s.listConditionsRoute)
+	g.Post("/conditions", mw.Require(actionCreateCondition, org), s.createConditionRoute)
+	g.Get("/conditions/:id", mw.Require(actionGetCondition, org), s.getConditionRoute)
+	g.Delete("/conditions/:id", mw.Require(actionDeleteCondition, org), s.deleteConditionRoute)
+}
+
+// listOrgsRoute lists the requester's org and its descendants
+func (s *Server) listOrgsRoute(c *fiber.Ctx) error {
+	os, _, err := s.visibleOrgs(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if os == nil {
+		os = models.OrgSlice{}
+	}
+	return c.JSON(os)
+}
+
+func (s *Server) getOrgRoute(c *fiber.Ctx) error {
+	o, err := s.subOrg(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(o)
+}
+
+func (s *Server) listAuditEventsRoute(c *fiber.Ctx) error {
+	es, err := s.admin.ListAuditEvents(context.Background(), reqOrgID(c))
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if es == nil {
+		es = []*datastore.AuditEvent{}
+	}
+	return c.JSON(es)
+}
+
+func (s *Server) listUsersAdminRoute(c *fiber.Ctx) error {
+	us, err := s.admin.ListUsersByOrgID(context.Background(), reqOrgID(c))
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	res := models.UserSlice{}
+	for _, u := range *us {
+		res = append(res, redactUser(u))
+	}
+	return c.JSON(res)
+}
+
+func (s *Server) createUserRoute(c *fiber.Ctx) error {
+	var u models.User
+	if err := c.BodyParser(&u); err != nil {
+		return s.adminError(c, err)
+	}
+	if u.Name == "" {
+		return s.adminError(c, errMissingName)
+	}
+	if u.APIKey == "" {
+		return s.adminError(c, errMissingKey)
+	}
+	u.UserID, u.OrgID = 0, reqOrgID(c)
+	if err := s.admin.CreateUser(context.Background(), &u); err != nil {
+		return s.adminError(c, err)
+	}
+	// the API key is only disclosed on creation
+	return c.Status(fiber.StatusCreated).JSON(u)
+}
+
+func (s *Server) getUserRoute(c *fiber.Ctx) error {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(redactUser(u))
+}
+
+func (s *Server) deleteUserRoute(c *fiber.Ctx) error {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.DeleteUserByID(context.Background(), u.UserID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) listUserRolesRoute(c *fiber.Ctx) error {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	bs, err := s.admin.ListRoleBindingsByUserID(context.Background(), u.UserID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if bs == nil {
+		bs = []*datastore.RoleBinding{}
+	}
+	return c.JSON(bs)
+}
+
+// bindRoleRoute binds a role to a user, for the not_before and expires_at window in the body if there is one
+func (s *Server) bindRoleRoute(c *fiber.Ctx) error {
+	u, r, err := s.orgUserAndRole(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	var w datastore.Window
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&w); err != nil {
+			return s.adminError(c, err)
+		}
+	}
+	if err := w.Validate(time.Now()); err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.BindUserRole(context.Background(), u.UserID, r.RoleID, w); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) unbindRoleRoute(c *fiber.Ctx) error {
+	u, r, err := s.orgUserAndRole(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.UnbindUserRole(context.Background(), u.UserID, r.RoleID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) getPermissionsRoute(c *fiber.Ctx) error {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	du, err := iam.Derive(context.Background(), s.ds, u)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(du.Permissions)
+}
+
+func (s *Server) explainRoute(c *fiber.Ctx) error {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	var check authzCheck
+	if err := c.BodyParser(&check); err != nil {
+		return s.adminError(c, err)
+	}
+	r, err := check.resource()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	du, err := iam.Derive(context.Background(), s.ds, u)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	exp, err := s.explainAuthz(du, check.Action, r)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(exp)
+}
+
+// whoCanRoute lists the users of the requester's org that may perform the action on the resource in the body, and
+// the roles and policies allowing each
+func (s *Server) whoCanRoute(c *fiber.Ctx) error {
+	var check authzCheck
+	if err := c.BodyParser(&check); err != nil {
+		return s.adminError(c, err)
+	}
+	r, err := check.resource()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	us, err := s.ds.ListUsersByOrgID(context.Background(), reqOrgID(c))
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	ps, err := iam.WhoCan(context.Background(), s.authz, s.ds, *us, check.Action, r)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(ps)
+}
+
+// listActionsRoute lists the actions in the catalog by resource type
+func (s *Server) listActionsRoute(c *fiber.Ctx) error {
+	byType := map[string][]catalog.Action{}
+	for _, t := range catalog.Default.Types() {
+		byType[t] = catalog.Default.Actions(t)
+	}
+	return c.JSON(byType)
+}
+
+// lintOrgRoute lints the roles of the requester's org, and the roles bound to each of its users together
+func (s *Server) lintOrgRoute(c *fiber.Ctx) error {
+	fs, err := iam.LintOrg(context.Background(), s.ds, s.admin, reqOrgID(c))
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(fs)
+}
+
+func (s *Server) lintUserRoute(c *fiber.Ctx) error {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	fs, err := iam.LintUser(context.Background(), s.ds, u)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(fs)
+}
+
+func (s *Server) lintRoleRoute(c *fiber.Ctx) error {
+	r, err := s.orgRole(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	fs, err := iam.LintRole(context.Background(), s.ds, s.admin, r)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(fs)
+}
+
+func (s *Server) listRolesRoute(c *fiber.Ctx) error {
+	rs, err := s.admin.ListRolesByOrgID(context.Background(), reqOrgID(c))
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(nonNilRoles(rs))
+}
+
+func (s *Server) createRoleRoute(c *fiber.Ctx) error {
+	var r models.Role
+	if err := c.BodyParser(&r); err != nil {
+		return s.adminError(c, err)
+	}
+	if r.Name == "" {
+		return s.adminError(c, errMissingName)
+	}
+	r.RoleID, r.OrgID = 0, reqOrgID(c)
+	if err := s.admin.CreateRole(context.Background(), &r); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(r)
+}
+
+func (s *Server) getRoleRoute(c *fiber.Ctx) error {
+	r, err := s.orgRole(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(r)
+}
+
+func (s *Server) deleteRoleRoute(c *fiber.Ctx) error {
+	r, err := s.orgRole(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.DeleteRoleByID(context.Background(), r.RoleID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) listRolePoliciesRoute(c *fiber.Ctx) error {
+	r, err := s.orgRole(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	ps, err := s.admin.ListPoliciesByRoleID(context.Background(), r.RoleID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(nonNilPolicies(ps))
+}
+
+func (s *Server) attachPolicyRoute(c *fiber.Ctx) error {
+	r, p, err := s.orgRoleAndPolicy(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if p.Kind == datastore.PolicyKindInline && p.OwnerRoleID != r.RoleID {
+		return s.adminError(c, errInline)
+	}
+	if err := s.admin.AttachRolePolicy(context.Background(), r.RoleID, p.PolicyID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) detachPolicyRoute(c *fiber.Ctx) error {
+	r, p, err := s.orgRoleAndPolicy(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if p.Kind == datastore.PolicyKindInline {
+		return s.adminError(c, errInline)
+	}
+	if err := s.admin.DetachRolePolicy(context.Background(), r.RoleID, p.PolicyID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) listPoliciesRoute(c *fiber.Ctx) error {
+	ps, err := s.admin.ListPoliciesByOrgID(context.Background(), reqOrgID(c))
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(nonNilPolicies(ps))
+}
+
+// createPolicyRoute creates a policy owned by the requester's org, or an inline policy of the role owner_role_id if
+// kind is inline
+func (s *Server) createPolicyRoute(c *fiber.Ctx) error {
+	var p models.Policy
+	if err := c.BodyParser(&p); err != nil {
+		return s.adminError(c, err)
+	}
+	if err := validatePolicy(&p, reqOrgID(c)); err != nil {
+		return s.adminError(c, err)
+	}
+	switch p.Kind {
+	case "", datastore.PolicyKindOrg:
+		p.Kind, p.OwnerRoleID = datastore.PolicyKindOrg, 0
+	case datastore.PolicyKindInline:
+		r, err := s.admin.FindRoleByID(context.Background(), p.OwnerRoleID)
+		if err != nil || r.OrgID != reqOrgID(c) {
+			return s.adminError(c, errNotFound)
+		}
+	default:
+		return s.adminError(c, errBadKind)
+	}
+	p.PolicyID, p.OwnerOrgID = 0, reqOrgID(c)
+	if err := s.admin.CreatePolicy(context.Background(), &p); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(p)
+}
+
+func (s *Server) getPolicyRoute(c *fiber.Ctx) error {
+	p, err := s.policy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(p)
+}
+
+// getPolicyUsageRoute returns the number of roles, orgs and users using a policy, to check before changing it
+func (s *Server) getPolicyUsageRoute(c *fiber.Ctx) error {
+	p, err := s.policy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	u, err := s.admin.GetPolicyUsage(context.Background(), p.PolicyID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(u)
+}
+
+func (s *Server) deletePolicyRoute(c *fiber.Ctx) error {
+	p, err := s.ownedPolicy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.DeletePolicyByID(context.Background(), p.PolicyID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) listPolicyConditionsRoute(c *fiber.Ctx) error {
+	p, err := s.policy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	cs, err := s.admin.ListConditionsByPolicyID(context.Background(), p.PolicyID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(nonNilConditions(cs))
+}
+
+func (s *Server) attachConditionRoute(c *fiber.Ctx) error {
+	p, cond, err := s.policyAndCondition(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.AttachPolicyCondition(context.Background(), p.PolicyID, cond.ConditionID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) detachConditionRoute(c *fiber.Ctx) error {
+	p, cond, err := s.policyAndCondition(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.DetachPolicyCondition(context.Background(), p.PolicyID, cond.ConditionID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) listPolicyVersionsRoute(c *fiber.Ctx) error {
+	p, err := s.policy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	vs, err := s.admin.ListPolicyVersions(context.Background(), p.PolicyID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if vs == nil {
+		vs = []*datastore.PolicyVersion{}
+	}
+	return c.JSON(vs)
+}
+
+// policyVersionRequest is the body of a request to create a policy version
+type policyVersionRequest struct {
+	datastore.PolicyVersion
+	// SetAsDefault makes the new version the policy's default version
+	SetAsDefault bool `json:"set_as_default"`
+}
+
+func (s *Server) createPolicyVersionRoute(c *fiber.Ctx) error {
+	p, err := s.ownedPolicy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	var req policyVersionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return s.adminError(c, err)
+	}
+	v := &req.PolicyVersion
+	vp := &models.Policy{
+		Name: p.Name, Effect: v.Effect, Actions: v.Actions, ResourceName: v.ResourceName,
+		NotActions: v.NotActions, NotResourceNames: v.NotResourceNames,
+	}
+	if err := validatePolicy(vp, reqOrgID(c)); err != nil {
+		return s.adminError(c, err)
+	}
+	for _, cond := range v.Conditions {
+		if err := validateCondition(cond.Model()); err != nil {
+			return s.adminError(c, err)
+		}
+	}
+	v.PolicyID = p.PolicyID
+	if err := s.admin.CreatePolicyVersion(context.Background(), v, req.SetAsDefault); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(v)
+}
+
+func (s *Server) getPolicyVersionRoute(c *fiber.Ctx) error {
+	p, err := s.policy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return s.adminError(c, errBadVersion)
+	}
+	v, err := s.admin.FindPolicyVersion(context.Background(), p.PolicyID, version)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(v)
+}
+
+func (s *Server) setDefaultPolicyVersionRoute(c *fiber.Ctx) error {
+	p, err := s.ownedPolicy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return s.adminError(c, errBadVersion)
+	}
+	if err := s.admin.SetDefaultPolicyVersion(context.Background(), p.PolicyID, req.Version); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) rollbackPolicyRoute(c *fiber.Ctx) error {
+	p, err := s.ownedPolicy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	v, err := s.admin.RollbackPolicy(context.Background(), p.PolicyID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(v)
+}
+
+// diffPolicyVersionsRoute describes the changes between the versions in the from and to query params, which default
+// to the version before the default version and the default version
+func (s *Server) diffPolicyVersionsRoute(c *fiber.Ctx) error {
+	p, err := s.policy(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	var versions [2]int
+	for i, q := range []string{"from", "to"} {
+		if c.Query(q) == "" {
+			continue
+		}
+		if versions[i], err = strconv.Atoi(c.Query(q)); err != nil {
+			return s.adminError(c, errBadVersion)
+		}
+	}
+	vs, err := s.admin.ListPolicyVersions(context.Background(), p.PolicyID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	d, err := datastore.DiffPolicyVersions(vs, versions[0], versions[1])
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(d)
+}
+
+func (s *Server) listConditionsRoute(c *fiber.Ctx) error {
+	cs, err := s.admin.ListConditions(context.Background())
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(nonNilConditions(cs))
+}
+
+func (s *Server) createConditionRoute(c *fiber.Ctx) error {
+	var cond models.Condition
+	if err := c.BodyParser(&cond); err != nil {
+		return s.adminError(c, err)
+	}
+	if err := validateCondition(&cond); err != nil {
+		return s.adminError(c, err)
+	}
+	cond.ConditionID = 0
+	if err := s.admin.CreateCondition(context.Background(), &cond); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(cond)
+}
+
+func (s *Server) getConditionRoute(c *fiber.Ctx) error {
+	cond, err := s.condition(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(cond)
+}
+
+func (s *Server) deleteConditionRoute(c *fiber.Ctx) error {
+	cond, err := s.condition(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.DeleteConditionByID(context.Background(), cond.ConditionID, reqOrgID(c)); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// adminError responds to a failed admin request with a JSON error
+func (s *Server) adminError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errNotFound), errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": errNotFound.Error()})
+	case errors.Is(err, errBadID), errors.Is(err, errMissingName), errors.Is(err, errMissingKey),
+		errors.Is(err, errBadEffect), errors.Is(err, errMissingType), errors.Is(err, errBadNRN),
+		errors.Is(err, errBadVersion), errors.Is(err, datastore.ErrBadWindow), errors.Is(err, errBadAccessTarget),
+		errors.Is(err, errMissingJustification), errors.Is(err, errBadDuration), errors.Is(err, errBadAccessStatus),
+		errors.Is(err, errBadWindow), errors.Is(err, errBadSince), errors.Is(err, errBadUserID),
+		errors.Is(err, errBadDays), errors.Is(err, errBadAction), errors.Is(err, errBadNotNRN),
+		errors.Is(err, errBadVariable), errors.Is(err, catalog.ErrUnknownAction), errors.Is(err, errBadKind),
+		errors.Is(err, errMissingParent), errors.Is(err, errForeignNRN),
+		errors.Is(err, errForeignAccessTarget):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errSelfApproval), errors.Is(err, errNotRequester), errors.Is(err, errManaged),
+		errors.Is(err, errMoveOwnOrg):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, datastore.ErrNoPreviousVersion), errors.Is(err, datastore.ErrBadTransition),
+		errors.Is(err, errInline), errors.Is(err, roles.ErrOrgCycle), errors.Is(err, datastore.ErrConditionInUse):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(fiber.Map{"error": fe.Message})
+	}
+	s.logger.Errorw("error handling admin request", "path", c.Path(), "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// validateCondition returns an error if cond is missing a type or its value has a bad variable
+func validateCondition(cond *models.Condition) error {
+	if cond.Type == "" {
+		return errMissingType
+	}
+	if err := roles.ValidateVariables(cond.Value); err != nil {
+		return errBadVariable
+	}
+	return nil
+}
+
+// validatePolicy returns an error if p can't be stored by the org orgID
+func validatePolicy(p *models.Policy, orgID int) error {
+	if p.Name == "" {
+		return errMissingName
+	}
+	if p.Effect != iam.EffectAllow && p.Effect != iam.EffectDeny {
+		return errBadEffect
+	}
+	if _, _, err := roles.SplitResourceName(p.ResourceName); err != nil {
+		return errBadNRN
+	}
+	for _, nrn := range p.NotResourceNames {
+		if _, _, err := roles.SplitResourceName(nrn); err != nil {
+			return errBadNotNRN
+		}
+	}
+	for _, s := range append([]string{p.ResourceName}, p.NotResourceNames...) {
+		if err := roles.ValidateVariables(s); err != nil {
+			return errBadVariable
+		}
+		if org, _, _ := roles.SplitResourceName(s); org != strconv.Itoa(orgID) && org != "${principal.org_id}" {
+			return errForeignNRN
+		}
+	}
+	rType, _ := roles.PolicyResourceName(p.ResourceName).GetType()
+	for _, a := range append(append([]string{}, p.Actions...), p.NotActions...) {
+		if err := roles.ValidateAction(a); err != nil {
+			return errBadAction
+		}
+		if err := catalog.Default.Validate(rType, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paramID returns the integer ID in the route param name
+func paramID(c *fiber.Ctx, name string) (int, error) {
+	id, err := strconv.Atoi(c.Params(name))
+	if err != nil {
+		return 0, errBadID
+	}
+	return id, nil
+}
+
+// reqOrgID returns the ID of the requester's org.  Only valid after authorization.
+func reqOrgID(c *fiber.Ctx) int {
+	reqUser, _ := iamfiber.User(c)
+	return reqUser.User.OrgID
+}
+
+func (s *Server) reqOrg(c *fiber.Ctx) (*models.Org, error) {
+	return s.admin.FindOrgByID(context.Background(), reqOrgID(c))
+}
+
+// orgUser finds the user with the ID in route param name, which must belong to the requester's org
+func (s *Server) orgUser(c *fiber.Ctx, name string) (*models.User, error) {
+	id, err := paramID(c, name)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.admin.FindUserByID(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if u.OrgID != reqOrgID(c) {
+		return nil, errNotFound
+	}
+	return u, nil
+}
+
+// orgRole finds the role with the ID in route param name, which must belong to the requester's org
+func (s *Server) orgRole(c *fiber.Ctx, name string) (*models.Role, error) {
+	id, err := paramID(c, name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.admin.FindRoleByID(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if r.OrgID != reqOrgID(c) {
+		return nil, errNotFound
+	}
+	return r, nil
+}
+
+// policy finds the policy with the ID in route param name, which must be a managed policy or belong to the
+// requester's org
+func (s *Server) policy(c *fiber.Ctx, name string) (*models.Policy, error) {
+	id, err := paramID(c, name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.admin.FindPolicyByID(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Kind != datastore.PolicyKindManaged && p.OwnerOrgID != reqOrgID(c) {
+		return nil, errNotFound
+	}
+	return p, nil
+}
+
+// ownedPolicy finds the policy with the ID in route param name like policy, but it must belong to the requester's
+// org, as managed policies are read-only
+func (s *Server) ownedPolicy(c *fiber.Ctx, name string) (*models.Policy, error) {
+	p, err := s.policy(c, name)
+	if err != nil {
+		return nil, err
+	}
+	if p.Kind == datastore.PolicyKindManaged {
+		return nil, errManaged
+	}
+	return p, nil
+}
+
+func (s *Server) condition(c *fiber.Ctx, name string) (*models.Condition, error) {
+	id, err := paramID(c, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.admin.FindConditionByID(context.Background(), id)
+}
+
+func (s *Server) orgUserAndRole(c *fiber.Ctx) (*models.User, *models.Role, error) {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.orgRole(c, "roleId")
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, r, nil
+}
+
+func (s *Server) orgRoleAndPolicy(c *fiber.Ctx) (*models.Role, *models.Policy, error) {
+	r, err := s.orgRole(c, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := s.policy(c, "policyId")
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, p, nil
+}
+
+func (s *Server) policyAndCondition(c *fiber.Ctx) (*models.Policy, *models.Condition, error) {
+	p, err := s.ownedPolicy(c, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+	cond, err := s.condition(c, "conditionId")
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, cond, nil
+}
+
+// redactUser returns a copy of u without its API key
+func redactUser(u *models.User) *models.User {
+	return &models.User{UserID: u.UserID, Name: u.Name, OrgID: u.OrgID}
+}
+
+func nonNilRoles(rs models.RoleSlice) models.RoleSlice {
+	if rs == nil {
+		return models.RoleSlice{}
+	}
+	return rs
+}
+
+func nonNilPolicies(ps models.PolicySlice) models.PolicySlice {
+	if ps == nil {
+		return models.PolicySlice{}
+	}
+	return ps
+}
+
+func nonNilConditions(cs models.ConditionSlice) models.ConditionSlice {
+	if cs == nil {
+		return models.ConditionSlice{}
+	}
+	return cs
+}
@@ -0,0 +1,1485 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memAdmin is an in memory datastore.Admin for testing
+type memAdmin struct {
+	orgs       map[int]*models.Org
+	users      map[int]*models.User
+	roles      map[int]*models.Role
+	policies   map[int]*models.Policy
+	conditions map[int]*models.Condition
+	// bindings between users and roles, roles and policies and policies and conditions
+	userRoles        map[[2]int]datastore.Window
+	rolePolicies     map[[2]int]bool
+	policyConditions map[[2]int]bool
+	// bindings between orgs and roles
+	orgRoles map[[2]int]bool
+	// versions of each policy, oldest first
+	versions map[int][]*datastore.PolicyVersion
+	events   []*datastore.AuditEvent
+	requests map[int]*datastore.AccessRequest
+	nextID   int
+	// decisions are recorded by concurrent requests, and numbered apart from other objects
+	mu        sync.Mutex
+	decisions []*datastore.Decision
+	// lastUsed is when each API key, policy and role was last used, by kind and ID
+	lastUsed map[string]map[int]time.Time
+}
+
+// newMemAdmin returns a memAdmin holding the users of mockDatastore, a role in each org, a policy of each org, a
+// managed policy and a condition
+func newMemAdmin() *memAdmin {
+	a := &memAdmin{
+		orgs: map[int]*models.Org{
+			0: {OrgID: 0, Name: "Aperture Science"},
+			1: {OrgID: 1, Name: "Black Mesa"},
+		},
+		users: map[int]*models.User{},
+		roles: map[int]*models.Role{
+			1: {RoleID: 1, Name: "viewZonesRole", OrgID: 0},
+			2: {RoleID: 2, Name: "blackMesaRole", OrgID: 1},
+		},
+		policies: map[int]*models.Policy{
+			1: {PolicyID: 1, Name: "viewZones", Effect: "allow", Actions: types.StringArray{"view"}, ResourceName: "oso:0:zone/*",
+				Kind: datastore.PolicyKindOrg},
+			2: {PolicyID: 2, Name: "ZoneReadOnly", Effect: "allow", Actions: types.StringArray{"view"},
+				ResourceName: "oso:${principal.org_id}:zone/*", Kind: datastore.PolicyKindManaged},
+			3: {PolicyID: 3, Name: "viewBlackMesaZones", Effect: "allow", Actions: types.StringArray{"view"},
+				ResourceName: "oso:1:zone/*", Kind: datastore.PolicyKindOrg, OwnerOrgID: 1},
+		},
+		conditions: map[int]*models.Condition{
+			1: {ConditionID: 1, Type: "matchSuffix", Value: "com"},
+		},
+		userRoles:        map[[2]int]datastore.Window{{1, 1}: {}},
+		rolePolicies:     map[[2]int]bool{{1, 1}: true, {2, 2}: true, {2, 3}: true},
+		policyConditions: map[[2]int]bool{{3, 1}: true},
+		orgRoles:         map[[2]int]bool{},
+		versions:         map[int][]*datastore.PolicyVersion{},
+		requests:         map[int]*datastore.AccessRequest{},
+		lastUsed:         map[string]map[int]time.Time{},
+		nextID:           100,
+	}
+	for id := 1; id <= 3; id++ {
+		setPolicyDefaults(a.policies[id])
+		a.recordVersion(id)
+	}
+	for id := 1; id <= 8; id++ {
+		u, _ := (&mockDatastore{}).FindUserByID(context.Background(), id)
+		a.users[id] = u
+	}
+	return a
+}
+
+// setPolicyDefaults sets the columns of p the policy table has defaults for, as inserting it does
+func setPolicyDefaults(p *models.Policy) {
+	p.DefaultVersion = 1
+	if p.NotActions == nil {
+		p.NotActions = types.StringArray{}
+	}
+	if p.NotResourceNames == nil {
+		p.NotResourceNames = types.StringArray{}
+	}
+}
+
+func (a *memAdmin) id() int {
+	a.nextID++
+	return a.nextID
+}
+
+func (a *memAdmin) ListOrgs(_ context.Context) (models.OrgSlice, error) {
+	var os models.OrgSlice
+	for _, id := range sortedKeys(a.orgs) {
+		os = append(os, a.orgs[id])
+	}
+	return os, nil
+}
+
+func (a *memAdmin) FindOrgByID(_ context.Context, id int) (*models.Org, error) {
+	return find(a.orgs, id)
+}
+
+func (a *memAdmin) CreateOrg(_ context.Context, o *models.Org) error {
+	o.OrgID = a.id()
+	a.orgs[o.OrgID] = o
+	return nil
+}
+
+func (a *memAdmin) DeleteOrgByID(_ context.Context, id int) error {
+	unbindAll(a.orgRoles, id, 0)
+	return remove(a.orgs, id)
+}
+
+func (a *memAdmin) MoveOrg(ctx context.Context, orgID int, parentID null.Int) error {
+	o, err := find(a.orgs, orgID)
+	if err != nil {
+		return err
+	}
+	if parentID.Valid {
+		if _, err := find(a.orgs, parentID.Int); err != nil {
+			return err
+		}
+		os, _ := a.ListOrgs(ctx)
+		if err := datastore.NewOrgTree(os).CheckMove(orgID, parentID.Int); err != nil {
+			return err
+		}
+	}
+	o.ParentID = parentID
+	return nil
+}
+
+func (a *memAdmin) ListOrgRoles(_ context.Context, orgID int) (models.RoleSlice, error) {
+	var rs models.RoleSlice
+	for _, id := range sortedKeys(a.roles) {
+		if a.orgRoles[[2]int{orgID, id}] {
+			rs = append(rs, a.roles[id])
+		}
+	}
+	return rs, nil
+}
+
+func (a *memAdmin) BindOrgRole(_ context.Context, orgID, roleID int) error {
+	a.orgRoles[[2]int{orgID, roleID}] = true
+	return nil
+}
+
+func (a *memAdmin) UnbindOrgRole(_ context.Context, orgID, roleID int) error {
+	delete(a.orgRoles, [2]int{orgID, roleID})
+	return nil
+}
+
+func (a *memAdmin) ListUsersByOrgID(_ context.Context, orgID int) (*models.UserSlice, error) {
+	var us models.UserSlice
+	for _, id := range sortedKeys(a.users) {
+		if a.users[id].OrgID == orgID {
+			us = append(us, a.users[id])
+		}
+	}
+	return &us, nil
+}
+
+func (a *memAdmin) FindUserByID(_ context.Context, id int) (*models.User, error) {
+	return find(a.users, id)
+}
+
+func (a *memAdmin) CreateUser(_ context.Context, u *models.User) error {
+	u.UserID = a.id()
+	a.users[u.UserID] = u
+	return nil
+}
+
+func (a *memAdmin) DeleteUserByID(_ context.Context, id int) error {
+	unbindAll(a.userRoles, id, 0)
+	return remove(a.users, id)
+}
+
+func (a *memAdmin) ListRolesByOrgID(_ context.Context, orgID int) (models.RoleSlice, error) {
+	var rs models.RoleSlice
+	for _, id := range sortedKeys(a.roles) {
+		if a.roles[id].OrgID == orgID {
+			rs = append(rs, a.roles[id])
+		}
+	}
+	return rs, nil
+}
+
+func (a *memAdmin) ListRoleBindingsByUserID(_ context.Context, userID int) ([]*datastore.RoleBinding, error) {
+	var bs []*datastore.RoleBinding
+	for _, id := range sortedKeys(a.roles) {
+		if w, ok := a.userRoles[[2]int{userID, id}]; ok {
+			bs = append(bs, &datastore.RoleBinding{Role: *a.roles[id], UserID: userID, Window: w})
+		}
+	}
+	return bs, nil
+}
+
+func (a *memAdmin) FindRoleByID(_ context.Context, id int) (*models.Role, error) {
+	return find(a.roles, id)
+}
+
+func (a *memAdmin) CreateRole(_ context.Context, r *models.Role) error {
+	r.RoleID = a.id()
+	a.roles[r.RoleID] = r
+	return nil
+}
+
+func (a *memAdmin) DeleteRoleByID(ctx context.Context, id int) error {
+	for _, pid := range sortedKeys(a.policies) {
+		if p := a.policies[pid]; p.Kind == datastore.PolicyKindInline && p.OwnerRoleID == id {
+			_ = a.DeletePolicyByID(ctx, pid)
+		}
+	}
+	unbindAll(a.userRoles, id, 1)
+	unbindAll(a.rolePolicies, id, 0)
+	unbindAll(a.orgRoles, id, 1)
+	return remove(a.roles, id)
+}
+
+func (a *memAdmin) ListPoliciesByOrgID(_ context.Context, orgID int) (models.PolicySlice, error) {
+	var ps models.PolicySlice
+	for _, id := range sortedKeys(a.policies) {
+		if p := a.policies[id]; p.Kind == datastore.PolicyKindManaged || p.OwnerOrgID == orgID {
+			ps = append(ps, p)
+		}
+	}
+	return ps, nil
+}
+
+func (a *memAdmin) ListPoliciesByRoleID(_ context.Context, roleID int) (models.PolicySlice, error) {
+	var ps models.PolicySlice
+	for _, id := range sortedKeys(a.policies) {
+		if a.rolePolicies[[2]int{roleID, id}] {
+			ps = append(ps, a.policies[id])
+		}
+	}
+	return ps, nil
+}
+
+func (a *memAdmin) FindPolicyByID(_ context.Context, id int) (*models.Policy, error) {
+	return find(a.policies, id)
+}
+
+func (a *memAdmin) CreatePolicy(_ context.Context, p *models.Policy) error {
+	p.PolicyID = a.id()
+	setPolicyDefaults(p)
+	a.policies[p.PolicyID] = p
+	if p.Kind == datastore.PolicyKindInline {
+		a.rolePolicies[[2]int{p.OwnerRoleID, p.PolicyID}] = true
+	}
+	a.recordVersion(p.PolicyID)
+	return nil
+}
+
+func (a *memAdmin) DeletePolicyByID(_ context.Context, id int) error {
+	unbindAll(a.rolePolicies, id, 1)
+	unbindAll(a.policyConditions, id, 0)
+	delete(a.versions, id)
+	return remove(a.policies, id)
+}
+
+func (a *memAdmin) GetPolicyUsage(_ context.Context, policyID int) (*datastore.PolicyUsage, error) {
+	if _, err := find(a.policies, policyID); err != nil {
+		return nil, err
+	}
+	u := &datastore.PolicyUsage{PolicyID: policyID}
+	orgs, users := map[int]bool{}, map[int]bool{}
+	for _, rid := range sortedKeys(a.roles) {
+		if !a.rolePolicies[[2]int{rid, policyID}] {
+			continue
+		}
+		u.Roles++
+		orgs[a.roles[rid].OrgID] = true
+		for b := range a.userRoles {
+			if b[1] == rid {
+				users[b[0]] = true
+			}
+		}
+	}
+	u.Orgs, u.Users = len(orgs), len(users)
+	return u, nil
+}
+
+func (a *memAdmin) ListConditions(_ context.Context) (models.ConditionSlice, error) {
+	var cs models.ConditionSlice
+	for _, id := range sortedKeys(a.conditions) {
+		cs = append(cs, a.conditions[id])
+	}
+	return cs, nil
+}
+
+func (a *memAdmin) ListConditionsByPolicyID(_ context.Context, policyID int) (models.ConditionSlice, error) {
+	var cs models.ConditionSlice
+	for _, id := range sortedKeys(a.conditions) {
+		if a.policyConditions[[2]int{policyID, id}] {
+			cs = append(cs, a.conditions[id])
+		}
+	}
+	return cs, nil
+}
+
+func (a *memAdmin) FindConditionByID(_ context.Context, id int) (*models.Condition, error) {
+	return find(a.conditions, id)
+}
+
+func (a *memAdmin) CreateCondition(_ context.Context, c *models.Condition) error {
+	c.ConditionID = a.id()
+	a.conditions[c.ConditionID] = c
+	return nil
+}
+
+func (a *memAdmin) DeleteConditionByID(_ context.Context, id, orgID int) error {
+	for b := range a.policyConditions {
+		if p := a.policies[b[0]]; b[1] == id && (p.Kind == datastore.PolicyKindManaged || p.OwnerOrgID != orgID) {
+			return datastore.ErrConditionInUse
+		}
+	}
+	for b := range a.policyConditions {
+		if b[1] == id {
+			delete(a.policyConditions, b)
+			a.recordVersion(b[0])
+		}
+	}
+	return remove(a.conditions, id)
+}
+
+func (a *memAdmin) BindUserRole(_ context.Context, userID, roleID int, w datastore.Window) error {
+	a.userRoles[[2]int{userID, roleID}] = w
+	return nil
+}
+
+func (a *memAdmin) UnbindUserRole(_ context.Context, userID, roleID int) error {
+	delete(a.userRoles, [2]int{userID, roleID})
+	return nil
+}
+
+func (a *memAdmin) AttachRolePolicy(_ context.Context, roleID, policyID int) error {
+	a.rolePolicies[[2]int{roleID, policyID}] = true
+	return nil
+}
+
+func (a *memAdmin) DetachRolePolicy(_ context.Context, roleID, policyID int) error {
+	delete(a.rolePolicies, [2]int{roleID, policyID})
+	return nil
+}
+
+func (a *memAdmin) AttachPolicyCondition(_ context.Context, policyID, conditionID int) error {
+	a.policyConditions[[2]int{policyID, conditionID}] = true
+	a.recordVersion(policyID)
+	return nil
+}
+
+func (a *memAdmin) DetachPolicyCondition(_ context.Context, policyID, conditionID int) error {
+	delete(a.policyConditions, [2]int{policyID, conditionID})
+	a.recordVersion(policyID)
+	return nil
+}
+
+func (a *memAdmin) ListPolicyVersions(_ context.Context, policyID int) ([]*datastore.PolicyVersion, error) {
+	if _, err := find(a.policies, policyID); err != nil {
+		return nil, err
+	}
+	return a.versions[policyID], nil
+}
+
+func (a *memAdmin) FindPolicyVersion(_ context.Context, policyID, version int) (*datastore.PolicyVersion, error) {
+	for _, v := range a.versions[policyID] {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (a *memAdmin) CreatePolicyVersion(ctx context.Context, v *datastore.PolicyVersion, setDefault bool) error {
+	v.Version = len(a.versions[v.PolicyID]) + 1
+	a.versions[v.PolicyID] = append(a.versions[v.PolicyID], v)
+	if !setDefault {
+		return nil
+	}
+	return a.SetDefaultPolicyVersion(ctx, v.PolicyID, v.Version)
+}
+
+// SetDefaultPolicyVersion copies the version's content into the policy, binding conditions with the same type and
+// value as the version's
+func (a *memAdmin) SetDefaultPolicyVersion(ctx context.Context, policyID, version int) error {
+	v, err := a.FindPolicyVersion(ctx, policyID, version)
+	if err != nil {
+		return err
+	}
+	p := a.policies[policyID]
+	p.Effect, p.Actions, p.ResourceName, p.DefaultVersion = v.Effect, v.Actions, v.ResourceName, version
+	unbindAll(a.policyConditions, policyID, 0)
+	for _, vc := range v.Conditions {
+		for id, c := range a.conditions {
+			if c.Type == vc.Type && c.Value == vc.Value {
+				a.policyConditions[[2]int{policyID, id}] = true
+			}
+		}
+	}
+	for _, pv := range a.versions[policyID] {
+		pv.IsDefault = pv.Version == version
+	}
+	return nil
+}
+
+func (a *memAdmin) RollbackPolicy(ctx context.Context, policyID int) (*datastore.PolicyVersion, error) {
+	prev, err := datastore.PreviousPolicyVersion(a.versions[policyID])
+	if err != nil {
+		return nil, err
+	}
+	return prev, a.SetDefaultPolicyVersion(ctx, policyID, prev.Version)
+}
+
+func (a *memAdmin) SweepExpiredBindings(_ context.Context, now time.Time) ([]*datastore.AuditEvent, error) {
+	var events []*datastore.AuditEvent
+	for b, w := range a.userRoles {
+		if w.ExpiresAt == nil || w.ExpiresAt.After(now) {
+			continue
+		}
+		delete(a.userRoles, b)
+		events = append(events, &datastore.AuditEvent{
+			EventID: a.id(), OccurredAt: now, Type: datastore.EventRoleBindingExpired,
+			OrgID: a.users[b[0]].OrgID, UserID: b[0], RoleID: b[1],
+		})
+	}
+	a.events = append(a.events, events...)
+	return events, nil
+}
+
+func (a *memAdmin) ListAuditEvents(_ context.Context, orgID int) ([]*datastore.AuditEvent, error) {
+	var es []*datastore.AuditEvent
+	for i := len(a.events) - 1; i >= 0; i-- {
+		if a.events[i].OrgID == orgID {
+			es = append(es, a.events[i])
+		}
+	}
+	return es, nil
+}
+
+func (a *memAdmin) RecordDecisions(_ context.Context, ds []*datastore.Decision) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, d := range ds {
+		d.DecisionID = len(a.decisions) + 1
+		a.decisions = append(a.decisions, d)
+	}
+	return nil
+}
+
+func (a *memAdmin) PruneDecisions(_ context.Context, before time.Time) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var kept []*datastore.Decision
+	for _, d := range a.decisions {
+		if !d.OccurredAt.Before(before) {
+			kept = append(kept, d)
+		}
+	}
+	n := int64(len(a.decisions) - len(kept))
+	a.decisions = kept
+	return n, nil
+}
+
+func (a *memAdmin) ListDecisions(_ context.Context, f datastore.DecisionFilter) ([]*datastore.Decision, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var ds []*datastore.Decision
+	for i := len(a.decisions) - 1; i >= 0; i-- {
+		if f.Matches(a.decisions[i]) {
+			ds = append(ds, a.decisions[i])
+		}
+	}
+	return ds, nil
+}
+
+func (a *memAdmin) RecordUsage(_ context.Context, us []*datastore.Usage) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, u := range us {
+		a.touch(datastore.UsageKindAPIKey, u.UserID, u.UsedAt)
+		for _, id := range u.PolicyIDs {
+			a.touch(datastore.UsageKindPolicy, id, u.UsedAt)
+		}
+		for ur := range a.userRoles {
+			for _, id := range u.PolicyIDs {
+				if ur[0] == u.UserID && a.rolePolicies[[2]int{ur[1], id}] {
+					a.touch(datastore.UsageKindRole, ur[1], u.UsedAt)
+				}
+			}
+		}
+		os, _ := a.ListOrgs(context.Background())
+		orgs := map[int]bool{u.OrgID: true}
+		for _, id := range datastore.NewOrgTree(os).Ancestors(u.OrgID) {
+			orgs[id] = true
+		}
+		for or := range a.orgRoles {
+			for _, id := range u.PolicyIDs {
+				if orgs[or[0]] && a.rolePolicies[[2]int{or[1], id}] {
+					a.touch(datastore.UsageKindRole, or[1], u.UsedAt)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// touch records a use of the kind of thing identified by id at t, unless a later use is recorded.  a.mu must be held.
+func (a *memAdmin) touch(kind string, id int, t time.Time) {
+	if a.lastUsed[kind] == nil {
+		a.lastUsed[kind] = map[int]time.Time{}
+	}
+	if t.After(a.lastUsed[kind][id]) {
+		a.lastUsed[kind][id] = t
+	}
+}
+
+func (a *memAdmin) ListUnused(_ context.Context, orgID int, since time.Time) ([]*datastore.Unused, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var unused []*datastore.Unused
+	add := func(kind string, id int, name string) {
+		u := &datastore.Unused{Kind: kind, ID: id, Name: name}
+		if t, ok := a.lastUsed[kind][id]; ok {
+			if !t.Before(since) {
+				return
+			}
+			u.LastUsedAt = &t
+		}
+		unused = append(unused, u)
+	}
+	for _, id := range sortedKeys(a.users) {
+		if a.users[id].OrgID == orgID {
+			add(datastore.UsageKindAPIKey, id, a.users[id].Name)
+		}
+	}
+	for _, id := range sortedKeys(a.policies) {
+		for rp := range a.rolePolicies {
+			if rp[1] == id && a.roles[rp[0]] != nil && a.roles[rp[0]].OrgID == orgID {
+				add(datastore.UsageKindPolicy, id, a.policies[id].Name)
+				break
+			}
+		}
+	}
+	for _, id := range sortedKeys(a.roles) {
+		if a.roles[id].OrgID == orgID {
+			add(datastore.UsageKindRole, id, a.roles[id].Name)
+		}
+	}
+	return unused, nil
+}
+
+func (a *memAdmin) CreateAccessRequest(_ context.Context, r *datastore.AccessRequest) error {
+	r.RequestID, r.Status = a.id(), datastore.AccessPending
+	a.requests[r.RequestID] = r
+	return nil
+}
+
+func (a *memAdmin) FindAccessRequest(_ context.Context, id int) (*datastore.AccessRequest, error) {
+	return find(a.requests, id)
+}
+
+func (a *memAdmin) ListAccessRequests(_ context.Context, orgID int, status string) ([]*datastore.AccessRequest, error) {
+	var rs []*datastore.AccessRequest
+	ids := sortedKeys(a.requests)
+	for i := len(ids) - 1; i >= 0; i-- {
+		r := a.requests[ids[i]]
+		if r.OrgID == orgID && (status == "" || r.Status == status) {
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
+
+func (a *memAdmin) DecideAccessRequest(ctx context.Context, id int, d datastore.AccessDecision, now time.Time) (*datastore.AccessRequest, error) {
+	r, err := find(a.requests, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Decide(d, now); err != nil {
+		return nil, err
+	}
+	if r.Status == datastore.AccessApproved {
+		r.GrantRoleID = r.RoleID
+		if r.RoleID == 0 {
+			name := fmt.Sprintf("access-request-%d", r.RequestID)
+			p := &models.Policy{
+				Name: name, Effect: "allow", Actions: types.StringArray{r.Action}, ResourceName: r.ResourceName,
+				Kind: datastore.PolicyKindInline, OwnerOrgID: r.OrgID,
+			}
+			_ = a.CreatePolicy(ctx, p)
+			role := &models.Role{Name: name, OrgID: r.OrgID}
+			_ = a.CreateRole(ctx, role)
+			p.OwnerRoleID = role.RoleID
+			_ = a.AttachRolePolicy(ctx, role.RoleID, p.PolicyID)
+			r.GrantRoleID = role.RoleID
+		}
+		// permanent bindings stay permanent
+		if w, ok := a.userRoles[[2]int{r.UserID, r.GrantRoleID}]; !ok || w.ExpiresAt != nil {
+			a.userRoles[[2]int{r.UserID, r.GrantRoleID}] = datastore.Window{ExpiresAt: r.ExpiresAt}
+		}
+	}
+	a.events = append(a.events, a.accessEvent(r, now))
+	return r, nil
+}
+
+func (a *memAdmin) ExpireAccessRequests(ctx context.Context, now time.Time) ([]*datastore.AuditEvent, error) {
+	var events []*datastore.AuditEvent
+	for _, id := range sortedKeys(a.requests) {
+		r := a.requests[id]
+		if r.Status != datastore.AccessApproved || r.ExpiresAt.After(now) {
+			continue
+		}
+		_ = r.Decide(datastore.AccessDecision{Status: datastore.AccessExpired}, now)
+		if r.RoleID == 0 {
+			// the grant's inline policy is deleted with its role
+			_ = a.DeleteRoleByID(ctx, r.GrantRoleID)
+		}
+		events = append(events, a.accessEvent(r, now))
+	}
+	a.events = append(a.events, events...)
+	return events, nil
+}
+
+// accessEvent records the audit event of r moving to its current status
+func (a *memAdmin) accessEvent(r *datastore.AccessRequest, now time.Time) *datastore.AuditEvent {
+	e := r.Event(now)
+	e.EventID = a.id()
+	return e
+}
+
+// recordVersion records the current content of a policy as a new default version
+func (a *memAdmin) recordVersion(policyID int) {
+	p := a.policies[policyID]
+	cs, _ := a.ListConditionsByPolicyID(context.Background(), policyID)
+	v := &datastore.PolicyVersion{
+		PolicyID:     policyID,
+		Version:      len(a.versions[policyID]) + 1,
+		Effect:       p.Effect,
+		Actions:      p.Actions,
+		ResourceName: p.ResourceName,
+		Conditions:   datastore.VersionConditions(policyfile.PolicyFromModel(p, cs).Conditions),
+		IsDefault:    true,
+	}
+	for _, pv := range a.versions[policyID] {
+		pv.IsDefault = false
+	}
+	a.versions[policyID] = append(a.versions[policyID], v)
+}
+
+func find[T any](m map[int]*T, id int) (*T, error) {
+	v, ok := m[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return v, nil
+}
+
+func remove[T any](m map[int]*T, id int) error {
+	if _, ok := m[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m, id)
+	return nil
+}
+
+func sortedKeys[T any](m map[int]*T) []int {
+	var ids []int
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// unbindAll removes every binding with id at position pos
+func unbindAll[V any](bindings map[[2]int]V, id, pos int) {
+	for b := range bindings {
+		if b[pos] == id {
+			delete(bindings, b)
+		}
+	}
+}
+
+func Test_sweepExpiredBindings(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	admin := newMemAdmin()
+	admin.userRoles[[2]int{2, 1}] = datastore.Window{ExpiresAt: &before}
+	admin.userRoles[[2]int{3, 1}] = datastore.Window{ExpiresAt: &after}
+	s := NewServer(newTestAuthorizer(t), &mockDatastore{}, admin, newNopLog(), defaultConfig())
+	s.sweepExpiredBindings(context.Background(), now)
+
+	assert.Equal(t, map[[2]int]datastore.Window{{1, 1}: {}, {3, 1}: {ExpiresAt: &after}}, admin.userRoles)
+
+	req, _ := http.NewRequest("GET", "/iam/audit-events", nil)
+	req.Header.Set("x-api-key", "ada")
+	res, err := s.setup().Test(req, -1)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"event_id":101,"occurred_at":"2021-11-01T12:00:00Z","type":"RoleBindingExpired","org_id":0,"user_id":2,"role_id":1}]`, string(body))
+}
+
+func Test_adminRoutes(t *testing.T) {
+	t.Parallel()
+
+	// steps run in order against the same admin datastore
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		apiKey  string
+		body    string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "missing api key",
+			method:  "GET",
+			route:   "/iam/users",
+			expCode: 401,
+			expBody: `{"error":"x-api-key value not found in request"}`,
+		},
+		{
+			name:    "not allowed to manage iam",
+			method:  "GET",
+			route:   "/iam/users",
+			apiKey:  "john",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "get own org",
+			method:  "GET",
+			route:   "/iam/orgs",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"org_id":0,"name":"Aperture Science","parent_id":null}]`,
+		},
+		{
+			name:    "other org hidden",
+			method:  "GET",
+			route:   "/iam/orgs/1",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "list users without api keys",
+			method:  "GET",
+			route:   "/iam/users",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"user_id":1,"name":"john","api_key":"","org_id":0},{"user_id":2,"name":"bob","api_key":"","org_id":0},` +
+				`{"user_id":3,"name":"tom","api_key":"","org_id":0},{"user_id":4,"name":"jim","api_key":"","org_id":0},` +
+				`{"user_id":6,"name":"ada","api_key":"","org_id":0},{"user_id":7,"name":"chell","api_key":"","org_id":0},` +
+				`{"user_id":8,"name":"glados","api_key":"","org_id":0}]`,
+		},
+		{
+			name:    "user in other org hidden",
+			method:  "GET",
+			route:   "/iam/users/5",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "bad id",
+			method:  "GET",
+			route:   "/iam/users/john",
+			apiKey:  "ada",
+			expCode: 400,
+			expBody: `{"error":"id must be an integer"}`,
+		},
+		{
+			name:    "create role",
+			method:  "POST",
+			route:   "/iam/roles",
+			apiKey:  "ada",
+			body:    `{"name": "deleteZonesRole", "org_id": 1}`,
+			expCode: 201,
+			expBody: `{"role_id":101,"name":"deleteZonesRole","org_id":0}`,
+		},
+		{
+			name:    "create policy with bad effect",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "deleteZones", "effect": "permit", "actions": ["delete"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"effect must be \"allow\" or \"deny\""}`,
+		},
+		{
+			name:    "create policy with bad action",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "deleteZones", "effect": "allow", "actions": ["*:DeleteZone"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"each action must be an action or glob pattern, optionally qualified by a service, e.g. zone:Get*"}`,
+		},
+		{
+			name:    "create policy with unknown action",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "viewZones", "effect": "allow", "actions": ["veiw"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"unknown action: \"veiw\" matches no zone action"}`,
+		},
+		{
+			name:    "create policy with unknown not action",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "allButDelete", "effect": "allow", "not_actions": ["delte"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"unknown action: \"delte\" matches no zone action"}`,
+		},
+		{
+			name:    "create policy with bad not resource name",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "denyAllButGmail", "effect": "deny", "actions": ["*"], "resource_name": "oso:0:zone/*", "not_resource_names": ["gmail.com"]}`,
+			expCode: 400,
+			expBody: `{"error":"each not_resource_name must be an NRN of the form oso:\u003corg\u003e:\u003ctype\u003e/\u003cid\u003e"}`,
+		},
+		{
+			name:    "create policy with unknown variable",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "viewOwnZones", "effect": "allow", "actions": ["view"], "resource_name": "oso:0:zone/${principal.email}"}`,
+			expCode: 400,
+			expBody: `{"error":"policy variables must be one of ${principal.user_id}, ${principal.org_id}, ${principal.name} or ${principal.tag/\u003ckey\u003e}"}`,
+		},
+		{
+			name:    "create policy in another org",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "viewBlackMesaZones", "effect": "allow", "actions": ["view"], "resource_name": "oso:1:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"resource_name and not_resource_names must be in the requester's org or ${principal.org_id}"}`,
+		},
+		{
+			name:    "create policy with not resource name in another org",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "denyAllButLambda", "effect": "deny", "actions": ["*"], "resource_name": "oso:0:zone/*", "not_resource_names": ["oso:1:zone/lambda.com"]}`,
+			expCode: 400,
+			expBody: `{"error":"resource_name and not_resource_names must be in the requester's org or ${principal.org_id}"}`,
+		},
+		{
+			name:    "create policy",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "deleteZones", "effect": "allow", "actions": ["delete"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 201,
+			expBody: `{"policy_id":102,"name":"deleteZones","effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"org","owner_org_id":0,"owner_role_id":0}`,
+		},
+		{
+			name:    "create condition",
+			method:  "POST",
+			route:   "/iam/conditions",
+			apiKey:  "ada",
+			body:    `{"type": "matchSuffix", "value": "net"}`,
+			expCode: 201,
+			expBody: `{"condition_id":103,"type":"matchSuffix","value":"net"}`,
+		},
+		{
+			name:    "attach condition",
+			method:  "PUT",
+			route:   "/iam/policies/102/conditions/103",
+			apiKey:  "ada",
+			expCode: 204,
+		},
+		{
+			name:    "attach policy",
+			method:  "PUT",
+			route:   "/iam/roles/101/policies/102",
+			apiKey:  "ada",
+			expCode: 204,
+		},
+		{
+			name:    "attach policy to role in other org",
+			method:  "PUT",
+			route:   "/iam/roles/2/policies/102",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "bind role",
+			method:  "PUT",
+			route:   "/iam/users/2/roles/101",
+			apiKey:  "ada",
+			expCode: 204,
+		},
+		{
+			name:    "bind role with expired window",
+			method:  "PUT",
+			route:   "/iam/users/3/roles/101",
+			apiKey:  "ada",
+			body:    `{"expires_at": "2021-01-01T00:00:00Z"}`,
+			expCode: 400,
+			expBody: `{"error":"expires_at must be in the future and after not_before"}`,
+		},
+		{
+			name:    "bind role for a window",
+			method:  "PUT",
+			route:   "/iam/users/3/roles/101",
+			apiKey:  "ada",
+			body:    `{"not_before": "2021-01-01T00:00:00Z", "expires_at": "2099-01-01T00:00:00Z"}`,
+			expCode: 204,
+		},
+		{
+			name:    "list user roles",
+			method:  "GET",
+			route:   "/iam/users/2/roles",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"role_id":101,"name":"deleteZonesRole","org_id":0,"user_id":2}]`,
+		},
+		{
+			name:    "list user roles with expiry",
+			method:  "GET",
+			route:   "/iam/users/3/roles",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"role_id":101,"name":"deleteZonesRole","org_id":0,"user_id":3,` +
+				`"not_before":"2021-01-01T00:00:00Z","expires_at":"2099-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:    "list role policies",
+			method:  "GET",
+			route:   "/iam/roles/101/policies",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"policy_id":102,"name":"deleteZones","effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"org","owner_org_id":0,"owner_role_id":0}]`,
+		},
+		{
+			name:    "list policy conditions",
+			method:  "GET",
+			route:   "/iam/policies/102/conditions",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"condition_id":103,"type":"matchSuffix","value":"net"}]`,
+		},
+		{
+			name:    "list policy versions",
+			method:  "GET",
+			route:   "/iam/policies/102/versions",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"policy_id":102,"version":1,"effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"conditions":null,"created_at":"0001-01-01T00:00:00Z","is_default":false},` +
+				`{"policy_id":102,"version":2,"effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"conditions":[{"type":"matchSuffix","value":"net"}],"created_at":"0001-01-01T00:00:00Z","is_default":true}]`,
+		},
+		{
+			name:    "diff default version with previous",
+			method:  "GET",
+			route:   "/iam/policies/102/diff",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `{"policy_id":102,"from":1,"to":2,"changes":["conditions: [] -\u003e [matchSuffix=net]"]}`,
+		},
+		{
+			name:    "diff missing version",
+			method:  "GET",
+			route:   "/iam/policies/102/diff?from=1&to=9",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "rollback",
+			method:  "POST",
+			route:   "/iam/policies/102/rollback",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `{"policy_id":102,"version":1,"effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"conditions":null,"created_at":"0001-01-01T00:00:00Z","is_default":true}`,
+		},
+		{
+			name:    "conditions of rolled back version",
+			method:  "GET",
+			route:   "/iam/policies/102/conditions",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[]`,
+		},
+		{
+			name:    "rollback first version",
+			method:  "POST",
+			route:   "/iam/policies/102/rollback",
+			apiKey:  "ada",
+			expCode: 409,
+			expBody: `{"error":"policy has no version before its default version"}`,
+		},
+		{
+			name:    "create policy version with bad effect",
+			method:  "POST",
+			route:   "/iam/policies/102/versions",
+			apiKey:  "ada",
+			body:    `{"effect": "permit", "actions": ["delete"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"effect must be \"allow\" or \"deny\""}`,
+		},
+		{
+			name:    "create policy version in another org",
+			method:  "POST",
+			route:   "/iam/policies/102/versions",
+			apiKey:  "ada",
+			body:    `{"effect": "allow", "actions": ["delete"], "resource_name": "oso:1:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"resource_name and not_resource_names must be in the requester's org or ${principal.org_id}"}`,
+		},
+		{
+			name:    "create policy version with untyped condition",
+			method:  "POST",
+			route:   "/iam/policies/102/versions",
+			apiKey:  "ada",
+			body:    `{"effect": "allow", "actions": ["delete"], "resource_name": "oso:0:zone/*", "conditions": [{"value": "com"}]}`,
+			expCode: 400,
+			expBody: `{"error":"type is required"}`,
+		},
+		{
+			name:   "create policy version with bad condition variable",
+			method: "POST",
+			route:  "/iam/policies/102/versions",
+			apiKey: "ada",
+			body: `{"effect": "allow", "actions": ["delete"], "resource_name": "oso:0:zone/*", ` +
+				`"conditions": [{"type": "matchSuffix", "value": "${principal.bogus}"}]}`,
+			expCode: 400,
+			expBody: `{"error":"policy variables must be one of ${principal.user_id}, ${principal.org_id}, ${principal.name} or ${principal.tag/\u003ckey\u003e}"}`,
+		},
+		{
+			name:    "create default policy version",
+			method:  "POST",
+			route:   "/iam/policies/102/versions",
+			apiKey:  "ada",
+			body:    `{"effect": "deny", "actions": ["delete"], "resource_name": "oso:0:zone/*", "set_as_default": true}`,
+			expCode: 201,
+			expBody: `{"policy_id":102,"version":3,"effect":"deny","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"conditions":null,"created_at":"0001-01-01T00:00:00Z","is_default":true}`,
+		},
+		{
+			name:    "policy is default version",
+			method:  "GET",
+			route:   "/iam/policies/102",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `{"policy_id":102,"name":"deleteZones","effect":"deny","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":3,"kind":"org","owner_org_id":0,"owner_role_id":0}`,
+		},
+		{
+			name:    "set default version",
+			method:  "PUT",
+			route:   "/iam/policies/102/default-version",
+			apiKey:  "ada",
+			body:    `{"version": 2}`,
+			expCode: 204,
+		},
+		{
+			name:    "get policy version",
+			method:  "GET",
+			route:   "/iam/policies/102/versions/2",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `{"policy_id":102,"version":2,"effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"conditions":[{"type":"matchSuffix","value":"net"}],"created_at":"0001-01-01T00:00:00Z","is_default":true}`,
+		},
+		{
+			name:    "explain",
+			method:  "POST",
+			route:   "/iam/users/1/explain",
+			apiKey:  "ada",
+			body:    `{"action": "view", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expBody: `{"decision":"allow","evaluations":[{"policy":{"ID":1,"Effect":"allow","Actions":["view"],"Resource":"oso:0:zone/*",` +
+				`"Conditions":{}},"covers_resource":true,"permits_action":true,"conditions_hold":true}]}`,
+		},
+		{
+			name:    "who can with conditions and implied actions",
+			method:  "POST",
+			route:   "/iam/who-can",
+			apiKey:  "ada",
+			body:    `{"action": "view", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expBody: `[{"user_id":1,"name":"john","grants":[{"role_id":1,"role":"viewZonesRole","policy_id":1,"policy":"viewZonesPolicy"}]},` +
+				`{"user_id":2,"name":"bob","grants":[{"role_id":1,"role":"deleteZonesRole","policy_id":1,"policy":"deleteZonesPolicy"}]},` +
+				`{"user_id":3,"name":"tom","grants":[{"role_id":1,"role":"deleteZonesRole","policy_id":1,"policy":"deleteZonesPolicy"}]},` +
+				`{"user_id":4,"name":"jim","grants":[{"role_id":1,"role":"viewComZonesRole","policy_id":1,"policy":"viewComZonesPolicy"}]}]`,
+		},
+		{
+			name:    "who can with deny override",
+			method:  "POST",
+			route:   "/iam/who-can",
+			apiKey:  "ada",
+			body:    `{"action": "delete", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expBody: `[{"user_id":2,"name":"bob","grants":[{"role_id":1,"role":"deleteZonesRole","policy_id":1,"policy":"deleteZonesPolicy"}]}]`,
+		},
+		{
+			name:    "who can without action",
+			method:  "POST",
+			route:   "/iam/who-can",
+			apiKey:  "ada",
+			body:    `{"resource": "oso:0:zone/foo.com"}`,
+			expCode: 400,
+			expBody: `{"error":"action is required"}`,
+		},
+		{
+			name:    "delete role",
+			method:  "DELETE",
+			route:   "/iam/roles/101",
+			apiKey:  "ada",
+			expCode: 204,
+		},
+		{
+			name:    "role unbound on delete",
+			method:  "GET",
+			route:   "/iam/users/2/roles",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[]`,
+		},
+		{
+			name:    "delete condition attached to policy of other org",
+			method:  "DELETE",
+			route:   "/iam/conditions/1",
+			apiKey:  "ada",
+			expCode: 409,
+			expBody: `{"error":"condition is attached to managed policies or policies of other orgs"}`,
+		},
+		{
+			name:    "delete condition",
+			method:  "DELETE",
+			route:   "/iam/conditions/103",
+			apiKey:  "ada",
+			expCode: 204,
+		},
+		{
+			name:    "deleting condition records policy version",
+			method:  "GET",
+			route:   "/iam/policies/102/versions/4",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `{"policy_id":102,"version":4,"effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"conditions":null,"created_at":"0001-01-01T00:00:00Z","is_default":true}`,
+		},
+		{
+			name:    "delete missing condition",
+			method:  "DELETE",
+			route:   "/iam/conditions/999",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "lint clean role",
+			method:  "GET",
+			route:   "/iam/roles/1/lint",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[]`,
+		},
+		{
+			name:    "create broad policy",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "everything", "effect": "allow", "actions": ["*"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 201,
+			expBody: `{"policy_id":104,"name":"everything","effect":"allow","actions":["*"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"org","owner_org_id":0,"owner_role_id":0}`,
+		},
+		{
+			name:    "create policy on missing zone",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "ada",
+			body:    `{"name": "viewBaz", "effect": "allow", "actions": ["view"], "resource_name": "oso:0:zone/baz.org"}`,
+			expCode: 201,
+			expBody: `{"policy_id":105,"name":"viewBaz","effect":"allow","actions":["view"],"resource_name":"oso:0:zone/baz.org",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"org","owner_org_id":0,"owner_role_id":0}`,
+		},
+		{
+			name:    "attach broad policy",
+			method:  "PUT",
+			route:   "/iam/roles/1/policies/104",
+			apiKey:  "ada",
+			expCode: 204,
+		},
+		{
+			name:    "attach policy on missing zone",
+			method:  "PUT",
+			route:   "/iam/roles/1/policies/105",
+			apiKey:  "ada",
+			expCode: 204,
+		},
+		{
+			name:    "lint role",
+			method:  "GET",
+			route:   "/iam/roles/1/lint",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"rule":"IAM001","severity":"error","role_id":1,"role":"viewZonesRole","policy_id":104,` +
+				`"message":"policy 104 allows all actions on oso:0:zone/*"},` +
+				`{"rule":"IAM004","severity":"warning","role_id":1,"role":"viewZonesRole","policy_id":105,` +
+				`"message":"policy 105 on oso:0:zone/baz.org matches no zone"}]`,
+		},
+		{
+			name:    "lint role in other org",
+			method:  "GET",
+			route:   "/iam/roles/2/lint",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "lint user",
+			method:  "GET",
+			route:   "/iam/users/3/lint",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[]`,
+		},
+		{
+			name:    "lint org",
+			method:  "GET",
+			route:   "/iam/lint",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"rule":"IAM001","severity":"error","role_id":1,"role":"viewZonesRole","policy_id":104,` +
+				`"message":"policy 104 allows all actions on oso:0:zone/*"},` +
+				`{"rule":"IAM004","severity":"warning","role_id":1,"role":"viewZonesRole","policy_id":105,` +
+				`"message":"policy 105 on oso:0:zone/baz.org matches no zone"}]`,
+		},
+	}
+
+	app := NewServer(newTestAuthorizer(t), &mockDatastore{}, newMemAdmin(), newNopLog(), defaultConfig()).setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", tt.apiKey)
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, string(body))
+		})
+	}
+}
+
+func Test_listActionsRoute(t *testing.T) {
+	t.Parallel()
+	app := NewServer(newTestAuthorizer(t), &mockDatastore{}, newMemAdmin(), newNopLog(), defaultConfig()).setup()
+	req, _ := http.NewRequest("GET", "/iam/actions", nil)
+	req.Header.Set("x-api-key", "ada")
+	res, err := app.Test(req, -1)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+
+	var byType map[string][]catalog.Action
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&byType))
+	assert.Equal(t, catalog.Default.Actions("zone"), byType["zone"])
+	assert.Len(t, byType, len(catalog.Default.Types()))
+}
+
+func Test_actionsCatalogued(t *testing.T) {
+	t.Parallel()
+	// the actions the app authorizes, and the resource type they're authorized on
+	actions := map[string][]string{
+		"org": {
+			actionGetOrg, actionListUsers, actionGetUser, actionCreateUser, actionDeleteUser, actionListRoles,
+			actionGetRole, actionCreateRole, actionDeleteRole, actionListPolicies, actionGetPolicy, actionCreatePolicy,
+			actionDeletePolicy, actionListConditions, actionGetCondition, actionCreateCondition, actionDeleteCondition,
+			actionBindRole, actionUnbindRole, actionAttachPolicy, actionDetachPolicy, actionAttachCondition,
+			actionDetachCondition, actionGetPermissions, actionListAuditEvents, actionCreatePolicyVersion,
+			actionSetDefaultPolicyVersion, actionMoveOrg,
+		},
+		"role": {actionRequestAccess, actionApproveAccess},
+		"zone": {iam.ReadAction, "delete", actionRequestAccess, actionApproveAccess},
+	}
+	for rType, as := range actions {
+		for _, a := range as {
+			assert.Len(t, catalog.Default.Match(rType, a), 1, "%s on %s", a, rType)
+		}
+	}
+}
+
+func Test_policyOwnership(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		body    string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "list policies of org and managed policies",
+			method:  "GET",
+			route:   "/iam/policies",
+			expCode: 200,
+			expBody: `[{"policy_id":1,"name":"viewZones","effect":"allow","actions":["view"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"org","owner_org_id":0,"owner_role_id":0},` +
+				`{"policy_id":2,"name":"ZoneReadOnly","effect":"allow","actions":["view"],` +
+				`"resource_name":"oso:${principal.org_id}:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"managed","owner_org_id":0,"owner_role_id":0}]`,
+		},
+		{
+			name:    "get policy of other org",
+			method:  "GET",
+			route:   "/iam/policies/3",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "delete managed policy",
+			method:  "DELETE",
+			route:   "/iam/policies/2",
+			expCode: 403,
+			expBody: `{"error":"managed policies are read-only"}`,
+		},
+		{
+			name:    "roll back managed policy",
+			method:  "POST",
+			route:   "/iam/policies/2/rollback",
+			expCode: 403,
+			expBody: `{"error":"managed policies are read-only"}`,
+		},
+		{
+			name:    "create policy with bad kind",
+			method:  "POST",
+			route:   "/iam/policies",
+			body:    `{"name": "viewZones", "effect": "allow", "actions": ["view"], "resource_name": "oso:0:zone/*", "kind": "managed"}`,
+			expCode: 400,
+			expBody: `{"error":"kind must be \"org\" or \"inline\""}`,
+		},
+		{
+			name:   "create inline policy for role of other org",
+			method: "POST",
+			route:  "/iam/policies",
+			body: `{"name": "viewZones", "effect": "allow", "actions": ["view"], "resource_name": "oso:0:zone/*", ` +
+				`"kind": "inline", "owner_role_id": 2}`,
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:   "create inline policy",
+			method: "POST",
+			route:  "/iam/policies",
+			body: `{"name": "deleteZones", "effect": "allow", "actions": ["delete"], "resource_name": "oso:0:zone/*", ` +
+				`"kind": "inline", "owner_role_id": 1}`,
+			expCode: 201,
+			expBody: `{"policy_id":101,"name":"deleteZones","effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"inline","owner_org_id":0,"owner_role_id":1}`,
+		},
+		{
+			name:    "inline policy is attached to its role",
+			method:  "GET",
+			route:   "/iam/roles/1/policies",
+			expCode: 200,
+			expBody: `[{"policy_id":1,"name":"viewZones","effect":"allow","actions":["view"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"org","owner_org_id":0,"owner_role_id":0},` +
+				`{"policy_id":101,"name":"deleteZones","effect":"allow","actions":["delete"],"resource_name":"oso:0:zone/*",` +
+				`"not_actions":[],"not_resource_names":[],"default_version":1,"kind":"inline","owner_org_id":0,"owner_role_id":1}]`,
+		},
+		{
+			name:    "create role",
+			method:  "POST",
+			route:   "/iam/roles",
+			body:    `{"name": "deleteZonesRole"}`,
+			expCode: 201,
+			expBody: `{"role_id":102,"name":"deleteZonesRole","org_id":0}`,
+		},
+		{
+			name:    "attach inline policy to other role",
+			method:  "PUT",
+			route:   "/iam/roles/102/policies/101",
+			expCode: 409,
+			expBody: `{"error":"inline policies can only be attached to the role they belong to, and are deleted rather than detached"}`,
+		},
+		{
+			name:    "detach inline policy",
+			method:  "DELETE",
+			route:   "/iam/roles/1/policies/101",
+			expCode: 409,
+			expBody: `{"error":"inline policies can only be attached to the role they belong to, and are deleted rather than detached"}`,
+		},
+		{
+			name:    "attach managed policy",
+			method:  "PUT",
+			route:   "/iam/roles/102/policies/2",
+			expCode: 204,
+		},
+		{
+			name:    "managed policy usage",
+			method:  "GET",
+			route:   "/iam/policies/2/usage",
+			expCode: 200,
+			expBody: `{"policy_id":2,"roles":2,"orgs":2,"users":0}`,
+		},
+		{
+			name:    "org policy usage",
+			method:  "GET",
+			route:   "/iam/policies/1/usage",
+			expCode: 200,
+			expBody: `{"policy_id":1,"roles":1,"orgs":1,"users":1}`,
+		},
+		{
+			name:    "usage of policy of other org",
+			method:  "GET",
+			route:   "/iam/policies/3/usage",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "delete role",
+			method:  "DELETE",
+			route:   "/iam/roles/1",
+			expCode: 204,
+		},
+		{
+			name:    "inline policy is deleted with its role",
+			method:  "GET",
+			route:   "/iam/policies/101",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+	}
+
+	app := NewServer(newTestAuthorizer(t), &mockDatastore{}, newMemAdmin(), newNopLog(), defaultConfig()).setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", "ada")
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, string(body))
+		})
+	}
+}
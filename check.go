@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamfiber"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+)
+
+const (
+	decisionAllow = iam.EffectAllow
+	decisionDeny  = iam.EffectDeny
+)
+
+// reasonMessages describes a policy's contribution to a decision, by effect
+var reasonMessages = map[string]string{
+	decisionAllow: "allowed by policy",
+	decisionDeny:  "explicitly denied by policy",
+}
+
+// maxBatchChecks is the most checks accepted in a single batch
+const maxBatchChecks = 1000
+
+var (
+	errMissingAction     = errors.New("action is required")
+	errPrincipalNotFound = errors.New("principal not found")
+	errTooManyChecks     = fmt.Errorf("batch may contain at most %d checks", maxBatchChecks)
+)
+
+// authzCheck is an action on the resource identified by the NRN in Resource
+type authzCheck struct {
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	// Attributes are optional attributes of the resource, for use by conditions
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// checkRequest asks whether Principal may perform an action on a resource
+type checkRequest struct {
+	// Principal is the user ID of the principal, or zero for the requester
+	Principal int `json:"principal"`
+	authzCheck
+}
+
+// batchCheckRequest asks whether Principal may perform each of Checks
+type batchCheckRequest struct {
+	// Principal is the user ID of the principal, or zero for the requester
+	Principal int          `json:"principal"`
+	Checks    []authzCheck `json:"checks"`
+}
+
+// batchCheckResponse holds the result of each check in a batchCheckRequest, in the order they were requested
+type batchCheckResponse struct {
+	Results []batchCheckResult `json:"results"`
+}
+
+// batchCheckResult is either the decision for a check or the error that prevented making one
+type batchCheckResult struct {
+	Decision string        `json:"decision,omitempty"`
+	Reasons  []checkReason `json:"reasons,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// checkResponse is the decision for a checkRequest and the reasons for it
+type checkResponse struct {
+	Decision string        `json:"decision"`
+	Reasons  []checkReason `json:"reasons"`
+}
+
+// checkReason is a policy that contributed to a decision.  A deny without any policy is implicit.
+type checkReason struct {
+	PolicyID int    `json:"policy_id,omitempty"`
+	Effect   string `json:"effect"`
+	Resource string `json:"resource,omitempty"`
+	Message  string `json:"message"`
+}
+
+// checkRoute decides whether a principal in the requester's org may perform an action on any resource, whether or
+// not it exists locally.  Principals the requester may not decide for are not found.
+func (s *Server) checkRoute(c *fiber.Ctx) error {
+	reqUser, err := iamfiber.User(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": errHTMLUserNotFound})
+	}
+
+	var req checkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	r, err := req.authzCheck.resource()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	principal, err := s.derivePrincipal(context.Background(), reqUser, req.Principal)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": errPrincipalNotFound.Error()})
+	}
+
+	res, err := s.checkAuthz(principal, req.Action, r)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(200).JSON(res)
+}
+
+// batchCheckRoute decides whether a principal in the requester's org may perform each of a list of actions on
+// resources, loading the principal's permissions once
+func (s *Server) batchCheckRoute(c *fiber.Ctx) error {
+	reqUser, err := iamfiber.User(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": errHTMLUserNotFound})
+	}
+
+	var req batchCheckRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(req.Checks) > maxBatchChecks {
+		return c.Status(400).JSON(fiber.Map{"error": errTooManyChecks.Error()})
+	}
+
+	principal, err := s.derivePrincipal(context.Background(), reqUser, req.Principal)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": errPrincipalNotFound.Error()})
+	}
+
+	return c.Status(200).JSON(batchCheckResponse{Results: s.batchCheckAuthz(principal, req.Checks)})
+}
+
+// resource validates the check and returns the resource it's for
+func (ac authzCheck) resource() (*roles.ExternalResource, error) {
+	if ac.Action == "" {
+		return nil, errMissingAction
+	}
+	return roles.NewExternalResource(ac.Resource, ac.Attributes)
+}
+
+// derivePrincipal loads the principal with the given user ID, which must belong to the requester's org.  A zero
+// user ID is the requester.  Deciding for another principal discloses its permissions, so the requester must be
+// allowed iam:GetPermissions on the org, like viewing the principal's permissions through the admin API.
+func (s *Server) derivePrincipal(ctx context.Context, reqUser *iam.DerivedUser, userID int) (*iam.DerivedUser, error) {
+	if userID == 0 || userID == reqUser.User.UserID {
+		return reqUser, nil
+	}
+	u, err := s.ds.FindUserByID(ctx, userID)
+	if err != nil {
+		s.logger.Errorw("error finding principal by ID", "userID", userID, "error", err)
+		return nil, err
+	}
+	if u.OrgID != reqUser.User.OrgID {
+		return nil, errPrincipalNotFound
+	}
+	org, err := roles.NewExternalResource(orgResourceName(reqUser.User.OrgID), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.newEnforcer().Authorize(iam.WithDerivedUser(ctx, reqUser), actionGetPermissions, "org", org); err != nil {
+		return nil, err
+	}
+	du, err := iam.Derive(ctx, s.ds, u)
+	if err != nil {
+		s.logger.Errorw("error finding effective permissions for principal", "userID", userID, "error", err)
+		return nil, err
+	}
+	return du, nil
+}
+
+// checkAuthz decides whether u may perform action on resource and explains the decision with the policies that
+// contributed to it
+func (s *Server) checkAuthz(u *iam.DerivedUser, action string, resource interface{}) (*checkResponse, error) {
+	res := s.newCheckEnforcer().Check(u, iam.Check{Action: action, Resource: resource})
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return newCheckResponse(res), nil
+}
+
+// newCheckResponse returns the response explaining the decision res with the policies of the deciding effect
+func newCheckResponse(res iam.CheckResult) *checkResponse {
+	resp := &checkResponse{Decision: decisionDeny, Reasons: []checkReason{}}
+	if res.Allowed {
+		resp.Decision = decisionAllow
+	}
+	for _, p := range res.Policies {
+		resp.Reasons = append(resp.Reasons, checkReason{
+			PolicyID: p.ID,
+			Effect:   p.Effect,
+			Resource: string(p.Resource),
+			Message:  reasonMessages[resp.Decision],
+		})
+	}
+	if len(resp.Reasons) == 0 && !res.Allowed {
+		resp.Reasons = append(resp.Reasons, checkReason{Effect: decisionDeny, Message: "no policy allows action"})
+	}
+	return resp
+}
+
+// batchCheckAuthz decides each of checks for u with the enforcer's batch evaluation.  Results are in the same order as
+// checks.  A check that's invalid or can't be decided has an error result and doesn't affect the others.
+func (s *Server) batchCheckAuthz(u *iam.DerivedUser, checks []authzCheck) []batchCheckResult {
+	results := make([]batchCheckResult, len(checks))
+	// the index in checks of each valid check in batch
+	var batch []iam.Check
+	var indexes []int
+	for i, check := range checks {
+		r, err := check.resource()
+		if err != nil {
+			results[i] = batchCheckResult{Error: err.Error()}
+			continue
+		}
+		batch = append(batch, iam.Check{Action: check.Action, Resource: r})
+		indexes = append(indexes, i)
+	}
+
+	for j, res := range s.newCheckEnforcer().AuthorizeBatch(u, batch) {
+		i := indexes[j]
+		if res.Err != nil {
+			results[i] = batchCheckResult{Error: res.Err.Error()}
+			continue
+		}
+		resp := newCheckResponse(res)
+		results[i] = batchCheckResult{Decision: resp.Decision, Reasons: resp.Reasons}
+	}
+	return results
+}
+
+// explainAuthz decides whether u may perform action on resource and evaluates each of u's policies against it
+func (s *Server) explainAuthz(u *iam.DerivedUser, action string, resource interface{}) (*iam.Explanation, error) {
+	exp, err := iam.Explain(s.authz, u, action, resource)
+	if err != nil {
+		s.logger.Errorw("error explaining authorization", "error", err)
+		return nil, err
+	}
+	return exp, nil
+}
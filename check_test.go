@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_checkRoute(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		apiKey  string
+		body    string
+		expCode int
+		expRes  checkResponse
+	}{
+		{
+			name:    "allowed by wildcard policy",
+			apiKey:  "ada",
+			body:    `{"principal": 1, "action": "view", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expRes: checkResponse{
+				Decision: decisionAllow,
+				Reasons: []checkReason{
+					{PolicyID: 1, Effect: "allow", Resource: "oso:0:zone/*", Message: "allowed by policy"},
+				},
+			},
+		},
+		{
+			name:    "resource does not exist locally",
+			apiKey:  "ada",
+			body:    `{"principal": 1, "action": "view", "resource": "oso:0:zone/nowhere.org"}`,
+			expCode: 200,
+			expRes: checkResponse{
+				Decision: decisionAllow,
+				Reasons: []checkReason{
+					{PolicyID: 1, Effect: "allow", Resource: "oso:0:zone/*", Message: "allowed by policy"},
+				},
+			},
+		},
+		{
+			name:    "implicitly denied",
+			apiKey:  "ada",
+			body:    `{"principal": 1, "action": "delete", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expRes: checkResponse{
+				Decision: decisionDeny,
+				Reasons: []checkReason{
+					{Effect: "deny", Message: "no policy allows action"},
+				},
+			},
+		},
+		{
+			name:    "explicitly denied",
+			apiKey:  "ada",
+			body:    `{"principal": 3, "action": "delete", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expRes: checkResponse{
+				Decision: decisionDeny,
+				Reasons: []checkReason{
+					{PolicyID: 2, Effect: "deny", Resource: "oso:0:zone/foo.com", Message: "explicitly denied by policy"},
+				},
+			},
+		},
+		{
+			name:    "denied by condition",
+			apiKey:  "ada",
+			body:    `{"principal": 4, "action": "view", "resource": "oso:0:zone/foo.net"}`,
+			expCode: 200,
+			expRes: checkResponse{
+				Decision: decisionDeny,
+				Reasons: []checkReason{
+					{Effect: "deny", Message: "no policy allows action"},
+				},
+			},
+		},
+		{
+			name:    "principal defaults to requester",
+			apiKey:  "john",
+			body:    `{"action": "view", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expRes: checkResponse{
+				Decision: decisionAllow,
+				Reasons: []checkReason{
+					{PolicyID: 1, Effect: "allow", Resource: "oso:0:zone/*", Message: "allowed by policy"},
+				},
+			},
+		},
+		{
+			name:    "principal in another org",
+			apiKey:  "bob",
+			body:    `{"principal": 5, "action": "view", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 404,
+		},
+		{
+			name:    "principal without iam:GetPermissions",
+			apiKey:  "bob",
+			body:    `{"principal": 1, "action": "view", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 404,
+		},
+		{
+			name:    "requester as principal without iam:GetPermissions",
+			apiKey:  "bob",
+			body:    `{"principal": 2, "action": "delete", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 200,
+			expRes: checkResponse{
+				Decision: decisionAllow,
+				Reasons: []checkReason{
+					{PolicyID: 1, Effect: "allow", Resource: "oso:0:zone/*", Message: "allowed by policy"},
+				},
+			},
+		},
+		{
+			name:    "bad resource name",
+			apiKey:  "bob",
+			body:    `{"principal": 1, "action": "view", "resource": "foo.com"}`,
+			expCode: 400,
+		},
+		{
+			name:    "missing action",
+			apiKey:  "bob",
+			body:    `{"principal": 1, "resource": "oso:0:zone/foo.com"}`,
+			expCode: 400,
+		},
+		{
+			name:    "unauthenticated",
+			apiKey:  "guybrush",
+			body:    `{"principal": 1, "action": "view", "resource": "oso:0:zone/foo.com"}`,
+			expCode: 401,
+		},
+	}
+	app := newTestServer(t, &mockDatastore{}, defaultConfig()).setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/authz/check", bytes.NewBufferString(tt.body))
+			req.Header.Set("x-api-key", tt.apiKey)
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req, -1)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			if tt.expCode != 200 {
+				return
+			}
+			var got checkResponse
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, tt.expRes, got)
+		})
+	}
+}
+
+func Test_batchCheckRoute(t *testing.T) {
+	t.Parallel()
+	allowed := batchCheckResult{
+		Decision: decisionAllow,
+		Reasons: []checkReason{
+			{PolicyID: 1, Effect: "allow", Resource: "oso:0:zone/*", Message: "allowed by policy"},
+		},
+	}
+	implicitlyDenied := batchCheckResult{
+		Decision: decisionDeny,
+		Reasons:  []checkReason{{Effect: "deny", Message: "no policy allows action"}},
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		body    string
+		expCode int
+		expRes  batchCheckResponse
+	}{
+		{
+			name:   "results in request order",
+			apiKey: "ada",
+			body: `{"principal": 1, "checks": [
+				{"action": "view", "resource": "oso:0:zone/foo.com"},
+				{"action": "delete", "resource": "oso:0:zone/foo.com"},
+				{"action": "view", "resource": "oso:0:zone/bar.net"}
+			]}`,
+			expCode: 200,
+			expRes: batchCheckResponse{Results: []batchCheckResult{
+				allowed,
+				implicitlyDenied,
+				allowed,
+			}},
+		},
+		{
+			name:   "per check errors",
+			apiKey: "john",
+			body: `{"checks": [
+				{"action": "view", "resource": "foo.com"},
+				{"resource": "oso:0:zone/foo.com"},
+				{"action": "view", "resource": "oso:0:zone/foo.com"}
+			]}`,
+			expCode: 200,
+			expRes: batchCheckResponse{Results: []batchCheckResult{
+				{Error: "improperly formated resource name"},
+				{Error: errMissingAction.Error()},
+				allowed,
+			}},
+		},
+		{
+			name:    "empty batch",
+			apiKey:  "john",
+			body:    `{"checks": []}`,
+			expCode: 200,
+			expRes:  batchCheckResponse{Results: []batchCheckResult{}},
+		},
+		{
+			name:    "too many checks",
+			apiKey:  "john",
+			body:    fmt.Sprintf(`{"checks": [%s]}`, strings.Repeat(`{"action": "view", "resource": "oso:0:zone/foo.com"},`, maxBatchChecks)+`{}`),
+			expCode: 400,
+		},
+		{
+			name:    "principal in another org",
+			apiKey:  "john",
+			body:    `{"principal": 5, "checks": [{"action": "view", "resource": "oso:0:zone/foo.com"}]}`,
+			expCode: 404,
+		},
+		{
+			name:    "principal without iam:GetPermissions",
+			apiKey:  "john",
+			body:    `{"principal": 2, "checks": [{"action": "view", "resource": "oso:0:zone/foo.com"}]}`,
+			expCode: 404,
+		},
+	}
+	app := newTestServer(t, &mockDatastore{}, defaultConfig()).setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/authz/batch-check", bytes.NewBufferString(tt.body))
+			req.Header.Set("x-api-key", tt.apiKey)
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req, -1)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			if tt.expCode != 200 {
+				return
+			}
+			var got batchCheckResponse
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, tt.expRes, got)
+		})
+	}
+}
+
+func Test_batchCheckAuthz(t *testing.T) {
+	t.Parallel()
+	ds := &mockDatastore{}
+	u, err := ds.FindUserByID(context.Background(), 4)
+	assert.NoError(t, err)
+	du, err := iam.Derive(context.Background(), ds, u)
+	assert.NoError(t, err)
+
+	// more checks than the enforcer's workers, alternating between zones jim can and can't view, and an invalid check
+	var checks []authzCheck
+	for i := 0; i < 32; i++ {
+		tld := "com"
+		if i%2 == 1 {
+			tld = "net"
+		}
+		checks = append(checks, authzCheck{Action: "view", Resource: fmt.Sprintf("oso:0:zone/zone%d.%s", i, tld)})
+	}
+	checks = append(checks, authzCheck{Action: "view", Resource: "gmail.com"})
+
+	results := newTestServer(t, ds, defaultConfig()).batchCheckAuthz(du, checks)
+	assert.Len(t, results, len(checks))
+	assert.NotEmpty(t, results[len(results)-1].Error)
+	for i, r := range results[:len(results)-1] {
+		assert.Empty(t, r.Error)
+		if i%2 == 1 {
+			assert.Equal(t, decisionDeny, r.Decision, checks[i].Resource)
+		} else {
+			assert.Equal(t, decisionAllow, r.Decision, checks[i].Resource)
+		}
+	}
+}
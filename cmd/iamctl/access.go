@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"time"
+)
+
+// decisionVerbs is the status each access subcommand deciding a request moves it to
+var decisionVerbs = map[string]string{
+	"approve": datastore.AccessApproved,
+	"deny":    datastore.AccessDenied,
+	"cancel":  datastore.AccessCancelled,
+}
+
+// runAccess runs the access subcommand in args, which requests temporary access and decides requests for it.
+// Against the API requests are made and decided by the API key's user, against the database by the given --user.
+func runAccess(ctx context.Context, c client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: access requires request, list, get, approve, deny or cancel", errUsage)
+	}
+	verb := args[0]
+	fs := flag.NewFlagSet("access", flag.ContinueOnError)
+	org := fs.Int("org", 1, "org ID, ignored against the API")
+	user := fs.Int("user", 0, "user ID making or deciding the request, ignored against the API")
+	role := fs.Int("role", 0, "role ID to request")
+	action := fs.String("action", "", "action to request")
+	resource := fs.String("resource", "", "NRN of the resource to request the action on")
+	duration := fs.Duration("duration", time.Hour, "how long access is requested for")
+	justification := fs.String("justification", "", "why access is requested")
+	status := fs.String("status", "", "only list requests with this status")
+	reason := fs.String("reason", "", "reason for a decision")
+	pos, err := parse(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch verb {
+	case "request":
+		if len(pos) != 0 {
+			return fmt.Errorf("%w: access request takes no arguments", errUsage)
+		}
+		r := &datastore.AccessRequest{
+			UserID: *user, RoleID: *role, Action: *action, ResourceName: *resource,
+			DurationSeconds: int(duration.Seconds()), Justification: *justification,
+		}
+		if *user != 0 {
+			u, err := c.FindUserByID(ctx, *user)
+			if err != nil {
+				return err
+			}
+			r.OrgID = u.OrgID
+		}
+		if err := c.CreateAccessRequest(ctx, r); err != nil {
+			return err
+		}
+		if p.json {
+			return p.print(r, nil, nil)
+		}
+		p.done("requested access %d", r.RequestID)
+		return nil
+	case "list":
+		if len(pos) != 0 {
+			return fmt.Errorf("%w: access list takes no arguments", errUsage)
+		}
+		rs, err := c.ListAccessRequests(ctx, *org, *status)
+		if err != nil {
+			return err
+		}
+		return p.accessRequests(rs)
+	case "get":
+		id, err := idArg(pos)
+		if err != nil {
+			return err
+		}
+		r, err := c.FindAccessRequest(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.accessRequests([]*datastore.AccessRequest{r})
+	case "approve", "deny", "cancel":
+		id, err := idArg(pos)
+		if err != nil {
+			return err
+		}
+		d := datastore.AccessDecision{Status: decisionVerbs[verb], DeciderID: *user, Reason: *reason}
+		r, err := c.DecideAccessRequest(ctx, id, d, time.Now())
+		if err != nil {
+			return err
+		}
+		if p.json {
+			return p.print(r, nil, nil)
+		}
+		p.done("%s access request %d", r.Status, r.RequestID)
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown access subcommand %q", errUsage, verb)
+	}
+}
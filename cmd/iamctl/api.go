@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/volatiletech/null/v8"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	errOrgsRequireDB     = errors.New("orgs can only be created and deleted against the database")
+	errSweepRequiresDB   = errors.New("expired role bindings can only be swept against the database")
+	errExpireRequiresDB  = errors.New("access requests can only be expired against the database")
+	errRecordUnsupported = errors.New("decisions and usage are only recorded by the server")
+	errPruneRequiresDB   = errors.New("decisions can only be pruned against the database")
+)
+
+// apiClient is a client that works through the admin API.  The API only manages the org of the user the API key
+// belongs to, so org IDs passed to it are ignored.
+type apiClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL, apiKey string) *apiClient {
+	return &apiClient{baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey, http: http.DefaultClient}
+}
+
+// do sends a request with body encoded as JSON, if any, and decodes the response into out, if any
+func (c *apiClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			apiErr.Error = http.StatusText(res.StatusCode)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, apiErr.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (c *apiClient) ListOrgs(ctx context.Context) (models.OrgSlice, error) {
+	var os models.OrgSlice
+	return os, c.do(ctx, http.MethodGet, "/iam/orgs", nil, &os)
+}
+
+func (c *apiClient) FindOrgByID(ctx context.Context, id int) (*models.Org, error) {
+	var o models.Org
+	return &o, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/orgs/%d", id), nil, &o)
+}
+
+func (c *apiClient) CreateOrg(context.Context, *models.Org) error {
+	return errOrgsRequireDB
+}
+
+func (c *apiClient) DeleteOrgByID(context.Context, int) error {
+	return errOrgsRequireDB
+}
+
+func (c *apiClient) MoveOrg(ctx context.Context, orgID int, parentID null.Int) error {
+	body := map[string]interface{}{"parent_id": parentID}
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/iam/orgs/%d/parent", orgID), body, nil)
+}
+
+func (c *apiClient) ListOrgRoles(ctx context.Context, orgID int) (models.RoleSlice, error) {
+	var rs models.RoleSlice
+	return rs, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/orgs/%d/roles", orgID), nil, &rs)
+}
+
+func (c *apiClient) BindOrgRole(ctx context.Context, orgID, roleID int) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/iam/orgs/%d/roles/%d", orgID, roleID), nil, nil)
+}
+
+func (c *apiClient) UnbindOrgRole(ctx context.Context, orgID, roleID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/orgs/%d/roles/%d", orgID, roleID), nil, nil)
+}
+
+func (c *apiClient) ListUsersByOrgID(ctx context.Context, _ int) (*models.UserSlice, error) {
+	var us models.UserSlice
+	return &us, c.do(ctx, http.MethodGet, "/iam/users", nil, &us)
+}
+
+func (c *apiClient) FindUserByID(ctx context.Context, id int) (*models.User, error) {
+	var u models.User
+	return &u, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/users/%d", id), nil, &u)
+}
+
+func (c *apiClient) CreateUser(ctx context.Context, u *models.User) error {
+	return c.do(ctx, http.MethodPost, "/iam/users", u, u)
+}
+
+func (c *apiClient) DeleteUserByID(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/users/%d", id), nil, nil)
+}
+
+func (c *apiClient) ListRolesByOrgID(ctx context.Context, _ int) (models.RoleSlice, error) {
+	var rs models.RoleSlice
+	return rs, c.do(ctx, http.MethodGet, "/iam/roles", nil, &rs)
+}
+
+func (c *apiClient) ListRoleBindingsByUserID(ctx context.Context, userID int) ([]*datastore.RoleBinding, error) {
+	var bs []*datastore.RoleBinding
+	return bs, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/users/%d/roles", userID), nil, &bs)
+}
+
+func (c *apiClient) FindRoleByID(ctx context.Context, id int) (*models.Role, error) {
+	var r models.Role
+	return &r, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/roles/%d", id), nil, &r)
+}
+
+func (c *apiClient) CreateRole(ctx context.Context, r *models.Role) error {
+	return c.do(ctx, http.MethodPost, "/iam/roles", r, r)
+}
+
+func (c *apiClient) DeleteRoleByID(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/roles/%d", id), nil, nil)
+}
+
+func (c *apiClient) ListPoliciesByOrgID(ctx context.Context, _ int) (models.PolicySlice, error) {
+	var ps models.PolicySlice
+	return ps, c.do(ctx, http.MethodGet, "/iam/policies", nil, &ps)
+}
+
+func (c *apiClient) ListPoliciesByRoleID(ctx context.Context, roleID int) (models.PolicySlice, error) {
+	var ps models.PolicySlice
+	return ps, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/roles/%d/policies", roleID), nil, &ps)
+}
+
+func (c *apiClient) FindPolicyByID(ctx context.Context, id int) (*models.Policy, error) {
+	var p models.Policy
+	return &p, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/policies/%d", id), nil, &p)
+}
+
+func (c *apiClient) CreatePolicy(ctx context.Context, p *models.Policy) error {
+	return c.do(ctx, http.MethodPost, "/iam/policies", p, p)
+}
+
+func (c *apiClient) DeletePolicyByID(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/policies/%d", id), nil, nil)
+}
+
+func (c *apiClient) GetPolicyUsage(ctx context.Context, policyID int) (*datastore.PolicyUsage, error) {
+	var u datastore.PolicyUsage
+	return &u, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/policies/%d/usage", policyID), nil, &u)
+}
+
+func (c *apiClient) ListConditions(ctx context.Context) (models.ConditionSlice, error) {
+	var cs models.ConditionSlice
+	return cs, c.do(ctx, http.MethodGet, "/iam/conditions", nil, &cs)
+}
+
+func (c *apiClient) ListConditionsByPolicyID(ctx context.Context, policyID int) (models.ConditionSlice, error) {
+	var cs models.ConditionSlice
+	return cs, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/policies/%d/conditions", policyID), nil, &cs)
+}
+
+func (c *apiClient) FindConditionByID(ctx context.Context, id int) (*models.Condition, error) {
+	var cond models.Condition
+	return &cond, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/conditions/%d", id), nil, &cond)
+}
+
+func (c *apiClient) CreateCondition(ctx context.Context, cond *models.Condition) error {
+	return c.do(ctx, http.MethodPost, "/iam/conditions", cond, cond)
+}
+
+func (c *apiClient) DeleteConditionByID(ctx context.Context, id, _ int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/conditions/%d", id), nil, nil)
+}
+
+func (c *apiClient) BindUserRole(ctx context.Context, userID, roleID int, w datastore.Window) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/iam/users/%d/roles/%d", userID, roleID), w, nil)
+}
+
+func (c *apiClient) UnbindUserRole(ctx context.Context, userID, roleID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/users/%d/roles/%d", userID, roleID), nil, nil)
+}
+
+func (c *apiClient) AttachRolePolicy(ctx context.Context, roleID, policyID int) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/iam/roles/%d/policies/%d", roleID, policyID), nil, nil)
+}
+
+func (c *apiClient) DetachRolePolicy(ctx context.Context, roleID, policyID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/roles/%d/policies/%d", roleID, policyID), nil, nil)
+}
+
+func (c *apiClient) AttachPolicyCondition(ctx context.Context, policyID, conditionID int) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/iam/policies/%d/conditions/%d", policyID, conditionID), nil, nil)
+}
+
+func (c *apiClient) DetachPolicyCondition(ctx context.Context, policyID, conditionID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/iam/policies/%d/conditions/%d", policyID, conditionID), nil, nil)
+}
+
+func (c *apiClient) EffectivePerms(ctx context.Context, userID int) (datastore.EffectivePerms, error) {
+	var perms datastore.EffectivePerms
+	return perms, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/users/%d/permissions", userID), nil, &perms)
+}
+
+func (c *apiClient) Explain(ctx context.Context, userID int, action, nrn string, attrs map[string]string) (*iam.Explanation, error) {
+	body := map[string]interface{}{"action": action, "resource": nrn, "attributes": attrs}
+	var exp iam.Explanation
+	return &exp, c.do(ctx, http.MethodPost, fmt.Sprintf("/iam/users/%d/explain", userID), body, &exp)
+}
+
+// WhoCan returns the users of the API key's org, so orgID is ignored
+func (c *apiClient) WhoCan(ctx context.Context, _ int, action, nrn string, attrs map[string]string) ([]*iam.Principal, error) {
+	body := map[string]interface{}{"action": action, "resource": nrn, "attributes": attrs}
+	var ps []*iam.Principal
+	return ps, c.do(ctx, http.MethodPost, "/iam/who-can", body, &ps)
+}
+
+// LintOrg lints the API key's org, so orgID is ignored
+func (c *apiClient) LintOrg(ctx context.Context, _ int) ([]iam.Finding, error) {
+	var fs []iam.Finding
+	return fs, c.do(ctx, http.MethodGet, "/iam/lint", nil, &fs)
+}
+
+func (c *apiClient) LintRole(ctx context.Context, roleID int) ([]iam.Finding, error) {
+	var fs []iam.Finding
+	return fs, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/roles/%d/lint", roleID), nil, &fs)
+}
+
+func (c *apiClient) LintUser(ctx context.Context, userID int) ([]iam.Finding, error) {
+	var fs []iam.Finding
+	return fs, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/users/%d/lint", userID), nil, &fs)
+}
+
+func (c *apiClient) ListPolicyVersions(ctx context.Context, policyID int) ([]*datastore.PolicyVersion, error) {
+	var vs []*datastore.PolicyVersion
+	return vs, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/policies/%d/versions", policyID), nil, &vs)
+}
+
+func (c *apiClient) FindPolicyVersion(ctx context.Context, policyID, version int) (*datastore.PolicyVersion, error) {
+	var v datastore.PolicyVersion
+	return &v, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/policies/%d/versions/%d", policyID, version), nil, &v)
+}
+
+func (c *apiClient) CreatePolicyVersion(ctx context.Context, v *datastore.PolicyVersion, setDefault bool) error {
+	body := struct {
+		*datastore.PolicyVersion
+		SetAsDefault bool `json:"set_as_default"`
+	}{v, setDefault}
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/iam/policies/%d/versions", v.PolicyID), body, v)
+}
+
+func (c *apiClient) SetDefaultPolicyVersion(ctx context.Context, policyID, version int) error {
+	body := map[string]int{"version": version}
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/iam/policies/%d/default-version", policyID), body, nil)
+}
+
+func (c *apiClient) RollbackPolicy(ctx context.Context, policyID int) (*datastore.PolicyVersion, error) {
+	var v datastore.PolicyVersion
+	return &v, c.do(ctx, http.MethodPost, fmt.Sprintf("/iam/policies/%d/rollback", policyID), nil, &v)
+}
+
+func (c *apiClient) SweepExpiredBindings(context.Context, time.Time) ([]*datastore.AuditEvent, error) {
+	return nil, errSweepRequiresDB
+}
+
+func (c *apiClient) ListAuditEvents(ctx context.Context, _ int) ([]*datastore.AuditEvent, error) {
+	var es []*datastore.AuditEvent
+	return es, c.do(ctx, http.MethodGet, "/iam/audit-events", nil, &es)
+}
+
+func (c *apiClient) RecordDecisions(context.Context, []*datastore.Decision) error {
+	return errRecordUnsupported
+}
+
+func (c *apiClient) PruneDecisions(context.Context, time.Time) (int64, error) {
+	return 0, errPruneRequiresDB
+}
+
+func (c *apiClient) RecordUsage(context.Context, []*datastore.Usage) error {
+	return errRecordUnsupported
+}
+
+// ListUnused lists what the API key's org hasn't used since since, rounded to whole days
+func (c *apiClient) ListUnused(ctx context.Context, _ int, since time.Time) ([]*datastore.Unused, error) {
+	days := int(math.Max(1, math.Round(time.Since(since).Hours()/24)))
+	var unused []*datastore.Unused
+	return unused, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/unused?days=%d", days), nil, &unused)
+}
+
+// ListDecisions lists the decisions of the API key's org, so the org of f is ignored.  The API can't filter by policy.
+func (c *apiClient) ListDecisions(ctx context.Context, f datastore.DecisionFilter) ([]*datastore.Decision, error) {
+	q := url.Values{}
+	if f.UserID != 0 {
+		q.Set("user_id", fmt.Sprint(f.UserID))
+	}
+	if !f.Since.IsZero() {
+		q.Set("since", f.Since.Format(time.RFC3339))
+	}
+	var ds []*datastore.Decision
+	return ds, c.do(ctx, http.MethodGet, "/iam/decisions?"+q.Encode(), nil, &ds)
+}
+
+func (c *apiClient) RecommendForUser(ctx context.Context, userID int, window time.Duration) (*iam.Recommendation, error) {
+	var rec iam.Recommendation
+	path := fmt.Sprintf("/iam/users/%d/recommendation?window=%s", userID, window)
+	return &rec, c.do(ctx, http.MethodGet, path, nil, &rec)
+}
+
+func (c *apiClient) RecommendForRole(ctx context.Context, roleID int, window time.Duration) (*iam.Recommendation, error) {
+	var rec iam.Recommendation
+	path := fmt.Sprintf("/iam/roles/%d/recommendation?window=%s", roleID, window)
+	return &rec, c.do(ctx, http.MethodGet, path, nil, &rec)
+}
+
+// CreateAccessRequest requests access for the API key's user, so the user and org of r are ignored
+func (c *apiClient) CreateAccessRequest(ctx context.Context, r *datastore.AccessRequest) error {
+	return c.do(ctx, http.MethodPost, "/iam/access-requests", r, r)
+}
+
+func (c *apiClient) FindAccessRequest(ctx context.Context, id int) (*datastore.AccessRequest, error) {
+	var r datastore.AccessRequest
+	return &r, c.do(ctx, http.MethodGet, fmt.Sprintf("/iam/access-requests/%d", id), nil, &r)
+}
+
+func (c *apiClient) ListAccessRequests(ctx context.Context, _ int, status string) ([]*datastore.AccessRequest, error) {
+	var rs []*datastore.AccessRequest
+	return rs, c.do(ctx, http.MethodGet, "/iam/access-requests?status="+url.QueryEscape(status), nil, &rs)
+}
+
+// DecideAccessRequest decides as the API key's user, so the decider of d is ignored
+func (c *apiClient) DecideAccessRequest(ctx context.Context, id int, d datastore.AccessDecision, _ time.Time) (*datastore.AccessRequest, error) {
+	verb := map[string]string{
+		datastore.AccessApproved:  "approve",
+		datastore.AccessDenied:    "deny",
+		datastore.AccessCancelled: "cancel",
+	}[d.Status]
+	body := map[string]string{"reason": d.Reason}
+	var r datastore.AccessRequest
+	return &r, c.do(ctx, http.MethodPost, fmt.Sprintf("/iam/access-requests/%d/%s", id, verb), body, &r)
+}
+
+func (c *apiClient) ExpireAccessRequests(context.Context, time.Time) ([]*datastore.AuditEvent, error) {
+	return nil, errExpireRequiresDB
+}
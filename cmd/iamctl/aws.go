@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/awspolicy"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"os"
+	"strconv"
+)
+
+// runImport creates policies from the AWS IAM style policy document in a file
+func runImport(ctx context.Context, s datastore.Syncer, p *printer, args []string) error {
+	fs := flag.NewFlagSet("policies import", flag.ContinueOnError)
+	file := fs.String("f", "", "AWS IAM style JSON policy document")
+	name := fs.String("name", "", "name of policies from statements without a Sid")
+	org := fs.Int("org", 1, "org ID the policies belong to")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *file == "" || len(pos) != 0 {
+		return fmt.Errorf("%w: policies import requires a policy document", errUsage)
+	}
+
+	fd, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	doc, err := awspolicy.Parse(fd)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+	ps, err := doc.Policies(*name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+	created, err := s.CreatePolicies(ctx, *org, ps)
+	if err != nil {
+		return err
+	}
+	return p.policies(created)
+}
+
+// runExport writes the policies with the IDs in args as an AWS IAM style policy document.  The document is always
+// JSON, whatever the output format.
+func runExport(ctx context.Context, c client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: policies export requires policy IDs", errUsage)
+	}
+	ps := make([]policyfile.Policy, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("%w: bad ID %q", errUsage, arg)
+		}
+		pol, err := c.FindPolicyByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		cs, err := c.ListConditionsByPolicyID(ctx, id)
+		if err != nil {
+			return err
+		}
+		ps[i] = policyfile.PolicyFromModel(pol, cs)
+	}
+
+	doc, err := awspolicy.FromPolicies(ps...)
+	if err != nil {
+		return err
+	}
+	return (&printer{w: p.w, json: true}).print(doc, nil, nil)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"time"
+)
+
+// client manages IAM data either directly in the database or through the admin API
+type client interface {
+	datastore.Admin
+	// EffectivePerms returns the effective permissions of the user with the given ID
+	EffectivePerms(ctx context.Context, userID int) (datastore.EffectivePerms, error)
+	// Explain evaluates the policies of the user with the given ID against action on the resource identified by nrn
+	Explain(ctx context.Context, userID int, action, nrn string, attrs map[string]string) (*iam.Explanation, error)
+	// WhoCan returns the users of an org that may perform action on the resource identified by nrn
+	WhoCan(ctx context.Context, orgID int, action, nrn string, attrs map[string]string) ([]*iam.Principal, error)
+	// LintOrg lints the roles of an org, and the roles bound to each of its users together
+	LintOrg(ctx context.Context, orgID int) ([]iam.Finding, error)
+	LintRole(ctx context.Context, roleID int) ([]iam.Finding, error)
+	LintUser(ctx context.Context, userID int) ([]iam.Finding, error)
+	// RecommendForUser recommends least privilege policies for a user from the access they used over window
+	RecommendForUser(ctx context.Context, userID int, window time.Duration) (*iam.Recommendation, error)
+	RecommendForRole(ctx context.Context, roleID int, window time.Duration) (*iam.Recommendation, error)
+}
+
+// dbClient is a client that works directly against the database.  It can also plan and apply policy files.
+type dbClient struct {
+	datastore.Admin
+	datastore.Syncer
+	ds    datastore.Datastore
+	authz iam.Authorizer
+}
+
+func (c *dbClient) EffectivePerms(ctx context.Context, userID int) (datastore.EffectivePerms, error) {
+	u, err := c.ds.FindUserByID(ctx, userID)
+	if err != nil {
+		return datastore.EffectivePerms{}, err
+	}
+	t, err := c.ds.GetOrgTree(ctx)
+	if err != nil {
+		return datastore.EffectivePerms{}, err
+	}
+	return c.ds.GetEffectivePerms(ctx, u, t)
+}
+
+func (c *dbClient) Explain(ctx context.Context, userID int, action, nrn string, attrs map[string]string) (*iam.Explanation, error) {
+	r, err := roles.NewExternalResource(nrn, attrs)
+	if err != nil {
+		return nil, err
+	}
+	u, err := c.ds.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	du, err := iam.Derive(ctx, c.ds, u)
+	if err != nil {
+		return nil, err
+	}
+	return iam.Explain(c.authz, du, action, r)
+}
+
+func (c *dbClient) WhoCan(ctx context.Context, orgID int, action, nrn string, attrs map[string]string) ([]*iam.Principal, error) {
+	r, err := roles.NewExternalResource(nrn, attrs)
+	if err != nil {
+		return nil, err
+	}
+	us, err := c.ds.ListUsersByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return iam.WhoCan(ctx, c.authz, c.ds, *us, action, r)
+}
+
+func (c *dbClient) LintOrg(ctx context.Context, orgID int) ([]iam.Finding, error) {
+	return iam.LintOrg(ctx, c.ds, c.Admin, orgID)
+}
+
+func (c *dbClient) LintRole(ctx context.Context, roleID int) ([]iam.Finding, error) {
+	r, err := c.FindRoleByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	return iam.LintRole(ctx, c.ds, c.Admin, r)
+}
+
+func (c *dbClient) LintUser(ctx context.Context, userID int) ([]iam.Finding, error) {
+	u, err := c.ds.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return iam.LintUser(ctx, c.ds, u)
+}
+
+func (c *dbClient) RecommendForUser(ctx context.Context, userID int, window time.Duration) (*iam.Recommendation, error) {
+	u, err := c.ds.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return iam.RecommendForUser(ctx, c.ds, c.Admin, u, time.Now().Add(-window))
+}
+
+func (c *dbClient) RecommendForRole(ctx context.Context, roleID int, window time.Duration) (*iam.Recommendation, error) {
+	r, err := c.FindRoleByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	return iam.RecommendForRole(ctx, c.ds, c.Admin, r, time.Now().Add(-window))
+}
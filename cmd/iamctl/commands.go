@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/volatiletech/null/v8"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runResource runs verb against the resource type named by cmd
+func runResource(ctx context.Context, c client, p *printer, cmd, verb string, args []string) error {
+	fs := flag.NewFlagSet(cmd+" "+verb, flag.ContinueOnError)
+	org := fs.Int("org", 1, "org ID, ignored against the API")
+	user := fs.Int("user", 0, "user ID")
+	role := fs.Int("role", 0, "role ID")
+	policy := fs.Int("policy", 0, "policy ID")
+	name := fs.String("name", "", "name")
+	apiKey := fs.String("api-key", "", "API key")
+	effect := fs.String("effect", "", "policy effect")
+	actions := fs.String("actions", "", "comma separated policy actions")
+	resource := fs.String("resource", "", "policy resource name")
+	notActions := fs.String("not-actions", "", "comma separated actions excluded from the policy")
+	notResources := fs.String("not-resources", "", "comma separated resource names excluded from the policy")
+	kind := fs.String("kind", "", "policy kind, org or inline")
+	inlineRole := fs.Int("inline-role", 0, "role ID an inline policy belongs to")
+	parent := fs.Int("parent", -1, "parent org ID")
+	condType := fs.String("type", "", "condition type")
+	value := fs.String("value", "", "condition value")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch verb {
+	case "list":
+		return list(ctx, c, p, cmd, *org, *user, *role, *policy)
+	case "get":
+		id, err := idArg(pos)
+		if err != nil {
+			return err
+		}
+		return get(ctx, c, p, cmd, id)
+	case "delete":
+		id, err := idArg(pos)
+		if err != nil {
+			return err
+		}
+		if cmd == "policies" {
+			if err := showUsage(ctx, c, p, id); err != nil {
+				return err
+			}
+		}
+		if err := remove(ctx, c, cmd, id, *org); err != nil {
+			return err
+		}
+		p.done("deleted %s %d", singular(cmd), id)
+		return nil
+	case "create":
+	default:
+		return fmt.Errorf("%w: unknown %s command %q", errUsage, cmd, verb)
+	}
+
+	switch cmd {
+	case "orgs":
+		o := &models.Org{Name: *name}
+		if *parent >= 0 {
+			o.ParentID = null.IntFrom(*parent)
+		}
+		if err := c.CreateOrg(ctx, o); err != nil {
+			return err
+		}
+		return p.orgs(models.OrgSlice{o})
+	case "users":
+		u := &models.User{Name: *name, APIKey: *apiKey, OrgID: *org}
+		if err := c.CreateUser(ctx, u); err != nil {
+			return err
+		}
+		return p.users(models.UserSlice{u})
+	case "roles":
+		r := &models.Role{Name: *name, OrgID: *org}
+		if err := c.CreateRole(ctx, r); err != nil {
+			return err
+		}
+		return p.roles(models.RoleSlice{r})
+	case "policies":
+		pol := &models.Policy{
+			Name: *name, Effect: *effect, ResourceName: *resource, Kind: *kind, OwnerOrgID: *org, OwnerRoleID: *inlineRole,
+		}
+		if *actions != "" {
+			pol.Actions = strings.Split(*actions, ",")
+		}
+		if *notActions != "" {
+			pol.NotActions = strings.Split(*notActions, ",")
+		}
+		if *notResources != "" {
+			pol.NotResourceNames = strings.Split(*notResources, ",")
+		}
+		if err := c.CreatePolicy(ctx, pol); err != nil {
+			return err
+		}
+		return p.policies(models.PolicySlice{pol})
+	default:
+		cond := &models.Condition{Type: *condType, Value: *value}
+		if err := c.CreateCondition(ctx, cond); err != nil {
+			return err
+		}
+		return p.conditions(models.ConditionSlice{cond})
+	}
+}
+
+func list(ctx context.Context, c client, p *printer, cmd string, org, user, role, policy int) error {
+	switch cmd {
+	case "orgs":
+		os, err := c.ListOrgs(ctx)
+		if err != nil {
+			return err
+		}
+		return p.orgs(os)
+	case "users":
+		us, err := c.ListUsersByOrgID(ctx, org)
+		if err != nil {
+			return err
+		}
+		return p.users(*us)
+	case "roles":
+		if user != 0 {
+			bs, err := c.ListRoleBindingsByUserID(ctx, user)
+			if err != nil {
+				return err
+			}
+			return p.bindings(bs)
+		}
+		rs, err := c.ListRolesByOrgID(ctx, org)
+		if err != nil {
+			return err
+		}
+		return p.roles(rs)
+	case "policies":
+		var ps models.PolicySlice
+		var err error
+		if role != 0 {
+			ps, err = c.ListPoliciesByRoleID(ctx, role)
+		} else {
+			ps, err = c.ListPoliciesByOrgID(ctx, org)
+		}
+		if err != nil {
+			return err
+		}
+		return p.policies(ps)
+	default:
+		var cs models.ConditionSlice
+		var err error
+		if policy != 0 {
+			cs, err = c.ListConditionsByPolicyID(ctx, policy)
+		} else {
+			cs, err = c.ListConditions(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		return p.conditions(cs)
+	}
+}
+
+func get(ctx context.Context, c client, p *printer, cmd string, id int) error {
+	switch cmd {
+	case "orgs":
+		o, err := c.FindOrgByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.orgs(models.OrgSlice{o})
+	case "users":
+		u, err := c.FindUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.users(models.UserSlice{u})
+	case "roles":
+		r, err := c.FindRoleByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.roles(models.RoleSlice{r})
+	case "policies":
+		pol, err := c.FindPolicyByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.policies(models.PolicySlice{pol})
+	default:
+		cond, err := c.FindConditionByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.conditions(models.ConditionSlice{cond})
+	}
+}
+
+func remove(ctx context.Context, c client, cmd string, id, org int) error {
+	switch cmd {
+	case "orgs":
+		return c.DeleteOrgByID(ctx, id)
+	case "users":
+		return c.DeleteUserByID(ctx, id)
+	case "roles":
+		return c.DeleteRoleByID(ctx, id)
+	case "policies":
+		return c.DeletePolicyByID(ctx, id)
+	default:
+		return c.DeleteConditionByID(ctx, id, org)
+	}
+}
+
+// runUsage writes the number of roles, orgs and users each policy with an ID in args is used by
+func runUsage(ctx context.Context, c client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: policies usage requires policy IDs", errUsage)
+	}
+	us := make([]*datastore.PolicyUsage, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("%w: bad ID %q", errUsage, arg)
+		}
+		if us[i], err = c.GetPolicyUsage(ctx, id); err != nil {
+			return err
+		}
+	}
+	return p.usage(us)
+}
+
+// showUsage reports how widely the policy with the given ID is used before it's edited or deleted
+func showUsage(ctx context.Context, c client, p *printer, id int) error {
+	u, err := c.GetPolicyUsage(ctx, id)
+	if err != nil {
+		return err
+	}
+	p.done("policy %d is attached to %d roles in %d orgs, bound to %d users", id, u.Roles, u.Orgs, u.Users)
+	return nil
+}
+
+// runBind binds or unbinds a role to a user or org, a policy to a role or a condition to a policy
+func runBind(ctx context.Context, c client, p *printer, bind bool, args []string) error {
+	fs := flag.NewFlagSet("bind", flag.ContinueOnError)
+	user := fs.Int("user", 0, "user ID")
+	org := fs.Int("org", -1, "org ID")
+	role := fs.Int("role", 0, "role ID")
+	policy := fs.Int("policy", 0, "policy ID")
+	notBefore := fs.String("not-before", "", "RFC 3339 time a role binding starts at")
+	expiresAt := fs.String("expires-at", "", "RFC 3339 time a role binding expires at")
+	expiresIn := fs.Duration("expires-in", 0, "duration until a role binding expires")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		return fmt.Errorf("%w: bind requires role, policy or condition", errUsage)
+	}
+	w, err := window(*notBefore, *expiresAt, *expiresIn)
+	if err != nil {
+		return err
+	}
+	id, err := idArg(pos[1:])
+	if err != nil {
+		return err
+	}
+
+	var target string
+	var targetID int
+	switch pos[0] {
+	case "role":
+		if *org >= 0 {
+			target, targetID = "org", *org
+			if bind {
+				err = c.BindOrgRole(ctx, *org, id)
+			} else {
+				err = c.UnbindOrgRole(ctx, *org, id)
+			}
+			break
+		}
+		target, targetID = "user", *user
+		if bind {
+			err = c.BindUserRole(ctx, *user, id, w)
+		} else {
+			err = c.UnbindUserRole(ctx, *user, id)
+		}
+	case "policy":
+		target, targetID = "role", *role
+		if bind {
+			err = c.AttachRolePolicy(ctx, *role, id)
+		} else {
+			err = c.DetachRolePolicy(ctx, *role, id)
+		}
+	case "condition":
+		target, targetID = "policy", *policy
+		if bind {
+			err = c.AttachPolicyCondition(ctx, *policy, id)
+		} else {
+			err = c.DetachPolicyCondition(ctx, *policy, id)
+		}
+	default:
+		return fmt.Errorf("%w: can't bind %q", errUsage, pos[0])
+	}
+	if err != nil {
+		return err
+	}
+	if bind {
+		p.done("bound %s %d to %s %d", pos[0], id, target, targetID)
+	} else {
+		p.done("unbound %s %d from %s %d", pos[0], id, target, targetID)
+	}
+	return nil
+}
+
+// window returns the window a role binding is effective in from the RFC 3339 times notBefore and expiresAt, or the
+// duration expiresIn from now
+func window(notBefore, expiresAt string, expiresIn time.Duration) (datastore.Window, error) {
+	var w datastore.Window
+	if expiresAt != "" && expiresIn != 0 {
+		return w, fmt.Errorf("%w: only one of --expires-at and --expires-in can be given", errUsage)
+	}
+	for _, t := range []struct {
+		value string
+		dst   **time.Time
+	}{{notBefore, &w.NotBefore}, {expiresAt, &w.ExpiresAt}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return w, fmt.Errorf("%w: bad time %q, expected RFC 3339", errUsage, t.value)
+		}
+		*t.dst = &parsed
+	}
+	if expiresIn != 0 {
+		exp := time.Now().Add(expiresIn)
+		w.ExpiresAt = &exp
+	}
+	return w, nil
+}
+
+func runAudit(ctx context.Context, c client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	org := fs.Int("org", 1, "org ID, ignored against the API")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return fmt.Errorf("%w: audit takes no arguments", errUsage)
+	}
+	es, err := c.ListAuditEvents(ctx, *org)
+	if err != nil {
+		return err
+	}
+	return p.auditEvents(es)
+}
+
+func runDecisions(ctx context.Context, c client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("decisions", flag.ContinueOnError)
+	org := fs.Int("org", 1, "org ID, ignored against the API")
+	user := fs.Int("user", 0, "only list the decisions of this user ID")
+	window := fs.Duration("window", 24*time.Hour, "how far back to list decisions")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return fmt.Errorf("%w: decisions takes no arguments", errUsage)
+	}
+	ds, err := c.ListDecisions(ctx, datastore.DecisionFilter{OrgID: *org, UserID: *user, Since: time.Now().Add(-*window)})
+	if err != nil {
+		return err
+	}
+	return p.decisions(ds)
+}
+
+// runActions lists the actions in the catalog, of every resource type or just --type
+func runActions(p *printer, args []string) error {
+	fs := flag.NewFlagSet("actions", flag.ContinueOnError)
+	rType := fs.String("type", "", "only list the actions of this resource type")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return fmt.Errorf("%w: actions takes no arguments", errUsage)
+	}
+	types := catalog.Default.Types()
+	if *rType != "" {
+		if catalog.Default.Actions(*rType) == nil {
+			return fmt.Errorf("%w: resource type %q isn't in the catalog", errUsage, *rType)
+		}
+		types = []string{*rType}
+	}
+	return p.actions(catalog.Default, types)
+}
+
+func runUnused(ctx context.Context, c client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("unused", flag.ContinueOnError)
+	org := fs.Int("org", 1, "org ID, ignored against the API")
+	days := fs.Int("days", 90, "list what hasn't been used for this many days")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || *days <= 0 {
+		return fmt.Errorf("%w: unused takes no arguments and a positive --days", errUsage)
+	}
+	unused, err := c.ListUnused(ctx, *org, time.Now().AddDate(0, 0, -*days))
+	if err != nil {
+		return err
+	}
+	return p.unused(unused)
+}
+
+func runRecommend(ctx context.Context, c client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("recommend", flag.ContinueOnError)
+	user := fs.Int("user", 0, "user ID to recommend policies for")
+	role := fs.Int("role", 0, "role ID to recommend policies for")
+	window := fs.Duration("window", 30*24*time.Hour, "how far back to look at the access used")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 || (*user == 0) == (*role == 0) {
+		return fmt.Errorf("%w: recommend requires one of --user or --role", errUsage)
+	}
+
+	var rec *iam.Recommendation
+	if *user != 0 {
+		rec, err = c.RecommendForUser(ctx, *user, *window)
+	} else {
+		rec, err = c.RecommendForRole(ctx, *role, *window)
+	}
+	if err != nil {
+		return err
+	}
+	return p.recommendation(rec)
+}
+
+func runPermissions(ctx context.Context, c client, p *printer, args []string) error {
+	id, err := idArg(args)
+	if err != nil {
+		return err
+	}
+	perms, err := c.EffectivePerms(ctx, id)
+	if err != nil {
+		return err
+	}
+	return p.permissions(perms)
+}
+
+func runExplain(ctx context.Context, c client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	var attrs attrFlag
+	fs.Var(&attrs, "attr", "resource attribute as KEY=VALUE, may be repeated")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 3 {
+		return fmt.Errorf("%w: explain requires a user ID, action and resource name", errUsage)
+	}
+	id, err := idArg(pos[:1])
+	if err != nil {
+		return err
+	}
+
+	exp, err := c.Explain(ctx, id, pos[1], pos[2], attrs)
+	if err != nil {
+		return err
+	}
+	return p.explanation(exp)
+}
+
+func runWhoCan(ctx context.Context, c client, p *printer, args []string) error {
+	fs := flag.NewFlagSet("who-can", flag.ContinueOnError)
+	org := fs.Int("org", 1, "org ID, ignored against the API")
+	var attrs attrFlag
+	fs.Var(&attrs, "attr", "resource attribute as KEY=VALUE, may be repeated")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 2 {
+		return fmt.Errorf("%w: who-can requires an action and resource name", errUsage)
+	}
+
+	ps, err := c.WhoCan(ctx, *org, pos[0], pos[1], attrs)
+	if err != nil {
+		return err
+	}
+	return p.principals(ps)
+}
+
+// idArg parses the single ID in args
+func idArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%w: expected an ID", errUsage)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad ID %q", errUsage, args[0])
+	}
+	return id, nil
+}
+
+// singular returns the name of a single resource of the type named by cmd
+func singular(cmd string) string {
+	if cmd == "policies" {
+		return "policy"
+	}
+	return strings.TrimSuffix(cmd, "s")
+}
+
+// attrFlag collects repeated KEY=VALUE flags
+type attrFlag map[string]string
+
+func (a *attrFlag) String() string {
+	return fmt.Sprint(map[string]string(*a))
+}
+
+func (a *attrFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("attribute %q is not KEY=VALUE", s)
+	}
+	if *a == nil {
+		*a = attrFlag{}
+	}
+	(*a)[k] = v
+	return nil
+}
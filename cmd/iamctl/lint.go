@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+)
+
+var errLintFailed = errors.New("lint found errors")
+
+// runLint lints the policies of an org, a role or a user, or lists the lint rules.  It returns errLintFailed after
+// printing the findings if any of them are errors.
+func runLint(ctx context.Context, c client, p *printer, args []string) error {
+	if len(args) > 0 && args[0] == "rules" {
+		if len(args) != 1 {
+			return fmt.Errorf("%w: lint rules takes no arguments", errUsage)
+		}
+		return p.lintRules(iam.LintRules)
+	}
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	org := fs.Int("org", 1, "org ID to lint, ignored against the API")
+	role := fs.Int("role", 0, "role ID to lint")
+	user := fs.Int("user", 0, "user ID to lint the roles of")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return fmt.Errorf("%w: lint takes no arguments", errUsage)
+	}
+	if *role != 0 && *user != 0 {
+		return fmt.Errorf("%w: lint takes one of --role or --user", errUsage)
+	}
+
+	var findings []iam.Finding
+	switch {
+	case *role != 0:
+		findings, err = c.LintRole(ctx, *role)
+	case *user != 0:
+		findings, err = c.LintUser(ctx, *user)
+	default:
+		findings, err = c.LintOrg(ctx, *org)
+	}
+	if err != nil {
+		return err
+	}
+	if err := p.findings(findings); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		if f.Severity == iam.SeverityError {
+			return errLintFailed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// iamctl manages the orgs, users, roles, policies and conditions of the IAM model, either directly in the database
+// or through the admin API of a running server.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	_ "github.com/lib/pq"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"go.uber.org/zap"
+	"io"
+	"os"
+)
+
+const defaultDSN = `dbname=oso-rbac-iam host=localhost user=oso password=ososecretpwd sslmode=disable`
+
+const usage = `usage: iamctl [flags] <command> [args]
+
+commands:
+  orgs       list | get <id> | create --name NAME [--parent ID] | delete <id>
+             move <id> [--parent ID] | roles <id>
+  users      list [--org ID] | get <id> | create --org ID --name NAME --api-key KEY | delete <id>
+  roles      list [--org ID | --user ID] | get <id> | create --org ID --name NAME | delete <id>
+  policies   list [--org ID | --role ID] | get <id> | delete <id>
+             create --name NAME --effect allow|deny (--actions A,B | --not-actions A,B) --resource NRN [--not-resources NRN,NRN]
+                    [--org ID] [--kind org|inline --inline-role ID]
+             import -f FILE [--name NAME] [--org ID] | export <id> [<id> ...] | usage <id> [<id> ...]
+             versions <id> | diff <id> [FROM [TO]] | rollback <id> | set-default <id> VERSION
+  conditions list [--policy ID] | get <id> | create --type TYPE --value VALUE | delete <id>
+  bind       role <id> (--user ID | --org ID) [--not-before TIME] [--expires-at TIME | --expires-in DURATION]
+             policy <id> --role ID | condition <id> --policy ID
+  unbind     role <id> (--user ID | --org ID) | policy <id> --role ID | condition <id> --policy ID
+  permissions <userID>
+  explain    <userID> <action> <nrn> [--attr KEY=VALUE ...]
+  who-can    <action> <nrn> [--attr KEY=VALUE ...] [--org ID]
+  lint       [--org ID | --role ID | --user ID] | rules
+  actions    [--type TYPE]
+  audit      [--org ID]
+  decisions  [--org ID] [--user ID] [--window DURATION]
+  recommend  (--user ID | --role ID) [--window DURATION]
+  unused     [--org ID] [--days N]
+  access     request (--role ID | --action A --resource NRN) --justification TEXT [--duration D] [--user ID]
+             list [--org ID] [--status S] | get <id> | approve <id> | deny <id> | cancel <id> [--reason TEXT] [--user ID]
+  plan       -f FILE|DIR [-f ...] [--prune]
+  apply      -f FILE|DIR [-f ...] [--prune]
+
+Against the API, orgs can't be created or deleted and users and roles are always those of the API key's org.
+orgs move makes an org an organizational unit of --parent, or a root without it.  Roles bound to an org with
+bind role --org apply to every user of the org and its descendants.
+plan, apply and policies import require the database.  Policies are imported and exported as AWS IAM style JSON.
+policies diff compares the default version with the one before it unless versions are given.
+Managed policies are shared by every org and read-only.  policies delete, rollback and set-default first report how
+many roles, orgs and users the policy is used by.
+Role bindings given --expires-at or --expires-in stop applying then, and are deleted by the server's sweeper.
+lint exits non-zero if any finding is an error.
+recommend proposes least privilege allow policies from the decisions recorded over --window, default 30 days.
+unused lists the roles, policies and API keys that haven't contributed to an allowed decision for --days, default 90.
+Access requests are made and decided by the API key's user, or against the database by --user.  Approved requests
+bind their role, or a role allowing their action, until they expire.
+
+flags:
+`
+
+var (
+	errUsage          = errors.New("invalid usage")
+	errSyncRequiresDB = errors.New("policy files can only be planned, applied and imported against the database")
+)
+
+func main() {
+	fs := flag.NewFlagSet("iamctl", flag.ContinueOnError)
+	dsn := fs.String("db", defaultDSN, "postgres connection string")
+	apiURL := fs.String("api", "", "base URL of the server's admin API, instead of the database")
+	apiKey := fs.String("api-key", os.Getenv("IAMCTL_API_KEY"), "API key for the admin API, defaults to $IAMCTL_API_KEY")
+	policy := fs.String("policy", "", "polar policy to explain decisions with against the database, defaults to the native authorizer")
+	format := fs.String("o", "table", "output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	p, err := newPrinter(os.Stdout, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var c client
+	if *apiURL != "" {
+		c = newAPIClient(*apiURL, *apiKey)
+	} else {
+		c, err = newDBClient(*dsn, *policy)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := run(context.Background(), c, p, fs.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errUsage) {
+			fs.Usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// newDBClient connects to the database at dsn.  Decisions are explained with the polar policy file if one is given.
+func newDBClient(dsn, policy string) (*dbClient, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	logger := zap.NewNop().Sugar()
+	authz := iam.NewNativeAuthorizer()
+	if policy != "" {
+		o, err := iam.NewOso(policy)
+		if err != nil {
+			return nil, err
+		}
+		authz = iam.NewOsoAuthorizer(o)
+	}
+	return &dbClient{
+		Admin:  datastore.NewAdmin(db, logger),
+		Syncer: datastore.NewSyncer(db, logger),
+		ds:     datastore.NewDatastore(db, logger),
+		authz:  authz,
+	}, nil
+}
+
+// run executes the command in args with c, writing results to p
+func run(ctx context.Context, c client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "orgs", "users", "roles", "policies", "conditions":
+		if len(args) == 0 {
+			return fmt.Errorf("%w: %s requires list, get, create or delete", errUsage, cmd)
+		}
+		if cmd == "policies" && args[0] == "import" {
+			s, ok := c.(datastore.Syncer)
+			if !ok {
+				return errSyncRequiresDB
+			}
+			return runImport(ctx, s, p, args[1:])
+		}
+		if cmd == "policies" && args[0] == "export" {
+			return runExport(ctx, c, p, args[1:])
+		}
+		if cmd == "orgs" && isOrgVerb(args[0]) {
+			return runOrgs(ctx, c, p, args[0], args[1:])
+		}
+		if cmd == "policies" && args[0] == "usage" {
+			return runUsage(ctx, c, p, args[1:])
+		}
+		if cmd == "policies" && isVersionVerb(args[0]) {
+			return runVersions(ctx, c, p, args[0], args[1:])
+		}
+		return runResource(ctx, c, p, cmd, args[0], args[1:])
+	case "bind", "unbind":
+		return runBind(ctx, c, p, cmd == "bind", args)
+	case "permissions":
+		return runPermissions(ctx, c, p, args)
+	case "explain":
+		return runExplain(ctx, c, p, args)
+	case "who-can":
+		return runWhoCan(ctx, c, p, args)
+	case "lint":
+		return runLint(ctx, c, p, args)
+	case "actions":
+		return runActions(p, args)
+	case "audit":
+		return runAudit(ctx, c, p, args)
+	case "decisions":
+		return runDecisions(ctx, c, p, args)
+	case "recommend":
+		return runRecommend(ctx, c, p, args)
+	case "unused":
+		return runUnused(ctx, c, p, args)
+	case "access":
+		return runAccess(ctx, c, p, args)
+	case "plan", "apply":
+		s, ok := c.(datastore.Syncer)
+		if !ok {
+			return errSyncRequiresDB
+		}
+		return runSync(ctx, s, p, cmd == "apply", args)
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+	}
+}
+
+// parse parses args with fs, allowing flags to follow positional arguments, and returns the positional arguments
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		if fs.NArg() == 0 {
+			return pos, nil
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestAPI returns a client for an admin API that responds to each "METHOD path" in routes with its status and body
+func newTestAPI(t *testing.T, routes map[string]struct {
+	status int
+	body   string
+}) client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "admin", r.Header.Get("x-api-key"))
+		route, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+			return
+		}
+		w.WriteHeader(route.status)
+		_, _ = w.Write([]byte(route.body))
+	}))
+	t.Cleanup(srv.Close)
+	return newAPIClient(srv.URL+"/", "admin")
+}
+
+func Test_run(t *testing.T) {
+	t.Parallel()
+	c := newTestAPI(t, map[string]struct {
+		status int
+		body   string
+	}{
+		"GET /iam/users":                      {200, `[{"user_id":1,"name":"bob","org_id":1},{"user_id":2,"name":"tom","org_id":1}]`},
+		"GET /iam/roles":                      {200, `[]`},
+		"GET /iam/orgs":                       {200, `[{"org_id":0,"name":"Aperture Science","parent_id":null},{"org_id":10,"name":"Enrichment Center","parent_id":0}]`},
+		"PUT /iam/orgs/10/parent":             {200, `{"org_id":10,"name":"Enrichment Center","parent_id":12}`},
+		"GET /iam/orgs/10/roles":              {200, `[{"role_id":3,"name":"oncall","org_id":0}]`},
+		"PUT /iam/orgs/10/roles/3":            {204, ``},
+		"POST /iam/policies":                  {201, `{"policy_id":7,"name":"viewZones","effect":"allow","actions":["view"],"resource_name":"oso:0:zone/*","kind":"org"}`},
+		"DELETE /iam/roles/3":                 {204, ``},
+		"PUT /iam/users/2/roles/3":            {204, ``},
+		"GET /iam/users/2/roles":              {200, `[{"role_id":3,"name":"oncall","org_id":1,"user_id":2,"expires_at":"2021-11-02T10:00:00Z"},{"role_id":4,"name":"viewer","org_id":1,"user_id":2}]`},
+		"GET /iam/audit-events":               {200, `[{"event_id":1,"occurred_at":"2021-11-02T10:00:30Z","type":"RoleBindingExpired","org_id":1,"user_id":2,"role_id":3,"detail":"expired"}]`},
+		"GET /iam/users/1/permissions":        {200, `{"Namespaces":{"zone":["oso:0:zone/*"]},"AllowPolicies":{"oso:0:zone/*":{"1":{"ID":1,"Effect":"allow","Actions":["view"],"Resource":"oso:0:zone/*","Conditions":{"1":{"Type":"matchSuffix","Value":"com","ID":1}}}}},"DenyPolicies":{}}`},
+		"GET /iam/policies/5":                 {200, `{"policy_id":5,"name":"viewComZones","effect":"allow","actions":["view"],"resource_name":"oso:0:zone/*"}`},
+		"GET /iam/policies/8":                 {200, `{"policy_id":8,"name":"denyAllButGmail","kind":"org","effect":"deny","not_actions":["view"],"resource_name":"oso:0:zone/*","not_resource_names":["oso:0:zone/gmail.com"]}`},
+		"GET /iam/policies/5/usage":           {200, `{"policy_id":5,"roles":2,"orgs":1,"users":3}`},
+		"GET /iam/policies/5/conditions":      {200, `[{"condition_id":1,"type":"matchSuffix","value":"com"}]`},
+		"GET /iam/policies/5/versions":        {200, `[{"policy_id":5,"version":1,"effect":"allow","actions":["view"],"resource_name":"oso:0:zone/*","conditions":[],"created_at":"2021-11-01T10:00:00Z","is_default":false},{"policy_id":5,"version":2,"effect":"allow","actions":["view"],"resource_name":"oso:0:zone/*","conditions":[{"type":"matchSuffix","value":"com"}],"created_at":"2021-11-02T10:00:00Z","is_default":true}]`},
+		"POST /iam/policies/5/rollback":       {200, `{"policy_id":5,"version":1,"effect":"allow","actions":["view"],"resource_name":"oso:0:zone/*","conditions":[],"created_at":"2021-11-01T10:00:00Z","is_default":true}`},
+		"POST /iam/access-requests":           {201, `{"request_id":4,"org_id":1,"user_id":2,"role_id":3,"duration_seconds":7200,"justification":"incident","status":"pending","created_at":"2021-11-02T10:00:00Z"}`},
+		"GET /iam/access-requests":            {200, `[{"request_id":5,"org_id":1,"user_id":2,"action":"delete","resource_name":"oso:0:zone/foo.com","duration_seconds":600,"justification":"cleanup","status":"approved","created_at":"2021-11-02T10:00:00Z","decider_id":1,"expires_at":"2021-11-02T10:10:00Z","grant_role_id":6},{"request_id":4,"org_id":1,"user_id":2,"role_id":3,"duration_seconds":7200,"justification":"incident","status":"pending","created_at":"2021-11-02T10:00:00Z"}]`},
+		"POST /iam/access-requests/4/approve": {200, `{"request_id":4,"org_id":1,"user_id":2,"role_id":3,"duration_seconds":7200,"justification":"incident","status":"approved","created_at":"2021-11-02T10:00:00Z","decider_id":1,"expires_at":"2021-11-02T12:00:00Z","grant_role_id":3}`},
+		"POST /iam/who-can":                   {200, `[{"user_id":2,"name":"tom","grants":[{"role_id":2,"role":"deleteZonesAndViewOne","policy_id":4,"policy":"deleteZones"}]},{"user_id":4,"name":"admin","grants":[{"role_id":4,"role":"iamAdmin","policy_id":6,"policy":"manageOrg"},{"role_id":6,"role":"accessApprover","policy_id":9,"policy":"approveIncidentAccess"}]}]`},
+		"GET /iam/lint":                       {200, `[{"rule":"IAM001","severity":"error","role_id":4,"role":"iamAdmin","policy_id":6,"message":"policy 6 allows all actions on oso:0:zone/*"}]`},
+		"GET /iam/roles/5/lint":               {200, `[{"rule":"IAM004","severity":"warning","role_id":5,"role":"accessRequester","policy_id":7,"message":"policy 7 on oso:0:zone/incident.io matches no zone"}]`},
+		"GET /iam/unused":                     {200, `[{"kind":"api_key","id":2,"name":"tom","last_used_at":"2021-07-01T09:00:00Z"},{"kind":"role","id":3,"name":"viewZonesRole"}]`},
+		"GET /iam/decisions":                  {200, `[{"decision_id":2,"occurred_at":"2021-11-01T12:00:00Z","org_id":0,"user_id":2,"action":"delete","resource_name":"oso:0:zone/gmail.com","allowed":false,"policy_ids":[]},{"decision_id":1,"occurred_at":"2021-11-01T11:00:00Z","org_id":0,"user_id":2,"action":"view","resource_name":"oso:0:zone/react.net","allowed":true,"policy_ids":[3,4]}]`},
+		"GET /iam/users/2/recommendation":     {200, `{"since":"2021-10-02T12:00:00Z","used":[{"action":"view","resource_name":"oso:0:zone/react.net"}],"policies":[{"name":"tom-least-privilege-1","effect":"allow","actions":["view"],"resource":"oso:0:zone/react.net"}],"added":[{"name":"tom-least-privilege-1","effect":"allow","actions":["view"],"resource":"oso:0:zone/react.net"}],"removed":[{"name":"deleteZones","effect":"allow","actions":["delete"],"resource":"oso:0:zone/*","conditions":[{"type":"matchSuffix","value":"net"}]}]}`},
+		"GET /iam/users/2/lint":               {200, `[]`},
+		"POST /iam/users/1/explain":           {200, `{"decision":"allow","evaluations":[{"policy":{"ID":1,"Effect":"allow","Actions":["view"],"Resource":"oso:0:zone/*"},"covers_resource":true,"permits_action":true,"conditions_hold":true}]}`},
+	})
+
+	tests := []struct {
+		name   string
+		args   []string
+		format string
+		exp    string
+		expErr string
+	}{
+		{
+			name: "list users",
+			args: []string{"users", "list"},
+			exp: "ID  NAME  ORG  API KEY\n" +
+				"1   bob   1    \n" +
+				"2   tom   1    \n",
+		},
+		{
+			name:   "empty list as json",
+			args:   []string{"roles", "list"},
+			format: "json",
+			exp:    "[]\n",
+		},
+		{
+			name: "create policy",
+			args: []string{"policies", "create", "--name", "viewZones", "--effect", "allow", "--actions", "view", "--resource", "oso:0:zone/*"},
+			exp: "ID  NAME       KIND  EFFECT  ACTIONS  RESOURCE\n" +
+				"7   viewZones  org   allow   view     oso:0:zone/*\n",
+		},
+		{
+			name: "get policy with exclusions",
+			args: []string{"policies", "get", "8"},
+			exp: "ID  NAME             KIND  EFFECT  ACTIONS        RESOURCE\n" +
+				"8   denyAllButGmail  org   deny    * except view  oso:0:zone/* except oso:0:zone/gmail.com\n",
+		},
+		{
+			name: "delete role",
+			args: []string{"roles", "delete", "3"},
+			exp:  "deleted role 3\n",
+		},
+		{
+			name: "bind role with flag after id",
+			args: []string{"bind", "role", "3", "--user", "2"},
+			exp:  "bound role 3 to user 2\n",
+		},
+		{
+			name: "list orgs",
+			args: []string{"orgs", "list"},
+			exp: "ID  NAME               PARENT\n" +
+				"0   Aperture Science   -\n" +
+				"10  Enrichment Center  0\n",
+		},
+		{
+			name: "move org",
+			args: []string{"orgs", "move", "10", "--parent", "12"},
+			exp:  "moved org 10 under org 12\n",
+		},
+		{
+			name: "list org roles",
+			args: []string{"orgs", "roles", "10"},
+			exp:  "ID  NAME    ORG\n" + "3   oncall  0\n",
+		},
+		{
+			name: "bind role to org",
+			args: []string{"bind", "role", "3", "--org", "10"},
+			exp:  "bound role 3 to org 10\n",
+		},
+		{
+			name: "bind role until",
+			args: []string{"bind", "role", "3", "--user", "2", "--expires-at", "2099-01-01T00:00:00Z"},
+			exp:  "bound role 3 to user 2\n",
+		},
+		{
+			name:   "bind role with bad expiry",
+			args:   []string{"bind", "role", "3", "--user", "2", "--expires-at", "tomorrow"},
+			expErr: `invalid usage: bad time "tomorrow", expected RFC 3339`,
+		},
+		{
+			name:   "bind role with expiry twice",
+			args:   []string{"bind", "role", "3", "--user", "2", "--expires-at", "2099-01-01T00:00:00Z", "--expires-in", "1h"},
+			expErr: "invalid usage: only one of --expires-at and --expires-in can be given",
+		},
+		{
+			name: "list user roles with expiry",
+			args: []string{"roles", "list", "--user", "2"},
+			exp: "ID  NAME    ORG  NOT BEFORE  EXPIRES\n" +
+				"3   oncall  1    -           2021-11-02T10:00:00Z\n" +
+				"4   viewer  1    -           -\n",
+		},
+		{
+			name: "audit events",
+			args: []string{"audit"},
+			exp: "ID  TIME                  TYPE                USER  ROLE  DETAIL\n" +
+				"1   2021-11-02T10:00:30Z  RoleBindingExpired  2     3     expired\n",
+		},
+		{
+			name: "request access",
+			args: []string{"access", "request", "--role", "3", "--duration", "2h", "--justification", "incident"},
+			exp:  "requested access 4\n",
+		},
+		{
+			name: "list access requests",
+			args: []string{"access", "list"},
+			exp: "ID  USER  REQUESTED                  DURATION  STATUS    EXPIRES               JUSTIFICATION\n" +
+				"5   2     delete oso:0:zone/foo.com  10m0s     approved  2021-11-02T10:10:00Z  cleanup\n" +
+				"4   2     role 3                     2h0m0s    pending   -                     incident\n",
+		},
+		{
+			name: "approve access request",
+			args: []string{"access", "approve", "4", "--reason", "paged"},
+			exp:  "approved access request 4\n",
+		},
+		{
+			name:   "unknown access subcommand",
+			args:   []string{"access", "grant", "4"},
+			expErr: `invalid usage: unknown access subcommand "grant"`,
+		},
+		{
+			name: "who can",
+			args: []string{"who-can", "delete", "oso:0:zone/react.net"},
+			exp: "USER  NAME   ROLE ID  ROLE                   POLICY ID  POLICY\n" +
+				"2     tom    2        deleteZonesAndViewOne  4          deleteZones\n" +
+				"4     admin  4        iamAdmin               6          manageOrg\n" +
+				"4     admin  6        accessApprover         9          approveIncidentAccess\n",
+		},
+		{
+			name:   "who can without resource",
+			args:   []string{"who-can", "delete"},
+			expErr: "invalid usage: who-can requires an action and resource name",
+		},
+		{
+			name: "lint role",
+			args: []string{"lint", "--role", "5"},
+			exp: "RULE    SEVERITY  ROLE ID  ROLE             POLICY  MESSAGE\n" +
+				"IAM004  warning   5        accessRequester  7       policy 7 on oso:0:zone/incident.io matches no zone\n",
+		},
+		{
+			name:   "lint user",
+			args:   []string{"lint", "--user", "2"},
+			format: "json",
+			exp:    "[]\n",
+		},
+		{
+			name:   "lint org with errors",
+			args:   []string{"lint"},
+			expErr: errLintFailed.Error(),
+		},
+		{
+			name:   "lint role and user",
+			args:   []string{"lint", "--role", "5", "--user", "2"},
+			expErr: "invalid usage: lint takes one of --role or --user",
+		},
+		{
+			name: "zone actions",
+			args: []string{"actions", "--type", "zone"},
+			exp: "TYPE  ACTION             ACCESS LEVEL            IMPLIES       ALIASES  DESCRIPTION\n" +
+				"zone  zone:GetZone       read                                  view     View a zone\n" +
+				"zone  zone:DeleteZone    write                   zone:GetZone  delete   Delete a zone\n" +
+				"zone  iam:RequestAccess  write                                          Request temporary access to the role or resource\n" +
+				"zone  iam:ApproveAccess  permissions-management                         Approve or deny requests for access to the role or resource\n",
+		},
+		{
+			name:   "actions of unknown type",
+			args:   []string{"actions", "--type", "incident"},
+			expErr: `invalid usage: resource type "incident" isn't in the catalog`,
+		},
+		{
+			name: "lint rules",
+			args: []string{"lint", "rules"},
+			exp: "RULE    SEVERITY  SUMMARY\n" +
+				"IAM001  error     allows all actions on all resources\n" +
+				"IAM002  warning   allow is shadowed by a deny\n" +
+				"IAM003  warning   duplicates another policy of the role\n" +
+				"IAM004  warning   matches no zone\n" +
+				"IAM005  error     condition type is unknown\n" +
+				"IAM006  error     action matches no action in the catalog\n",
+		},
+		{
+			name: "decisions",
+			args: []string{"decisions", "--user", "2"},
+			exp: "ID  TIME                  USER  ACTION  RESOURCE              DECISION  POLICIES\n" +
+				"2   2021-11-01T12:00:00Z  2     delete  oso:0:zone/gmail.com  deny      \n" +
+				"1   2021-11-01T11:00:00Z  2     view    oso:0:zone/react.net  allow     3,4\n",
+		},
+		{
+			name: "unused",
+			args: []string{"unused", "--days", "30"},
+			exp: "KIND     ID  NAME           LAST USED\n" +
+				"api_key  2   tom            2021-07-01T09:00:00Z\n" +
+				"role     3   viewZonesRole  never\n",
+		},
+		{
+			name:   "unused for no days",
+			args:   []string{"unused", "--days", "0"},
+			expErr: "invalid usage: unused takes no arguments and a positive --days",
+		},
+		{
+			name: "recommend for user",
+			args: []string{"recommend", "--user", "2"},
+			exp: "   NAME                   ACTIONS  RESOURCE              CONDITIONS\n" +
+				"+  tom-least-privilege-1  view     oso:0:zone/react.net  \n" +
+				"-  deleteZones            delete   oso:0:zone/*          matchSuffix=net\n",
+		},
+		{
+			name:   "recommend without principal",
+			args:   []string{"recommend", "--window", "1h"},
+			expErr: "invalid usage: recommend requires one of --user or --role",
+		},
+		{
+			name: "permissions",
+			args: []string{"permissions", "1"},
+			exp: "EFFECT  NAMESPACE     POLICY  ACTIONS  CONDITIONS\n" +
+				"allow   oso:0:zone/*  1       view     matchSuffix=com\n",
+		},
+		{
+			name: "explain",
+			args: []string{"explain", "1", "view", "oso:0:zone/gmail.com", "--attr", "env=prod"},
+			exp: "decision: allow\n" +
+				"POLICY  EFFECT  RESOURCE      COVERS  PERMITS  CONDITIONS  APPLIES\n" +
+				"1       allow   oso:0:zone/*  true    true     true        true\n",
+		},
+		{
+			name: "export policy",
+			args: []string{"policies", "export", "5"},
+			exp: `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "viewComZones",
+      "Effect": "Allow",
+      "Action": [
+        "view"
+      ],
+      "Resource": [
+        "arn:oso:iam::0:zone/*"
+      ],
+      "Condition": {
+        "StringLike": {
+          "oso:Name": [
+            "*com"
+          ]
+        }
+      }
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "policy versions",
+			args: []string{"policies", "versions", "5"},
+			exp: "VERSION  DEFAULT  EFFECT  ACTIONS  RESOURCE      CONDITIONS       CREATED\n" +
+				"1                 allow   view     oso:0:zone/*                   2021-11-01T10:00:00Z\n" +
+				"2        *        allow   view     oso:0:zone/*  matchSuffix=com  2021-11-02T10:00:00Z\n",
+		},
+		{
+			name: "diff default version",
+			args: []string{"policies", "diff", "5"},
+			exp:  "policy 5 version 1 -> 2:\n  conditions: [] -> [matchSuffix=com]\n",
+		},
+		{
+			name:   "diff missing version",
+			args:   []string{"policies", "diff", "5", "1", "3"},
+			expErr: "sql: no rows in result set",
+		},
+		{
+			name: "rollback",
+			args: []string{"policies", "rollback", "5"},
+			exp:  "policy 5 is attached to 2 roles in 1 orgs, bound to 3 users\nrolled back policy 5 to version 1\n",
+		},
+		{
+			name: "policy usage",
+			args: []string{"policies", "usage", "5"},
+			exp: "POLICY  ROLES  ORGS  USERS\n" +
+				"5       2      1     3\n",
+		},
+		{
+			name:   "set default without version",
+			args:   []string{"policies", "set-default", "5"},
+			expErr: "invalid usage: policies set-default requires a policy ID and version",
+		},
+		{
+			name:   "policies can't be imported through the api",
+			args:   []string{"policies", "import", "-f", "policy.json"},
+			expErr: errSyncRequiresDB.Error(),
+		},
+		{
+			name:   "api error",
+			args:   []string{"users", "get", "9"},
+			expErr: "GET /iam/users/9: not found",
+		},
+		{
+			name:   "orgs can't be created through the api",
+			args:   []string{"orgs", "create", "--name", "Black Mesa"},
+			expErr: errOrgsRequireDB.Error(),
+		},
+		{
+			name:   "policy files can't be applied through the api",
+			args:   []string{"apply", "-f", "policies"},
+			expErr: errSyncRequiresDB.Error(),
+		},
+		{
+			name:   "bad id",
+			args:   []string{"users", "get", "bob"},
+			expErr: `invalid usage: bad ID "bob"`,
+		},
+		{
+			name:   "unknown command",
+			args:   []string{"zones", "list"},
+			expErr: `invalid usage: unknown command "zones"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := tt.format
+			if format == "" {
+				format = "table"
+			}
+			var out bytes.Buffer
+			p, err := newPrinter(&out, format)
+			assert.NoError(t, err)
+
+			err = run(context.Background(), c, p, tt.args)
+			if tt.expErr != "" {
+				assert.EqualError(t, err, tt.expErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, out.String())
+		})
+	}
+}
+
+func Test_attrFlag(t *testing.T) {
+	t.Parallel()
+	var a attrFlag
+	assert.NoError(t, a.Set("env=prod"))
+	assert.NoError(t, a.Set("tier=a=b"))
+	assert.Equal(t, attrFlag{"env": "prod", "tier": "a=b"}, a)
+	assert.Error(t, a.Set("env"))
+	assert.True(t, strings.Contains(a.String(), "env:prod"))
+}
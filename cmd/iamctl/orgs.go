@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/volatiletech/null/v8"
+)
+
+// isOrgVerb returns true if verb is one of the orgs commands managing the org hierarchy
+func isOrgVerb(verb string) bool {
+	return verb == "move" || verb == "roles"
+}
+
+// runOrgs moves an org under a parent, or lists the roles bound to an org
+func runOrgs(ctx context.Context, c client, p *printer, verb string, args []string) error {
+	fs := flag.NewFlagSet("orgs "+verb, flag.ContinueOnError)
+	parent := fs.Int("parent", -1, "parent org ID, the org is made a root if not given")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	id, err := idArg(pos)
+	if err != nil {
+		return err
+	}
+
+	if verb == "roles" {
+		rs, err := c.ListOrgRoles(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.roles(rs)
+	}
+	var parentID null.Int
+	if *parent >= 0 {
+		parentID = null.IntFrom(*parent)
+	}
+	if err := c.MoveOrg(ctx, id, parentID); err != nil {
+		return err
+	}
+	if parentID.Valid {
+		p.done("moved org %d under org %d", id, parentID.Int)
+	} else {
+		p.done("made org %d a root", id)
+	}
+	return nil
+}
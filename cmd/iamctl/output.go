@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// printer writes command results as a table or as JSON
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{w: w, json: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// print writes v as JSON, or as a table of header and rows
+func (p *printer) print(v interface{}, header []string, rows [][]string) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+// done reports the success of a command without a result.  Nothing is written in JSON mode.
+func (p *printer) done(format string, a ...interface{}) {
+	if !p.json {
+		fmt.Fprintf(p.w, format+"\n", a...)
+	}
+}
+
+func (p *printer) orgs(os models.OrgSlice) error {
+	rows := make([][]string, len(os))
+	for i, o := range os {
+		parent := "-"
+		if o.ParentID.Valid {
+			parent = fmt.Sprint(o.ParentID.Int)
+		}
+		rows[i] = []string{fmt.Sprint(o.OrgID), o.Name, parent}
+	}
+	return p.print(nonNil(os), []string{"ID", "NAME", "PARENT"}, rows)
+}
+
+func (p *printer) users(us models.UserSlice) error {
+	rows := make([][]string, len(us))
+	for i, u := range us {
+		rows[i] = []string{fmt.Sprint(u.UserID), u.Name, fmt.Sprint(u.OrgID), u.APIKey}
+	}
+	return p.print(nonNil(us), []string{"ID", "NAME", "ORG", "API KEY"}, rows)
+}
+
+func (p *printer) roles(rs models.RoleSlice) error {
+	rows := make([][]string, len(rs))
+	for i, r := range rs {
+		rows[i] = []string{fmt.Sprint(r.RoleID), r.Name, fmt.Sprint(r.OrgID)}
+	}
+	return p.print(nonNil(rs), []string{"ID", "NAME", "ORG"}, rows)
+}
+
+// bindings writes the roles bound to a user and the window each binding is effective in
+func (p *printer) bindings(bs []*datastore.RoleBinding) error {
+	rows := make([][]string, len(bs))
+	for i, b := range bs {
+		rows[i] = []string{fmt.Sprint(b.RoleID), b.Name, fmt.Sprint(b.OrgID), formatTime(b.NotBefore), formatTime(b.ExpiresAt)}
+	}
+	return p.print(nonNil(bs), []string{"ID", "NAME", "ORG", "NOT BEFORE", "EXPIRES"}, rows)
+}
+
+func (p *printer) auditEvents(es []*datastore.AuditEvent) error {
+	rows := make([][]string, len(es))
+	for i, e := range es {
+		rows[i] = []string{fmt.Sprint(e.EventID), e.OccurredAt.Format(time.RFC3339), e.Type, fmt.Sprint(e.UserID), fmt.Sprint(e.RoleID), e.Detail}
+	}
+	return p.print(nonNil(es), []string{"ID", "TIME", "TYPE", "USER", "ROLE", "DETAIL"}, rows)
+}
+
+func (p *printer) decisions(ds []*datastore.Decision) error {
+	rows := make([][]string, len(ds))
+	for i, d := range ds {
+		decision := iam.EffectDeny
+		if d.Allowed {
+			decision = iam.EffectAllow
+		}
+		ids := make([]string, len(d.PolicyIDs))
+		for j, id := range d.PolicyIDs {
+			ids[j] = fmt.Sprint(id)
+		}
+		rows[i] = []string{
+			fmt.Sprint(d.DecisionID), d.OccurredAt.Format(time.RFC3339), fmt.Sprint(d.UserID), d.Action, d.ResourceName,
+			decision, strings.Join(ids, ","),
+		}
+	}
+	return p.print(nonNil(ds), []string{"ID", "TIME", "USER", "ACTION", "RESOURCE", "DECISION", "POLICIES"}, rows)
+}
+
+// unused writes the roles, policies and API keys unused, with when they were last used if they ever were
+func (p *printer) unused(us []*datastore.Unused) error {
+	rows := make([][]string, len(us))
+	for i, u := range us {
+		lastUsed := "never"
+		if u.LastUsedAt != nil {
+			lastUsed = u.LastUsedAt.Format(time.RFC3339)
+		}
+		rows[i] = []string{u.Kind, fmt.Sprint(u.ID), u.Name, lastUsed}
+	}
+	return p.print(nonNil(us), []string{"KIND", "ID", "NAME", "LAST USED"}, rows)
+}
+
+// recommendation writes the recommended policies, marking those added with + and followed by those removed marked
+// with -
+func (p *printer) recommendation(rec *iam.Recommendation) error {
+	added := map[string]bool{}
+	for _, a := range rec.Added {
+		added[a.Name] = true
+	}
+	var rows [][]string
+	row := func(change string, pol policyfile.Policy) {
+		rows = append(rows, []string{
+			change, pol.Name, strings.Join(pol.Actions, ","), pol.Resource,
+			formatVersionConditions(datastore.VersionConditions(pol.Conditions)),
+		})
+	}
+	for _, pol := range rec.Policies {
+		change := ""
+		if added[pol.Name] {
+			change = "+"
+		}
+		row(change, pol)
+	}
+	for _, pol := range rec.Removed {
+		row("-", pol)
+	}
+	return p.print(rec, []string{"", "NAME", "ACTIONS", "RESOURCE", "CONDITIONS"}, rows)
+}
+
+func (p *printer) accessRequests(rs []*datastore.AccessRequest) error {
+	rows := make([][]string, len(rs))
+	for i, r := range rs {
+		requested := r.Action + " " + r.ResourceName
+		if r.RoleID != 0 {
+			requested = fmt.Sprintf("role %d", r.RoleID)
+		}
+		rows[i] = []string{
+			fmt.Sprint(r.RequestID), fmt.Sprint(r.UserID), requested, (time.Duration(r.DurationSeconds) * time.Second).String(),
+			r.Status, formatTime(r.ExpiresAt), r.Justification,
+		}
+	}
+	return p.print(nonNil(rs), []string{"ID", "USER", "REQUESTED", "DURATION", "STATUS", "EXPIRES", "JUSTIFICATION"}, rows)
+}
+
+func (p *printer) policies(ps models.PolicySlice) error {
+	rows := make([][]string, len(ps))
+	for i, pol := range ps {
+		rows[i] = []string{
+			fmt.Sprint(pol.PolicyID), pol.Name, pol.Kind, pol.Effect, formatExcept(pol.Actions, pol.NotActions),
+			formatExcept([]string{pol.ResourceName}, pol.NotResourceNames),
+		}
+	}
+	return p.print(nonNil(ps), []string{"ID", "NAME", "KIND", "EFFECT", "ACTIONS", "RESOURCE"}, rows)
+}
+
+func (p *printer) usage(us []*datastore.PolicyUsage) error {
+	rows := make([][]string, len(us))
+	for i, u := range us {
+		rows[i] = []string{fmt.Sprint(u.PolicyID), fmt.Sprint(u.Roles), fmt.Sprint(u.Orgs), fmt.Sprint(u.Users)}
+	}
+	return p.print(us, []string{"POLICY", "ROLES", "ORGS", "USERS"}, rows)
+}
+
+func (p *printer) conditions(cs models.ConditionSlice) error {
+	rows := make([][]string, len(cs))
+	for i, c := range cs {
+		rows[i] = []string{fmt.Sprint(c.ConditionID), c.Type, c.Value}
+	}
+	return p.print(nonNil(cs), []string{"ID", "TYPE", "VALUE"}, rows)
+}
+
+// permissions writes a row per policy in perms, ordered by effect, namespace and policy ID
+func (p *printer) permissions(perms datastore.EffectivePerms) error {
+	var rows [][]string
+	for _, e := range []struct {
+		effect   string
+		policies datastore.PoliciesByNamespace
+	}{{iam.EffectAllow, perms.AllowPolicies}, {iam.EffectDeny, perms.DenyPolicies}} {
+		var namespaces []string
+		for ns := range e.policies {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+		for _, ns := range namespaces {
+			var ps []*roles.RolePolicy
+			for _, pol := range e.policies[ns] {
+				ps = append(ps, pol)
+			}
+			sort.Slice(ps, func(i, j int) bool { return ps[i].ID < ps[j].ID })
+			for _, pol := range ps {
+				rows = append(rows, []string{e.effect, ns, fmt.Sprint(pol.ID), formatExcept(pol.Actions, pol.NotActions), formatConditions(pol)})
+			}
+		}
+	}
+	return p.print(perms, []string{"EFFECT", "NAMESPACE", "POLICY", "ACTIONS", "CONDITIONS"}, rows)
+}
+
+// principals writes a row per grant allowing each principal
+func (p *printer) principals(ps []*iam.Principal) error {
+	var rows [][]string
+	for _, pr := range ps {
+		for _, g := range pr.Grants {
+			rows = append(rows, []string{
+				fmt.Sprint(pr.UserID), pr.Name, fmt.Sprint(g.RoleID), g.Role, fmt.Sprint(g.PolicyID), g.Policy,
+			})
+		}
+	}
+	return p.print(nonNil(ps), []string{"USER", "NAME", "ROLE ID", "ROLE", "POLICY ID", "POLICY"}, rows)
+}
+
+func (p *printer) findings(fs []iam.Finding) error {
+	rows := make([][]string, len(fs))
+	for i, f := range fs {
+		rows[i] = []string{f.Rule, f.Severity, fmt.Sprint(f.RoleID), f.Role, fmt.Sprint(f.PolicyID), f.Message}
+	}
+	return p.print(nonNil(fs), []string{"RULE", "SEVERITY", "ROLE ID", "ROLE", "POLICY", "MESSAGE"}, rows)
+}
+
+func (p *printer) lintRules(rs []iam.LintRule) error {
+	rows := make([][]string, len(rs))
+	for i, r := range rs {
+		rows[i] = []string{r.ID, r.Severity, r.Summary}
+	}
+	return p.print(rs, []string{"RULE", "SEVERITY", "SUMMARY"}, rows)
+}
+
+// actions writes the catalog's actions of each of types
+func (p *printer) actions(c *catalog.Catalog, types []string) error {
+	byType := map[string][]catalog.Action{}
+	var rows [][]string
+	for _, t := range types {
+		byType[t] = c.Actions(t)
+		for _, a := range c.Actions(t) {
+			rows = append(rows, []string{
+				t, a.Name, string(a.AccessLevel), strings.Join(a.Implies, ","), strings.Join(a.Aliases, ","), a.Description,
+			})
+		}
+	}
+	return p.print(byType, []string{"TYPE", "ACTION", "ACCESS LEVEL", "IMPLIES", "ALIASES", "DESCRIPTION"}, rows)
+}
+
+func (p *printer) explanation(exp *iam.Explanation) error {
+	if p.json {
+		return p.print(exp, nil, nil)
+	}
+	fmt.Fprintf(p.w, "decision: %s\n", exp.Decision)
+	rows := make([][]string, len(exp.Evaluations))
+	for i, pe := range exp.Evaluations {
+		rows[i] = []string{
+			fmt.Sprint(pe.Policy.ID), pe.Policy.Effect, string(pe.Policy.Resource),
+			fmt.Sprint(pe.CoversResource), fmt.Sprint(pe.PermitsAction), fmt.Sprint(pe.ConditionsHold), fmt.Sprint(pe.Applies()),
+		}
+	}
+	return p.print(exp, []string{"POLICY", "EFFECT", "RESOURCE", "COVERS", "PERMITS", "CONDITIONS", "APPLIES"}, rows)
+}
+
+func (p *printer) versions(vs []*datastore.PolicyVersion) error {
+	rows := make([][]string, len(vs))
+	for i, v := range vs {
+		def := ""
+		if v.IsDefault {
+			def = "*"
+		}
+		rows[i] = []string{
+			fmt.Sprint(v.Version), def, v.Effect, formatExcept(v.Actions, v.NotActions),
+			formatExcept([]string{v.ResourceName}, v.NotResourceNames),
+			formatVersionConditions(v.Conditions), v.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	return p.print(nonNil(vs), []string{"VERSION", "DEFAULT", "EFFECT", "ACTIONS", "RESOURCE", "CONDITIONS", "CREATED"}, rows)
+}
+
+func (p *printer) diff(d *datastore.PolicyVersionDiff) error {
+	if p.json {
+		return p.print(d, nil, nil)
+	}
+	fmt.Fprintf(p.w, "policy %d version %d -> %d:\n", d.PolicyID, d.From, d.To)
+	if len(d.Changes) == 0 {
+		fmt.Fprintln(p.w, "  no changes")
+	}
+	for _, c := range d.Changes {
+		fmt.Fprintf(p.w, "  %s\n", c)
+	}
+	return nil
+}
+
+func (p *printer) plans(plans []*policyfile.Plan) error {
+	if p.json {
+		return p.print(plans, nil, nil)
+	}
+	for _, plan := range plans {
+		fmt.Fprint(p.w, plan)
+	}
+	return nil
+}
+
+// formatConditions formats the conditions of p in ID order
+func formatConditions(p *roles.RolePolicy) string {
+	var ids []int
+	for id := range p.Conditions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	conds := make([]string, len(ids))
+	for i, id := range ids {
+		conds[i] = fmt.Sprintf("%s=%v", p.Conditions[id].Type, p.Conditions[id].Value)
+	}
+	return strings.Join(conds, ",")
+}
+
+// formatExcept joins items, followed by the items excepted from them.  Items default to * when only exceptions are
+// given.
+func formatExcept(items, except []string) string {
+	s := strings.Join(items, ",")
+	if len(except) == 0 {
+		return s
+	}
+	if s == "" {
+		s = "*"
+	}
+	return s + " except " + strings.Join(except, ",")
+}
+
+func formatVersionConditions(cs datastore.VersionConditions) string {
+	conds := make([]string, len(cs))
+	for i, c := range cs {
+		conds[i] = c.String()
+	}
+	return strings.Join(conds, ",")
+}
+
+// formatTime formats t as RFC 3339, or as - if it's nil
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// nonNil returns an empty slice in place of a nil one so empty lists are encoded as []
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"strings"
+)
+
+// runSync plans the changes that make the database match the policy files in args, applying them if apply is true
+func runSync(ctx context.Context, s datastore.Syncer, p *printer, apply bool, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	var files filesFlag
+	fs.Var(&files, "f", "policy file or directory of policy files, may be repeated")
+	prune := fs.Bool("prune", false, "delete users, roles and policies of the org that aren't in the policy files")
+	pos, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 || len(pos) != 0 {
+		return fmt.Errorf("%w: plan and apply require policy files", errUsage)
+	}
+
+	docs, err := policyfile.LoadFiles(files...)
+	if err != nil {
+		return err
+	}
+	plans := make([]*policyfile.Plan, len(docs))
+	for i, d := range docs {
+		current, err := s.LoadDocument(ctx, d.Org)
+		if err != nil {
+			return err
+		}
+		if plans[i], err = policyfile.NewPlan(current, d, *prune); err != nil {
+			return fmt.Errorf("org %q: %w", d.Org, err)
+		}
+	}
+
+	if err := p.plans(plans); err != nil {
+		return err
+	}
+	if !apply {
+		return nil
+	}
+	for _, plan := range plans {
+		if plan.Empty() {
+			continue
+		}
+		if err := s.Apply(ctx, plan); err != nil {
+			return fmt.Errorf("org %q: %w", plan.Org, err)
+		}
+		p.done("applied %d changes to org %s", len(plan.Changes), plan.Org)
+	}
+	return nil
+}
+
+// filesFlag collects repeated file flags
+type filesFlag []string
+
+func (f *filesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *filesFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
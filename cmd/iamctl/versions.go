@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"strconv"
+)
+
+// runVersions runs the policies subcommand verb, which manages the versions of a policy
+func runVersions(ctx context.Context, c client, p *printer, verb string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: policies %s requires a policy ID", errUsage, verb)
+	}
+	id, err := idArg(args[:1])
+	if err != nil {
+		return err
+	}
+	versions, err := versionArgs(args[1:])
+	if err != nil {
+		return err
+	}
+
+	if (verb == "versions" || verb == "rollback") && len(versions) > 0 {
+		return fmt.Errorf("%w: policies %s only takes a policy ID", errUsage, verb)
+	}
+
+	switch verb {
+	case "versions":
+		vs, err := c.ListPolicyVersions(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.versions(vs)
+	case "diff":
+		if len(versions) > 2 {
+			return fmt.Errorf("%w: policies diff takes at most two versions", errUsage)
+		}
+		versions = append(versions, 0, 0)
+		vs, err := c.ListPolicyVersions(ctx, id)
+		if err != nil {
+			return err
+		}
+		d, err := datastore.DiffPolicyVersions(vs, versions[0], versions[1])
+		if err != nil {
+			return err
+		}
+		return p.diff(d)
+	case "rollback":
+		if err := showUsage(ctx, c, p, id); err != nil {
+			return err
+		}
+		v, err := c.RollbackPolicy(ctx, id)
+		if err != nil {
+			return err
+		}
+		if p.json {
+			return p.print(v, nil, nil)
+		}
+		p.done("rolled back policy %d to version %d", id, v.Version)
+		return nil
+	default:
+		if len(versions) != 1 {
+			return fmt.Errorf("%w: policies set-default requires a policy ID and version", errUsage)
+		}
+		if err := showUsage(ctx, c, p, id); err != nil {
+			return err
+		}
+		if err := c.SetDefaultPolicyVersion(ctx, id, versions[0]); err != nil {
+			return err
+		}
+		p.done("set default version of policy %d to %d", id, versions[0])
+		return nil
+	}
+}
+
+func isVersionVerb(verb string) bool {
+	return verb == "versions" || verb == "diff" || verb == "rollback" || verb == "set-default"
+}
+
+// versionArgs parses the policy versions in args
+func versionArgs(args []string) ([]int, error) {
+	versions := make([]int, len(args))
+	for i, arg := range args {
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad version %q", errUsage, arg)
+		}
+		versions[i] = v
+	}
+	return versions, nil
+}
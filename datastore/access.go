@@ -0,0 +1,265 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"time"
+)
+
+// Access request statuses
+const (
+	AccessPending   = "pending"
+	AccessApproved  = "approved"
+	AccessDenied    = "denied"
+	AccessCancelled = "cancelled"
+	AccessExpired   = "expired"
+)
+
+// Audit event types of access requests
+const (
+	EventAccessRequestApproved  = "AccessRequestApproved"
+	EventAccessRequestDenied    = "AccessRequestDenied"
+	EventAccessRequestCancelled = "AccessRequestCancelled"
+	EventAccessRequestExpired   = "AccessRequestExpired"
+)
+
+// ErrBadTransition is returned when an access request can't move to a status from its current one
+var ErrBadTransition = errors.New("access request can't be decided")
+
+// accessTransitions is the statuses an access request may move to from each status
+var accessTransitions = map[string][]string{
+	AccessPending:  {AccessApproved, AccessDenied, AccessCancelled},
+	AccessApproved: {AccessExpired},
+}
+
+// accessEvents is the audit event recorded when an access request moves to each status
+var accessEvents = map[string]string{
+	AccessApproved:  EventAccessRequestApproved,
+	AccessDenied:    EventAccessRequestDenied,
+	AccessCancelled: EventAccessRequestCancelled,
+	AccessExpired:   EventAccessRequestExpired,
+}
+
+// AccessRequest is a user's request for a role, or for an action on a resource, for a limited time.  Approving it
+// binds the role, or a role granting the action, to the user until the request expires.
+type AccessRequest struct {
+	RequestID int `boil:"request_id" json:"request_id"`
+	OrgID     int `boil:"org_id" json:"org_id"`
+	UserID    int `boil:"user_id" json:"user_id"`
+	// RoleID is the role requested, or 0 if Action on ResourceName is requested
+	RoleID          int        `boil:"role_id" json:"role_id,omitempty"`
+	Action          string     `boil:"action" json:"action,omitempty"`
+	ResourceName    string     `boil:"resource_name" json:"resource_name,omitempty"`
+	DurationSeconds int        `boil:"duration_seconds" json:"duration_seconds"`
+	Justification   string     `boil:"justification" json:"justification"`
+	Status          string     `boil:"status" json:"status"`
+	CreatedAt       time.Time  `boil:"created_at" json:"created_at"`
+	DecidedAt       *time.Time `boil:"decided_at" json:"decided_at,omitempty"`
+	DeciderID       int        `boil:"decider_id" json:"decider_id,omitempty"`
+	Reason          string     `boil:"reason" json:"reason,omitempty"`
+	ExpiresAt       *time.Time `boil:"expires_at" json:"expires_at,omitempty"`
+	// GrantRoleID is the role bound to the user on approval
+	GrantRoleID int `boil:"grant_role_id" json:"grant_role_id,omitempty"`
+}
+
+// AccessDecision moves an access request to Status, made by the user with DeciderID
+type AccessDecision struct {
+	Status    string
+	DeciderID int
+	Reason    string
+}
+
+// CanTransition returns true if an access request may move from status from to status to
+func CanTransition(from, to string) bool {
+	for _, s := range accessTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Decide moves r to the status of d at now, setting when it expires if it's approved
+func (r *AccessRequest) Decide(d AccessDecision, now time.Time) error {
+	if !CanTransition(r.Status, d.Status) {
+		return fmt.Errorf("%w: it's %s, so it can't be %s", ErrBadTransition, r.Status, d.Status)
+	}
+	r.Status = d.Status
+	if d.Status == AccessExpired {
+		// the decision approving r is kept
+		return nil
+	}
+	r.DeciderID, r.Reason, r.DecidedAt = d.DeciderID, d.Reason, &now
+	if d.Status == AccessApproved {
+		exp := now.Add(time.Duration(r.DurationSeconds) * time.Second)
+		r.ExpiresAt = &exp
+	}
+	return nil
+}
+
+// grantName is the name of the role and policy created to grant an action on a resource
+func (r *AccessRequest) grantName() string {
+	return fmt.Sprintf("access-request-%d", r.RequestID)
+}
+
+// Event returns the audit event of r moving to its current status at now
+func (r *AccessRequest) Event(now time.Time) *AuditEvent {
+	return &AuditEvent{
+		OccurredAt: now, Type: accessEvents[r.Status], OrgID: r.OrgID, UserID: r.UserID, RoleID: r.GrantRoleID,
+		Detail: fmt.Sprintf("access request %d %s", r.RequestID, r.Status),
+	}
+}
+
+const selectAccessRequests = `select request_id, org_id, user_id, role_id, action, resource_name, duration_seconds,
+	justification, status, created_at, decided_at, decider_id, reason, expires_at, grant_role_id from access_request`
+
+func (ds *datastore) CreateAccessRequest(ctx context.Context, r *AccessRequest) error {
+	r.Status = AccessPending
+	row := ds.db.QueryRowContext(ctx, `insert into access_request
+		(org_id, user_id, role_id, action, resource_name, duration_seconds, justification, status)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning request_id, created_at`,
+		r.OrgID, r.UserID, r.RoleID, r.Action, r.ResourceName, r.DurationSeconds, r.Justification, r.Status,
+	)
+	return row.Scan(&r.RequestID, &r.CreatedAt)
+}
+
+func (ds *datastore) FindAccessRequest(ctx context.Context, id int) (*AccessRequest, error) {
+	var r AccessRequest
+	if err := queries.Raw(selectAccessRequests+" where request_id = $1", id).Bind(ctx, ds.db, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListAccessRequests returns the access requests of an org with the given status, or all of them if it's empty,
+// newest first
+func (ds *datastore) ListAccessRequests(ctx context.Context, orgID int, status string) ([]*AccessRequest, error) {
+	var rs []*AccessRequest
+	err := queries.Raw(selectAccessRequests+" where org_id = $1 and ($2 = '' or status = $2) order by request_id desc",
+		orgID, status,
+	).Bind(ctx, ds.db, &rs)
+	return rs, err
+}
+
+// DecideAccessRequest makes decision d on an access request at now, granting access if it's approved
+func (ds *datastore) DecideAccessRequest(ctx context.Context, id int, d AccessDecision, now time.Time) (*AccessRequest, error) {
+	var r AccessRequest
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		if err := queries.Raw(selectAccessRequests+" where request_id = $1 for update", id).Bind(ctx, tx, &r); err != nil {
+			return err
+		}
+		if err := r.Decide(d, now); err != nil {
+			return err
+		}
+		if r.Status == AccessApproved {
+			if err := grantAccess(ctx, tx, &r); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `insert into access_approval (request_id, approver_id, decision, reason, created_at)
+			values ($1, $2, $3, $4, $5)`, r.RequestID, d.DeciderID, d.Status, d.Reason, now); err != nil {
+			return err
+		}
+		if err := updateAccessRequest(ctx, tx, &r); err != nil {
+			return err
+		}
+		return insertAuditEvent(ctx, tx, r.Event(now))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ExpireAccessRequests expires the approved access requests that expired at or before now, deleting the roles and
+// policies created to grant them, and returns the audit events recorded
+func (ds *datastore) ExpireAccessRequests(ctx context.Context, now time.Time) ([]*AuditEvent, error) {
+	var events []*AuditEvent
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		var rs []*AccessRequest
+		err := queries.Raw(selectAccessRequests+" where status = $1 and expires_at <= $2 for update",
+			AccessApproved, now,
+		).Bind(ctx, tx, &rs)
+		if err != nil {
+			return err
+		}
+		for _, r := range rs {
+			if err := r.Decide(AccessDecision{Status: AccessExpired}, now); err != nil {
+				return err
+			}
+			// only roles created for requests are deleted, the bindings of requested roles are swept once they expire
+			if r.RoleID == 0 && r.GrantRoleID != 0 {
+				if err := revokeGrant(ctx, tx, r.GrantRoleID); err != nil {
+					return err
+				}
+			}
+			if err := updateAccessRequest(ctx, tx, r); err != nil {
+				return err
+			}
+			e := r.Event(now)
+			if err := insertAuditEvent(ctx, tx, e); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// grantAccess binds the requested role, or a role with an inline policy allowing the requested action, to the
+// requester until the request expires
+func grantAccess(ctx context.Context, exec boil.ContextExecutor, r *AccessRequest) error {
+	r.GrantRoleID = r.RoleID
+	if r.RoleID == 0 {
+		role := &models.Role{Name: r.grantName(), OrgID: r.OrgID}
+		if err := role.Insert(ctx, exec, boil.Infer()); err != nil {
+			return err
+		}
+		p := &models.Policy{
+			Name: r.grantName(), Effect: "allow", Actions: types.StringArray{r.Action}, ResourceName: r.ResourceName,
+			Kind: PolicyKindInline, OwnerOrgID: r.OrgID, OwnerRoleID: role.RoleID,
+		}
+		if err := p.Insert(ctx, exec, boil.Infer()); err != nil {
+			return err
+		}
+		if err := recordPolicyVersion(ctx, exec, p.PolicyID); err != nil {
+			return err
+		}
+		if err := role.AddPolicies(ctx, exec, false, p); err != nil {
+			return err
+		}
+		r.GrantRoleID = role.RoleID
+	}
+	// an existing binding is only extended, so a permanent binding stays permanent
+	_, err := exec.ExecContext(ctx, `insert into user_roles (user_id, role_id, expires_at) values ($1, $2, $3)
+		on conflict (user_id, role_id) do update set expires_at = greatest(user_roles.expires_at, excluded.expires_at)
+		where user_roles.expires_at is not null`, r.UserID, r.GrantRoleID, r.ExpiresAt)
+	return err
+}
+
+// revokeGrant deletes the role created to grant an access request, and its inline policy with it
+func revokeGrant(ctx context.Context, exec boil.ContextExecutor, roleID int) error {
+	err := deleteRole(ctx, exec, roleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+func updateAccessRequest(ctx context.Context, exec boil.ContextExecutor, r *AccessRequest) error {
+	_, err := exec.ExecContext(ctx, `update access_request set status = $2, decided_at = $3, decider_id = $4, reason = $5,
+		expires_at = $6, grant_role_id = $7 where request_id = $1`,
+		r.RequestID, r.Status, r.DecidedAt, r.DeciderID, r.Reason, r.ExpiresAt, r.GrantRoleID,
+	)
+	return err
+}
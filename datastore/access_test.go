@@ -0,0 +1,78 @@
+package datastore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAccessRequest_Decide(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	decided, expires := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name   string
+		r      AccessRequest
+		d      AccessDecision
+		expR   AccessRequest
+		expErr error
+	}{
+		{
+			name: "approve",
+			r:    AccessRequest{Status: AccessPending, DurationSeconds: 3600},
+			d:    AccessDecision{Status: AccessApproved, DeciderID: 2, Reason: "incident"},
+			expR: AccessRequest{
+				Status: AccessApproved, DurationSeconds: 3600, DecidedAt: &now, DeciderID: 2, Reason: "incident",
+				ExpiresAt: &expires,
+			},
+		},
+		{
+			name: "deny",
+			r:    AccessRequest{Status: AccessPending, DurationSeconds: 3600},
+			d:    AccessDecision{Status: AccessDenied, DeciderID: 2},
+			expR: AccessRequest{Status: AccessDenied, DurationSeconds: 3600, DecidedAt: &now, DeciderID: 2},
+		},
+		{
+			name: "cancel",
+			r:    AccessRequest{Status: AccessPending, UserID: 1},
+			d:    AccessDecision{Status: AccessCancelled, DeciderID: 1},
+			expR: AccessRequest{Status: AccessCancelled, UserID: 1, DecidedAt: &now, DeciderID: 1},
+		},
+		{
+			name: "expire keeps approval",
+			r:    AccessRequest{Status: AccessApproved, DecidedAt: &decided, DeciderID: 2, ExpiresAt: &now},
+			d:    AccessDecision{Status: AccessExpired},
+			expR: AccessRequest{Status: AccessExpired, DecidedAt: &decided, DeciderID: 2, ExpiresAt: &now},
+		},
+		{
+			name:   "approve twice",
+			r:      AccessRequest{Status: AccessApproved},
+			d:      AccessDecision{Status: AccessApproved, DeciderID: 2},
+			expR:   AccessRequest{Status: AccessApproved},
+			expErr: ErrBadTransition,
+		},
+		{
+			name:   "cancel denied",
+			r:      AccessRequest{Status: AccessDenied},
+			d:      AccessDecision{Status: AccessCancelled, DeciderID: 1},
+			expR:   AccessRequest{Status: AccessDenied},
+			expErr: ErrBadTransition,
+		},
+		{
+			name:   "expire pending",
+			r:      AccessRequest{Status: AccessPending},
+			d:      AccessDecision{Status: AccessExpired},
+			expR:   AccessRequest{Status: AccessPending},
+			expErr: ErrBadTransition,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.r.Decide(tt.d, now)
+			assert.ErrorIs(t, err, tt.expErr)
+			assert.Equal(t, tt.expR, tt.r)
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"go.uber.org/zap"
+	"time"
+)
+
+// ErrConditionInUse is returned when deleting a condition that's attached to policies the deleting org doesn't own
+var ErrConditionInUse = errors.New("condition is attached to managed policies or policies of other orgs")
+
+// Admin manages orgs, users, roles, policies and conditions and the bindings between them
+type Admin interface {
+	ListOrgs(ctx context.Context) (models.OrgSlice, error)
+	FindOrgByID(ctx context.Context, id int) (*models.Org, error)
+	CreateOrg(ctx context.Context, o *models.Org) error
+	DeleteOrgByID(ctx context.Context, id int) error
+	// MoveOrg makes parentID the parent of an org, or makes the org a root if parentID is null.  Returns
+	// roles.ErrOrgCycle if parentID is the org or one of its descendants.
+	MoveOrg(ctx context.Context, orgID int, parentID null.Int) error
+	// ListOrgRoles returns the roles bound to an org, which apply to every user of the org and its descendants
+	ListOrgRoles(ctx context.Context, orgID int) (models.RoleSlice, error)
+	BindOrgRole(ctx context.Context, orgID, roleID int) error
+	UnbindOrgRole(ctx context.Context, orgID, roleID int) error
+
+	ListUsersByOrgID(ctx context.Context, orgID int) (*models.UserSlice, error)
+	FindUserByID(ctx context.Context, id int) (*models.User, error)
+	CreateUser(ctx context.Context, u *models.User) error
+	DeleteUserByID(ctx context.Context, id int) error
+
+	ListRolesByOrgID(ctx context.Context, orgID int) (models.RoleSlice, error)
+	// ListRoleBindingsByUserID returns the roles bound to a user and the window each binding is effective in
+	ListRoleBindingsByUserID(ctx context.Context, userID int) ([]*RoleBinding, error)
+	FindRoleByID(ctx context.Context, id int) (*models.Role, error)
+	CreateRole(ctx context.Context, r *models.Role) error
+	DeleteRoleByID(ctx context.Context, id int) error
+
+	// ListPoliciesByOrgID returns the managed policies and the org and inline policies of an org
+	ListPoliciesByOrgID(ctx context.Context, orgID int) (models.PolicySlice, error)
+	ListPoliciesByRoleID(ctx context.Context, roleID int) (models.PolicySlice, error)
+	FindPolicyByID(ctx context.Context, id int) (*models.Policy, error)
+	// CreatePolicy creates a policy, attaching it to its role if it's an inline policy
+	CreatePolicy(ctx context.Context, p *models.Policy) error
+	DeletePolicyByID(ctx context.Context, id int) error
+	// GetPolicyUsage returns the number of roles, orgs and users a policy is attached or bound to
+	GetPolicyUsage(ctx context.Context, policyID int) (*PolicyUsage, error)
+
+	ListConditions(ctx context.Context) (models.ConditionSlice, error)
+	ListConditionsByPolicyID(ctx context.Context, policyID int) (models.ConditionSlice, error)
+	FindConditionByID(ctx context.Context, id int) (*models.Condition, error)
+	CreateCondition(ctx context.Context, c *models.Condition) error
+	// DeleteConditionByID deletes a condition and detaches it from the policies of orgID.  Returns ErrConditionInUse
+	// if it's attached to any other policy.
+	DeleteConditionByID(ctx context.Context, id, orgID int) error
+
+	// BindUserRole binds a role to a user for the window w, which is open ended if it's zero
+	BindUserRole(ctx context.Context, userID, roleID int, w Window) error
+	UnbindUserRole(ctx context.Context, userID, roleID int) error
+	AttachRolePolicy(ctx context.Context, roleID, policyID int) error
+	DetachRolePolicy(ctx context.Context, roleID, policyID int) error
+	AttachPolicyCondition(ctx context.Context, policyID, conditionID int) error
+	DetachPolicyCondition(ctx context.Context, policyID, conditionID int) error
+
+	// ListPolicyVersions returns the versions of a policy, oldest first
+	ListPolicyVersions(ctx context.Context, policyID int) ([]*PolicyVersion, error)
+	FindPolicyVersion(ctx context.Context, policyID, version int) (*PolicyVersion, error)
+	// CreatePolicyVersion creates the next version of a policy, making it the default if setDefault is true
+	CreatePolicyVersion(ctx context.Context, v *PolicyVersion, setDefault bool) error
+	SetDefaultPolicyVersion(ctx context.Context, policyID, version int) error
+	// RollbackPolicy makes the version before a policy's default version its default, and returns it
+	RollbackPolicy(ctx context.Context, policyID int) (*PolicyVersion, error)
+
+	// SweepExpiredBindings deletes role bindings that expired at or before now and returns the audit events recorded
+	SweepExpiredBindings(ctx context.Context, now time.Time) ([]*AuditEvent, error)
+	ListAuditEvents(ctx context.Context, orgID int) ([]*AuditEvent, error)
+	// RecordDecisions records a batch of authorization decisions in the decision audit trail
+	RecordDecisions(ctx context.Context, ds []*Decision) error
+	ListDecisions(ctx context.Context, f DecisionFilter) ([]*Decision, error)
+	// PruneDecisions deletes the decisions that occurred before before and returns how many were deleted
+	PruneDecisions(ctx context.Context, before time.Time) (int64, error)
+	// RecordUsage records the last use of the API keys, policies and roles in a batch of usage
+	RecordUsage(ctx context.Context, us []*Usage) error
+	// ListUnused returns the roles, policies and API keys of an org that haven't been used since since
+	ListUnused(ctx context.Context, orgID int, since time.Time) ([]*Unused, error)
+
+	// CreateAccessRequest creates a pending access request
+	CreateAccessRequest(ctx context.Context, r *AccessRequest) error
+	FindAccessRequest(ctx context.Context, id int) (*AccessRequest, error)
+	ListAccessRequests(ctx context.Context, orgID int, status string) ([]*AccessRequest, error)
+	// DecideAccessRequest makes decision d on an access request at now, granting access if it's approved
+	DecideAccessRequest(ctx context.Context, id int, d AccessDecision, now time.Time) (*AccessRequest, error)
+	// ExpireAccessRequests expires approved access requests that expired at or before now and returns the audit
+	// events recorded
+	ExpireAccessRequests(ctx context.Context, now time.Time) ([]*AuditEvent, error)
+}
+
+// NewAdmin returns an Admin that manages IAM data in db
+func NewAdmin(db *sql.DB, l *zap.SugaredLogger) Admin {
+	return &datastore{db: db, logger: l}
+}
+
+func (ds *datastore) ListOrgs(ctx context.Context) (models.OrgSlice, error) {
+	return models.Orgs(qm.OrderBy("org_id")).All(ctx, ds.db)
+}
+
+func (ds *datastore) FindOrgByID(ctx context.Context, id int) (*models.Org, error) {
+	return models.FindOrg(ctx, ds.db, id)
+}
+
+func (ds *datastore) CreateOrg(ctx context.Context, o *models.Org) error {
+	return o.Insert(ctx, ds.db, boil.Infer())
+}
+
+// DeleteOrgByID deletes an org.  Fails if the org still has users, roles, zones or child orgs.
+func (ds *datastore) DeleteOrgByID(ctx context.Context, id int) error {
+	_, err := models.Orgs(qm.Where("org_id = ?", id)).DeleteAll(ctx, ds.db)
+	return err
+}
+
+func (ds *datastore) CreateUser(ctx context.Context, u *models.User) error {
+	return u.Insert(ctx, ds.db, boil.Infer())
+}
+
+// DeleteUserByID deletes a user and their tags and unbinds their roles
+func (ds *datastore) DeleteUserByID(ctx context.Context, id int) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		return deleteUser(ctx, tx, id)
+	})
+}
+
+// deleteUser deletes a user and the bindings to it with exec
+func deleteUser(ctx context.Context, exec boil.ContextExecutor, id int) error {
+	u, err := models.FindUser(ctx, exec, id)
+	if err != nil {
+		return err
+	}
+	if err := u.SetRoles(ctx, exec, false); err != nil {
+		return err
+	}
+	if err := setUserTags(ctx, exec, id, nil); err != nil {
+		return err
+	}
+	_, err = u.Delete(ctx, exec)
+	return err
+}
+
+func (ds *datastore) ListRolesByOrgID(ctx context.Context, orgID int) (models.RoleSlice, error) {
+	return models.Roles(qm.Where("org_id = ?", orgID), qm.OrderBy("role_id")).All(ctx, ds.db)
+}
+
+func (ds *datastore) FindRoleByID(ctx context.Context, id int) (*models.Role, error) {
+	return models.FindRole(ctx, ds.db, id)
+}
+
+func (ds *datastore) CreateRole(ctx context.Context, r *models.Role) error {
+	return r.Insert(ctx, ds.db, boil.Infer())
+}
+
+// DeleteRoleByID deletes a role and its inline policies, unbinding it from its users and detaching its other policies
+func (ds *datastore) DeleteRoleByID(ctx context.Context, id int) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		return deleteRole(ctx, tx, id)
+	})
+}
+
+// deleteRole deletes a role, its inline policies and the bindings to it with exec
+func deleteRole(ctx context.Context, exec boil.ContextExecutor, id int) error {
+	r, err := models.FindRole(ctx, exec, id)
+	if err != nil {
+		return err
+	}
+	if err := r.SetUsers(ctx, exec, false); err != nil {
+		return err
+	}
+	if _, err := exec.ExecContext(ctx, `delete from org_roles where role_id = $1`, id); err != nil {
+		return err
+	}
+	if err := deleteInlinePolicies(ctx, exec, id); err != nil {
+		return err
+	}
+	if err := r.SetPolicies(ctx, exec, false); err != nil {
+		return err
+	}
+	_, err = r.Delete(ctx, exec)
+	return err
+}
+
+func (ds *datastore) ListPoliciesByRoleID(ctx context.Context, roleID int) (models.PolicySlice, error) {
+	return models.Policies(
+		qm.InnerJoin("role_policies rp on rp.policy_id = policy.policy_id"),
+		qm.Where("rp.role_id = ?", roleID),
+		qm.OrderBy("policy.policy_id"),
+	).All(ctx, ds.db)
+}
+
+func (ds *datastore) FindPolicyByID(ctx context.Context, id int) (*models.Policy, error) {
+	return models.FindPolicy(ctx, ds.db, id)
+}
+
+// DeletePolicyByID deletes a policy, detaching it from its roles and conditions
+func (ds *datastore) DeletePolicyByID(ctx context.Context, id int) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		return deletePolicy(ctx, tx, id)
+	})
+}
+
+// deletePolicy deletes a policy, its versions and the bindings to it with exec
+func deletePolicy(ctx context.Context, exec boil.ContextExecutor, id int) error {
+	p, err := models.FindPolicy(ctx, exec, id)
+	if err != nil {
+		return err
+	}
+	if _, err := exec.ExecContext(ctx, `delete from policy_version where policy_id = $1`, id); err != nil {
+		return err
+	}
+	if err := p.SetRoles(ctx, exec, false); err != nil {
+		return err
+	}
+	if err := p.SetConditions(ctx, exec, false); err != nil {
+		return err
+	}
+	_, err = p.Delete(ctx, exec)
+	return err
+}
+
+func (ds *datastore) ListConditions(ctx context.Context) (models.ConditionSlice, error) {
+	return models.Conditions(qm.OrderBy("condition_id")).All(ctx, ds.db)
+}
+
+func (ds *datastore) ListConditionsByPolicyID(ctx context.Context, policyID int) (models.ConditionSlice, error) {
+	return models.Conditions(
+		qm.InnerJoin("condition_policies cp on cp.condition_id = condition.condition_id"),
+		qm.Where("cp.policy_id = ?", policyID),
+		qm.OrderBy("condition.condition_id"),
+	).All(ctx, ds.db)
+}
+
+func (ds *datastore) FindConditionByID(ctx context.Context, id int) (*models.Condition, error) {
+	return models.FindCondition(ctx, ds.db, id)
+}
+
+func (ds *datastore) CreateCondition(ctx context.Context, c *models.Condition) error {
+	return c.Insert(ctx, ds.db, boil.Infer())
+}
+
+// DeleteConditionByID deletes a condition, detaching it from its policies and recording a new version of each.  It
+// returns ErrConditionInUse if the condition is attached to a managed policy or a policy of an org other than orgID.
+func (ds *datastore) DeleteConditionByID(ctx context.Context, id, orgID int) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		c, err := models.FindCondition(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		ps, err := c.Policies().All(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, p := range ps {
+			if p.Kind == PolicyKindManaged || p.OwnerOrgID != orgID {
+				return ErrConditionInUse
+			}
+		}
+		if err := c.SetPolicies(ctx, tx, false); err != nil {
+			return err
+		}
+		for _, p := range ps {
+			if err := recordPolicyVersion(ctx, tx, p.PolicyID); err != nil {
+				return err
+			}
+		}
+		_, err = c.Delete(ctx, tx)
+		return err
+	})
+}
+
+func (ds *datastore) UnbindUserRole(ctx context.Context, userID, roleID int) error {
+	u, r, err := ds.findUserAndRole(ctx, userID, roleID)
+	if err != nil {
+		return err
+	}
+	return u.RemoveRoles(ctx, ds.db, r)
+}
+
+func (ds *datastore) AttachRolePolicy(ctx context.Context, roleID, policyID int) error {
+	r, p, err := ds.findRoleAndPolicy(ctx, roleID, policyID)
+	if err != nil {
+		return err
+	}
+	return r.AddPolicies(ctx, ds.db, false, p)
+}
+
+func (ds *datastore) DetachRolePolicy(ctx context.Context, roleID, policyID int) error {
+	r, p, err := ds.findRoleAndPolicy(ctx, roleID, policyID)
+	if err != nil {
+		return err
+	}
+	return r.RemovePolicies(ctx, ds.db, p)
+}
+
+// AttachPolicyCondition attaches a condition to a policy, recording a new version of the policy
+func (ds *datastore) AttachPolicyCondition(ctx context.Context, policyID, conditionID int) error {
+	p, c, err := ds.findPolicyAndCondition(ctx, policyID, conditionID)
+	if err != nil {
+		return err
+	}
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		if err := p.AddConditions(ctx, tx, false, c); err != nil {
+			return err
+		}
+		return recordPolicyVersion(ctx, tx, policyID)
+	})
+}
+
+// DetachPolicyCondition detaches a condition from a policy, recording a new version of the policy
+func (ds *datastore) DetachPolicyCondition(ctx context.Context, policyID, conditionID int) error {
+	p, c, err := ds.findPolicyAndCondition(ctx, policyID, conditionID)
+	if err != nil {
+		return err
+	}
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		if err := p.RemoveConditions(ctx, tx, c); err != nil {
+			return err
+		}
+		return recordPolicyVersion(ctx, tx, policyID)
+	})
+}
+
+func (ds *datastore) findUserAndRole(ctx context.Context, userID, roleID int) (*models.User, *models.Role, error) {
+	u, err := models.FindUser(ctx, ds.db, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := models.FindRole(ctx, ds.db, roleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, r, nil
+}
+
+func (ds *datastore) findRoleAndPolicy(ctx context.Context, roleID, policyID int) (*models.Role, *models.Policy, error) {
+	r, err := models.FindRole(ctx, ds.db, roleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := models.FindPolicy(ctx, ds.db, policyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, p, nil
+}
+
+func (ds *datastore) findPolicyAndCondition(ctx context.Context, policyID, conditionID int) (*models.Policy, *models.Condition, error) {
+	p, err := models.FindPolicy(ctx, ds.db, policyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := models.FindCondition(ctx, ds.db, conditionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, c, nil
+}
+
+// inTx runs fn in a transaction, committing if it succeeds and rolling back if it fails
+func (ds *datastore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			ds.logger.Errorw("error rolling back transaction", "error", rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,43 @@
+package datastore
+
+import (
+	"context"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"time"
+)
+
+// Audit event types
+const (
+	// EventRoleBindingExpired is recorded when an expired role binding is swept
+	EventRoleBindingExpired = "RoleBindingExpired"
+)
+
+// AuditEvent is a change to the IAM data of an org that wasn't made by a request, such as a binding expiring.  Events
+// outlive the users and roles they refer to.
+type AuditEvent struct {
+	EventID    int       `boil:"event_id" json:"event_id"`
+	OccurredAt time.Time `boil:"occurred_at" json:"occurred_at"`
+	Type       string    `boil:"type" json:"type"`
+	OrgID      int       `boil:"org_id" json:"org_id"`
+	UserID     int       `boil:"user_id" json:"user_id,omitempty"`
+	RoleID     int       `boil:"role_id" json:"role_id,omitempty"`
+	Detail     string    `boil:"detail" json:"detail,omitempty"`
+}
+
+// ListAuditEvents returns the audit events of an org, newest first
+func (ds *datastore) ListAuditEvents(ctx context.Context, orgID int) ([]*AuditEvent, error) {
+	var es []*AuditEvent
+	err := queries.Raw(`select event_id, occurred_at, type, org_id, user_id, role_id, detail from audit_event
+		where org_id = $1 order by event_id desc`, orgID).Bind(ctx, ds.db, &es)
+	return es, err
+}
+
+// insertAuditEvent records e with exec, setting its ID
+func insertAuditEvent(ctx context.Context, exec boil.ContextExecutor, e *AuditEvent) error {
+	row := exec.QueryRowContext(ctx, `insert into audit_event (occurred_at, type, org_id, user_id, role_id, detail)
+		values ($1, $2, $3, $4, $5, $6) returning event_id`,
+		e.OccurredAt, e.Type, e.OrgID, e.UserID, e.RoleID, e.Detail,
+	)
+	return row.Scan(&e.EventID)
+}
@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"time"
+)
+
+// ErrBadWindow is returned when binding a role with a window that ends before it starts or has already ended
+var ErrBadWindow = errors.New("expires_at must be in the future and after not_before")
+
+// Window is the time a role binding is effective in.  Either end may be nil, in which case the window is open at
+// that end.
+type Window struct {
+	NotBefore *time.Time `boil:"not_before" json:"not_before,omitempty"`
+	ExpiresAt *time.Time `boil:"expires_at" json:"expires_at,omitempty"`
+}
+
+// Active returns true if t is within w
+func (w Window) Active(t time.Time) bool {
+	return (w.NotBefore == nil || !t.Before(*w.NotBefore)) && (w.ExpiresAt == nil || t.Before(*w.ExpiresAt))
+}
+
+// Validate returns ErrBadWindow if w ends at or before now, or before it starts
+func (w Window) Validate(now time.Time) error {
+	if w.ExpiresAt == nil {
+		return nil
+	}
+	if !w.ExpiresAt.After(now) || (w.NotBefore != nil && !w.ExpiresAt.After(*w.NotBefore)) {
+		return ErrBadWindow
+	}
+	return nil
+}
+
+// RoleBinding is a role bound to a user and the window the binding is effective in
+type RoleBinding struct {
+	models.Role `boil:",bind"`
+	UserID      int `boil:"user_id" json:"user_id"`
+	Window      `boil:",bind"`
+}
+
+// ListRoleBindingsByUserID returns the roles bound to a user, including those outside their window
+func (ds *datastore) ListRoleBindingsByUserID(ctx context.Context, userID int) ([]*RoleBinding, error) {
+	var bs []*RoleBinding
+	err := queries.Raw(`select role.role_id, role.name, role.org_id, ur.user_id, ur.not_before, ur.expires_at
+		from role inner join user_roles ur on ur.role_id = role.role_id
+		where ur.user_id = $1 order by role.role_id`, userID).Bind(ctx, ds.db, &bs)
+	return bs, err
+}
+
+// BindUserRole binds a role to a user for w, replacing the window of an existing binding
+func (ds *datastore) BindUserRole(ctx context.Context, userID, roleID int, w Window) error {
+	if _, _, err := ds.findUserAndRole(ctx, userID, roleID); err != nil {
+		return err
+	}
+	_, err := ds.db.ExecContext(ctx, `insert into user_roles (user_id, role_id, not_before, expires_at) values ($1, $2, $3, $4)
+		on conflict (user_id, role_id) do update set not_before = excluded.not_before, expires_at = excluded.expires_at`,
+		userID, roleID, w.NotBefore, w.ExpiresAt,
+	)
+	return err
+}
+
+// SweepExpiredBindings deletes the role bindings that expired at or before now, recording an audit event for each
+func (ds *datastore) SweepExpiredBindings(ctx context.Context, now time.Time) ([]*AuditEvent, error) {
+	var events []*AuditEvent
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `delete from user_roles ur using "user" u
+			where u.user_id = ur.user_id and ur.expires_at <= $1
+			returning ur.user_id, ur.role_id, u.org_id, ur.expires_at`, now)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e := &AuditEvent{Type: EventRoleBindingExpired, OccurredAt: now}
+			var expiresAt time.Time
+			if err := rows.Scan(&e.UserID, &e.RoleID, &e.OrgID, &expiresAt); err != nil {
+				return err
+			}
+			e.Detail = fmt.Sprintf("binding of role %d to user %d expired at %s", e.RoleID, e.UserID, expiresAt.Format(time.RFC3339))
+			events = append(events, e)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := insertAuditEvent(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
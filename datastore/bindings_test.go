@@ -0,0 +1,56 @@
+package datastore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name      string
+		w         Window
+		expActive bool
+		expErr    error
+	}{
+		{
+			name:      "open",
+			expActive: true,
+		},
+		{
+			name:      "started",
+			w:         Window{NotBefore: &before, ExpiresAt: &after},
+			expActive: true,
+		},
+		{
+			name:      "starts at now",
+			w:         Window{NotBefore: &now},
+			expActive: true,
+		},
+		{
+			name: "not started",
+			w:    Window{NotBefore: &after},
+		},
+		{
+			name:   "expires at now",
+			w:      Window{ExpiresAt: &now},
+			expErr: ErrBadWindow,
+		},
+		{
+			name:   "expires before it starts",
+			w:      Window{NotBefore: &after, ExpiresAt: &after},
+			expErr: ErrBadWindow,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.expActive, tt.w.Active(now))
+			assert.ErrorIs(t, tt.w.Validate(now), tt.expErr)
+		})
+	}
+}
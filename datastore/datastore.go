@@ -8,16 +8,32 @@ import (
 	"github.com/mburtless/oso-rbac-iam/pkg/roles"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 	"go.uber.org/zap"
+	"sort"
 )
 
 type Datastore interface {
 	FindZoneByID(ctx context.Context, id int) (*models.Zone, error)
 	ListZonesByOrgID(ctx context.Context, orgID int) (*models.ZoneSlice, error)
+	// ListRecordsByZoneID, FindRecordByID, CreateRecord, UpdateRecord and DeleteRecordByID manage the DNS records of
+	// zones
+	ListRecordsByZoneID(ctx context.Context, zoneID int) ([]*Record, error)
+	FindRecordByID(ctx context.Context, id int) (*Record, error)
+	CreateRecord(ctx context.Context, r *Record) error
+	UpdateRecord(ctx context.Context, r *Record) error
+	DeleteRecordByID(ctx context.Context, id int) error
 	ListUsersByOrgID(ctx context.Context, orgID int) (*models.UserSlice, error)
 	FindUserByKey(ctx context.Context, key string) (*models.User, error)
+	FindUserByID(ctx context.Context, id int) (*models.User, error)
 	GetUserRoles(ctx context.Context, user *models.User) (models.RoleSlice, error)
-	GetUserRolesAndPolicies(ctx context.Context, userID int) ([]*DenormalizedRole, error)
-	GetEffectivePerms(ctx context.Context, userID int) (EffectivePerms, error)
+	// GetUserRolesAndPolicies and GetEffectivePerms load the roles bound to a user, and to its org and the org's
+	// ancestors in t, with their policies
+	GetUserRolesAndPolicies(ctx context.Context, u *models.User, t roles.OrgTree) ([]*DenormalizedRole, error)
+	GetEffectivePerms(ctx context.Context, u *models.User, t roles.OrgTree) (EffectivePerms, error)
+	// ListUserTags returns the tags of the user with the given ID, which policy variables like ${principal.tag/team}
+	// are substituted with
+	ListUserTags(ctx context.Context, userID int) (map[string]string, error)
+	// GetOrgTree returns the hierarchy of orgs, which policies on the resources of an org are inherited down
+	GetOrgTree(ctx context.Context) (roles.OrgTree, error)
 }
 
 type datastore struct {
@@ -64,6 +80,15 @@ func (ds *datastore) FindUserByKey(ctx context.Context, key string) (*models.Use
 	return u, nil
 }
 
+func (ds *datastore) FindUserByID(ctx context.Context, id int) (*models.User, error) {
+	u, err := models.FindUser(ctx, ds.db, id)
+	if err != nil {
+		return nil, err
+	}
+	ds.logger.Debugw("found user in PG", "user", u)
+	return u, nil
+}
+
 func (ds *datastore) GetUserRoles(ctx context.Context, user *models.User) (models.RoleSlice, error) {
 	r, err := user.Roles().All(ctx, ds.db)
 	if err != nil {
@@ -73,22 +98,31 @@ func (ds *datastore) GetUserRoles(ctx context.Context, user *models.User) (model
 	return r, nil
 }
 
-func (ds *datastore) GetUserRolesAndPolicies(ctx context.Context, userID int) ([]*DenormalizedRole, error) {
+// denormalizedColumns are the columns of a DenormalizedRole
+var denormalizedColumns = []string{
+	"role.*",
+	"policy.*",
+	// account for nil vals due to left join
+	"COALESCE(c.condition_id, 0) as condition_id",
+	"COALESCE(c.type, '') as type",
+	"COALESCE(c.value, '') as value",
+}
+
+// GetUserRolesAndPolicies returns the roles bound to u, and to its org and the org's ancestors in t, with their
+// policies
+func (ds *datastore) GetUserRolesAndPolicies(ctx context.Context, u *models.User, t roles.OrgTree) ([]*DenormalizedRole, error) {
 	var dr []*DenormalizedRole
 	// TODO: optimize query for new EffectivePerms datastrucuture?
 	err := models.NewQuery(
-		qm.Select(
-			"role.*",
-			"policy.*",
-			// account for nil vals due to left join
-			"COALESCE(c.condition_id, 0) as condition_id",
-			"COALESCE(c.type, '') as type",
-			"COALESCE(c.value, '') as value"),
+		qm.Select(denormalizedColumns...),
 		qm.From("user_roles"),
 		qm.InnerJoin("role on user_roles.role_id = role.role_id"),
 		qm.InnerJoin("role_policies on user_roles.role_id = role.role_id"),
 		qm.InnerJoin("policy on role_policies.policy_id = policy.policy_id"),
-		qm.And("user_roles.user_id = ?", userID),
+		qm.And("user_roles.user_id = ?", u.UserID),
+		// bindings outside their window aren't effective
+		qm.And("(user_roles.not_before is null or user_roles.not_before <= now())"),
+		qm.And("(user_roles.expires_at is null or user_roles.expires_at > now())"),
 		qm.And("role_policies.role_id = role.role_id"),
 		qm.LeftOuterJoin("condition_policies cp on policy.policy_id = cp.policy_id"),
 		qm.LeftOuterJoin("condition c on c.condition_id = cp.condition_id"),
@@ -97,14 +131,30 @@ func (ds *datastore) GetUserRolesAndPolicies(ctx context.Context, userID int) ([
 		return nil, err
 	}
 
+	orgs := userOrgs(u, t)
+	var inherited []*DenormalizedRole
+	err = models.NewQuery(
+		qm.Select(denormalizedColumns...),
+		qm.From("org_roles"),
+		qm.InnerJoin("role on org_roles.role_id = role.role_id"),
+		qm.InnerJoin("role_policies on role_policies.role_id = role.role_id"),
+		qm.InnerJoin("policy on role_policies.policy_id = policy.policy_id"),
+		qm.LeftOuterJoin("condition_policies cp on policy.policy_id = cp.policy_id"),
+		qm.LeftOuterJoin("condition c on c.condition_id = cp.condition_id"),
+		qm.WhereIn("org_roles.org_id in ?", orgs...),
+	).Bind(ctx, ds.db, &inherited)
+	if err != nil {
+		return nil, err
+	}
+	dr = append(dr, inherited...)
 
 	ds.logger.Debugw("found denorm roles for user", "roles", dr)
 	return dr, nil
 }
 
-func (ds *datastore) GetEffectivePerms(ctx context.Context, userID int) (EffectivePerms, error) {
+func (ds *datastore) GetEffectivePerms(ctx context.Context, u *models.User, t roles.OrgTree) (EffectivePerms, error) {
 	// load user's roles and policies
-	drs, err := ds.GetUserRolesAndPolicies(ctx, userID)
+	drs, err := ds.GetUserRolesAndPolicies(ctx, u, t)
 	if err != nil {
 		ds.logger.Errorw("error finding effective permissions for user", "error", err)
 		return EffectivePerms{}, err
@@ -139,13 +189,18 @@ func ToCondition(cond models.Condition) *roles.Condition {
 }
 
 func ToPolicy(policy *models.Policy) *roles.RolePolicy {
-	return &roles.RolePolicy{
+	rp := &roles.RolePolicy{
 		ID: 		policy.PolicyID,
 		Effect:     policy.Effect,
 		Actions:    policy.Actions,
 		Resource:   roles.PolicyResourceName(policy.ResourceName),
 		Conditions: map[int]*roles.Condition{},
+		NotActions: policy.NotActions,
 	}
+	for _, nrn := range policy.NotResourceNames {
+		rp.NotResourceNames = append(rp.NotResourceNames, roles.PolicyResourceName(nrn))
+	}
+	return rp
 }
 
 // ToEffectivePerms converts a slice of denormalized roles into a set of effective permissions
@@ -215,3 +270,87 @@ type EffectivePerms struct {
 
 // PoliciesByNamespace is used to cache all policies, sorted by namespace they apply to
 type PoliciesByNamespace map[string]map[int]*roles.RolePolicy
+
+// Policies returns the allow or deny policies, per effect, cached under namespace, ordered by ID.  Polar iterates
+// these rather than the cache, as Oso converts a map to a dictionary by stringifying its keys, which collapses a map
+// with integer keys to one of its policies.
+func (ep EffectivePerms) Policies(effect, namespace string) []*roles.RolePolicy {
+	byNamespace := ep.AllowPolicies
+	if effect == "deny" {
+		byNamespace = ep.DenyPolicies
+	}
+	ps := make([]*roles.RolePolicy, 0, len(byNamespace[namespace]))
+	for _, p := range byNamespace[namespace] {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].ID < ps[j].ID })
+	return ps
+}
+
+// ForPrincipal returns the perms with the variables of each policy substituted with p's attributes, cached under
+// their substituted resource names.  Allow policies whose variables can't be substituted are dropped, as they match
+// nothing, but deny policies are only dropped when their resource name can't be, so they still apply.
+func (ep EffectivePerms) ForPrincipal(p roles.Principal) EffectivePerms {
+	sub := EffectivePerms{Namespaces: ep.Namespaces}
+	for _, c := range []struct {
+		from PoliciesByNamespace
+		to   *PoliciesByNamespace
+	}{{ep.AllowPolicies, &sub.AllowPolicies}, {ep.DenyPolicies, &sub.DenyPolicies}} {
+		if c.from == nil {
+			continue
+		}
+		*c.to = PoliciesByNamespace{}
+		for namespace, ps := range c.from {
+			for id, policy := range ps {
+				ns := namespace
+				if policy.HasVariables() {
+					var ok bool
+					if policy, ok = policy.ForPrincipal(p); !ok {
+						continue
+					}
+					ns = string(policy.Resource)
+				}
+				if (*c.to)[ns] == nil {
+					(*c.to)[ns] = map[int]*roles.RolePolicy{}
+				}
+				(*c.to)[ns][id] = policy
+			}
+		}
+	}
+	return sub
+}
+
+// ForOrgTree returns the perms with the policies inherited by the descendants in t of the orgs of each policy's
+// resource name added, so a policy on oso:1:zone/* also covers the zones of org 1's OUs.  Variables must already
+// be substituted.
+func (ep EffectivePerms) ForOrgTree(t roles.OrgTree) EffectivePerms {
+	if len(t) == 0 {
+		return ep
+	}
+	index := t.Index()
+	tree := EffectivePerms{Namespaces: ep.Namespaces}
+	for _, c := range []struct {
+		from PoliciesByNamespace
+		to   *PoliciesByNamespace
+	}{{ep.AllowPolicies, &tree.AllowPolicies}, {ep.DenyPolicies, &tree.DenyPolicies}} {
+		if c.from == nil {
+			continue
+		}
+		*c.to = PoliciesByNamespace{}
+		add := func(ns string, p *roles.RolePolicy) {
+			if (*c.to)[ns] == nil {
+				(*c.to)[ns] = map[int]*roles.RolePolicy{}
+			}
+			(*c.to)[ns][p.ID] = p
+		}
+		for namespace, ps := range c.from {
+			for _, policy := range ps {
+				add(namespace, policy)
+				for _, inherited := range policy.Inherited(index) {
+					add(string(inherited.Resource), inherited)
+				}
+			}
+		}
+	}
+	return tree
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/mburtless/oso-rbac-iam/pkg/roles"
 	"github.com/stretchr/testify/assert"
 	"github.com/volatiletech/sqlboiler/v4/types"
+	"sort"
 	"testing"
 )
 
@@ -158,6 +159,38 @@ func Test_ToEffectivePerms(t *testing.T) {
 				DenyPolicies: PoliciesByNamespace{},
 			},
 		},
+		{
+			name: "deny policy with not actions and not resource names",
+			denormRoles: []*DenormalizedRole{
+				{
+					Role: models.Role{RoleID: 1, Name: "guybrush", OrgID: orgId},
+					Policy: models.Policy{
+						PolicyID: 1,
+						Name: "bar",
+						Effect: "deny",
+						ResourceName: "oso:0:zone/*",
+						NotActions: types.StringArray{"view"},
+						NotResourceNames: types.StringArray{"oso:0:zone/gmail.com"},
+					},
+				},
+			},
+			want: EffectivePerms{
+				Namespaces: map[string][]string{},
+				AllowPolicies: PoliciesByNamespace{},
+				DenyPolicies: PoliciesByNamespace{
+					"oso:0:zone/*": map[int]*roles.RolePolicy{
+						1: {
+							ID: 1,
+							Effect:     "deny",
+							Resource:   roles.PolicyResourceName("oso:0:zone/*"),
+							Conditions: map[int]*roles.Condition{},
+							NotActions: []string{"view"},
+							NotResourceNames: []roles.PolicyResourceName{"oso:0:zone/gmail.com"},
+						},
+					},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -167,3 +200,96 @@ func Test_ToEffectivePerms(t *testing.T) {
 		})
 	}
 }
+
+func TestEffectivePerms_ForPrincipal(t *testing.T) {
+	viewOrg := &roles.RolePolicy{ID: 1, Effect: "allow", Actions: []string{"view"}, Resource: "oso:${principal.org_id}:zone/*"}
+	viewTeam := &roles.RolePolicy{ID: 2, Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/${principal.tag/team}.com"}
+	denyFoo := &roles.RolePolicy{ID: 3, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:0:zone/foo.com"}
+	denyAllButTeam := &roles.RolePolicy{
+		ID: 4, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:${principal.org_id}:zone/*",
+		NotResourceNames: []roles.PolicyResourceName{"oso:${principal.org_id}:zone/${principal.tag/team}.com"},
+		Conditions:       map[int]*roles.Condition{1: {ID: 1, Type: "matchSuffix", Value: "${principal.tag/team}.com"}},
+	}
+	denyTeam := &roles.RolePolicy{ID: 5, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:0:zone/${principal.tag/team}.com"}
+	ep := EffectivePerms{
+		Namespaces: map[string][]string{"zone": {"oso:${principal.org_id}:zone/*", "oso:0:zone/${principal.tag/team}.com"}},
+		AllowPolicies: PoliciesByNamespace{
+			"oso:${principal.org_id}:zone/*":       {1: viewOrg},
+			"oso:0:zone/${principal.tag/team}.com": {2: viewTeam},
+		},
+		DenyPolicies: PoliciesByNamespace{
+			"oso:0:zone/foo.com":                   {3: denyFoo},
+			"oso:${principal.org_id}:zone/*":       {4: denyAllButTeam},
+			"oso:0:zone/${principal.tag/team}.com": {5: denyTeam},
+		},
+	}
+
+	t.Run("substituted", func(t *testing.T) {
+		got := ep.ForPrincipal(roles.Principal{UserID: 1, OrgID: 2, Name: "guybrush", Tags: map[string]string{"team": "pirates"}})
+		assert.Equal(t, PoliciesByNamespace{
+			"oso:2:zone/*":           {1: {ID: 1, Effect: "allow", Actions: []string{"view"}, Resource: "oso:2:zone/*", Conditions: map[int]*roles.Condition{}}},
+			"oso:0:zone/pirates.com": {2: {ID: 2, Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/pirates.com", Conditions: map[int]*roles.Condition{}}},
+		}, got.AllowPolicies)
+		assert.Equal(t, PoliciesByNamespace{
+			"oso:0:zone/foo.com": {3: denyFoo},
+			"oso:2:zone/*": {4: {
+				ID: 4, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:2:zone/*",
+				NotResourceNames: []roles.PolicyResourceName{"oso:2:zone/pirates.com"},
+				Conditions:       map[int]*roles.Condition{1: {ID: 1, Type: "matchSuffix", Value: "pirates.com"}},
+			}},
+			"oso:0:zone/pirates.com": {5: {ID: 5, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:0:zone/pirates.com", Conditions: map[int]*roles.Condition{}}},
+		}, got.DenyPolicies)
+	})
+
+	t.Run("unresolved policies dropped", func(t *testing.T) {
+		got := ep.ForPrincipal(roles.Principal{UserID: 1, OrgID: 2, Name: "guybrush"})
+		assert.Len(t, got.AllowPolicies, 1)
+		assert.Contains(t, got.AllowPolicies, "oso:2:zone/*")
+	})
+
+	t.Run("unresolved deny exclusions exclude nothing", func(t *testing.T) {
+		got := ep.ForPrincipal(roles.Principal{UserID: 1, OrgID: 2, Name: "guybrush"})
+		assert.Equal(t, PoliciesByNamespace{
+			"oso:0:zone/foo.com": {3: denyFoo},
+			"oso:2:zone/*": {4: {
+				ID: 4, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:2:zone/*", Conditions: map[int]*roles.Condition{},
+			}},
+		}, got.DenyPolicies)
+	})
+}
+
+func TestEffectivePerms_ForOrgTree(t *testing.T) {
+	viewOrg := &roles.RolePolicy{ID: 1, Effect: "allow", Actions: []string{"view"}, Resource: "oso:1:zone/*"}
+	denyFoo := &roles.RolePolicy{ID: 2, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:2:zone/foo.com"}
+	ep := EffectivePerms{
+		AllowPolicies: PoliciesByNamespace{"oso:1:zone/*": {1: viewOrg}},
+		DenyPolicies:  PoliciesByNamespace{"oso:2:zone/foo.com": {2: denyFoo}},
+	}
+
+	t.Run("inherited by descendants", func(t *testing.T) {
+		got := ep.ForOrgTree(roles.OrgTree{2: 1, 3: 2})
+		assert.Equal(t, []string{"oso:1:zone/*", "oso:2:zone/*", "oso:3:zone/*"}, namespaces(got.AllowPolicies))
+		assert.Equal(t, []string{"oso:2:zone/foo.com", "oso:3:zone/foo.com"}, namespaces(got.DenyPolicies))
+		assert.Equal(t, roles.PolicyResourceName("oso:3:zone/foo.com"), got.DenyPolicies["oso:3:zone/foo.com"][2].Resource)
+	})
+
+	t.Run("OU moved between parents", func(t *testing.T) {
+		got := ep.ForOrgTree(roles.OrgTree{2: 1, 3: 1})
+		assert.Equal(t, []string{"oso:1:zone/*", "oso:2:zone/*", "oso:3:zone/*"}, namespaces(got.AllowPolicies))
+		assert.Equal(t, []string{"oso:2:zone/foo.com"}, namespaces(got.DenyPolicies))
+	})
+
+	t.Run("no hierarchy", func(t *testing.T) {
+		assert.Equal(t, ep, ep.ForOrgTree(roles.OrgTree{}))
+	})
+}
+
+// namespaces returns the namespaces of ps in order
+func namespaces(ps PoliciesByNamespace) []string {
+	var ns []string
+	for n := range ps {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
@@ -0,0 +1,116 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"strings"
+	"time"
+)
+
+// Decision is an authorization decision made for a user, recorded so the access users actually use can be analyzed
+type Decision struct {
+	DecisionID   int       `boil:"decision_id" json:"decision_id"`
+	OccurredAt   time.Time `boil:"occurred_at" json:"occurred_at"`
+	OrgID        int       `boil:"org_id" json:"org_id"`
+	UserID       int       `boil:"user_id" json:"user_id"`
+	Action       string    `boil:"action" json:"action"`
+	ResourceName string    `boil:"resource_name" json:"resource_name"`
+	Allowed      bool      `boil:"allowed" json:"allowed"`
+	// PolicyIDs are the allow policies that applied to an allowed decision
+	PolicyIDs types.Int64Array `boil:"policy_ids" json:"policy_ids"`
+}
+
+// DecisionFilter selects the decisions of an org occurring at or after Since.  A zero UserID selects the decisions of
+// every user, and PolicyIDs, if any, select only allowed decisions one of them applied to.
+type DecisionFilter struct {
+	OrgID     int
+	UserID    int
+	PolicyIDs []int
+	Since     time.Time
+}
+
+// Matches returns true if d is selected by f
+func (f DecisionFilter) Matches(d *Decision) bool {
+	if d.OrgID != f.OrgID || (f.UserID != 0 && d.UserID != f.UserID) || d.OccurredAt.Before(f.Since) {
+		return false
+	}
+	if len(f.PolicyIDs) == 0 {
+		return true
+	}
+	for _, id := range d.PolicyIDs {
+		for _, fID := range f.PolicyIDs {
+			if int(id) == fID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decisionInsertRows is how many decisions are inserted by each statement, keeping its parameters under postgres'
+// limit
+const decisionInsertRows = 1000
+
+// RecordDecisions records ds in one transaction, inserting up to decisionInsertRows decisions a statement
+func (ds *datastore) RecordDecisions(ctx context.Context, decisions []*Decision) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		for start := 0; start < len(decisions); start += decisionInsertRows {
+			end := start + decisionInsertRows
+			if end > len(decisions) {
+				end = len(decisions)
+			}
+			values := make([]string, 0, end-start)
+			args := make([]interface{}, 0, 7*(end-start))
+			for _, d := range decisions[start:end] {
+				policyIDs := d.PolicyIDs
+				if policyIDs == nil {
+					policyIDs = types.Int64Array{}
+				}
+				n := len(args)
+				values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+				args = append(args, d.OccurredAt, d.OrgID, d.UserID, d.Action, d.ResourceName, d.Allowed, policyIDs)
+			}
+			if _, err := tx.ExecContext(ctx, `insert into decision (occurred_at, org_id, user_id, action, resource_name,
+				allowed, policy_ids) values `+strings.Join(values, ", "), args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PruneDecisions deletes the decisions that occurred before before
+func (ds *datastore) PruneDecisions(ctx context.Context, before time.Time) (int64, error) {
+	res, err := ds.db.ExecContext(ctx, `delete from decision where occurred_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ListDecisions returns the decisions selected by f, newest first
+func (ds *datastore) ListDecisions(ctx context.Context, f DecisionFilter) ([]*Decision, error) {
+	where := []string{"org_id = $1", "occurred_at >= $2"}
+	args := []interface{}{f.OrgID, f.Since}
+	if f.UserID != 0 {
+		args = append(args, f.UserID)
+		where = append(where, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if len(f.PolicyIDs) != 0 {
+		ids := make(types.Int64Array, len(f.PolicyIDs))
+		for i, id := range f.PolicyIDs {
+			ids[i] = int64(id)
+		}
+		args = append(args, ids)
+		where = append(where, fmt.Sprintf("policy_ids && $%d", len(args)))
+	}
+
+	var decisions []*Decision
+	err := queries.Raw(`select decision_id, occurred_at, org_id, user_id, action, resource_name, allowed, policy_ids
+		from decision where `+strings.Join(where, " and ")+` order by decision_id desc`, args...,
+	).Bind(ctx, ds.db, &decisions)
+	return decisions, err
+}
@@ -0,0 +1,34 @@
+package datastore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"testing"
+	"time"
+)
+
+func TestDecisionFilter_Matches(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	d := &Decision{OccurredAt: now, OrgID: 1, UserID: 2, Action: "view", Allowed: true, PolicyIDs: types.Int64Array{3, 4}}
+	tests := []struct {
+		name string
+		f    DecisionFilter
+		exp  bool
+	}{
+		{name: "org", f: DecisionFilter{OrgID: 1}, exp: true},
+		{name: "other org", f: DecisionFilter{OrgID: 2}},
+		{name: "user", f: DecisionFilter{OrgID: 1, UserID: 2, Since: now}, exp: true},
+		{name: "other user", f: DecisionFilter{OrgID: 1, UserID: 3}},
+		{name: "before since", f: DecisionFilter{OrgID: 1, Since: now.Add(time.Second)}},
+		{name: "policy", f: DecisionFilter{OrgID: 1, PolicyIDs: []int{5, 4}}, exp: true},
+		{name: "other policies", f: DecisionFilter{OrgID: 1, PolicyIDs: []int{5}}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.exp, tt.f.Matches(d))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+)
+
+// NewOrgTree returns the hierarchy of the orgs in os
+func NewOrgTree(os models.OrgSlice) roles.OrgTree {
+	t := roles.OrgTree{}
+	for _, o := range os {
+		if o.ParentID.Valid {
+			t[o.OrgID] = o.ParentID.Int
+		}
+	}
+	return t
+}
+
+func (ds *datastore) GetOrgTree(ctx context.Context) (roles.OrgTree, error) {
+	os, err := models.Orgs(models.OrgWhere.ParentID.IsNotNull()).All(ctx, ds.db)
+	if err != nil {
+		return nil, err
+	}
+	return NewOrgTree(os), nil
+}
+
+// MoveOrg makes parentID the parent of an org, or makes the org a root if parentID is null
+func (ds *datastore) MoveOrg(ctx context.Context, orgID int, parentID null.Int) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		// locking every org serializes moves, which could otherwise create a cycle between them
+		os, err := models.Orgs(qm.For("update")).All(ctx, tx)
+		if err != nil {
+			return err
+		}
+		ids := map[int]bool{}
+		for _, o := range os {
+			ids[o.OrgID] = true
+		}
+		if !ids[orgID] || (parentID.Valid && !ids[parentID.Int]) {
+			return sql.ErrNoRows
+		}
+		if parentID.Valid {
+			if err := NewOrgTree(os).CheckMove(orgID, parentID.Int); err != nil {
+				return err
+			}
+		}
+		_, err = models.Orgs(models.OrgWhere.OrgID.EQ(orgID)).UpdateAll(ctx, tx, models.M{"parent_id": parentID})
+		return err
+	})
+}
+
+func (ds *datastore) ListOrgRoles(ctx context.Context, orgID int) (models.RoleSlice, error) {
+	return models.Roles(
+		qm.InnerJoin("org_roles o on o.role_id = role.role_id"),
+		qm.Where("o.org_id = ?", orgID),
+		qm.OrderBy("role.role_id"),
+	).All(ctx, ds.db)
+}
+
+func (ds *datastore) BindOrgRole(ctx context.Context, orgID, roleID int) error {
+	_, err := ds.db.ExecContext(ctx, `insert into org_roles (org_id, role_id) values ($1, $2)
+		on conflict (org_id, role_id) do nothing`, orgID, roleID)
+	return err
+}
+
+func (ds *datastore) UnbindOrgRole(ctx context.Context, orgID, roleID int) error {
+	_, err := ds.db.ExecContext(ctx, `delete from org_roles where org_id = $1 and role_id = $2`, orgID, roleID)
+	return err
+}
+
+// userOrgs returns the IDs of the org of u and its ancestors in t, whose bound roles apply to u
+func userOrgs(u *models.User, t roles.OrgTree) []interface{} {
+	orgs := []interface{}{u.OrgID}
+	for _, a := range t.Ancestors(u.OrgID) {
+		orgs = append(orgs, a)
+	}
+	return orgs
+}
@@ -0,0 +1,88 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+)
+
+// The kinds of policy, which determine who owns a policy and may change it
+const (
+	// PolicyKindManaged policies are shared by every org and can't be changed through the admin API
+	PolicyKindManaged = "managed"
+	// PolicyKindOrg policies belong to an org and may be attached to any of its roles
+	PolicyKindOrg = "org"
+	// PolicyKindInline policies belong to a single role, and are deleted with it
+	PolicyKindInline = "inline"
+)
+
+// PolicyUsage is how widely a policy is used, for judging the impact of changing or deleting it
+type PolicyUsage struct {
+	PolicyID int `json:"policy_id"`
+	// Roles is the number of roles the policy is attached to, and Orgs the number of orgs they belong to
+	Roles int `json:"roles"`
+	Orgs  int `json:"orgs"`
+	// Users is the number of users bound to those roles
+	Users int `json:"users"`
+}
+
+// ListPoliciesByOrgID returns the managed policies and the policies owned by an org, including the inline policies of
+// its roles
+func (ds *datastore) ListPoliciesByOrgID(ctx context.Context, orgID int) (models.PolicySlice, error) {
+	return models.Policies(
+		qm.Where("kind = ?", PolicyKindManaged),
+		qm.Or("owner_org_id = ?", orgID),
+		qm.OrderBy("policy_id"),
+	).All(ctx, ds.db)
+}
+
+// CreatePolicy creates a policy and its first version, attaching an inline policy to its role
+func (ds *datastore) CreatePolicy(ctx context.Context, p *models.Policy) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		if err := p.Insert(ctx, tx, boil.Infer()); err != nil {
+			return err
+		}
+		if p.Kind == PolicyKindInline {
+			r := &models.Role{RoleID: p.OwnerRoleID}
+			if err := r.AddPolicies(ctx, tx, false, p); err != nil {
+				return err
+			}
+		}
+		return recordPolicyVersion(ctx, tx, p.PolicyID)
+	})
+}
+
+func (ds *datastore) GetPolicyUsage(ctx context.Context, policyID int) (*PolicyUsage, error) {
+	if _, err := models.FindPolicy(ctx, ds.db, policyID); err != nil {
+		return nil, err
+	}
+	u := &PolicyUsage{PolicyID: policyID}
+	err := ds.db.QueryRowContext(ctx, `select count(distinct rp.role_id), count(distinct r.org_id), count(distinct ur.user_id)
+		from role_policies rp
+		inner join role r on r.role_id = rp.role_id
+		left join user_roles ur on ur.role_id = rp.role_id
+		where rp.policy_id = $1`, policyID).Scan(&u.Roles, &u.Orgs, &u.Users)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// deleteInlinePolicies deletes the inline policies of the role with the given ID with exec
+func deleteInlinePolicies(ctx context.Context, exec boil.ContextExecutor, roleID int) error {
+	ps, err := models.Policies(
+		models.PolicyWhere.Kind.EQ(PolicyKindInline),
+		models.PolicyWhere.OwnerRoleID.EQ(roleID),
+	).All(ctx, exec)
+	if err != nil {
+		return err
+	}
+	for _, p := range ps {
+		if err := deletePolicy(ctx, exec, p.PolicyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
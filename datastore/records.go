@@ -0,0 +1,107 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"strings"
+)
+
+// defaultTTL is the TTL of records created without one, in seconds
+const defaultTTL = 300
+
+var (
+	// ErrBadRecordName is returned when a record's name isn't its zone's name or a subdomain of it
+	ErrBadRecordName = errors.New("record name must be the zone's name or a subdomain of it")
+	// ErrBadRecordType is returned when a record's type isn't a supported DNS record type
+	ErrBadRecordType = errors.New("record type must be one of A, AAAA, CNAME, MX, NS or TXT")
+	// ErrMissingRecordValue is returned when a record has no value
+	ErrMissingRecordValue = errors.New("record value is required")
+)
+
+// recordTypes are the supported DNS record types
+var recordTypes = map[string]bool{"A": true, "AAAA": true, "CNAME": true, "MX": true, "NS": true, "TXT": true}
+
+// Record is a DNS record of a zone.  Its resource name is nested under its zone's, as
+// oso:<org>:zone/<zone>/record/<name>, so policies on the zone cover its records.
+type Record struct {
+	RecordID int `boil:"record_id" json:"record_id"`
+	ZoneID   int `boil:"zone_id" json:"zone_id"`
+	// Name is the fully qualified domain name of the record, e.g. www.gmail.com in the zone gmail.com
+	Name         string `boil:"name" json:"name"`
+	Type         string `boil:"type" json:"type"`
+	Value        string `boil:"value" json:"value"`
+	TTL          int    `boil:"ttl" json:"ttl"`
+	ResourceName string `boil:"resource_name" json:"resource_name"`
+}
+
+// InZone validates r as a record of zone z, setting its zone, resource name and default TTL
+func (r *Record) InZone(z *models.Zone) error {
+	name := strings.ToLower(strings.TrimSuffix(r.Name, "."))
+	if name != z.Name && !strings.HasSuffix(name, "."+z.Name) || strings.ContainsAny(name, "/:*?[]{}") {
+		return ErrBadRecordName
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	r.Name, r.ZoneID = name, z.ZoneID
+	r.ResourceName = fmt.Sprintf("%s/record/%s", z.ResourceName, name)
+	return nil
+}
+
+// Validate returns an error if r's type or value are invalid, and sets its default TTL
+func (r *Record) Validate() error {
+	r.Type = strings.ToUpper(r.Type)
+	if !recordTypes[r.Type] {
+		return ErrBadRecordType
+	}
+	if r.Value == "" {
+		return ErrMissingRecordValue
+	}
+	if r.TTL <= 0 {
+		r.TTL = defaultTTL
+	}
+	return nil
+}
+
+const selectRecords = `select record_id, zone_id, name, type, value, ttl, resource_name from record`
+
+// ListRecordsByZoneID returns the records of a zone ordered by name and type
+func (ds *datastore) ListRecordsByZoneID(ctx context.Context, zoneID int) ([]*Record, error) {
+	var rs []*Record
+	err := queries.Raw(selectRecords+" where zone_id = $1 order by name, type", zoneID).Bind(ctx, ds.db, &rs)
+	return rs, err
+}
+
+func (ds *datastore) FindRecordByID(ctx context.Context, id int) (*Record, error) {
+	var r Record
+	if err := queries.Raw(selectRecords+" where record_id = $1", id).Bind(ctx, ds.db, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateRecord creates a record validated with InZone
+func (ds *datastore) CreateRecord(ctx context.Context, r *Record) error {
+	row := ds.db.QueryRowContext(ctx, `insert into record (zone_id, name, type, value, ttl, resource_name)
+		values ($1, $2, $3, $4, $5, $6) returning record_id`,
+		r.ZoneID, r.Name, r.Type, r.Value, r.TTL, r.ResourceName,
+	)
+	return row.Scan(&r.RecordID)
+}
+
+// UpdateRecord updates the type, value and TTL of a record validated with Validate.  Its name, and so its resource
+// name, can't change.
+func (ds *datastore) UpdateRecord(ctx context.Context, r *Record) error {
+	_, err := ds.db.ExecContext(ctx, `update record set type = $2, value = $3, ttl = $4 where record_id = $1`,
+		r.RecordID, r.Type, r.Value, r.TTL,
+	)
+	return err
+}
+
+func (ds *datastore) DeleteRecordByID(ctx context.Context, id int) error {
+	_, err := ds.db.ExecContext(ctx, `delete from record where record_id = $1`, id)
+	return err
+}
@@ -0,0 +1,62 @@
+package datastore
+
+import (
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecord_InZone(t *testing.T) {
+	t.Parallel()
+	z := &models.Zone{ZoneID: 1, Name: "gmail.com", ResourceName: "oso:0:zone/gmail.com"}
+	tests := []struct {
+		name   string
+		r      Record
+		exp    Record
+		expErr error
+	}{
+		{
+			name: "subdomain",
+			r:    Record{Name: "www.gmail.com", Type: "a", Value: "192.0.2.10"},
+			exp: Record{ZoneID: 1, Name: "www.gmail.com", Type: "A", Value: "192.0.2.10", TTL: 300,
+				ResourceName: "oso:0:zone/gmail.com/record/www.gmail.com"},
+		},
+		{
+			name: "apex",
+			r:    Record{Name: "Gmail.com.", Type: "MX", Value: "10 mx.gmail.com", TTL: 60},
+			exp: Record{ZoneID: 1, Name: "gmail.com", Type: "MX", Value: "10 mx.gmail.com", TTL: 60,
+				ResourceName: "oso:0:zone/gmail.com/record/gmail.com"},
+		},
+		{
+			name:   "other zone",
+			r:      Record{Name: "www.notgmail.com", Type: "A", Value: "192.0.2.10"},
+			expErr: ErrBadRecordName,
+		},
+		{
+			name:   "pattern",
+			r:      Record{Name: "*.gmail.com", Type: "A", Value: "192.0.2.10"},
+			expErr: ErrBadRecordName,
+		},
+		{
+			name:   "unsupported type",
+			r:      Record{Name: "www.gmail.com", Type: "SRV", Value: "0 5 5060 sip.gmail.com"},
+			expErr: ErrBadRecordType,
+		},
+		{
+			name:   "missing value",
+			r:      Record{Name: "www.gmail.com", Type: "A"},
+			expErr: ErrMissingRecordValue,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.r.InZone(z)
+			assert.Equal(t, tt.expErr, err)
+			if err == nil {
+				assert.Equal(t, tt.exp, tt.r)
+			}
+		})
+	}
+}
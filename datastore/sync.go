@@ -0,0 +1,311 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"go.uber.org/zap"
+)
+
+// Syncer reads the IAM data of an org as a policy document and applies plans to it
+type Syncer interface {
+	// LoadDocument returns the IAM data of the org with the given name, or nil if there's no such org.  The policies
+	// of an org are the org policies attached to its roles.  Managed policies are referred to by name and inline
+	// policies aren't managed by policy files.
+	LoadDocument(ctx context.Context, org string) (*policyfile.Document, error)
+	// Apply makes the changes in p in a single transaction
+	Apply(ctx context.Context, p *policyfile.Plan) error
+	// CreatePolicies creates policies of an org, their conditions and their first versions in a single transaction
+	CreatePolicies(ctx context.Context, orgID int, ps []policyfile.Policy) (models.PolicySlice, error)
+}
+
+// NewSyncer returns a Syncer for the IAM data in db
+func NewSyncer(db *sql.DB, l *zap.SugaredLogger) Syncer {
+	return &datastore{db: db, logger: l}
+}
+
+func (ds *datastore) LoadDocument(ctx context.Context, org string) (*policyfile.Document, error) {
+	o, err := models.Orgs(qm.Where("name = ?", org)).One(ctx, ds.db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &policyfile.Document{OrgID: o.OrgID, Org: o.Name}
+
+	// roles created to grant access requests aren't managed by policy files either
+	rs, err := models.Roles(
+		qm.Where("org_id = ?", o.OrgID),
+		qm.Where("role_id not in (select grant_role_id from access_request where role_id = 0)"),
+		qm.OrderBy("role_id"),
+		qm.Load(models.RoleRels.Policies+"."+models.PolicyRels.Conditions),
+	).All(ctx, ds.db)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	for _, r := range rs {
+		role := policyfile.Role{ID: r.RoleID, Name: r.Name}
+		for _, p := range r.R.Policies {
+			switch p.Kind {
+			case PolicyKindManaged:
+				role.ManagedPolicies = append(role.ManagedPolicies, p.Name)
+				continue
+			case PolicyKindInline:
+				continue
+			}
+			role.Policies = append(role.Policies, p.Name)
+			if !seen[p.PolicyID] {
+				seen[p.PolicyID] = true
+				d.Policies = append(d.Policies, policyfile.PolicyFromModel(p, p.R.Conditions))
+			}
+		}
+		d.Roles = append(d.Roles, role)
+	}
+
+	us, err := models.Users(
+		qm.Where("org_id = ?", o.OrgID),
+		qm.OrderBy("user_id"),
+		qm.Load(models.UserRels.Roles),
+	).All(ctx, ds.db)
+	if err != nil {
+		return nil, err
+	}
+	// time-bound bindings aren't managed by policy files, so applying leaves them alone
+	timeBound, err := timeBoundBindings(ctx, ds.db, o.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range us {
+		user := policyfile.User{ID: u.UserID, Name: u.Name, APIKey: u.APIKey}
+		if user.Tags, err = listUserTags(ctx, ds.db, u.UserID); err != nil {
+			return nil, err
+		}
+		if len(user.Tags) == 0 {
+			user.Tags = nil
+		}
+		for _, r := range u.R.Roles {
+			if !timeBound[[2]int{u.UserID, r.RoleID}] {
+				user.Roles = append(user.Roles, r.Name)
+			}
+		}
+		d.Users = append(d.Users, user)
+	}
+	return d, nil
+}
+
+func (ds *datastore) Apply(ctx context.Context, p *policyfile.Plan) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		a := &applier{orgID: p.OrgID, created: map[policyfile.Kind]map[string]int{
+			policyfile.KindPolicy: {}, policyfile.KindRole: {}, policyfile.KindUser: {},
+		}}
+		for _, c := range p.Changes {
+			if err := a.apply(ctx, tx, c); err != nil {
+				return fmt.Errorf("%s: %w", c, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (ds *datastore) CreatePolicies(ctx context.Context, orgID int, ps []policyfile.Policy) (models.PolicySlice, error) {
+	created := make(models.PolicySlice, len(ps))
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		for i, p := range ps {
+			if err := p.Validate(); err != nil {
+				return fmt.Errorf("policy %q: %w", p.Name, err)
+			}
+			pol := p.Model()
+			pol.PolicyID, pol.Kind, pol.OwnerOrgID = 0, PolicyKindOrg, orgID
+			if err := pol.Insert(ctx, tx, boil.Infer()); err != nil {
+				return err
+			}
+			if err := setConditions(ctx, tx, pol, p.Conditions); err != nil {
+				return err
+			}
+			if err := recordPolicyVersion(ctx, tx, pol.PolicyID); err != nil {
+				return err
+			}
+			created[i] = pol
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// applier applies the changes of a plan, tracking the IDs of the objects it creates
+type applier struct {
+	orgID   int
+	created map[policyfile.Kind]map[string]int
+}
+
+// id returns the ID of the object of kind named name, which is id unless the object was created by the plan
+func (a *applier) id(kind policyfile.Kind, name string, id int) int {
+	if id != 0 {
+		return id
+	}
+	return a.created[kind][name]
+}
+
+func (a *applier) apply(ctx context.Context, exec boil.ContextExecutor, c policyfile.Change) error {
+	switch c.Op {
+	case policyfile.Create:
+		return a.create(ctx, exec, c)
+	case policyfile.Update:
+		if c.Kind == policyfile.KindUser {
+			return a.updateUser(ctx, exec, c)
+		}
+		if err := c.Policy.Validate(); err != nil {
+			return err
+		}
+		pol := c.Policy.Model()
+		pol.Kind, pol.OwnerOrgID = PolicyKindOrg, a.orgID
+		if _, err := pol.Update(ctx, exec, boil.Infer()); err != nil {
+			return err
+		}
+		if err := setConditions(ctx, exec, pol, c.Policy.Conditions); err != nil {
+			return err
+		}
+		return recordPolicyVersion(ctx, exec, pol.PolicyID)
+	case policyfile.Bind, policyfile.Unbind:
+		id, targetID := a.id(c.Kind, c.Name, c.ID), a.id(c.TargetKind(), c.Target, c.TargetID)
+		if c.Managed {
+			p, err := models.Policies(models.PolicyWhere.Kind.EQ(PolicyKindManaged), models.PolicyWhere.Name.EQ(c.Name)).One(ctx, exec)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("unknown managed policy %q", c.Name)
+			}
+			if err != nil {
+				return err
+			}
+			id = p.PolicyID
+		}
+		if c.Kind == policyfile.KindPolicy {
+			r, pol := &models.Role{RoleID: targetID}, &models.Policy{PolicyID: id}
+			if c.Op == policyfile.Bind {
+				return r.AddPolicies(ctx, exec, false, pol)
+			}
+			return r.RemovePolicies(ctx, exec, pol)
+		}
+		u, r := &models.User{UserID: targetID}, &models.Role{RoleID: id}
+		if c.Op == policyfile.Bind {
+			// a role bound by a policy file is bound permanently, even if it was time-bound
+			_, err := exec.ExecContext(ctx, `insert into user_roles (user_id, role_id) values ($1, $2)
+				on conflict (user_id, role_id) do update set not_before = null, expires_at = null`, u.UserID, r.RoleID)
+			return err
+		}
+		return u.RemoveRoles(ctx, exec, r)
+	case policyfile.Delete:
+		switch c.Kind {
+		case policyfile.KindUser:
+			return deleteUser(ctx, exec, c.ID)
+		case policyfile.KindRole:
+			return deleteRole(ctx, exec, c.ID)
+		default:
+			return deletePolicy(ctx, exec, c.ID)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", c.Op)
+	}
+}
+
+func (a *applier) create(ctx context.Context, exec boil.ContextExecutor, c policyfile.Change) error {
+	switch c.Kind {
+	case policyfile.KindOrg:
+		o := &models.Org{Name: c.Name}
+		if err := o.Insert(ctx, exec, boil.Infer()); err != nil {
+			return err
+		}
+		a.orgID = o.OrgID
+	case policyfile.KindPolicy:
+		if err := c.Policy.Validate(); err != nil {
+			return err
+		}
+		pol := c.Policy.Model()
+		pol.Kind, pol.OwnerOrgID = PolicyKindOrg, a.orgID
+		if err := pol.Insert(ctx, exec, boil.Infer()); err != nil {
+			return err
+		}
+		a.created[c.Kind][c.Name] = pol.PolicyID
+		if err := setConditions(ctx, exec, pol, c.Policy.Conditions); err != nil {
+			return err
+		}
+		return recordPolicyVersion(ctx, exec, pol.PolicyID)
+	case policyfile.KindRole:
+		r := &models.Role{Name: c.Name, OrgID: a.orgID}
+		if err := r.Insert(ctx, exec, boil.Infer()); err != nil {
+			return err
+		}
+		a.created[c.Kind][c.Name] = r.RoleID
+	case policyfile.KindUser:
+		u := c.User.Model(a.orgID)
+		if err := u.Insert(ctx, exec, boil.Infer()); err != nil {
+			return err
+		}
+		a.created[c.Kind][c.Name] = u.UserID
+		return setUserTags(ctx, exec, u.UserID, c.User.Tags)
+	}
+	return nil
+}
+
+// updateUser updates the API key and tags of a user, if they're in the diff of c
+func (a *applier) updateUser(ctx context.Context, exec boil.ContextExecutor, c policyfile.Change) error {
+	for _, field := range c.Diff {
+		switch field {
+		case "api_key":
+			if _, err := c.User.Model(a.orgID).Update(ctx, exec, boil.Whitelist(models.UserColumns.APIKey)); err != nil {
+				return err
+			}
+		case "tags":
+			if err := setUserTags(ctx, exec, c.ID, c.User.Tags); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// timeBoundBindings returns the user and role IDs of the bindings in an org that have a window
+func timeBoundBindings(ctx context.Context, exec boil.ContextExecutor, orgID int) (map[[2]int]bool, error) {
+	rows, err := exec.QueryContext(ctx, `select ur.user_id, ur.role_id from user_roles ur
+		inner join "user" u on u.user_id = ur.user_id
+		where u.org_id = $1 and (ur.not_before is not null or ur.expires_at is not null)`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bindings := map[[2]int]bool{}
+	for rows.Next() {
+		var b [2]int
+		if err := rows.Scan(&b[0], &b[1]); err != nil {
+			return nil, err
+		}
+		bindings[b] = true
+	}
+	return bindings, rows.Err()
+}
+
+// setConditions replaces the conditions attached to p, reusing existing conditions with the same type and value
+func setConditions(ctx context.Context, exec boil.ContextExecutor, p *models.Policy, conds []policyfile.Condition) error {
+	var cs models.ConditionSlice
+	for _, fc := range conds {
+		c, err := models.Conditions(qm.Where("type = ? and value = ?", fc.Type, fc.Value)).One(ctx, exec)
+		if errors.Is(err, sql.ErrNoRows) {
+			c = fc.Model()
+			err = c.Insert(ctx, exec, boil.Infer())
+		}
+		if err != nil {
+			return err
+		}
+		cs = append(cs, c)
+	}
+	return p.SetConditions(ctx, exec, false, cs...)
+}
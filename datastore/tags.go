@@ -0,0 +1,42 @@
+package datastore
+
+import (
+	"context"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// ListUserTags returns the tags of the user with the given ID
+func (ds *datastore) ListUserTags(ctx context.Context, userID int) (map[string]string, error) {
+	return listUserTags(ctx, ds.db, userID)
+}
+
+func listUserTags(ctx context.Context, exec boil.ContextExecutor, userID int) (map[string]string, error) {
+	rows, err := exec.QueryContext(ctx, `select key, value from user_tag where user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		tags[k] = v
+	}
+	return tags, rows.Err()
+}
+
+// setUserTags replaces the tags of the user with the given ID
+func setUserTags(ctx context.Context, exec boil.ContextExecutor, userID int, tags map[string]string) error {
+	if _, err := exec.ExecContext(ctx, `delete from user_tag where user_id = $1`, userID); err != nil {
+		return err
+	}
+	for k, v := range tags {
+		_, err := exec.ExecContext(ctx, `insert into user_tag (user_id, key, value) values ($1, $2, $3)`, userID, k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"time"
+)
+
+// Kinds of things whose last use is tracked
+const (
+	UsageKindAPIKey = "api_key"
+	UsageKindPolicy = "policy"
+	UsageKindRole   = "role"
+)
+
+// Usage is the allow policies that contributed to a user's allowed decisions, and when the last of them was made.  The
+// user's API key and the roles bound to the user, or to its org and the org's ancestors, that the policies are attached
+// to were used with them.
+type Usage struct {
+	UserID    int
+	OrgID     int
+	PolicyIDs []int
+	UsedAt    time.Time
+}
+
+// Unused is a role, policy or API key, identified by the ID of its user, that hasn't contributed to an allowed
+// decision since a report's cutoff
+type Unused struct {
+	Kind string `boil:"kind" json:"kind"`
+	ID   int    `boil:"id" json:"id"`
+	Name string `boil:"name" json:"name"`
+	// LastUsedAt is nil if it's never been used since usage was first tracked
+	LastUsedAt *time.Time `boil:"last_used_at" json:"last_used_at,omitempty"`
+}
+
+// RecordUsage records the last use of the API keys, policies and roles in us, keeping later uses already recorded
+func (ds *datastore) RecordUsage(ctx context.Context, us []*Usage) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		for _, u := range us {
+			ids := make(types.Int64Array, len(u.PolicyIDs))
+			for i, id := range u.PolicyIDs {
+				ids[i] = int64(id)
+			}
+			if _, err := tx.ExecContext(ctx, `insert into last_used (kind, id, used_at) values ($1, $2, $3)
+				on conflict (kind, id) do update set used_at = greatest(last_used.used_at, excluded.used_at)`,
+				UsageKindAPIKey, u.UserID, u.UsedAt,
+			); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `insert into last_used (kind, id, used_at)
+				select distinct $1, unnest($2::int[]), $3::timestamptz
+				on conflict (kind, id) do update set used_at = greatest(last_used.used_at, excluded.used_at)`,
+				UsageKindPolicy, ids, u.UsedAt,
+			); err != nil {
+				return err
+			}
+			// roles bound to the user's org and its ancestors apply to the user, like those bound to it
+			if _, err := tx.ExecContext(ctx, `with recursive orgs (org_id) as (
+					select $5::int
+					union
+					select o.parent_id from org o join orgs on o.org_id = orgs.org_id where o.parent_id is not null
+				)
+				insert into last_used (kind, id, used_at)
+				select distinct $1, rp.role_id, $2::timestamptz from role_policies rp
+				where rp.policy_id = any($4) and (
+					rp.role_id in (select ur.role_id from user_roles ur where ur.user_id = $3) or
+					rp.role_id in (select o.role_id from org_roles o where o.org_id in (select org_id from orgs))
+				)
+				on conflict (kind, id) do update set used_at = greatest(last_used.used_at, excluded.used_at)`,
+				UsageKindRole, u.UsedAt, u.UserID, ids, u.OrgID,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListUnused returns the roles, policies attached to them and API keys of an org that haven't been used since since,
+// ordered by kind and ID
+func (ds *datastore) ListUnused(ctx context.Context, orgID int, since time.Time) ([]*Unused, error) {
+	var unused []*Unused
+	err := queries.Raw(`
+		select 'role' as kind, r.role_id as id, r.name, lu.used_at as last_used_at from role r
+		left join last_used lu on lu.kind = 'role' and lu.id = r.role_id
+		where r.org_id = $1 and (lu.used_at is null or lu.used_at < $2)
+		union all
+		select 'policy', p.policy_id, p.name, lu.used_at from policy p
+		left join last_used lu on lu.kind = 'policy' and lu.id = p.policy_id
+		where p.policy_id in (
+			select rp.policy_id from role_policies rp join role r on r.role_id = rp.role_id where r.org_id = $1
+		) and (lu.used_at is null or lu.used_at < $2)
+		union all
+		select 'api_key', u.user_id, u.name, lu.used_at from "user" u
+		left join last_used lu on lu.kind = 'api_key' and lu.id = u.user_id
+		where u.org_id = $1 and (lu.used_at is null or lu.used_at < $2)
+		order by kind, id`, orgID, since,
+	).Bind(ctx, ds.db, &unused)
+	return unused, err
+}
@@ -0,0 +1,269 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"time"
+)
+
+// ErrNoPreviousVersion is returned when rolling back a policy whose default version is its first
+var ErrNoPreviousVersion = errors.New("policy has no version before its default version")
+
+// PolicyVersion is an immutable version of a policy's effect, actions, resource, exclusions and conditions.  A
+// policy's row always holds the content of its default version, so it's the version effective permissions are
+// evaluated with.
+type PolicyVersion struct {
+	PolicyID     int               `boil:"policy_id" json:"policy_id"`
+	Version      int               `boil:"version" json:"version"`
+	Effect       string            `boil:"effect" json:"effect"`
+	Actions      types.StringArray `boil:"actions" json:"actions"`
+	ResourceName string            `boil:"resource_name" json:"resource_name"`
+	Conditions   VersionConditions `boil:"conditions" json:"conditions"`
+	// NotActions and NotResourceNames are the actions and resource names excluded from the version
+	NotActions       types.StringArray `boil:"not_actions" json:"not_actions,omitempty"`
+	NotResourceNames types.StringArray `boil:"not_resource_names" json:"not_resource_names,omitempty"`
+	CreatedAt        time.Time         `boil:"created_at" json:"created_at"`
+	// IsDefault is true if the version is the policy's default version
+	IsDefault bool `boil:"is_default" json:"is_default"`
+}
+
+// Policy returns the content of the version as a policy with the given name
+func (v *PolicyVersion) Policy(name string) policyfile.Policy {
+	return policyfile.Policy{
+		ID:           v.PolicyID,
+		Name:         name,
+		Effect:       v.Effect,
+		Actions:      v.Actions,
+		Resource:     v.ResourceName,
+		Conditions:   v.Conditions,
+		NotActions:   v.NotActions,
+		NotResources: v.NotResourceNames,
+	}
+}
+
+// VersionConditions is the conditions of a policy version, stored as JSON
+type VersionConditions []policyfile.Condition
+
+func (vc VersionConditions) Value() (driver.Value, error) {
+	if vc == nil {
+		vc = VersionConditions{}
+	}
+	b, err := json.Marshal(vc)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (vc *VersionConditions) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, vc)
+	case string:
+		return json.Unmarshal([]byte(src), vc)
+	case nil:
+		*vc = nil
+		return nil
+	default:
+		return fmt.Errorf("can't scan %T into conditions", src)
+	}
+}
+
+// PolicyVersionDiff is the changes between two versions of a policy
+type PolicyVersionDiff struct {
+	PolicyID int      `json:"policy_id"`
+	From     int      `json:"from"`
+	To       int      `json:"to"`
+	Changes  []string `json:"changes"`
+}
+
+// DiffPolicyVersions describes the changes from version from to version to of the policy with versions vs.  to
+// defaults to the default version and from to the version before to.
+func DiffPolicyVersions(vs []*PolicyVersion, from, to int) (*PolicyVersionDiff, error) {
+	byVersion := map[int]*PolicyVersion{}
+	for _, v := range vs {
+		byVersion[v.Version] = v
+		if to == 0 && v.IsDefault {
+			to = v.Version
+		}
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	fv, tv := byVersion[from], byVersion[to]
+	if fv == nil || tv == nil {
+		return nil, sql.ErrNoRows
+	}
+	changes := policyfile.Diff(fv.Policy(""), tv.Policy(""))
+	if changes == nil {
+		changes = []string{}
+	}
+	return &PolicyVersionDiff{PolicyID: tv.PolicyID, From: from, To: to, Changes: changes}, nil
+}
+
+// PreviousPolicyVersion returns the latest of vs before the default version
+func PreviousPolicyVersion(vs []*PolicyVersion) (*PolicyVersion, error) {
+	def := 0
+	for _, v := range vs {
+		if v.IsDefault {
+			def = v.Version
+		}
+	}
+	var prev *PolicyVersion
+	for _, v := range vs {
+		if v.Version < def && (prev == nil || v.Version > prev.Version) {
+			prev = v
+		}
+	}
+	if prev == nil {
+		return nil, ErrNoPreviousVersion
+	}
+	return prev, nil
+}
+
+const selectPolicyVersions = `select pv.policy_id, pv.version, pv.effect, pv.actions, pv.resource_name, pv.conditions,
+	pv.not_actions, pv.not_resource_names, pv.created_at, pv.version = p.default_version as is_default
+	from policy_version pv inner join policy p on p.policy_id = pv.policy_id
+	where pv.policy_id = $1`
+
+func (ds *datastore) ListPolicyVersions(ctx context.Context, policyID int) ([]*PolicyVersion, error) {
+	return listPolicyVersions(ctx, ds.db, policyID)
+}
+
+func listPolicyVersions(ctx context.Context, exec boil.ContextExecutor, policyID int) ([]*PolicyVersion, error) {
+	if _, err := models.FindPolicy(ctx, exec, policyID, models.PolicyColumns.PolicyID); err != nil {
+		return nil, err
+	}
+	var vs []*PolicyVersion
+	err := queries.Raw(selectPolicyVersions+" order by pv.version", policyID).Bind(ctx, exec, &vs)
+	return vs, err
+}
+
+func (ds *datastore) FindPolicyVersion(ctx context.Context, policyID, version int) (*PolicyVersion, error) {
+	var v PolicyVersion
+	err := queries.Raw(selectPolicyVersions+" and pv.version = $2", policyID, version).Bind(ctx, ds.db, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (ds *datastore) CreatePolicyVersion(ctx context.Context, v *PolicyVersion, setDefault bool) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		if err := insertPolicyVersion(ctx, tx, v); err != nil {
+			return err
+		}
+		if !setDefault {
+			return nil
+		}
+		return setDefaultPolicyVersion(ctx, tx, v)
+	})
+}
+
+func (ds *datastore) SetDefaultPolicyVersion(ctx context.Context, policyID, version int) error {
+	return ds.inTx(ctx, func(tx *sql.Tx) error {
+		var v PolicyVersion
+		err := queries.Raw(selectPolicyVersions+" and pv.version = $2", policyID, version).Bind(ctx, tx, &v)
+		if err != nil {
+			return err
+		}
+		return setDefaultPolicyVersion(ctx, tx, &v)
+	})
+}
+
+// RollbackPolicy makes the version before a policy's default version its default version
+func (ds *datastore) RollbackPolicy(ctx context.Context, policyID int) (*PolicyVersion, error) {
+	var prev *PolicyVersion
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		vs, err := listPolicyVersions(ctx, tx, policyID)
+		if err != nil {
+			return err
+		}
+		if prev, err = PreviousPolicyVersion(vs); err != nil {
+			return err
+		}
+		return setDefaultPolicyVersion(ctx, tx, prev)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prev, nil
+}
+
+// insertPolicyVersion inserts v as the next version of its policy, setting its version and creation time.  The
+// policy row is locked until exec's transaction ends so concurrent inserts for the policy can't compute the same
+// version, so exec must be a transaction.
+func insertPolicyVersion(ctx context.Context, exec boil.ContextExecutor, v *PolicyVersion) error {
+	for _, a := range []*types.StringArray{&v.Actions, &v.NotActions, &v.NotResourceNames} {
+		if *a == nil {
+			*a = types.StringArray{}
+		}
+	}
+	if _, err := exec.ExecContext(ctx, `select policy_id from policy where policy_id = $1 for update`, v.PolicyID); err != nil {
+		return err
+	}
+	row := exec.QueryRowContext(ctx, `insert into policy_version (policy_id, version, effect, actions, resource_name,
+		conditions, not_actions, not_resource_names)
+		select $1, coalesce(max(version), 0) + 1, $2, $3, $4, $5, $6, $7 from policy_version where policy_id = $1
+		returning version, created_at`,
+		v.PolicyID, v.Effect, v.Actions, v.ResourceName, v.Conditions, v.NotActions, v.NotResourceNames,
+	)
+	return row.Scan(&v.Version, &v.CreatedAt)
+}
+
+// setDefaultPolicyVersion makes v its policy's default version, copying its content into the policy
+func setDefaultPolicyVersion(ctx context.Context, exec boil.ContextExecutor, v *PolicyVersion) error {
+	p, err := models.FindPolicy(ctx, exec, v.PolicyID)
+	if err != nil {
+		return err
+	}
+	p.Effect, p.Actions, p.ResourceName = v.Effect, v.Actions, v.ResourceName
+	p.NotActions, p.NotResourceNames = v.NotActions, v.NotResourceNames
+	if _, err := p.Update(ctx, exec, boil.Infer()); err != nil {
+		return err
+	}
+	if err := setConditions(ctx, exec, p, v.Conditions); err != nil {
+		return err
+	}
+	_, err = exec.ExecContext(ctx, `update policy set default_version = $2 where policy_id = $1`, v.PolicyID, v.Version)
+	if err == nil {
+		v.IsDefault = true
+	}
+	return err
+}
+
+// recordPolicyVersion records the current content of a policy as a new version and makes it the default
+func recordPolicyVersion(ctx context.Context, exec boil.ContextExecutor, policyID int) error {
+	p, err := models.FindPolicy(ctx, exec, policyID)
+	if err != nil {
+		return err
+	}
+	cs, err := p.Conditions(qm.OrderBy("condition.condition_id")).All(ctx, exec)
+	if err != nil {
+		return err
+	}
+	v := &PolicyVersion{
+		PolicyID:         p.PolicyID,
+		Effect:           p.Effect,
+		Actions:          p.Actions,
+		ResourceName:     p.ResourceName,
+		Conditions:       VersionConditions(policyfile.PolicyFromModel(p, cs).Conditions),
+		NotActions:       p.NotActions,
+		NotResourceNames: p.NotResourceNames,
+	}
+	if err := insertPolicyVersion(ctx, exec, v); err != nil {
+		return err
+	}
+	_, err = exec.ExecContext(ctx, `update policy set default_version = $2 where policy_id = $1`, v.PolicyID, v.Version)
+	return err
+}
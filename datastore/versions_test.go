@@ -0,0 +1,90 @@
+package datastore
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"testing"
+)
+
+func testVersions() []*PolicyVersion {
+	return []*PolicyVersion{
+		{PolicyID: 1, Version: 1, Effect: "allow", Actions: types.StringArray{"view"}, ResourceName: "oso:0:zone/*"},
+		{
+			PolicyID: 1, Version: 2, Effect: "allow", Actions: types.StringArray{"view"}, ResourceName: "oso:0:zone/*",
+			Conditions: VersionConditions{{Type: "matchSuffix", Value: "com"}}, IsDefault: true,
+		},
+		{PolicyID: 1, Version: 3, Effect: "deny", Actions: types.StringArray{"view", "delete"}, ResourceName: "oso:0:zone/*"},
+	}
+}
+
+func TestDiffPolicyVersions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		from, to int
+		exp      *PolicyVersionDiff
+		expErr   error
+	}{
+		{
+			name: "default version and previous",
+			exp:  &PolicyVersionDiff{PolicyID: 1, From: 1, To: 2, Changes: []string{"conditions: [] -> [matchSuffix=com]"}},
+		},
+		{
+			name: "given versions",
+			from: 1,
+			to:   3,
+			exp: &PolicyVersionDiff{PolicyID: 1, From: 1, To: 3, Changes: []string{
+				"effect: allow -> deny", "actions: [view] -> [view delete]",
+			}},
+		},
+		{
+			name: "same version",
+			from: 2,
+			to:   2,
+			exp:  &PolicyVersionDiff{PolicyID: 1, From: 2, To: 2, Changes: []string{}},
+		},
+		{
+			name:   "missing version",
+			from:   1,
+			to:     4,
+			expErr: sql.ErrNoRows,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d, err := DiffPolicyVersions(testVersions(), tt.from, tt.to)
+			assert.ErrorIs(t, err, tt.expErr)
+			assert.Equal(t, tt.exp, d)
+		})
+	}
+}
+
+func TestPreviousPolicyVersion(t *testing.T) {
+	t.Parallel()
+	vs := testVersions()
+	prev, err := PreviousPolicyVersion(vs)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, prev.Version)
+
+	_, err = PreviousPolicyVersion(vs[:1])
+	assert.ErrorIs(t, err, ErrNoPreviousVersion)
+}
+
+func TestVersionConditions(t *testing.T) {
+	t.Parallel()
+	vc := VersionConditions{{Type: "matchSuffix", Value: "com"}}
+	v, err := vc.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"matchSuffix","value":"com"}]`, v)
+
+	var scanned VersionConditions
+	assert.NoError(t, scanned.Scan([]byte(v.(string))))
+	assert.Equal(t, vc, scanned)
+
+	v, err = VersionConditions(nil).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `[]`, v)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultRecommendationWindow is how far back recommendations look at the access used by default
+	defaultRecommendationWindow = 30 * 24 * time.Hour
+	// defaultDecisionFlushInterval is how often the decisions recorded are written
+	defaultDecisionFlushInterval = 5 * time.Second
+	// maxPendingDecisions is how many decisions are recorded before they're written early
+	maxPendingDecisions = 1000
+	// defaultDecisionRetention is how long decisions are kept for by default
+	defaultDecisionRetention = 90 * 24 * time.Hour
+)
+
+var (
+	errBadWindow = errors.New("window must be a positive duration, e.g. 720h")
+	errBadSince  = errors.New("since must be an RFC 3339 time")
+	errBadUserID = errors.New("user_id must be an integer")
+)
+
+// recordDecision tracks the usage of d and records it in the decision audit trail, as configured.  Both only hold d in
+// memory until it's written in the background.
+func (s *Server) recordDecision(d *datastore.Decision) {
+	if s.usage != nil {
+		s.usage.Track(d)
+	}
+	if s.decisions != nil {
+		s.decisions.Record(d)
+	}
+}
+
+// decisionRecorder returns the function the server's decisions are recorded with, or nil if they're neither recorded
+// nor tracked
+func (s *Server) decisionRecorder() func(*datastore.Decision) {
+	if s.decisions == nil && s.usage == nil {
+		return nil
+	}
+	return s.recordDecision
+}
+
+// flushDecisions writes the decisions recorded every interval, or sooner when enough are pending, until ctx is done,
+// and then writes what's left
+func (s *Server) flushDecisions(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.writeDecisions(context.Background())
+			return
+		case <-t.C:
+			s.writeDecisions(ctx)
+		case <-s.decisions.Full():
+			s.writeDecisions(ctx)
+		}
+	}
+}
+
+// writeDecisions writes the decisions recorded.  Decisions that can't be written are logged and kept to be written
+// next time.
+func (s *Server) writeDecisions(ctx context.Context) {
+	if err := s.decisions.Flush(ctx); err != nil {
+		s.logger.Errorw("error writing decisions", "error", err)
+	}
+}
+
+// pruneDecisions deletes the decisions older than the configured retention at now
+func (s *Server) pruneDecisions(ctx context.Context, now time.Time) {
+	n, err := s.admin.PruneDecisions(ctx, now.Add(-s.cfg.DecisionRetention))
+	if err != nil {
+		s.logger.Errorw("error pruning decisions", "error", err)
+		return
+	}
+	if n > 0 {
+		s.logger.Infow("decisions pruned", "count", n)
+	}
+}
+
+// listDecisionsRoute lists the decisions made for the requester's org since the since query param, and only those of
+// the user_id param if it's given
+func (s *Server) listDecisionsRoute(c *fiber.Ctx) error {
+	f := datastore.DecisionFilter{OrgID: reqOrgID(c)}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return s.adminError(c, errBadSince)
+		}
+		f.Since = t
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			return s.adminError(c, errBadUserID)
+		}
+		f.UserID = id
+	}
+	ds, err := s.admin.ListDecisions(context.Background(), f)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if ds == nil {
+		ds = []*datastore.Decision{}
+	}
+	return c.JSON(ds)
+}
+
+// recommendUserRoute recommends least privilege policies for a user from the access they used over the window query
+// param
+func (s *Server) recommendUserRoute(c *fiber.Ctx) error {
+	u, err := s.orgUser(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	since, err := recommendationSince(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	rec, err := iam.RecommendForUser(context.Background(), s.ds, s.admin, u, since)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(rec)
+}
+
+// recommendRoleRoute recommends least privilege policies for a role from the access its users used with it over the
+// window query param
+func (s *Server) recommendRoleRoute(c *fiber.Ctx) error {
+	r, err := s.orgRole(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	since, err := recommendationSince(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	rec, err := iam.RecommendForRole(context.Background(), s.ds, s.admin, r, since)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	return c.JSON(rec)
+}
+
+// recommendationSince returns the start of the window in the request's window query param, which defaults to
+// defaultRecommendationWindow
+func recommendationSince(c *fiber.Ctx) (time.Time, error) {
+	window := defaultRecommendationWindow
+	if w := c.Query("window"); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 {
+			return time.Time{}, errBadWindow
+		}
+		window = d
+	}
+	return time.Now().Add(-window), nil
+}
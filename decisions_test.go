@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_recommendationRoutes(t *testing.T) {
+	t.Parallel()
+
+	// steps run in order against the same admin datastore
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		apiKey  string
+		body    string
+		expCode int
+		expBody string
+		// flush writes the decisions recorded before the step
+		flush bool
+	}{
+		{
+			name:    "view zone",
+			method:  "GET",
+			route:   "/zone/0",
+			apiKey:  "john",
+			expCode: 200,
+		},
+		{
+			name:    "denied delete",
+			method:  "DELETE",
+			route:   "/zone/0",
+			apiKey:  "john",
+			expCode: 403,
+		},
+		{
+			name:    "decisions recorded",
+			method:  "GET",
+			route:   "/iam/decisions?user_id=1",
+			apiKey:  "ada",
+			flush:   true,
+			expCode: 200,
+			expBody: `[{"decision_id":2,"occurred_at":"<time>","org_id":0,"user_id":1,"action":"zone:DeleteZone","resource_name":"oso:0:zone/foo.com",` +
+				`"allowed":false,"policy_ids":[]},` +
+				`{"decision_id":1,"occurred_at":"<time>","org_id":0,"user_id":1,"action":"zone:GetZone","resource_name":"oso:0:zone/foo.com",` +
+				`"allowed":true,"policy_ids":[1]}]`,
+		},
+		{
+			name:    "bad since",
+			method:  "GET",
+			route:   "/iam/decisions?since=yesterday",
+			apiKey:  "ada",
+			expCode: 400,
+			expBody: `{"error":"since must be an RFC 3339 time"}`,
+		},
+		{
+			name:    "narrowed to zone used",
+			method:  "GET",
+			route:   "/iam/users/1/recommendation?window=1h",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `{"since":"<time>","used":[{"action":"zone:GetZone","resource_name":"oso:0:zone/foo.com"}],` +
+				`"policies":[{"name":"john-least-privilege-1","effect":"allow","actions":["zone:GetZone"],"resource":"oso:0:zone/foo.com"}],` +
+				`"added":[{"name":"john-least-privilege-1","effect":"allow","actions":["zone:GetZone"],"resource":"oso:0:zone/foo.com"}],` +
+				`"removed":[{"name":"viewZonesPolicy","effect":"allow","actions":["view"],"resource":"oso:0:zone/*"}]}`,
+		},
+		{
+			name:    "bad window",
+			method:  "GET",
+			route:   "/iam/users/1/recommendation?window=-1h",
+			apiKey:  "ada",
+			expCode: 400,
+			expBody: `{"error":"window must be a positive duration, e.g. 720h"}`,
+		},
+		{
+			name:    "check other zone",
+			method:  "POST",
+			route:   "/authz/check",
+			apiKey:  "john",
+			body:    `{"action": "view", "resource": "oso:0:zone/bar.net"}`,
+			expCode: 200,
+			expBody: `{"decision":"allow","reasons":[{"policy_id":1,"effect":"allow","resource":"oso:0:zone/*","message":"allowed by policy"}]}`,
+		},
+		{
+			name:    "check other zone for principal",
+			method:  "POST",
+			route:   "/authz/batch-check",
+			apiKey:  "ada",
+			body:    `{"principal": 1, "checks": [{"action": "view", "resource": "oso:0:zone/baz.org"}]}`,
+			expCode: 200,
+		},
+		{
+			// checks aren't access, so the zones checked aren't used
+			name:    "role used on zone viewed",
+			method:  "GET",
+			route:   "/iam/roles/1/recommendation",
+			apiKey:  "ada",
+			flush:   true,
+			expCode: 200,
+			expBody: `{"since":"<time>","used":[{"action":"zone:GetZone","resource_name":"oso:0:zone/foo.com"}],` +
+				`"policies":[{"name":"viewZonesRole-least-privilege-1","effect":"allow","actions":["zone:GetZone"],"resource":"oso:0:zone/foo.com"}],` +
+				`"added":[{"name":"viewZonesRole-least-privilege-1","effect":"allow","actions":["zone:GetZone"],"resource":"oso:0:zone/foo.com"}],` +
+				`"removed":[{"name":"viewZones","effect":"allow","actions":["view"],"resource":"oso:0:zone/*"}]}`,
+		},
+		{
+			name:    "checks not recorded",
+			method:  "GET",
+			route:   "/iam/decisions?user_id=1",
+			apiKey:  "ada",
+			flush:   true,
+			expCode: 200,
+			expBody: `[{"decision_id":2,"occurred_at":"<time>","org_id":0,"user_id":1,"action":"zone:DeleteZone","resource_name":"oso:0:zone/foo.com",` +
+				`"allowed":false,"policy_ids":[]},` +
+				`{"decision_id":1,"occurred_at":"<time>","org_id":0,"user_id":1,"action":"zone:GetZone","resource_name":"oso:0:zone/foo.com",` +
+				`"allowed":true,"policy_ids":[1]}]`,
+		},
+	}
+
+	s := NewServer(newTestAuthorizer(t), &mockDatastore{}, newMemAdmin(), newNopLog(), defaultConfig())
+	app := s.setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.flush {
+				require.NoError(t, s.decisions.Flush(context.Background()))
+			}
+			req, _ := http.NewRequest(tt.method, tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", tt.apiKey)
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			if tt.expBody == "" {
+				return
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, timestamps.ReplaceAllString(string(body), `"<time>"`))
+		})
+	}
+}
+
+func Test_pruneDecisions(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	old := &datastore.Decision{OccurredAt: now.Add(-defaultDecisionRetention - time.Hour), Action: "view"}
+	recent := &datastore.Decision{OccurredAt: now.Add(-time.Hour), Action: "delete"}
+
+	admin := newMemAdmin()
+	require.NoError(t, admin.RecordDecisions(context.Background(), []*datastore.Decision{old, recent}))
+	s := NewServer(newTestAuthorizer(t), &mockDatastore{}, admin, newNopLog(), defaultConfig())
+	s.pruneDecisions(context.Background(), now)
+
+	assert.Equal(t, []*datastore.Decision{recent}, admin.decisions)
+}
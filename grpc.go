@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/pkg/authzpb"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// decisions maps decisions to their protobuf enum
+var decisions = map[string]authzpb.Decision{
+	decisionAllow: authzpb.Decision_DECISION_ALLOW,
+	decisionDeny:  authzpb.Decision_DECISION_DENY,
+}
+
+// newGRPCServer configures a gRPC server exposing the AuthzService
+func (s *Server) newGRPCServer() *grpc.Server {
+	mw := iamgrpc.New(iamgrpc.Config{Enforcer: s.newEnforcer()})
+	authenticator := iam.NewAuthenticator(s.ds, s.logger)
+	gs := grpc.NewServer(
+		grpc.UnaryInterceptor(mw.UnaryServerInterceptor(authenticator)),
+		grpc.StreamInterceptor(mw.StreamServerInterceptor(authenticator)),
+	)
+	authzpb.RegisterAuthzServiceServer(gs, &authzServer{Server: s})
+	return gs
+}
+
+// authzServer implements authzpb.AuthzServiceServer with the same datastore and Oso policy as the HTTP API
+type authzServer struct {
+	authzpb.UnimplementedAuthzServiceServer
+	*Server
+}
+
+func (s *authzServer) Check(ctx context.Context, req *authzpb.CheckRequest) (*authzpb.CheckResponse, error) {
+	principal, err := s.principal(ctx, req.GetPrincipal())
+	if err != nil {
+		return nil, err
+	}
+	r, err := fromPBCheck(req.GetCheck()).resource()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res, err := s.checkAuthz(principal, req.GetCheck().GetAction(), r)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &authzpb.CheckResponse{Decision: decisions[res.Decision], Reasons: toPBReasons(res.Reasons)}, nil
+}
+
+func (s *authzServer) BatchCheck(ctx context.Context, req *authzpb.BatchCheckRequest) (*authzpb.BatchCheckResponse, error) {
+	if len(req.GetChecks()) > maxBatchChecks {
+		return nil, status.Error(codes.InvalidArgument, errTooManyChecks.Error())
+	}
+	principal, err := s.principal(ctx, req.GetPrincipal())
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]authzCheck, len(req.GetChecks()))
+	for i, c := range req.GetChecks() {
+		checks[i] = fromPBCheck(c)
+	}
+	res := &authzpb.BatchCheckResponse{Results: make([]*authzpb.BatchCheckResult, len(checks))}
+	for i, r := range s.batchCheckAuthz(principal, checks) {
+		res.Results[i] = &authzpb.BatchCheckResult{
+			Decision: decisions[r.Decision],
+			Reasons:  toPBReasons(r.Reasons),
+			Error:    r.Error,
+		}
+	}
+	return res, nil
+}
+
+func (s *authzServer) ListAllowedResources(
+	ctx context.Context, req *authzpb.ListAllowedResourcesRequest,
+) (*authzpb.ListAllowedResourcesResponse, error) {
+	if req.GetAction() == "" {
+		return nil, status.Error(codes.InvalidArgument, errMissingAction.Error())
+	}
+	if req.GetResourceType() != "zone" {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported resource type %q", req.GetResourceType())
+	}
+	principal, err := s.principal(ctx, req.GetPrincipal())
+	if err != nil {
+		return nil, err
+	}
+
+	zs, err := s.ds.ListZonesByOrgID(ctx, principal.User.OrgID)
+	if err != nil {
+		s.logger.Errorw("error listing zones for org", "orgID", principal.User.OrgID, "error", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &authzpb.ListAllowedResourcesResponse{Resources: []*authzpb.Resource{}}
+	for _, z := range *zs {
+		allowed, err := s.authz.IsAllowed(principal, req.GetAction(), z)
+		if err != nil {
+			s.logger.Errorw("error authorizing zone", "zone", z.Name, "error", err)
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if allowed {
+			res.Resources = append(res.Resources, &authzpb.Resource{
+				Id:           int64(z.ZoneID),
+				Name:         z.Name,
+				ResourceName: z.ResourceName,
+			})
+		}
+	}
+	return res, nil
+}
+
+func (s *authzServer) Explain(ctx context.Context, req *authzpb.ExplainRequest) (*authzpb.ExplainResponse, error) {
+	principal, err := s.principal(ctx, req.GetPrincipal())
+	if err != nil {
+		return nil, err
+	}
+	r, err := fromPBCheck(req.GetCheck()).resource()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	exp, err := s.explainAuthz(principal, req.GetCheck().GetAction(), r)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &authzpb.ExplainResponse{Decision: decisions[exp.Decision]}
+	for _, pe := range exp.Evaluations {
+		res.Evaluations = append(res.Evaluations, &authzpb.PolicyEvaluation{
+			PolicyId:       int64(pe.Policy.ID),
+			Effect:         pe.Policy.Effect,
+			Resource:       string(pe.Policy.Resource),
+			CoversResource: pe.CoversResource,
+			PermitsAction:  pe.PermitsAction,
+			ConditionsHold: pe.ConditionsHold,
+			Applies:        pe.Applies(),
+		})
+	}
+	return res, nil
+}
+
+// principal loads the principal with the given user ID on behalf of the authenticated caller
+func (s *authzServer) principal(ctx context.Context, userID int64) (*iam.DerivedUser, error) {
+	caller, err := iamgrpc.User(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	principal, err := s.derivePrincipal(ctx, caller, int(userID))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, errPrincipalNotFound.Error())
+	}
+	return principal, nil
+}
+
+func fromPBCheck(c *authzpb.Check) authzCheck {
+	return authzCheck{Action: c.GetAction(), Resource: c.GetResource(), Attributes: c.GetAttributes()}
+}
+
+func toPBReasons(reasons []checkReason) []*authzpb.Reason {
+	var pbReasons []*authzpb.Reason
+	for _, r := range reasons {
+		pbReasons = append(pbReasons, &authzpb.Reason{
+			PolicyId: int64(r.PolicyID),
+			Effect:   r.Effect,
+			Resource: r.Resource,
+			Message:  r.Message,
+		})
+	}
+	return pbReasons
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/pkg/authzpb"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamgrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+// newBufconnClient serves the AuthzService over an in memory listener and returns a client for it
+func newBufconnClient(t *testing.T) authzpb.AuthzServiceClient {
+	lis := bufconn.Listen(1024 * 1024)
+	s := newTestServer(t, &mockDatastore{}, defaultConfig()).newGRPCServer()
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return authzpb.NewAuthzServiceClient(conn)
+}
+
+func withAPIKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), iamgrpc.APIKeyMetadataKey, key)
+}
+
+func Test_grpcCheck(t *testing.T) {
+	t.Parallel()
+	client := newBufconnClient(t)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		req     *authzpb.CheckRequest
+		expCode codes.Code
+		expRes  *authzpb.CheckResponse
+	}{
+		{
+			name: "allowed",
+			ctx:  withAPIKey("ada"),
+			req: &authzpb.CheckRequest{
+				Principal: 1,
+				Check:     &authzpb.Check{Action: "view", Resource: "oso:0:zone/foo.com"},
+			},
+			expCode: codes.OK,
+			expRes: &authzpb.CheckResponse{
+				Decision: authzpb.Decision_DECISION_ALLOW,
+				Reasons: []*authzpb.Reason{
+					{PolicyId: 1, Effect: "allow", Resource: "oso:0:zone/*", Message: "allowed by policy"},
+				},
+			},
+		},
+		{
+			name: "explicitly denied",
+			ctx:  withAPIKey("tom"),
+			req: &authzpb.CheckRequest{
+				Check: &authzpb.Check{Action: "delete", Resource: "oso:0:zone/foo.com"},
+			},
+			expCode: codes.OK,
+			expRes: &authzpb.CheckResponse{
+				Decision: authzpb.Decision_DECISION_DENY,
+				Reasons: []*authzpb.Reason{
+					{PolicyId: 2, Effect: "deny", Resource: "oso:0:zone/foo.com", Message: "explicitly denied by policy"},
+				},
+			},
+		},
+		{
+			name: "bad resource name",
+			ctx:  withAPIKey("bob"),
+			req: &authzpb.CheckRequest{
+				Check: &authzpb.Check{Action: "view", Resource: "foo.com"},
+			},
+			expCode: codes.InvalidArgument,
+		},
+		{
+			name: "principal in another org",
+			ctx:  withAPIKey("bob"),
+			req: &authzpb.CheckRequest{
+				Principal: 5,
+				Check:     &authzpb.Check{Action: "view", Resource: "oso:0:zone/foo.com"},
+			},
+			expCode: codes.NotFound,
+		},
+		{
+			name: "principal without iam:GetPermissions",
+			ctx:  withAPIKey("bob"),
+			req: &authzpb.CheckRequest{
+				Principal: 1,
+				Check:     &authzpb.Check{Action: "view", Resource: "oso:0:zone/foo.com"},
+			},
+			expCode: codes.NotFound,
+		},
+		{
+			name: "missing api key",
+			ctx:  context.Background(),
+			req: &authzpb.CheckRequest{
+				Check: &authzpb.Check{Action: "view", Resource: "oso:0:zone/foo.com"},
+			},
+			expCode: codes.Unauthenticated,
+		},
+		{
+			name: "unknown api key",
+			ctx:  withAPIKey("guybrush"),
+			req: &authzpb.CheckRequest{
+				Check: &authzpb.Check{Action: "view", Resource: "oso:0:zone/foo.com"},
+			},
+			expCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.Check(tt.ctx, tt.req)
+			assert.Equal(t, tt.expCode, status.Code(err))
+			if tt.expCode != codes.OK {
+				return
+			}
+			assert.Equal(t, tt.expRes.GetDecision(), res.GetDecision())
+			assert.Equal(t, len(tt.expRes.GetReasons()), len(res.GetReasons()))
+			for i, r := range tt.expRes.GetReasons() {
+				assert.Equal(t, r.String(), res.GetReasons()[i].String())
+			}
+		})
+	}
+}
+
+func Test_grpcBatchCheck(t *testing.T) {
+	t.Parallel()
+	client := newBufconnClient(t)
+
+	res, err := client.BatchCheck(withAPIKey("john"), &authzpb.BatchCheckRequest{
+		Checks: []*authzpb.Check{
+			{Action: "view", Resource: "oso:0:zone/foo.com"},
+			{Action: "delete", Resource: "oso:0:zone/foo.com"},
+			{Action: "view", Resource: "foo.com"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.GetResults(), 3)
+	assert.Equal(t, authzpb.Decision_DECISION_ALLOW, res.GetResults()[0].GetDecision())
+	assert.Equal(t, authzpb.Decision_DECISION_DENY, res.GetResults()[1].GetDecision())
+	assert.Equal(t, authzpb.Decision_DECISION_UNSPECIFIED, res.GetResults()[2].GetDecision())
+	assert.NotEmpty(t, res.GetResults()[2].GetError())
+
+	_, err = client.BatchCheck(withAPIKey("john"), &authzpb.BatchCheckRequest{
+		Checks: make([]*authzpb.Check, maxBatchChecks+1),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_grpcListAllowedResources(t *testing.T) {
+	t.Parallel()
+	client := newBufconnClient(t)
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		req      *authzpb.ListAllowedResourcesRequest
+		expCode  codes.Code
+		expNames []string
+	}{
+		{
+			name:     "all zones viewable",
+			apiKey:   "john",
+			req:      &authzpb.ListAllowedResourcesRequest{Action: "view", ResourceType: "zone"},
+			expCode:  codes.OK,
+			expNames: []string{"foo.com", "bar.net"},
+		},
+		{
+			name:     "zones viewable by condition",
+			apiKey:   "jim",
+			req:      &authzpb.ListAllowedResourcesRequest{Action: "view", ResourceType: "zone"},
+			expCode:  codes.OK,
+			expNames: []string{"foo.com"},
+		},
+		{
+			name:     "zones deletable despite deny",
+			apiKey:   "ada",
+			req:      &authzpb.ListAllowedResourcesRequest{Principal: 3, Action: "delete", ResourceType: "zone"},
+			expCode:  codes.OK,
+			expNames: []string{"bar.net"},
+		},
+		{
+			name:    "principal without iam:GetPermissions",
+			apiKey:  "john",
+			req:     &authzpb.ListAllowedResourcesRequest{Principal: 3, Action: "delete", ResourceType: "zone"},
+			expCode: codes.NotFound,
+		},
+		{
+			name:     "no zones allowed",
+			apiKey:   "john",
+			req:      &authzpb.ListAllowedResourcesRequest{Action: "delete", ResourceType: "zone"},
+			expCode:  codes.OK,
+			expNames: []string{},
+		},
+		{
+			name:    "unsupported resource type",
+			apiKey:  "john",
+			req:     &authzpb.ListAllowedResourcesRequest{Action: "view", ResourceType: "user"},
+			expCode: codes.InvalidArgument,
+		},
+		{
+			name:    "missing action",
+			apiKey:  "john",
+			req:     &authzpb.ListAllowedResourcesRequest{ResourceType: "zone"},
+			expCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.ListAllowedResources(withAPIKey(tt.apiKey), tt.req)
+			assert.Equal(t, tt.expCode, status.Code(err))
+			if tt.expCode != codes.OK {
+				return
+			}
+			names := []string{}
+			for _, r := range res.GetResources() {
+				names = append(names, r.GetName())
+			}
+			assert.Equal(t, tt.expNames, names)
+		})
+	}
+}
+
+func Test_grpcExplain(t *testing.T) {
+	t.Parallel()
+	client := newBufconnClient(t)
+
+	res, err := client.Explain(withAPIKey("tom"), &authzpb.ExplainRequest{
+		Check: &authzpb.Check{Action: "delete", Resource: "oso:0:zone/foo.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, authzpb.Decision_DECISION_DENY, res.GetDecision())
+	require.Len(t, res.GetEvaluations(), 2)
+
+	allow, deny := res.GetEvaluations()[0], res.GetEvaluations()[1]
+	assert.Equal(t, "allow", allow.GetEffect())
+	assert.True(t, allow.GetApplies())
+	assert.Equal(t, "deny", deny.GetEffect())
+	assert.True(t, deny.GetApplies())
+
+	res, err = client.Explain(withAPIKey("jim"), &authzpb.ExplainRequest{
+		Check: &authzpb.Check{Action: "view", Resource: "oso:0:zone/foo.net"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, authzpb.Decision_DECISION_DENY, res.GetDecision())
+	require.Len(t, res.GetEvaluations(), 1)
+	pe := res.GetEvaluations()[0]
+	assert.True(t, pe.GetCoversResource())
+	assert.True(t, pe.GetPermitsAction())
+	assert.False(t, pe.GetConditionsHold())
+	assert.False(t, pe.GetApplies())
+}
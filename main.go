@@ -1,111 +1,234 @@
 package main
 
 //go:generate sqlboiler --wipe psql
+//go:generate protoc --go_out=. --go_opt=module=github.com/mburtless/oso-rbac-iam --go-grpc_out=. --go-grpc_opt=module=github.com/mburtless/oso-rbac-iam proto/authz.proto
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	_ "github.com/lib/pq"
 	"github.com/mburtless/oso-rbac-iam/datastore"
-	"github.com/mburtless/oso-rbac-iam/models"
-	"github.com/mburtless/oso-rbac-iam/pkg/matchers"
-	"github.com/mburtless/oso-rbac-iam/pkg/roles"
-	"github.com/osohq/go-oso"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
 	"go.uber.org/zap"
 	"log"
-	"reflect"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var (
-	osoClient        oso.Oso
-	logger           *zap.SugaredLogger
 	errMissingZoneId = errors.New("zoneId not found in request params")
 	errMissingAPIKey = errors.New("x-api-key value not found in request headers")
 )
 
+// Config configures a Server
+type Config struct {
+	// DisclosurePolicies is the disclosure policy for each resource type.  Types not listed conceal.
+	DisclosurePolicies map[string]iam.DisclosurePolicy
+	// SweepInterval is how often expired role bindings are deleted
+	SweepInterval time.Duration
+	// RecordDecisions records the decisions made by the app's middleware for analysis, writing the decisions recorded
+	// every DecisionFlushInterval and deleting them once they're older than DecisionRetention
+	RecordDecisions       bool
+	DecisionFlushInterval time.Duration
+	DecisionRetention     time.Duration
+	// TrackUsage tracks when roles, policies and API keys were last used, writing the usage tracked every
+	// UsageFlushInterval
+	TrackUsage         bool
+	UsageFlushInterval time.Duration
+}
+
+// defaultConfig returns the configuration the app is served with
+func defaultConfig() Config {
+	return Config{
+		DisclosurePolicies: defaultDisclosurePolicies(), SweepInterval: defaultSweepInterval, RecordDecisions: true,
+		DecisionFlushInterval: defaultDecisionFlushInterval, DecisionRetention: defaultDecisionRetention,
+		TrackUsage: true, UsageFlushInterval: defaultUsageFlushInterval,
+	}
+}
+
+// Server serves the HTTP and gRPC APIs with the dependencies it was built with
+type Server struct {
+	authz  iam.Authorizer
+	ds     datastore.Datastore
+	admin  datastore.Admin
+	logger *zap.SugaredLogger
+	cfg    Config
+	// usage tracks the usage of allowed decisions, if cfg.TrackUsage is set and there's an admin
+	usage *iam.UsageTracker
+	// decisions records decisions in the decision audit trail, if cfg.RecordDecisions is set and there's an admin
+	decisions *iam.DecisionRecorder
+}
+
+// NewServer returns a Server that authorizes with a and looks up users and resources in ds.  The admin API is served
+// with admin, unless it's nil.
+func NewServer(a iam.Authorizer, ds datastore.Datastore, admin datastore.Admin, l *zap.SugaredLogger, cfg Config) *Server {
+	s := &Server{authz: a, ds: ds, admin: admin, logger: l, cfg: cfg}
+	if cfg.TrackUsage && admin != nil {
+		s.usage = iam.NewUsageTracker(admin.RecordUsage, maxPendingUsage)
+	}
+	if cfg.RecordDecisions && admin != nil {
+		s.decisions = iam.NewDecisionRecorder(admin.RecordDecisions, maxPendingDecisions)
+	}
+	return s
+}
+
 func main() {
+	authorizer := flag.String("authorizer", "oso", "authorizer to decide with: oso, native or differential")
+	flag.Parse()
+
 	l, err := zap.NewDevelopment()
 	if err != nil {
 		log.Fatalf("can't initialize zap logger: %s", err.Error())
 	}
 	defer l.Sync()
-	logger = l.Sugar()
+	logger := l.Sugar()
 
-	if err := initOso(); err != nil {
-		log.Fatalf("Failed to initialize Oso: %s", err.Error())
+	a, err := newAuthorizer(*authorizer, logger)
+	if err != nil {
+		log.Fatalf("Failed to initialize authorizer: %s", err.Error())
 	}
 
-	db, err := initPG()
+	db, err := initPG(logger)
 	if err != nil {
 		log.Fatalf("Failed to connect to PG: %s", err.Error())
 	}
 	defer db.Close()
 
-	app := setup(datastore.NewDatastore(db, logger))
+	s := NewServer(a, datastore.NewDatastore(db, logger), datastore.NewAdmin(db, logger), logger, defaultConfig())
+	app := s.setup()
+
+	// delete role bindings as they expire and decisions as they age out
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var jobs sync.WaitGroup
+	runJob := func(job func(ctx context.Context, interval time.Duration), interval time.Duration) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(ctx, interval)
+		}()
+	}
+	runJob(s.sweepBindings, s.cfg.SweepInterval)
+	if s.usage != nil {
+		runJob(s.flushUsage, s.cfg.UsageFlushInterval)
+	}
+	if s.decisions != nil {
+		runJob(s.flushDecisions, s.cfg.DecisionFlushInterval)
+	}
 
-	if err := app.Listen(":5000"); err != nil {
-		log.Fatalf("Failed to start: %s", err.Error())
+	// serve gRPC alongside HTTP until either fails or the process is signalled to stop
+	lis, err := net.Listen("tcp", ":5001")
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC: %s", err.Error())
 	}
-}
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = s.serve(sigCtx, app, lis)
 
-// setup configures routes
-func setup(ds datastore.Datastore) *fiber.App {
-	app := fiber.New()
+	// stop the background jobs once nothing can be decided anymore, so the flushers write what's pending
+	cancel()
+	jobs.Wait()
+	if err != nil {
+		log.Fatalf("Failed to serve: %s", err.Error())
+	}
+}
 
-	// Middleware
-	app.Use(func(c *fiber.Ctx) error {
-		return setReqMeta(c, ds)
-	})
+// serve serves app on port 5000 and the gRPC API on lis until ctx is done or either server fails, then shuts both down
+// gracefully.  The error of the server that failed, if any, is returned.
+func (s *Server) serve(ctx context.Context, app *fiber.App, lis net.Listener) error {
+	grpcServer := s.newGRPCServer()
+	errs := make(chan error, 2)
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			errs <- fmt.Errorf("gRPC: %w", err)
+		}
+	}()
+	go func() {
+		if err := app.Listen(":5000"); err != nil {
+			errs <- fmt.Errorf("HTTP: %w", err)
+		}
+	}()
 
-	// Endpoints
-	app.Get("/user", func(c *fiber.Ctx) error {
-		return listUsersRoute(c, ds)
-	})
+	var err error
+	select {
+	case <-ctx.Done():
+		s.logger.Info("shutting down")
+	case err = <-errs:
+		s.logger.Errorw("server failed, shutting down", "error", err)
+	}
+	grpcServer.GracefulStop()
+	if shutdownErr := app.Shutdown(); shutdownErr != nil {
+		s.logger.Errorw("error shutting down HTTP", "error", shutdownErr)
+	}
+	return err
+}
 
-	app.Get("/zone/:zoneId", func(c *fiber.Ctx) error {
-		return getZoneRoute(c, ds)
+// setup configures routes
+func (s *Server) setup() *fiber.App {
+	app := fiber.New(fiber.Config{
+		// use the standard library for JSON, fiber's bundled encoder faults encoding maps
+		JSONEncoder: json.Marshal,
+		JSONDecoder: json.Unmarshal,
 	})
 
-	app.Get("/zone", func(c *fiber.Ctx) error {
-		return listZonesRoute(c, ds)
-	})
+	// Middleware
+	mw := s.newMiddleware()
+	app.Use(mw.Authenticate(iam.NewAuthenticator(s.ds, s.logger)))
 
-	app.Delete("/zone/:zoneId", func(c *fiber.Ctx) error {
-		return deleteZoneRoute(c, ds)
-	})
+	// Endpoints
+	app.Get("/user", s.listUsersRoute)
+	app.Get("/zone/:zoneId", mw.Require(actionGetZone, s.zoneLoader()), s.getZoneRoute)
+	app.Get("/zone", s.listZonesRoute)
+	app.Delete("/zone/:zoneId", mw.Require(actionDeleteZone, s.zoneLoader()), s.deleteZoneRoute)
+	app.Get("/zone/:zoneId/record", s.listRecordsRoute)
+	app.Post("/zone/:zoneId/record", s.parseNewRecord, mw.Require(actionCreateRecord, s.newRecordLoader()), s.createRecordRoute)
+	app.Get("/zone/:zoneId/record/:recordId", mw.Require(actionGetRecord, s.recordLoader()), s.getRecordRoute)
+	app.Put("/zone/:zoneId/record/:recordId", mw.Require(actionUpdateRecord, s.recordLoader()), s.updateRecordRoute)
+	app.Delete("/zone/:zoneId/record/:recordId", mw.Require(actionDeleteRecord, s.recordLoader()), s.deleteRecordRoute)
+	app.Post("/authz/check", s.checkRoute)
+	app.Post("/authz/batch-check", s.batchCheckRoute)
+
+	if s.admin != nil {
+		s.setupAdmin(app)
+		s.setupAccessRequests(app)
+	}
 	return app
 }
 
-// initOso loads polar policy, registers resources and initializes Oso client singleton
-func initOso() error {
-	var err error
-	osoClient, err = oso.NewOso()
-	if err != nil {
-		return err
+// newAuthorizer returns the Authorizer for mode, which is one of:
+//   - "oso" evaluates iam.polar with Oso
+//   - "native" evaluates permissions in Go
+//   - "differential" decides with Oso, also evaluates in Go and logs any mismatch
+func newAuthorizer(mode string, logger *zap.SugaredLogger) (iam.Authorizer, error) {
+	if mode == "native" {
+		return iam.NewNativeAuthorizer(), nil
 	}
 
-	// Register custom types with Oso core
-	if err := osoClient.RegisterClass(reflect.TypeOf(roles.PolicyResourceName("foo")), nil); err != nil {
-		return err
+	o, err := iam.NewOso("iam.polar")
+	if err != nil {
+		return nil, err
 	}
-	osoClient.RegisterClass(reflect.TypeOf(models.Zone{}), nil)
-	osoClient.RegisterClass(reflect.TypeOf(models.User{}), nil)
-	osoClient.RegisterClass(reflect.TypeOf(models.Role{}), nil)
-	osoClient.RegisterClass(reflect.TypeOf(models.Policy{}), nil)
-	osoClient.RegisterClass(reflect.TypeOf(roles.RolePolicy{}), nil)
-	osoClient.RegisterClass(reflect.TypeOf(datastore.EffectivePerms{}), nil)
-	osoClient.RegisterClass(reflect.TypeOf(DerivedUser{}), nil)
-	osoClient.RegisterClass(reflect.TypeOf(matchers.HasSuffix{}), nil)
-
-	// Load Oso policy
-	if err := osoClient.LoadFiles([]string{"iam.polar"}); err != nil {
-		return err
+	switch mode {
+	case "oso":
+		return iam.NewOsoAuthorizer(o), nil
+	case "differential":
+		return iam.NewDifferentialAuthorizer(iam.NewOsoAuthorizer(o), iam.NewNativeAuthorizer(), func(m iam.Mismatch) {
+			logger.Warnw("authorizers disagree", "mismatch", m.String())
+		}), nil
 	}
-	return nil
+	return nil, fmt.Errorf("unknown authorizer %q", mode)
 }
 
-func initPG() (*sql.DB, error) {
+func initPG(logger *zap.SugaredLogger) (*sql.DB, error) {
 	db, err := sql.Open("postgres", `dbname=oso-rbac-iam host=localhost user=oso password=ososecretpwd sslmode=disable`)
 	if err != nil {
 		return nil, err
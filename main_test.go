@@ -3,15 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/gofiber/fiber/v2"
 	"github.com/lucasepe/codename"
 	"github.com/mburtless/oso-rbac-iam/datastore"
 	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
 	"github.com/mburtless/oso-rbac-iam/pkg/roles"
 	"github.com/stretchr/testify/assert"
 	"github.com/volatiletech/sqlboiler/v4/types"
 	"go.uber.org/zap"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"testing"
 )
@@ -22,9 +23,24 @@ func newNopLog() *zap.SugaredLogger {
 	return l.Sugar()
 }
 
-func Test_setup(t *testing.T) {
-	logger = newNopLog()
+// newTestServer returns a Server backed by ds, without the admin API, that doesn't log
+func newTestServer(tb testing.TB, ds datastore.Datastore, cfg Config) *Server {
+	return NewServer(newTestAuthorizer(tb), ds, nil, newNopLog(), cfg)
+}
+
+// newTestAuthorizer decides with the app's polar policy and fails the test if the native authorizer disagrees
+func newTestAuthorizer(tb testing.TB) iam.Authorizer {
+	a, err := newAuthorizer("oso", newNopLog())
+	if err != nil {
+		tb.Fatalf("Failed to initialize Oso: %s", err.Error())
+	}
+	return iam.NewDifferentialAuthorizer(a, iam.NewNativeAuthorizer(), func(m iam.Mismatch) {
+		tb.Errorf("authorizers disagree: %s", m)
+	})
+}
 
+func Test_setup(t *testing.T) {
+	t.Parallel()
 	tests := []struct {
 		name    string
 		route   string
@@ -53,14 +69,31 @@ func Test_setup(t *testing.T) {
 			expBody: errHTMLZoneNotFound,
 		},
 		{
-			name:   "view zone without authz",
-			route:  "/zone/0",
-			method: "GET",
-			apiKey: "bob",
-			expErr: false,
-			// TODO: change to 401
+			name:    "view zone without authz",
+			route:   "/zone/0",
+			method:  "GET",
+			apiKey:  "glados",
+			expErr:  false,
 			expCode: 404,
-			expBody: "<h1>Whoops!</h1><p>That zone was not found</p>",
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "view zone implied by delete",
+			route:   "/zone/0",
+			method:  "GET",
+			apiKey:  "bob",
+			expErr:  false,
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Welcome bob to zone foo.com</p>",
+		},
+		{
+			name:    "view zone with unknown api key",
+			route:   "/zone/0",
+			method:  "GET",
+			apiKey:  "guybrush",
+			expErr:  false,
+			expCode: 401,
+			expBody: errHTMLUserNotFound,
 		},
 		{
 			name:    "delete valid zone",
@@ -72,24 +105,31 @@ func Test_setup(t *testing.T) {
 			expBody: "<h1>A Repo</h1><p>Deleted zone foo.com</p>",
 		},
 		{
-			name:   "delete zone without authz",
-			route:  "/zone/0",
-			method: "DELETE",
-			apiKey: "john",
-			expErr: false,
-			// TODO: change to 401?
+			name:    "delete nonexistant zone",
+			route:   "/zone/5",
+			method:  "DELETE",
+			apiKey:  "bob",
+			expErr:  false,
 			expCode: 404,
 			expBody: errHTMLZoneNotFound,
 		},
 		{
-			name:   "delete zone without authz via deny",
-			route:  "/zone/0",
-			method: "DELETE",
-			apiKey: "tom",
-			expErr: false,
-			// TODO: change to 401?
-			expCode: 404,
-			expBody: errHTMLZoneNotFound,
+			name:    "delete viewable zone without authz",
+			route:   "/zone/0",
+			method:  "DELETE",
+			apiKey:  "john",
+			expErr:  false,
+			expCode: 403,
+			expBody: errHTMLForbidden,
+		},
+		{
+			name:    "delete zone without authz via deny",
+			route:   "/zone/0",
+			method:  "DELETE",
+			apiKey:  "tom",
+			expErr:  false,
+			expCode: 403,
+			expBody: errHTMLForbidden,
 		},
 		{
 			name:    "view zone with matchSuffix conditional",
@@ -100,11 +140,35 @@ func Test_setup(t *testing.T) {
 			expCode: 200,
 			expBody: "<h1>A Repo</h1><p>Welcome jim to zone foo.com</p>",
 		},
+		{
+			name:    "list zones",
+			route:   "/zone",
+			method:  "GET",
+			apiKey:  "john",
+			expErr:  false,
+			expCode: 200,
+			expBody: "<h1>Zones</h1><p>foo.com,bar.net</p>",
+		},
+		{
+			name:    "list users",
+			route:   "/user",
+			method:  "GET",
+			apiKey:  "john",
+			expErr:  false,
+			expCode: 200,
+			expBody: "<h1>Users</h1><p>john,bob,tom,jim</p>",
+		},
+		{
+			name:    "list users with unknown api key",
+			route:   "/user",
+			method:  "GET",
+			apiKey:  "guybrush",
+			expErr:  false,
+			expCode: 401,
+			expBody: errHTMLUserNotFound,
+		},
 	}
-	if err := initOso(); err != nil {
-		log.Fatalf("Failed to initialize Oso: %s", err.Error())
-	}
-	app := setup(&mockDatastore{})
+	app := newTestServer(t, &mockDatastore{}, defaultConfig()).setup()
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -124,20 +188,99 @@ func Test_setup(t *testing.T) {
 	}
 }
 
-func benchmarkAuthz(b *testing.B, roles []*datastore.DenormalizedRole) {
-	// test single role with many policies attached
-	// generate many roles with single policy attached
-	logger = newNopLog()
+func Test_disclosurePolicies(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		policy  iam.DisclosurePolicy
+		route   string
+		method  string
+		apiKey  string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "reveal forbidden when zone is viewable",
+			policy:  iam.RevealForbidden,
+			route:   "/zone/0",
+			method:  "DELETE",
+			apiKey:  "john",
+			expCode: 403,
+			expBody: errHTMLForbidden,
+		},
+		{
+			name:    "reveal forbidden hides zone that isn't viewable",
+			policy:  iam.RevealForbidden,
+			route:   "/zone/0",
+			method:  "GET",
+			apiKey:  "glados",
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "conceal forbidden when zone is viewable",
+			policy:  iam.ConcealForbidden,
+			route:   "/zone/0",
+			method:  "DELETE",
+			apiKey:  "john",
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "conceal forbidden hides zone that isn't viewable",
+			policy:  iam.ConcealForbidden,
+			route:   "/zone/0",
+			method:  "GET",
+			apiKey:  "glados",
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "conceal forbidden still allows authorized requests",
+			policy:  iam.ConcealForbidden,
+			route:   "/zone/0",
+			method:  "DELETE",
+			apiKey:  "bob",
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Deleted zone foo.com</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{DisclosurePolicies: map[string]iam.DisclosurePolicy{"zone": tt.policy}}
+			app := newTestServer(t, &mockDatastore{}, cfg).setup()
+			req, _ := http.NewRequest(tt.method, tt.route, nil)
+			req.Header.Set("x-api-key", tt.apiKey)
+			res, err := app.Test(req, -1)
+			assert.NoError(t, err)
 
-	if err := initOso(); err != nil {
-		log.Fatalf("Failed to initialize Oso: %s", err.Error())
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, string(body))
+		})
 	}
+}
 
+func benchmarkAuthz(b *testing.B, roles []*datastore.DenormalizedRole) {
+	// test single role with many policies attached
+	// generate many roles with single policy attached
 	ds := newBenchDatastore(roles)
 	//b.Logf("roles in datastore:\n%s", ds.denormRoles)
 
-	app := setup(ds)
+	// compare authorizers on the same datastore
+	for _, mode := range []string{"oso", "native"} {
+		b.Run(mode, func(b *testing.B) {
+			a, err := newAuthorizer(mode, newNopLog())
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchmarkApp(b, NewServer(a, ds, nil, newNopLog(), defaultConfig()).setup())
+		})
+	}
+}
 
+func benchmarkApp(b *testing.B, app *fiber.App) {
 	// reset timer to ignore init time
 	b.ResetTimer()
 
@@ -235,9 +378,33 @@ func (ds *mockDatastore) FindZoneByID(_ context.Context, id int) (*models.Zone,
 }
 
 func (ds *mockDatastore) ListZonesByOrgID(_ context.Context, _ int) (*models.ZoneSlice, error) {
+	zs := models.ZoneSlice{
+		{ZoneID: 1, Name: "foo.com", ResourceName: "oso:0:zone/foo.com", OrgID: 0},
+		{ZoneID: 2, Name: "bar.net", ResourceName: "oso:0:zone/bar.net", OrgID: 0},
+	}
+	return &zs, nil
+}
+
+func (ds *mockDatastore) ListRecordsByZoneID(_ context.Context, _ int) ([]*datastore.Record, error) {
 	return nil, nil
 }
 
+func (ds *mockDatastore) FindRecordByID(_ context.Context, _ int) (*datastore.Record, error) {
+	return nil, fmt.Errorf("record not found")
+}
+
+func (ds *mockDatastore) CreateRecord(_ context.Context, _ *datastore.Record) error {
+	return nil
+}
+
+func (ds *mockDatastore) UpdateRecord(_ context.Context, _ *datastore.Record) error {
+	return nil
+}
+
+func (ds *mockDatastore) DeleteRecordByID(_ context.Context, _ int) error {
+	return nil
+}
+
 func (ds *mockDatastore) ListUsersByOrgID(ctx context.Context, orgID int) (*models.UserSlice, error) {
 	us := models.UserSlice{
 		{UserID: 1, Name: "john", APIKey: "john", OrgID: 2000},
@@ -250,10 +417,13 @@ func (ds *mockDatastore) ListUsersByOrgID(ctx context.Context, orgID int) (*mode
 
 func (ds *mockDatastore) FindUserByKey(_ context.Context, key string) (*models.User, error) {
 	keyToID := map[string]int{
-		"john": 1,
-		"bob":  2,
-		"tom":  3,
-		"jim":  4,
+		"john":   1,
+		"bob":    2,
+		"tom":    3,
+		"jim":    4,
+		"ada":    6,
+		"chell":  7,
+		"glados": 8,
 	}
 	if id, ok := keyToID[key]; ok {
 		return &models.User{
@@ -267,12 +437,38 @@ func (ds *mockDatastore) FindUserByKey(_ context.Context, key string) (*models.U
 	return nil, fmt.Errorf("user not found")
 }
 
+func (ds *mockDatastore) FindUserByID(_ context.Context, id int) (*models.User, error) {
+	idToName := map[int]string{
+		1: "john",
+		2: "bob",
+		3: "tom",
+		4: "jim",
+		6: "ada",
+		7: "chell",
+		8: "glados",
+	}
+	if name, ok := idToName[id]; ok {
+		return &models.User{
+			UserID: id,
+			Name:   name,
+			APIKey: name,
+			OrgID:  0,
+		}, nil
+	}
+	// user in another org
+	if id == 5 {
+		return &models.User{UserID: 5, Name: "elaine", APIKey: "elaine", OrgID: 1}, nil
+	}
+
+	return nil, fmt.Errorf("user not found")
+}
+
 func (ds *mockDatastore) GetUserRoles(_ context.Context, _ *models.User) (models.RoleSlice, error) {
 	return nil, nil
 }
 
-func (ds *mockDatastore) GetUserRolesAndPolicies(_ context.Context, userID int) ([]*datastore.DenormalizedRole, error) {
-	switch userID {
+func (ds *mockDatastore) GetUserRolesAndPolicies(_ context.Context, user *models.User, _ roles.OrgTree) ([]*datastore.DenormalizedRole, error) {
+	switch user.UserID {
 	case 1:
 		return []*datastore.DenormalizedRole{
 			{
@@ -289,13 +485,35 @@ func (ds *mockDatastore) GetUserRolesAndPolicies(_ context.Context, userID int)
 					PolicyID: 1, Name: "deleteZonesPolicy", Effect: "allow", Actions: types.StringArray{"delete"}, ResourceName: "oso:0:zone/*"},
 			},
 		}, nil
+	case 3:
+		return []*datastore.DenormalizedRole{
+			{
+				Role: models.Role{RoleID: 1, Name: "deleteZonesRole", OrgID: 0},
+				Policy: models.Policy{
+					PolicyID: 1, Name: "deleteZonesPolicy", Effect: "allow", Actions: types.StringArray{"delete"}, ResourceName: "oso:0:zone/*"},
+			},
+			{
+				Role: models.Role{RoleID: 2, Name: "protectFooRole", OrgID: 0},
+				Policy: models.Policy{
+					PolicyID: 2, Name: "denyDeleteFooPolicy", Effect: "deny", Actions: types.StringArray{"delete"}, ResourceName: "oso:0:zone/foo.com"},
+			},
+		}, nil
+	case 4:
+		return []*datastore.DenormalizedRole{
+			{
+				Role: models.Role{RoleID: 1, Name: "viewComZonesRole", OrgID: 0},
+				Policy: models.Policy{
+					PolicyID: 1, Name: "viewComZonesPolicy", Effect: "allow", Actions: types.StringArray{"view"}, ResourceName: "oso:0:zone/*"},
+				Condition: models.Condition{ConditionID: 1, Type: "matchSuffix", Value: "com"},
+			},
+		}, nil
 	}
 
 	return nil, fmt.Errorf("role not found for user")
 }
 
-func (ds *mockDatastore) GetEffectivePerms(_ context.Context, userID int) (datastore.EffectivePerms, error) {
-	switch userID {
+func (ds *mockDatastore) GetEffectivePerms(_ context.Context, user *models.User, _ roles.OrgTree) (datastore.EffectivePerms, error) {
+	switch user.UserID {
 	case 1:
 		return datastore.EffectivePerms{
 			Namespaces: map[string][]string{
@@ -304,6 +522,7 @@ func (ds *mockDatastore) GetEffectivePerms(_ context.Context, userID int) (datas
 			AllowPolicies: datastore.PoliciesByNamespace{
 				"oso:0:zone/*": map[int]*roles.RolePolicy{
 					1: {
+						ID:         1,
 						Effect:     "allow",
 						Actions:    []string{"view"},
 						Resource:   "oso:0:zone/*",
@@ -320,6 +539,7 @@ func (ds *mockDatastore) GetEffectivePerms(_ context.Context, userID int) (datas
 			AllowPolicies: datastore.PoliciesByNamespace{
 				"oso:0:zone/*": map[int]*roles.RolePolicy{
 					1: {
+						ID:         1,
 						Effect:     "allow",
 						Actions:    []string{"delete"},
 						Resource:   "oso:0:zone/*",
@@ -336,6 +556,7 @@ func (ds *mockDatastore) GetEffectivePerms(_ context.Context, userID int) (datas
 			AllowPolicies: datastore.PoliciesByNamespace{
 				"oso:0:zone/*": map[int]*roles.RolePolicy{
 					1: {
+						ID:         1,
 						Effect:     "allow",
 						Actions:    []string{"delete"},
 						Resource:   "oso:0:zone/*",
@@ -346,6 +567,7 @@ func (ds *mockDatastore) GetEffectivePerms(_ context.Context, userID int) (datas
 			DenyPolicies: datastore.PoliciesByNamespace{
 				"oso:0:zone/foo.com": map[int]*roles.RolePolicy{
 					2: {
+						ID:         2,
 						Effect:     "deny",
 						Actions:    []string{"delete"},
 						Resource:   "oso:0:zone/foo.com",
@@ -362,6 +584,7 @@ func (ds *mockDatastore) GetEffectivePerms(_ context.Context, userID int) (datas
 			AllowPolicies: datastore.PoliciesByNamespace{
 				"oso:0:zone/*": map[int]*roles.RolePolicy{
 					1: {
+						ID:       1,
 						Effect:   "allow",
 						Actions:  []string{"view"},
 						Resource: "oso:0:zone/*",
@@ -372,10 +595,92 @@ func (ds *mockDatastore) GetEffectivePerms(_ context.Context, userID int) (datas
 				},
 			},
 		}, nil
+	case 6:
+		// iam admin of org 0
+		return datastore.EffectivePerms{
+			Namespaces: map[string][]string{
+				"org": {"oso:0:org/0"},
+			},
+			AllowPolicies: datastore.PoliciesByNamespace{
+				"oso:0:org/0": map[int]*roles.RolePolicy{
+					5: {
+						ID:         5,
+						Effect:     "allow",
+						Actions:    []string{"*"},
+						Resource:   "oso:0:org/0",
+						Conditions: map[int]*roles.Condition{},
+					},
+				},
+			},
+		}, nil
+	case 7:
+		// may request a role and to delete a zone
+		return datastore.EffectivePerms{
+			Namespaces: map[string][]string{
+				"role": {"oso:0:role/viewZonesRole"},
+				"zone": {"oso:0:zone/foo.com"},
+			},
+			AllowPolicies: datastore.PoliciesByNamespace{
+				"oso:0:role/viewZonesRole": map[int]*roles.RolePolicy{
+					6: {
+						ID:         6,
+						Effect:     "allow",
+						Actions:    []string{"iam:RequestAccess"},
+						Resource:   "oso:0:role/viewZonesRole",
+						Conditions: map[int]*roles.Condition{},
+					},
+				},
+				"oso:0:zone/foo.com": map[int]*roles.RolePolicy{
+					7: {
+						ID:         7,
+						Effect:     "allow",
+						Actions:    []string{"iam:RequestAccess"},
+						Resource:   "oso:0:zone/foo.com",
+						Conditions: map[int]*roles.Condition{},
+					},
+				},
+			},
+		}, nil
+	case 8:
+		// may approve access to the role and zone user 7 may request, and request access to the zone
+		return datastore.EffectivePerms{
+			Namespaces: map[string][]string{
+				"role": {"oso:0:role/viewZonesRole"},
+				"zone": {"oso:0:zone/foo.com"},
+			},
+			AllowPolicies: datastore.PoliciesByNamespace{
+				"oso:0:role/viewZonesRole": map[int]*roles.RolePolicy{
+					8: {
+						ID:         8,
+						Effect:     "allow",
+						Actions:    []string{"iam:ApproveAccess"},
+						Resource:   "oso:0:role/viewZonesRole",
+						Conditions: map[int]*roles.Condition{},
+					},
+				},
+				"oso:0:zone/foo.com": map[int]*roles.RolePolicy{
+					9: {
+						ID:         9,
+						Effect:     "allow",
+						Actions:    []string{"iam:ApproveAccess", "iam:RequestAccess"},
+						Resource:   "oso:0:zone/foo.com",
+						Conditions: map[int]*roles.Condition{},
+					},
+				},
+			},
+		}, nil
 	}
 	return datastore.EffectivePerms{}, fmt.Errorf("role not found for user")
 }
 
+func (ds *mockDatastore) ListUserTags(_ context.Context, _ int) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (ds *mockDatastore) GetOrgTree(_ context.Context) (roles.OrgTree, error) {
+	return roles.OrgTree{}, nil
+}
+
 // datastore for benchmarks
 
 // configures new datastore populated with given roles
@@ -407,6 +712,26 @@ func (ds *benchDatastore) ListZonesByOrgID(_ context.Context, _ int) (*models.Zo
 	return nil, nil
 }
 
+func (ds *benchDatastore) ListRecordsByZoneID(_ context.Context, _ int) ([]*datastore.Record, error) {
+	return nil, nil
+}
+
+func (ds *benchDatastore) FindRecordByID(_ context.Context, _ int) (*datastore.Record, error) {
+	return nil, fmt.Errorf("record not found")
+}
+
+func (ds *benchDatastore) CreateRecord(_ context.Context, _ *datastore.Record) error {
+	return nil
+}
+
+func (ds *benchDatastore) UpdateRecord(_ context.Context, _ *datastore.Record) error {
+	return nil
+}
+
+func (ds *benchDatastore) DeleteRecordByID(_ context.Context, _ int) error {
+	return nil
+}
+
 func (ds *benchDatastore) FindUserByKey(_ context.Context, key string) (*models.User, error) {
 	switch key {
 	case "bob":
@@ -421,6 +746,20 @@ func (ds *benchDatastore) FindUserByKey(_ context.Context, key string) (*models.
 	return nil, fmt.Errorf("user not found")
 }
 
+func (ds *benchDatastore) FindUserByID(_ context.Context, id int) (*models.User, error) {
+	switch id {
+	case 1:
+		return &models.User{
+			UserID: 1,
+			Name:   "bob",
+			APIKey: "bob",
+			OrgID:  0,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("user not found")
+}
+
 func (ds *benchDatastore) GetUserRoles(_ context.Context, _ *models.User) (models.RoleSlice, error) {
 	return nil, nil
 }
@@ -429,8 +768,8 @@ func (ds *benchDatastore) ListUsersByOrgID(_ context.Context, _ int) (*models.Us
 	return nil, nil
 }
 
-func (ds *benchDatastore) GetUserRolesAndPolicies(_ context.Context, userID int) ([]*datastore.DenormalizedRole, error) {
-	switch userID {
+func (ds *benchDatastore) GetUserRolesAndPolicies(_ context.Context, user *models.User, _ roles.OrgTree) ([]*datastore.DenormalizedRole, error) {
+	switch user.UserID {
 	case 1:
 		return ds.denormRoles, nil
 	}
@@ -438,8 +777,8 @@ func (ds *benchDatastore) GetUserRolesAndPolicies(_ context.Context, userID int)
 	return nil, fmt.Errorf("role not found for user")
 }
 
-func (ds *benchDatastore) GetEffectivePerms(_ context.Context, userID int) (datastore.EffectivePerms, error) {
-	switch userID {
+func (ds *benchDatastore) GetEffectivePerms(_ context.Context, user *models.User, _ roles.OrgTree) (datastore.EffectivePerms, error) {
+	switch user.UserID {
 	case 1:
 		return ds.permissions, nil
 	}
@@ -447,6 +786,14 @@ func (ds *benchDatastore) GetEffectivePerms(_ context.Context, userID int) (data
 	return datastore.EffectivePerms{}, fmt.Errorf("role not found for user")
 }
 
+func (ds *benchDatastore) ListUserTags(_ context.Context, _ int) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (ds *benchDatastore) GetOrgTree(_ context.Context) (roles.OrgTree, error) {
+	return roles.OrgTree{}, nil
+}
+
 // generates a single role with many policies attatched
 func genSingleRoleManyPolicies(numPolicies int) ([]*datastore.DenormalizedRole, error) {
 	var denormRoles []*datastore.DenormalizedRole
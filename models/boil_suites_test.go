@@ -128,6 +128,7 @@ func TestInsert(t *testing.T) {
 // TestToOne tests cannot be run in parallel
 // or deadlocks can occur.
 func TestToOne(t *testing.T) {
+	t.Run("OrgToOrgUsingParent", testOrgToOneOrgUsingParent)
 	t.Run("RoleToOrgUsingOrg", testRoleToOneOrgUsingOrg)
 	t.Run("UserToOrgUsingOrg", testUserToOneOrgUsingOrg)
 	t.Run("ZoneToOrgUsingOrg", testZoneToOneOrgUsingOrg)
@@ -141,6 +142,7 @@ func TestOneToOne(t *testing.T) {}
 // or deadlocks can occur.
 func TestToMany(t *testing.T) {
 	t.Run("ConditionToPolicies", testConditionToManyPolicies)
+	t.Run("OrgToParentOrgs", testOrgToManyParentOrgs)
 	t.Run("OrgToRoles", testOrgToManyRoles)
 	t.Run("OrgToUsers", testOrgToManyUsers)
 	t.Run("OrgToZones", testOrgToManyZones)
@@ -154,6 +156,7 @@ func TestToMany(t *testing.T) {
 // TestToOneSet tests cannot be run in parallel
 // or deadlocks can occur.
 func TestToOneSet(t *testing.T) {
+	t.Run("OrgToOrgUsingParentOrgs", testOrgToOneSetOpOrgUsingParent)
 	t.Run("RoleToOrgUsingRoles", testRoleToOneSetOpOrgUsingOrg)
 	t.Run("UserToOrgUsingUsers", testUserToOneSetOpOrgUsingOrg)
 	t.Run("ZoneToOrgUsingZones", testZoneToOneSetOpOrgUsingOrg)
@@ -161,7 +164,9 @@ func TestToOneSet(t *testing.T) {
 
 // TestToOneRemove tests cannot be run in parallel
 // or deadlocks can occur.
-func TestToOneRemove(t *testing.T) {}
+func TestToOneRemove(t *testing.T) {
+	t.Run("OrgToOrgUsingParentOrgs", testOrgToOneRemoveOpOrgUsingParent)
+}
 
 // TestOneToOneSet tests cannot be run in parallel
 // or deadlocks can occur.
@@ -175,6 +180,7 @@ func TestOneToOneRemove(t *testing.T) {}
 // or deadlocks can occur.
 func TestToManyAdd(t *testing.T) {
 	t.Run("ConditionToPolicies", testConditionToManyAddOpPolicies)
+	t.Run("OrgToParentOrgs", testOrgToManyAddOpParentOrgs)
 	t.Run("OrgToRoles", testOrgToManyAddOpRoles)
 	t.Run("OrgToUsers", testOrgToManyAddOpUsers)
 	t.Run("OrgToZones", testOrgToManyAddOpZones)
@@ -189,6 +195,7 @@ func TestToManyAdd(t *testing.T) {
 // or deadlocks can occur.
 func TestToManySet(t *testing.T) {
 	t.Run("ConditionToPolicies", testConditionToManySetOpPolicies)
+	t.Run("OrgToParentOrgs", testOrgToManySetOpParentOrgs)
 	t.Run("PolicyToConditions", testPolicyToManySetOpConditions)
 	t.Run("PolicyToRoles", testPolicyToManySetOpRoles)
 	t.Run("RoleToPolicies", testRoleToManySetOpPolicies)
@@ -200,6 +207,7 @@ func TestToManySet(t *testing.T) {
 // or deadlocks can occur.
 func TestToManyRemove(t *testing.T) {
 	t.Run("ConditionToPolicies", testConditionToManyRemoveOpPolicies)
+	t.Run("OrgToParentOrgs", testOrgToManyRemoveOpParentOrgs)
 	t.Run("PolicyToConditions", testPolicyToManyRemoveOpConditions)
 	t.Run("PolicyToRoles", testPolicyToManyRemoveOpRoles)
 	t.Run("RoleToPolicies", testRoleToManyRemoveOpPolicies)
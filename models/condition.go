@@ -473,7 +473,7 @@ func (conditionL) LoadPolicies(ctx context.Context, e boil.ContextExecutor, sing
 	}
 
 	query := NewQuery(
-		qm.Select("\"policy\".policy_id, \"policy\".name, \"policy\".effect, \"policy\".actions, \"policy\".resource_name, \"a\".\"condition_id\""),
+		qm.Select("\"policy\".policy_id, \"policy\".name, \"policy\".effect, \"policy\".actions, \"policy\".resource_name, \"policy\".not_actions, \"policy\".not_resource_names, \"policy\".default_version, \"policy\".kind, \"policy\".owner_org_id, \"policy\".owner_role_id, \"a\".\"condition_id\""),
 		qm.From("\"policy\""),
 		qm.InnerJoin("\"condition_policies\" as \"a\" on \"policy\".\"policy_id\" = \"a\".\"policy_id\""),
 		qm.WhereIn("\"a\".\"condition_id\" in ?", args...),
@@ -494,7 +494,7 @@ func (conditionL) LoadPolicies(ctx context.Context, e boil.ContextExecutor, sing
 		one := new(Policy)
 		var localJoinCol int
 
-		err = results.Scan(&one.PolicyID, &one.Name, &one.Effect, &one.Actions, &one.ResourceName, &localJoinCol)
+		err = results.Scan(&one.PolicyID, &one.Name, &one.Effect, &one.Actions, &one.ResourceName, &one.NotActions, &one.NotResourceNames, &one.DefaultVersion, &one.Kind, &one.OwnerOrgID, &one.OwnerRoleID, &localJoinCol)
 		if err != nil {
 			return errors.Wrap(err, "failed to scan eager loaded results for policy")
 		}
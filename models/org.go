@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/friendsofgo/errors"
+	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/queries"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
@@ -23,55 +24,92 @@ import (
 
 // Org is an object representing the database table.
 type Org struct {
-	OrgID int    `boil:"org_id" json:"org_id" toml:"org_id" yaml:"org_id"`
-	Name  string `boil:"name" json:"name" toml:"name" yaml:"name"`
+	OrgID    int      `boil:"org_id" json:"org_id" toml:"org_id" yaml:"org_id"`
+	Name     string   `boil:"name" json:"name" toml:"name" yaml:"name"`
+	ParentID null.Int `boil:"parent_id" json:"parent_id,omitempty" toml:"parent_id" yaml:"parent_id,omitempty"`
 
 	R *orgR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L orgL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var OrgColumns = struct {
-	OrgID string
-	Name  string
+	OrgID    string
+	Name     string
+	ParentID string
 }{
-	OrgID: "org_id",
-	Name:  "name",
+	OrgID:    "org_id",
+	Name:     "name",
+	ParentID: "parent_id",
 }
 
 var OrgTableColumns = struct {
-	OrgID string
-	Name  string
+	OrgID    string
+	Name     string
+	ParentID string
 }{
-	OrgID: "org.org_id",
-	Name:  "org.name",
+	OrgID:    "org.org_id",
+	Name:     "org.name",
+	ParentID: "org.parent_id",
 }
 
 // Generated where
 
+type whereHelpernull_Int struct{ field string }
+
+func (w whereHelpernull_Int) EQ(x null.Int) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, false, x)
+}
+func (w whereHelpernull_Int) NEQ(x null.Int) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, true, x)
+}
+func (w whereHelpernull_Int) LT(x null.Int) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LT, x)
+}
+func (w whereHelpernull_Int) LTE(x null.Int) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LTE, x)
+}
+func (w whereHelpernull_Int) GT(x null.Int) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GT, x)
+}
+func (w whereHelpernull_Int) GTE(x null.Int) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GTE, x)
+}
+
+func (w whereHelpernull_Int) IsNull() qm.QueryMod    { return qmhelper.WhereIsNull(w.field) }
+func (w whereHelpernull_Int) IsNotNull() qm.QueryMod { return qmhelper.WhereIsNotNull(w.field) }
+
 var OrgWhere = struct {
-	OrgID whereHelperint
-	Name  whereHelperstring
+	OrgID    whereHelperint
+	Name     whereHelperstring
+	ParentID whereHelpernull_Int
 }{
-	OrgID: whereHelperint{field: "\"org\".\"org_id\""},
-	Name:  whereHelperstring{field: "\"org\".\"name\""},
+	OrgID:    whereHelperint{field: "\"org\".\"org_id\""},
+	Name:     whereHelperstring{field: "\"org\".\"name\""},
+	ParentID: whereHelpernull_Int{field: "\"org\".\"parent_id\""},
 }
 
 // OrgRels is where relationship names are stored.
 var OrgRels = struct {
-	Roles string
-	Users string
-	Zones string
+	Parent     string
+	ParentOrgs string
+	Roles      string
+	Users      string
+	Zones      string
 }{
-	Roles: "Roles",
-	Users: "Users",
-	Zones: "Zones",
+	Parent:     "Parent",
+	ParentOrgs: "ParentOrgs",
+	Roles:      "Roles",
+	Users:      "Users",
+	Zones:      "Zones",
 }
 
 // orgR is where relationships are stored.
 type orgR struct {
-	Roles RoleSlice `boil:"Roles" json:"Roles" toml:"Roles" yaml:"Roles"`
-	Users UserSlice `boil:"Users" json:"Users" toml:"Users" yaml:"Users"`
-	Zones ZoneSlice `boil:"Zones" json:"Zones" toml:"Zones" yaml:"Zones"`
+	Parent     *Org      `boil:"Parent" json:"Parent" toml:"Parent" yaml:"Parent"`
+	ParentOrgs OrgSlice  `boil:"ParentOrgs" json:"ParentOrgs" toml:"ParentOrgs" yaml:"ParentOrgs"`
+	Roles      RoleSlice `boil:"Roles" json:"Roles" toml:"Roles" yaml:"Roles"`
+	Users      UserSlice `boil:"Users" json:"Users" toml:"Users" yaml:"Users"`
+	Zones      ZoneSlice `boil:"Zones" json:"Zones" toml:"Zones" yaml:"Zones"`
 }
 
 // NewStruct creates a new relationship struct
@@ -83,8 +121,8 @@ func (*orgR) NewStruct() *orgR {
 type orgL struct{}
 
 var (
-	orgAllColumns            = []string{"org_id", "name"}
-	orgColumnsWithoutDefault = []string{"name"}
+	orgAllColumns            = []string{"org_id", "name", "parent_id"}
+	orgColumnsWithoutDefault = []string{"name", "parent_id"}
 	orgColumnsWithDefault    = []string{"org_id"}
 	orgPrimaryKeyColumns     = []string{"org_id"}
 )
@@ -364,6 +402,41 @@ func (q orgQuery) Exists(ctx context.Context, exec boil.ContextExecutor) (bool,
 	return count > 0, nil
 }
 
+// Parent pointed to by the foreign key.
+func (o *Org) Parent(mods ...qm.QueryMod) orgQuery {
+	queryMods := []qm.QueryMod{
+		qm.Where("\"org_id\" = ?", o.ParentID),
+	}
+
+	queryMods = append(queryMods, mods...)
+
+	query := Orgs(queryMods...)
+	queries.SetFrom(query.Query, "\"org\"")
+
+	return query
+}
+
+// ParentOrgs retrieves all the org's Orgs with an executor via parent_id column.
+func (o *Org) ParentOrgs(mods ...qm.QueryMod) orgQuery {
+	var queryMods []qm.QueryMod
+	if len(mods) != 0 {
+		queryMods = append(queryMods, mods...)
+	}
+
+	queryMods = append(queryMods,
+		qm.Where("\"org\".\"parent_id\"=?", o.OrgID),
+	)
+
+	query := Orgs(queryMods...)
+	queries.SetFrom(query.Query, "\"org\"")
+
+	if len(queries.GetSelect(query.Query)) == 0 {
+		queries.SetSelect(query.Query, []string{"\"org\".*"})
+	}
+
+	return query
+}
+
 // Roles retrieves all the role's Roles with an executor.
 func (o *Org) Roles(mods ...qm.QueryMod) roleQuery {
 	var queryMods []qm.QueryMod
@@ -427,6 +500,212 @@ func (o *Org) Zones(mods ...qm.QueryMod) zoneQuery {
 	return query
 }
 
+// LoadParent allows an eager lookup of values, cached into the
+// loaded structs of the objects. This is for an N-1 relationship.
+func (orgL) LoadParent(ctx context.Context, e boil.ContextExecutor, singular bool, maybeOrg interface{}, mods queries.Applicator) error {
+	var slice []*Org
+	var object *Org
+
+	if singular {
+		object = maybeOrg.(*Org)
+	} else {
+		slice = *maybeOrg.(*[]*Org)
+	}
+
+	args := make([]interface{}, 0, 1)
+	if singular {
+		if object.R == nil {
+			object.R = &orgR{}
+		}
+		if !queries.IsNil(object.ParentID) {
+			args = append(args, object.ParentID)
+		}
+
+	} else {
+	Outer:
+		for _, obj := range slice {
+			if obj.R == nil {
+				obj.R = &orgR{}
+			}
+
+			for _, a := range args {
+				if queries.Equal(a, obj.ParentID) {
+					continue Outer
+				}
+			}
+
+			if !queries.IsNil(obj.ParentID) {
+				args = append(args, obj.ParentID)
+			}
+
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := NewQuery(
+		qm.From(`org`),
+		qm.WhereIn(`org.org_id in ?`, args...),
+	)
+	if mods != nil {
+		mods.Apply(query)
+	}
+
+	results, err := query.QueryContext(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to eager load Org")
+	}
+
+	var resultSlice []*Org
+	if err = queries.Bind(results, &resultSlice); err != nil {
+		return errors.Wrap(err, "failed to bind eager loaded slice Org")
+	}
+
+	if err = results.Close(); err != nil {
+		return errors.Wrap(err, "failed to close results of eager load for org")
+	}
+	if err = results.Err(); err != nil {
+		return errors.Wrap(err, "error occurred during iteration of eager loaded relations for org")
+	}
+
+	if len(orgAfterSelectHooks) != 0 {
+		for _, obj := range resultSlice {
+			if err := obj.doAfterSelectHooks(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(resultSlice) == 0 {
+		return nil
+	}
+
+	if singular {
+		foreign := resultSlice[0]
+		object.R.Parent = foreign
+		if foreign.R == nil {
+			foreign.R = &orgR{}
+		}
+		foreign.R.ParentOrgs = append(foreign.R.ParentOrgs, object)
+		return nil
+	}
+
+	for _, local := range slice {
+		for _, foreign := range resultSlice {
+			if queries.Equal(local.ParentID, foreign.OrgID) {
+				local.R.Parent = foreign
+				if foreign.R == nil {
+					foreign.R = &orgR{}
+				}
+				foreign.R.ParentOrgs = append(foreign.R.ParentOrgs, local)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadParentOrgs allows an eager lookup of values, cached into the
+// loaded structs of the objects. This is for a 1-M or N-M relationship.
+func (orgL) LoadParentOrgs(ctx context.Context, e boil.ContextExecutor, singular bool, maybeOrg interface{}, mods queries.Applicator) error {
+	var slice []*Org
+	var object *Org
+
+	if singular {
+		object = maybeOrg.(*Org)
+	} else {
+		slice = *maybeOrg.(*[]*Org)
+	}
+
+	args := make([]interface{}, 0, 1)
+	if singular {
+		if object.R == nil {
+			object.R = &orgR{}
+		}
+		args = append(args, object.OrgID)
+	} else {
+	Outer:
+		for _, obj := range slice {
+			if obj.R == nil {
+				obj.R = &orgR{}
+			}
+
+			for _, a := range args {
+				if queries.Equal(a, obj.OrgID) {
+					continue Outer
+				}
+			}
+
+			args = append(args, obj.OrgID)
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := NewQuery(
+		qm.From(`org`),
+		qm.WhereIn(`org.parent_id in ?`, args...),
+	)
+	if mods != nil {
+		mods.Apply(query)
+	}
+
+	results, err := query.QueryContext(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to eager load org")
+	}
+
+	var resultSlice []*Org
+	if err = queries.Bind(results, &resultSlice); err != nil {
+		return errors.Wrap(err, "failed to bind eager loaded slice org")
+	}
+
+	if err = results.Close(); err != nil {
+		return errors.Wrap(err, "failed to close results in eager load on org")
+	}
+	if err = results.Err(); err != nil {
+		return errors.Wrap(err, "error occurred during iteration of eager loaded relations for org")
+	}
+
+	if len(orgAfterSelectHooks) != 0 {
+		for _, obj := range resultSlice {
+			if err := obj.doAfterSelectHooks(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+	if singular {
+		object.R.ParentOrgs = resultSlice
+		for _, foreign := range resultSlice {
+			if foreign.R == nil {
+				foreign.R = &orgR{}
+			}
+			foreign.R.Parent = object
+		}
+		return nil
+	}
+
+	for _, foreign := range resultSlice {
+		for _, local := range slice {
+			if queries.Equal(local.OrgID, foreign.ParentID) {
+				local.R.ParentOrgs = append(local.R.ParentOrgs, foreign)
+				if foreign.R == nil {
+					foreign.R = &orgR{}
+				}
+				foreign.R.Parent = local
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
 // LoadRoles allows an eager lookup of values, cached into the
 // loaded structs of the objects. This is for a 1-M or N-M relationship.
 func (orgL) LoadRoles(ctx context.Context, e boil.ContextExecutor, singular bool, maybeOrg interface{}, mods queries.Applicator) error {
@@ -721,6 +1000,213 @@ func (orgL) LoadZones(ctx context.Context, e boil.ContextExecutor, singular bool
 	return nil
 }
 
+// SetParent of the org to the related item.
+// Sets o.R.Parent to related.
+// Adds o to related.R.ParentOrgs.
+func (o *Org) SetParent(ctx context.Context, exec boil.ContextExecutor, insert bool, related *Org) error {
+	var err error
+	if insert {
+		if err = related.Insert(ctx, exec, boil.Infer()); err != nil {
+			return errors.Wrap(err, "failed to insert into foreign table")
+		}
+	}
+
+	updateQuery := fmt.Sprintf(
+		"UPDATE \"org\" SET %s WHERE %s",
+		strmangle.SetParamNames("\"", "\"", 1, []string{"parent_id"}),
+		strmangle.WhereClause("\"", "\"", 2, orgPrimaryKeyColumns),
+	)
+	values := []interface{}{related.OrgID, o.OrgID}
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, updateQuery)
+		fmt.Fprintln(writer, values)
+	}
+	if _, err = exec.ExecContext(ctx, updateQuery, values...); err != nil {
+		return errors.Wrap(err, "failed to update local table")
+	}
+
+	queries.Assign(&o.ParentID, related.OrgID)
+	if o.R == nil {
+		o.R = &orgR{
+			Parent: related,
+		}
+	} else {
+		o.R.Parent = related
+	}
+
+	if related.R == nil {
+		related.R = &orgR{
+			ParentOrgs: OrgSlice{o},
+		}
+	} else {
+		related.R.ParentOrgs = append(related.R.ParentOrgs, o)
+	}
+
+	return nil
+}
+
+// RemoveParent relationship.
+// Sets o.R.Parent to nil.
+// Removes o from all passed in related items' relationships struct (Optional).
+func (o *Org) RemoveParent(ctx context.Context, exec boil.ContextExecutor, related *Org) error {
+	var err error
+
+	queries.SetScanner(&o.ParentID, nil)
+	if _, err = o.Update(ctx, exec, boil.Whitelist("parent_id")); err != nil {
+		return errors.Wrap(err, "failed to update local table")
+	}
+
+	if o.R != nil {
+		o.R.Parent = nil
+	}
+	if related == nil || related.R == nil {
+		return nil
+	}
+
+	for i, ri := range related.R.ParentOrgs {
+		if queries.Equal(o.ParentID, ri.ParentID) {
+			continue
+		}
+
+		ln := len(related.R.ParentOrgs)
+		if ln > 1 && i < ln-1 {
+			related.R.ParentOrgs[i] = related.R.ParentOrgs[ln-1]
+		}
+		related.R.ParentOrgs = related.R.ParentOrgs[:ln-1]
+		break
+	}
+	return nil
+}
+
+// AddParentOrgs adds the given related objects to the existing relationships
+// of the org, optionally inserting them as new records.
+// Appends related to o.R.ParentOrgs.
+// Sets related.R.Parent appropriately.
+func (o *Org) AddParentOrgs(ctx context.Context, exec boil.ContextExecutor, insert bool, related ...*Org) error {
+	var err error
+	for _, rel := range related {
+		if insert {
+			queries.Assign(&rel.ParentID, o.OrgID)
+			if err = rel.Insert(ctx, exec, boil.Infer()); err != nil {
+				return errors.Wrap(err, "failed to insert into foreign table")
+			}
+		} else {
+			updateQuery := fmt.Sprintf(
+				"UPDATE \"org\" SET %s WHERE %s",
+				strmangle.SetParamNames("\"", "\"", 1, []string{"parent_id"}),
+				strmangle.WhereClause("\"", "\"", 2, orgPrimaryKeyColumns),
+			)
+			values := []interface{}{o.OrgID, rel.OrgID}
+
+			if boil.IsDebug(ctx) {
+				writer := boil.DebugWriterFrom(ctx)
+				fmt.Fprintln(writer, updateQuery)
+				fmt.Fprintln(writer, values)
+			}
+			if _, err = exec.ExecContext(ctx, updateQuery, values...); err != nil {
+				return errors.Wrap(err, "failed to update foreign table")
+			}
+
+			queries.Assign(&rel.ParentID, o.OrgID)
+		}
+	}
+
+	if o.R == nil {
+		o.R = &orgR{
+			ParentOrgs: related,
+		}
+	} else {
+		o.R.ParentOrgs = append(o.R.ParentOrgs, related...)
+	}
+
+	for _, rel := range related {
+		if rel.R == nil {
+			rel.R = &orgR{
+				Parent: o,
+			}
+		} else {
+			rel.R.Parent = o
+		}
+	}
+	return nil
+}
+
+// SetParentOrgs removes all previously related items of the
+// org replacing them completely with the passed
+// in related items, optionally inserting them as new records.
+// Sets o.R.Parent's ParentOrgs accordingly.
+// Replaces o.R.ParentOrgs with related.
+// Sets related.R.Parent's ParentOrgs accordingly.
+func (o *Org) SetParentOrgs(ctx context.Context, exec boil.ContextExecutor, insert bool, related ...*Org) error {
+	query := "update \"org\" set \"parent_id\" = null where \"parent_id\" = $1"
+	values := []interface{}{o.OrgID}
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, query)
+		fmt.Fprintln(writer, values)
+	}
+	_, err := exec.ExecContext(ctx, query, values...)
+	if err != nil {
+		return errors.Wrap(err, "failed to remove relationships before set")
+	}
+
+	if o.R != nil {
+		for _, rel := range o.R.ParentOrgs {
+			queries.SetScanner(&rel.ParentID, nil)
+			if rel.R == nil {
+				continue
+			}
+
+			rel.R.Parent = nil
+		}
+
+		o.R.ParentOrgs = nil
+	}
+	return o.AddParentOrgs(ctx, exec, insert, related...)
+}
+
+// RemoveParentOrgs relationships from objects passed in.
+// Removes related items from R.ParentOrgs (uses pointer comparison, removal does not keep order)
+// Sets related.R.Parent.
+func (o *Org) RemoveParentOrgs(ctx context.Context, exec boil.ContextExecutor, related ...*Org) error {
+	if len(related) == 0 {
+		return nil
+	}
+
+	var err error
+	for _, rel := range related {
+		queries.SetScanner(&rel.ParentID, nil)
+		if rel.R != nil {
+			rel.R.Parent = nil
+		}
+		if _, err = rel.Update(ctx, exec, boil.Whitelist("parent_id")); err != nil {
+			return err
+		}
+	}
+	if o.R == nil {
+		return nil
+	}
+
+	for _, rel := range related {
+		for i, ri := range o.R.ParentOrgs {
+			if rel != ri {
+				continue
+			}
+
+			ln := len(o.R.ParentOrgs)
+			if ln > 1 && i < ln-1 {
+				o.R.ParentOrgs[i] = o.R.ParentOrgs[ln-1]
+			}
+			o.R.ParentOrgs = o.R.ParentOrgs[:ln-1]
+			break
+		}
+	}
+
+	return nil
+}
+
 // AddRoles adds the given related objects to the existing relationships
 // of the org, optionally inserting them as new records.
 // Appends related to o.R.Roles.
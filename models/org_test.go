@@ -494,6 +494,83 @@ func testOrgsInsertWhitelist(t *testing.T) {
 	}
 }
 
+func testOrgToManyParentOrgs(t *testing.T) {
+	var err error
+	ctx := context.Background()
+	tx := MustTx(boil.BeginTx(ctx, nil))
+	defer func() { _ = tx.Rollback() }()
+
+	var a Org
+	var b, c Org
+
+	seed := randomize.NewSeed()
+	if err = randomize.Struct(seed, &a, orgDBTypes, true, orgColumnsWithDefault...); err != nil {
+		t.Errorf("Unable to randomize Org struct: %s", err)
+	}
+
+	if err := a.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = randomize.Struct(seed, &b, orgDBTypes, false, orgColumnsWithDefault...); err != nil {
+		t.Fatal(err)
+	}
+	if err = randomize.Struct(seed, &c, orgDBTypes, false, orgColumnsWithDefault...); err != nil {
+		t.Fatal(err)
+	}
+
+	queries.Assign(&b.ParentID, a.OrgID)
+	queries.Assign(&c.ParentID, a.OrgID)
+	if err = b.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := a.ParentOrgs().All(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bFound, cFound := false, false
+	for _, v := range check {
+		if queries.Equal(v.ParentID, b.ParentID) {
+			bFound = true
+		}
+		if queries.Equal(v.ParentID, c.ParentID) {
+			cFound = true
+		}
+	}
+
+	if !bFound {
+		t.Error("expected to find b")
+	}
+	if !cFound {
+		t.Error("expected to find c")
+	}
+
+	slice := OrgSlice{&a}
+	if err = a.L.LoadParentOrgs(ctx, tx, false, (*[]*Org)(&slice), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(a.R.ParentOrgs); got != 2 {
+		t.Error("number of eager loaded records wrong, got:", got)
+	}
+
+	a.R.ParentOrgs = nil
+	if err = a.L.LoadParentOrgs(ctx, tx, true, &a, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(a.R.ParentOrgs); got != 2 {
+		t.Error("number of eager loaded records wrong, got:", got)
+	}
+
+	if t.Failed() {
+		t.Logf("%#v", check)
+	}
+}
+
 func testOrgToManyRoles(t *testing.T) {
 	var err error
 	ctx := context.Background()
@@ -728,6 +805,257 @@ func testOrgToManyZones(t *testing.T) {
 	}
 }
 
+func testOrgToManyAddOpParentOrgs(t *testing.T) {
+	var err error
+
+	ctx := context.Background()
+	tx := MustTx(boil.BeginTx(ctx, nil))
+	defer func() { _ = tx.Rollback() }()
+
+	var a Org
+	var b, c, d, e Org
+
+	seed := randomize.NewSeed()
+	if err = randomize.Struct(seed, &a, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+	foreigners := []*Org{&b, &c, &d, &e}
+	for _, x := range foreigners {
+		if err = randomize.Struct(seed, x, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := a.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	foreignersSplitByInsertion := [][]*Org{
+		{&b, &c},
+		{&d, &e},
+	}
+
+	for i, x := range foreignersSplitByInsertion {
+		err = a.AddParentOrgs(ctx, tx, i != 0, x...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first := x[0]
+		second := x[1]
+
+		if !queries.Equal(a.OrgID, first.ParentID) {
+			t.Error("foreign key was wrong value", a.OrgID, first.ParentID)
+		}
+		if !queries.Equal(a.OrgID, second.ParentID) {
+			t.Error("foreign key was wrong value", a.OrgID, second.ParentID)
+		}
+
+		if first.R.Parent != &a {
+			t.Error("relationship was not added properly to the foreign slice")
+		}
+		if second.R.Parent != &a {
+			t.Error("relationship was not added properly to the foreign slice")
+		}
+
+		if a.R.ParentOrgs[i*2] != first {
+			t.Error("relationship struct slice not set to correct value")
+		}
+		if a.R.ParentOrgs[i*2+1] != second {
+			t.Error("relationship struct slice not set to correct value")
+		}
+
+		count, err := a.ParentOrgs().Count(ctx, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int64((i + 1) * 2); count != want {
+			t.Error("want", want, "got", count)
+		}
+	}
+}
+
+func testOrgToManySetOpParentOrgs(t *testing.T) {
+	var err error
+
+	ctx := context.Background()
+	tx := MustTx(boil.BeginTx(ctx, nil))
+	defer func() { _ = tx.Rollback() }()
+
+	var a Org
+	var b, c, d, e Org
+
+	seed := randomize.NewSeed()
+	if err = randomize.Struct(seed, &a, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+	foreigners := []*Org{&b, &c, &d, &e}
+	for _, x := range foreigners {
+		if err = randomize.Struct(seed, x, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = a.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.SetParentOrgs(ctx, tx, false, &b, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := a.ParentOrgs().Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Error("count was wrong:", count)
+	}
+
+	err = a.SetParentOrgs(ctx, tx, true, &d, &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err = a.ParentOrgs().Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Error("count was wrong:", count)
+	}
+
+	if !queries.IsValuerNil(b.ParentID) {
+		t.Error("want b's foreign key value to be nil")
+	}
+	if !queries.IsValuerNil(c.ParentID) {
+		t.Error("want c's foreign key value to be nil")
+	}
+	if !queries.Equal(a.OrgID, d.ParentID) {
+		t.Error("foreign key was wrong value", a.OrgID, d.ParentID)
+	}
+	if !queries.Equal(a.OrgID, e.ParentID) {
+		t.Error("foreign key was wrong value", a.OrgID, e.ParentID)
+	}
+
+	if b.R.Parent != nil {
+		t.Error("relationship was not removed properly from the foreign struct")
+	}
+	if c.R.Parent != nil {
+		t.Error("relationship was not removed properly from the foreign struct")
+	}
+	if d.R.Parent != &a {
+		t.Error("relationship was not added properly to the foreign struct")
+	}
+	if e.R.Parent != &a {
+		t.Error("relationship was not added properly to the foreign struct")
+	}
+
+	if a.R.ParentOrgs[0] != &d {
+		t.Error("relationship struct slice not set to correct value")
+	}
+	if a.R.ParentOrgs[1] != &e {
+		t.Error("relationship struct slice not set to correct value")
+	}
+}
+
+func testOrgToManyRemoveOpParentOrgs(t *testing.T) {
+	var err error
+
+	ctx := context.Background()
+	tx := MustTx(boil.BeginTx(ctx, nil))
+	defer func() { _ = tx.Rollback() }()
+
+	var a Org
+	var b, c, d, e Org
+
+	seed := randomize.NewSeed()
+	if err = randomize.Struct(seed, &a, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+	foreigners := []*Org{&b, &c, &d, &e}
+	for _, x := range foreigners {
+		if err = randomize.Struct(seed, x, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := a.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.AddParentOrgs(ctx, tx, true, foreigners...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := a.ParentOrgs().Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Error("count was wrong:", count)
+	}
+
+	err = a.RemoveParentOrgs(ctx, tx, foreigners[:2]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err = a.ParentOrgs().Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Error("count was wrong:", count)
+	}
+
+	if !queries.IsValuerNil(b.ParentID) {
+		t.Error("want b's foreign key value to be nil")
+	}
+	if !queries.IsValuerNil(c.ParentID) {
+		t.Error("want c's foreign key value to be nil")
+	}
+
+	if b.R.Parent != nil {
+		t.Error("relationship was not removed properly from the foreign struct")
+	}
+	if c.R.Parent != nil {
+		t.Error("relationship was not removed properly from the foreign struct")
+	}
+	if d.R.Parent != &a {
+		t.Error("relationship to a should have been preserved")
+	}
+	if e.R.Parent != &a {
+		t.Error("relationship to a should have been preserved")
+	}
+
+	if len(a.R.ParentOrgs) != 2 {
+		t.Error("should have preserved two relationships")
+	}
+
+	// Removal doesn't do a stable deletion for performance so we have to flip the order
+	if a.R.ParentOrgs[1] != &d {
+		t.Error("relationship to d should have been preserved")
+	}
+	if a.R.ParentOrgs[0] != &e {
+		t.Error("relationship to e should have been preserved")
+	}
+}
+
 func testOrgToManyAddOpRoles(t *testing.T) {
 	var err error
 
@@ -953,6 +1281,165 @@ func testOrgToManyAddOpZones(t *testing.T) {
 		}
 	}
 }
+func testOrgToOneOrgUsingParent(t *testing.T) {
+	ctx := context.Background()
+	tx := MustTx(boil.BeginTx(ctx, nil))
+	defer func() { _ = tx.Rollback() }()
+
+	var local Org
+	var foreign Org
+
+	seed := randomize.NewSeed()
+	if err := randomize.Struct(seed, &local, orgDBTypes, true, orgColumnsWithDefault...); err != nil {
+		t.Errorf("Unable to randomize Org struct: %s", err)
+	}
+	if err := randomize.Struct(seed, &foreign, orgDBTypes, false, orgColumnsWithDefault...); err != nil {
+		t.Errorf("Unable to randomize Org struct: %s", err)
+	}
+
+	if err := foreign.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	queries.Assign(&local.ParentID, foreign.OrgID)
+	if err := local.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := local.Parent().One(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !queries.Equal(check.OrgID, foreign.OrgID) {
+		t.Errorf("want: %v, got %v", foreign.OrgID, check.OrgID)
+	}
+
+	slice := OrgSlice{&local}
+	if err = local.L.LoadParent(ctx, tx, false, (*[]*Org)(&slice), nil); err != nil {
+		t.Fatal(err)
+	}
+	if local.R.Parent == nil {
+		t.Error("struct should have been eager loaded")
+	}
+
+	local.R.Parent = nil
+	if err = local.L.LoadParent(ctx, tx, true, &local, nil); err != nil {
+		t.Fatal(err)
+	}
+	if local.R.Parent == nil {
+		t.Error("struct should have been eager loaded")
+	}
+}
+
+func testOrgToOneSetOpOrgUsingParent(t *testing.T) {
+	var err error
+
+	ctx := context.Background()
+	tx := MustTx(boil.BeginTx(ctx, nil))
+	defer func() { _ = tx.Rollback() }()
+
+	var a Org
+	var b, c Org
+
+	seed := randomize.NewSeed()
+	if err = randomize.Struct(seed, &a, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+	if err = randomize.Struct(seed, &b, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+	if err = randomize.Struct(seed, &c, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, x := range []*Org{&b, &c} {
+		err = a.SetParent(ctx, tx, i != 0, x)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a.R.Parent != x {
+			t.Error("relationship struct not set to correct value")
+		}
+
+		if x.R.ParentOrgs[0] != &a {
+			t.Error("failed to append to foreign relationship struct")
+		}
+		if !queries.Equal(a.ParentID, x.OrgID) {
+			t.Error("foreign key was wrong value", a.ParentID)
+		}
+
+		zero := reflect.Zero(reflect.TypeOf(a.ParentID))
+		reflect.Indirect(reflect.ValueOf(&a.ParentID)).Set(zero)
+
+		if err = a.Reload(ctx, tx); err != nil {
+			t.Fatal("failed to reload", err)
+		}
+
+		if !queries.Equal(a.ParentID, x.OrgID) {
+			t.Error("foreign key was wrong value", a.ParentID, x.OrgID)
+		}
+	}
+}
+
+func testOrgToOneRemoveOpOrgUsingParent(t *testing.T) {
+	var err error
+
+	ctx := context.Background()
+	tx := MustTx(boil.BeginTx(ctx, nil))
+	defer func() { _ = tx.Rollback() }()
+
+	var a Org
+	var b Org
+
+	seed := randomize.NewSeed()
+	if err = randomize.Struct(seed, &a, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+	if err = randomize.Struct(seed, &b, orgDBTypes, false, strmangle.SetComplement(orgPrimaryKeyColumns, orgColumnsWithoutDefault)...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Insert(ctx, tx, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.SetParent(ctx, tx, true, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.RemoveParent(ctx, tx, &b); err != nil {
+		t.Error("failed to remove relationship")
+	}
+
+	count, err := a.Parent().Count(ctx, tx)
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 0 {
+		t.Error("want no relationships remaining")
+	}
+
+	if a.R.Parent != nil {
+		t.Error("R struct entry should be nil")
+	}
+
+	if !queries.IsValuerNil(a.ParentID) {
+		t.Error("foreign key value should be nil")
+	}
+
+	if len(b.R.ParentOrgs) != 0 {
+		t.Error("failed to remove a from b's relationships")
+	}
+}
 
 func testOrgsReload(t *testing.T) {
 	t.Parallel()
@@ -1028,7 +1515,7 @@ func testOrgsSelect(t *testing.T) {
 }
 
 var (
-	orgDBTypes = map[string]string{`OrgID`: `integer`, `Name`: `character varying`}
+	orgDBTypes = map[string]string{`OrgID`: `integer`, `Name`: `character varying`, `ParentID`: `integer`}
 	_          = bytes.MinRead
 )
 
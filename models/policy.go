@@ -24,42 +24,72 @@ import (
 
 // Policy is an object representing the database table.
 type Policy struct {
-	PolicyID     int               `boil:"policy_id" json:"policy_id" toml:"policy_id" yaml:"policy_id"`
-	Name         string            `boil:"name" json:"name" toml:"name" yaml:"name"`
-	Effect       string            `boil:"effect" json:"effect" toml:"effect" yaml:"effect"`
-	Actions      types.StringArray `boil:"actions" json:"actions,omitempty" toml:"actions" yaml:"actions,omitempty"`
-	ResourceName string            `boil:"resource_name" json:"resource_name" toml:"resource_name" yaml:"resource_name"`
+	PolicyID         int               `boil:"policy_id" json:"policy_id" toml:"policy_id" yaml:"policy_id"`
+	Name             string            `boil:"name" json:"name" toml:"name" yaml:"name"`
+	Effect           string            `boil:"effect" json:"effect" toml:"effect" yaml:"effect"`
+	Actions          types.StringArray `boil:"actions" json:"actions,omitempty" toml:"actions" yaml:"actions,omitempty"`
+	ResourceName     string            `boil:"resource_name" json:"resource_name" toml:"resource_name" yaml:"resource_name"`
+	NotActions       types.StringArray `boil:"not_actions" json:"not_actions" toml:"not_actions" yaml:"not_actions"`
+	NotResourceNames types.StringArray `boil:"not_resource_names" json:"not_resource_names" toml:"not_resource_names" yaml:"not_resource_names"`
+	DefaultVersion   int               `boil:"default_version" json:"default_version" toml:"default_version" yaml:"default_version"`
+	Kind             string            `boil:"kind" json:"kind" toml:"kind" yaml:"kind"`
+	OwnerOrgID       int               `boil:"owner_org_id" json:"owner_org_id" toml:"owner_org_id" yaml:"owner_org_id"`
+	OwnerRoleID      int               `boil:"owner_role_id" json:"owner_role_id" toml:"owner_role_id" yaml:"owner_role_id"`
 
 	R *policyR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L policyL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var PolicyColumns = struct {
-	PolicyID     string
-	Name         string
-	Effect       string
-	Actions      string
-	ResourceName string
+	PolicyID         string
+	Name             string
+	Effect           string
+	Actions          string
+	ResourceName     string
+	NotActions       string
+	NotResourceNames string
+	DefaultVersion   string
+	Kind             string
+	OwnerOrgID       string
+	OwnerRoleID      string
 }{
-	PolicyID:     "policy_id",
-	Name:         "name",
-	Effect:       "effect",
-	Actions:      "actions",
-	ResourceName: "resource_name",
+	PolicyID:         "policy_id",
+	Name:             "name",
+	Effect:           "effect",
+	Actions:          "actions",
+	ResourceName:     "resource_name",
+	NotActions:       "not_actions",
+	NotResourceNames: "not_resource_names",
+	DefaultVersion:   "default_version",
+	Kind:             "kind",
+	OwnerOrgID:       "owner_org_id",
+	OwnerRoleID:      "owner_role_id",
 }
 
 var PolicyTableColumns = struct {
-	PolicyID     string
-	Name         string
-	Effect       string
-	Actions      string
-	ResourceName string
+	PolicyID         string
+	Name             string
+	Effect           string
+	Actions          string
+	ResourceName     string
+	NotActions       string
+	NotResourceNames string
+	DefaultVersion   string
+	Kind             string
+	OwnerOrgID       string
+	OwnerRoleID      string
 }{
-	PolicyID:     "policy.policy_id",
-	Name:         "policy.name",
-	Effect:       "policy.effect",
-	Actions:      "policy.actions",
-	ResourceName: "policy.resource_name",
+	PolicyID:         "policy.policy_id",
+	Name:             "policy.name",
+	Effect:           "policy.effect",
+	Actions:          "policy.actions",
+	ResourceName:     "policy.resource_name",
+	NotActions:       "policy.not_actions",
+	NotResourceNames: "policy.not_resource_names",
+	DefaultVersion:   "policy.default_version",
+	Kind:             "policy.kind",
+	OwnerOrgID:       "policy.owner_org_id",
+	OwnerRoleID:      "policy.owner_role_id",
 }
 
 // Generated where
@@ -91,17 +121,29 @@ func (w whereHelpertypes_StringArray) IsNotNull() qm.QueryMod {
 }
 
 var PolicyWhere = struct {
-	PolicyID     whereHelperint
-	Name         whereHelperstring
-	Effect       whereHelperstring
-	Actions      whereHelpertypes_StringArray
-	ResourceName whereHelperstring
+	PolicyID         whereHelperint
+	Name             whereHelperstring
+	Effect           whereHelperstring
+	Actions          whereHelpertypes_StringArray
+	ResourceName     whereHelperstring
+	NotActions       whereHelpertypes_StringArray
+	NotResourceNames whereHelpertypes_StringArray
+	DefaultVersion   whereHelperint
+	Kind             whereHelperstring
+	OwnerOrgID       whereHelperint
+	OwnerRoleID      whereHelperint
 }{
-	PolicyID:     whereHelperint{field: "\"policy\".\"policy_id\""},
-	Name:         whereHelperstring{field: "\"policy\".\"name\""},
-	Effect:       whereHelperstring{field: "\"policy\".\"effect\""},
-	Actions:      whereHelpertypes_StringArray{field: "\"policy\".\"actions\""},
-	ResourceName: whereHelperstring{field: "\"policy\".\"resource_name\""},
+	PolicyID:         whereHelperint{field: "\"policy\".\"policy_id\""},
+	Name:             whereHelperstring{field: "\"policy\".\"name\""},
+	Effect:           whereHelperstring{field: "\"policy\".\"effect\""},
+	Actions:          whereHelpertypes_StringArray{field: "\"policy\".\"actions\""},
+	ResourceName:     whereHelperstring{field: "\"policy\".\"resource_name\""},
+	NotActions:       whereHelpertypes_StringArray{field: "\"policy\".\"not_actions\""},
+	NotResourceNames: whereHelpertypes_StringArray{field: "\"policy\".\"not_resource_names\""},
+	DefaultVersion:   whereHelperint{field: "\"policy\".\"default_version\""},
+	Kind:             whereHelperstring{field: "\"policy\".\"kind\""},
+	OwnerOrgID:       whereHelperint{field: "\"policy\".\"owner_org_id\""},
+	OwnerRoleID:      whereHelperint{field: "\"policy\".\"owner_role_id\""},
 }
 
 // PolicyRels is where relationship names are stored.
@@ -128,9 +170,9 @@ func (*policyR) NewStruct() *policyR {
 type policyL struct{}
 
 var (
-	policyAllColumns            = []string{"policy_id", "name", "effect", "actions", "resource_name"}
+	policyAllColumns            = []string{"policy_id", "name", "effect", "actions", "resource_name", "not_actions", "not_resource_names", "default_version", "kind", "owner_org_id", "owner_role_id"}
 	policyColumnsWithoutDefault = []string{"name", "effect", "actions", "resource_name"}
-	policyColumnsWithDefault    = []string{"policy_id"}
+	policyColumnsWithDefault    = []string{"policy_id", "not_actions", "not_resource_names", "default_version", "kind", "owner_org_id", "owner_role_id"}
 	policyPrimaryKeyColumns     = []string{"policy_id"}
 )
 
@@ -1192,7 +1192,7 @@ func testPoliciesSelect(t *testing.T) {
 }
 
 var (
-	policyDBTypes = map[string]string{`PolicyID`: `integer`, `Name`: `text`, `Effect`: `text`, `Actions`: `ARRAYtext`, `ResourceName`: `text`}
+	policyDBTypes = map[string]string{`PolicyID`: `integer`, `Name`: `text`, `Effect`: `text`, `Actions`: `ARRAYtext`, `ResourceName`: `text`, `NotActions`: `ARRAYtext`, `NotResourceNames`: `ARRAYtext`, `DefaultVersion`: `integer`, `Kind`: `text`, `OwnerOrgID`: `integer`, `OwnerRoleID`: `integer`}
 	_             = bytes.MinRead
 )
 
@@ -1,69 +1,68 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"github.com/mburtless/oso-rbac-iam/datastore"
-	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamfiber"
+	"strings"
 )
 
-type reqMetaKeyType string
-
-const reqMetaKey reqMetaKeyType = "reqMetaKey"
-
-var errMissingReqMeta = errors.New("request metadata not found in user context")
+// notFoundBodies is the body of the 404 response for each resource type
+var notFoundBodies = map[string]string{
+	"zone":   errHTMLZoneNotFound,
+	"record": errHTMLRecordNotFound,
+}
 
-// DerivedUser is a user and all of it's roles and policies
-type DerivedUser struct {
-	User        *models.User
-	Permissions datastore.EffectivePerms
+// newMiddleware configures IAM enforcement middleware for the app's routes
+func (s *Server) newMiddleware() *iamfiber.Middleware {
+	return iamfiber.New(iamfiber.Config{
+		Enforcer:     s.newEnforcer(),
+		ErrorHandler: errorHandler,
+	})
 }
 
-// loads derived user associated with request and saves it in request metadata in user context
-// for use in fine grained authorization within endpoint
-func setReqMeta(c *fiber.Ctx, ds datastore.Datastore) error {
-	var (
-		reqMeta DerivedUser
-		err     error
-	)
-	apiKey := c.Get("x-api-key", "")
-	if apiKey == "" {
-		return c.Status(401).SendString(fmt.Sprintf("<h1>Whoops!<h1><p>%s</p>", errMissingAPIKey))
-	}
+// newEnforcer configures the authorization core shared by the app's HTTP and gRPC middleware
+func (s *Server) newEnforcer() *iam.Enforcer {
+	return iam.NewEnforcer(iam.EnforcerConfig{
+		Authorizer:         s.authz,
+		DisclosurePolicies: s.cfg.DisclosurePolicies,
+		Record:             s.decisionRecorder(),
+		Logger:             s.logger,
+	})
+}
 
-	// load user
-	reqMeta.User, err = ds.FindUserByKey(context.Background(), apiKey)
-	if err != nil {
-		logger.Errorw("error finding user by api key", "error", err)
-		return c.Status(401).SendString("<h1>Whoops!<h1><p>User not found</p>")
-	}
+// newCheckEnforcer returns an Enforcer for the check APIs.  Their decisions answer what a principal could do rather
+// than record what it did, so they're neither recorded in the decision audit trail nor tracked as usage, which would
+// attribute them to the principal and mark its policies and API key used.
+func (s *Server) newCheckEnforcer() *iam.Enforcer {
+	return iam.NewEnforcer(iam.EnforcerConfig{
+		Authorizer:         s.authz,
+		DisclosurePolicies: s.cfg.DisclosurePolicies,
+		Logger:             s.logger,
+	})
+}
 
-	// load roles and policies from ds into set of permissions
-	reqMeta.Permissions, err = ds.GetEffectivePerms(context.Background(), reqMeta.User.UserID)
-	if err != nil {
-		logger.Errorw("error finding effective permissions for user", "error", err)
-		return c.Status(401).SendString("<h1>Whoops!<h1><p>User not found</p>")
+// errorHandler responds to authentication and authorization failures in the format of the API requested
+func errorHandler(c *fiber.Ctx, err *iam.Error) error {
+	if strings.HasPrefix(c.Path(), adminPrefix+"/") {
+		return jsonErrorHandler(c, err)
 	}
-	logger.Debugw("found effective permissions for user", "roles", reqMeta.Permissions)
-
-	// save to user context
-	ctx := c.UserContext()
-	ctx = context.WithValue(ctx, reqMetaKey, reqMeta)
-	c.SetUserContext(ctx)
-
-	return c.Next()
+	return htmlErrorHandler(c, err)
 }
 
-func getReqMeta(c *fiber.Ctx) (*DerivedUser, error) {
-	reqMeta := c.UserContext().Value(reqMetaKey)
-	if reqMeta == nil {
-		return nil, errMissingReqMeta
-	}
-	rm, ok := reqMeta.(DerivedUser)
-	if !ok {
-		return nil, errors.New("invalid request metadata in user context")
+// htmlErrorHandler responds to authentication and authorization failures with HTML error pages
+func htmlErrorHandler(c *fiber.Ctx, err *iam.Error) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	switch err.Status {
+	case fiber.StatusUnauthorized:
+		if errors.Is(err, iam.ErrMissingAPIKey) {
+			return c.Status(err.Status).SendString(fmt.Sprintf("<h1>Whoops!<h1><p>%s</p>", errMissingAPIKey))
+		}
+		return c.Status(err.Status).SendString(errHTMLUserNotFound)
+	case fiber.StatusForbidden:
+		return c.Status(err.Status).SendString(errHTMLForbidden)
 	}
-	return &rm, nil
+	return c.Status(err.Status).SendString(notFoundBodies[err.ResourceType])
 }
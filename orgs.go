@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/volatiletech/null/v8"
+)
+
+// actionMoveOrg moves an organizational unit of the requester's org under another, authorized on the requester's org
+const actionMoveOrg = "iam:MoveOrg"
+
+var (
+	errMissingParent = errors.New("parent_id is required")
+	errMoveOwnOrg    = errors.New("an org can only be moved by the admins of its ancestors")
+)
+
+// visibleOrgs returns the requester's org and its descendants, ordered by ID, and whether the org with each ID is
+// one of them
+func (s *Server) visibleOrgs(c *fiber.Ctx) (models.OrgSlice, map[int]bool, error) {
+	os, err := s.admin.ListOrgs(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, reqID := datastore.NewOrgTree(os), reqOrgID(c)
+	var visible models.OrgSlice
+	ids := map[int]bool{}
+	for _, o := range os {
+		if o.OrgID == reqID || tree.IsAncestor(reqID, o.OrgID) {
+			visible = append(visible, o)
+			ids[o.OrgID] = true
+		}
+	}
+	return visible, ids, nil
+}
+
+// subOrg finds the org with the ID in route param name, which must be the requester's org or one of its descendants
+func (s *Server) subOrg(c *fiber.Ctx, name string) (*models.Org, error) {
+	id, err := paramID(c, name)
+	if err != nil {
+		return nil, err
+	}
+	os, _, err := s.visibleOrgs(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range os {
+		if o.OrgID == id {
+			return o, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+// moveOrgRoute moves one of the requester's org's descendants under the parent_id in the body, which must be the
+// requester's org or another of its descendants
+func (s *Server) moveOrgRoute(c *fiber.Ctx) error {
+	o, err := s.subOrg(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if o.OrgID == reqOrgID(c) {
+		return s.adminError(c, errMoveOwnOrg)
+	}
+	var body struct {
+		ParentID null.Int `json:"parent_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return s.adminError(c, err)
+	}
+	if !body.ParentID.Valid {
+		return s.adminError(c, errMissingParent)
+	}
+	_, visible, err := s.visibleOrgs(c)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if !visible[body.ParentID.Int] {
+		return s.adminError(c, errNotFound)
+	}
+	if err := s.admin.MoveOrg(context.Background(), o.OrgID, body.ParentID); err != nil {
+		return s.adminError(c, err)
+	}
+	o.ParentID = body.ParentID
+	return c.JSON(o)
+}
+
+func (s *Server) listOrgRolesRoute(c *fiber.Ctx) error {
+	o, err := s.subOrg(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	rs, err := s.admin.ListOrgRoles(context.Background(), o.OrgID)
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if rs == nil {
+		rs = models.RoleSlice{}
+	}
+	return c.JSON(rs)
+}
+
+// bindOrgRoleRoute binds one of the requester's org's roles to the org or one of its descendants, applying it to
+// each of their users
+func (s *Server) bindOrgRoleRoute(c *fiber.Ctx) error {
+	o, err := s.subOrg(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	r, err := s.orgRole(c, "roleId")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.BindOrgRole(context.Background(), o.OrgID, r.RoleID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *Server) unbindOrgRoleRoute(c *fiber.Ctx) error {
+	o, err := s.subOrg(c, "id")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	r, err := s.orgRole(c, "roleId")
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if err := s.admin.UnbindOrgRole(context.Background(), o.OrgID, r.RoleID); err != nil {
+		return s.adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
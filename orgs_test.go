@@ -0,0 +1,150 @@
+package main
+
+import (
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/volatiletech/null/v8"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_orgHierarchy(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		body    string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "list org and its organizational units",
+			method:  "GET",
+			route:   "/iam/orgs",
+			expCode: 200,
+			expBody: `[{"org_id":0,"name":"Aperture Science","parent_id":null},` +
+				`{"org_id":10,"name":"Enrichment Center","parent_id":0},` +
+				`{"org_id":11,"name":"Test Chamber 19","parent_id":10},` +
+				`{"org_id":12,"name":"Test Chamber 20","parent_id":0}]`,
+		},
+		{
+			name:    "get organizational unit",
+			method:  "GET",
+			route:   "/iam/orgs/11",
+			expCode: 200,
+			expBody: `{"org_id":11,"name":"Test Chamber 19","parent_id":10}`,
+		},
+		{
+			name:    "get other org",
+			method:  "GET",
+			route:   "/iam/orgs/1",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "move organizational unit between parents",
+			method:  "PUT",
+			route:   "/iam/orgs/11/parent",
+			body:    `{"parent_id": 12}`,
+			expCode: 200,
+			expBody: `{"org_id":11,"name":"Test Chamber 19","parent_id":12}`,
+		},
+		{
+			name:    "move organizational unit under its descendant",
+			method:  "PUT",
+			route:   "/iam/orgs/12/parent",
+			body:    `{"parent_id": 11}`,
+			expCode: 409,
+			expBody: `{"error":"an org can't be moved under itself or one of its descendants"}`,
+		},
+		{
+			name:    "move organizational unit under itself",
+			method:  "PUT",
+			route:   "/iam/orgs/12/parent",
+			body:    `{"parent_id": 12}`,
+			expCode: 409,
+			expBody: `{"error":"an org can't be moved under itself or one of its descendants"}`,
+		},
+		{
+			name:    "move own org",
+			method:  "PUT",
+			route:   "/iam/orgs/0/parent",
+			body:    `{"parent_id": 10}`,
+			expCode: 403,
+			expBody: `{"error":"an org can only be moved by the admins of its ancestors"}`,
+		},
+		{
+			name:    "move organizational unit under other org",
+			method:  "PUT",
+			route:   "/iam/orgs/11/parent",
+			body:    `{"parent_id": 1}`,
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "move organizational unit without parent",
+			method:  "PUT",
+			route:   "/iam/orgs/11/parent",
+			body:    `{}`,
+			expCode: 400,
+			expBody: `{"error":"parent_id is required"}`,
+		},
+		{
+			name:    "bind role to organizational unit",
+			method:  "PUT",
+			route:   "/iam/orgs/12/roles/1",
+			expCode: 204,
+		},
+		{
+			name:    "bind role of other org to organizational unit",
+			method:  "PUT",
+			route:   "/iam/orgs/12/roles/2",
+			expCode: 404,
+			expBody: `{"error":"not found"}`,
+		},
+		{
+			name:    "list roles of organizational unit",
+			method:  "GET",
+			route:   "/iam/orgs/12/roles",
+			expCode: 200,
+			expBody: `[{"role_id":1,"name":"viewZonesRole","org_id":0}]`,
+		},
+		{
+			name:    "unbind role from organizational unit",
+			method:  "DELETE",
+			route:   "/iam/orgs/12/roles/1",
+			expCode: 204,
+		},
+		{
+			name:    "list roles of organizational unit after unbinding",
+			method:  "GET",
+			route:   "/iam/orgs/12/roles",
+			expCode: 200,
+			expBody: `[]`,
+		},
+	}
+
+	admin := newMemAdmin()
+	admin.orgs[10] = &models.Org{OrgID: 10, Name: "Enrichment Center", ParentID: null.IntFrom(0)}
+	admin.orgs[11] = &models.Org{OrgID: 11, Name: "Test Chamber 19", ParentID: null.IntFrom(10)}
+	admin.orgs[12] = &models.Org{OrgID: 12, Name: "Test Chamber 20", ParentID: null.IntFrom(0)}
+	app := NewServer(newTestAuthorizer(t), &mockDatastore{}, admin, newNopLog(), defaultConfig()).setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", "ada")
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, string(body))
+		})
+	}
+}
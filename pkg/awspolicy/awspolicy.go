@@ -0,0 +1,279 @@
+// Package awspolicy converts between AWS IAM style JSON policy documents and IAM model policies.
+//
+// Resources are ARNs of the form arn:oso:iam::<org ID>:<resource ID>, which map to the NRN
+// oso:<org ID>:<resource ID>.  Actions and NotActions are used as they are.  The only supported condition is StringLike on the
+// oso:Name key with a single value of the form *<suffix>, which maps to a matchSuffix condition.
+package awspolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Version is the only supported policy language version
+const Version = "2012-10-17"
+
+const (
+	arnPartition = "oso"
+	arnService   = "iam"
+	// nameKey is the condition key of the handle of a resource
+	nameKey = "oso:Name"
+)
+
+var (
+	errNoStatements = errors.New("policy document has no statements")
+	errBadARN       = errors.New("resource must be an ARN of the form arn:oso:iam::<org ID>:<type>/<name>")
+)
+
+// Document is an AWS IAM style policy document
+type Document struct {
+	Version   string     `json:"Version"`
+	ID        string     `json:"Id,omitempty"`
+	Statement Statements `json:"Statement"`
+}
+
+// Statement is a single statement of a policy document.  NotResource, Principal and NotPrincipal are only decoded so
+// they can be rejected.
+type Statement struct {
+	Sid          string                       `json:"Sid,omitempty"`
+	Effect       string                       `json:"Effect"`
+	Action       Values                       `json:"Action,omitempty"`
+	NotAction    Values                       `json:"NotAction,omitempty"`
+	Resource     Values                       `json:"Resource,omitempty"`
+	NotResource  Values                       `json:"NotResource,omitempty"`
+	Principal    json.RawMessage              `json:"Principal,omitempty"`
+	NotPrincipal json.RawMessage              `json:"NotPrincipal,omitempty"`
+	Condition    map[string]map[string]Values `json:"Condition,omitempty"`
+}
+
+// Statements is the statements of a policy document, which may be a single statement or a list of them
+type Statements []Statement
+
+func (s *Statements) UnmarshalJSON(b []byte) error {
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '{' {
+		var st Statement
+		if err := strictUnmarshal(b, &st); err != nil {
+			return err
+		}
+		*s = Statements{st}
+		return nil
+	}
+	var sts []Statement
+	if err := strictUnmarshal(b, &sts); err != nil {
+		return err
+	}
+	*s = sts
+	return nil
+}
+
+// Values is a single string or a list of them
+type Values []string
+
+func (v *Values) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = Values{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return errors.New("expected a string or a list of strings")
+	}
+	*v = ss
+	return nil
+}
+
+// Parse decodes the policy document in r
+func Parse(r io.Reader) (*Document, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var d Document
+	if err := strictUnmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	if d.Version != Version {
+		return nil, fmt.Errorf("unsupported policy version %q, only %q is supported", d.Version, Version)
+	}
+	if len(d.Statement) == 0 {
+		return nil, errNoStatements
+	}
+	return &d, nil
+}
+
+func strictUnmarshal(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Policies converts the statements of d into policies, one for each resource of each statement.  Policies are named
+// after their statement's Sid, or name and the statement's position if it has none, and numbered if the statement
+// has more than one resource.
+func (d *Document) Policies(name string) ([]policyfile.Policy, error) {
+	var ps []policyfile.Policy
+	for i, st := range d.Statement {
+		stName := st.Sid
+		if stName == "" {
+			stName = name
+			if len(d.Statement) > 1 {
+				stName = fmt.Sprintf("%s-%d", name, i+1)
+			}
+		}
+		if stName == "" {
+			return nil, fmt.Errorf("statement %d: a name is required for statements without a Sid", i+1)
+		}
+		sps, err := st.policies(stName)
+		if err != nil {
+			return nil, fmt.Errorf("statement %q: %w", stName, err)
+		}
+		ps = append(ps, sps...)
+	}
+	return ps, nil
+}
+
+func (st Statement) policies(name string) ([]policyfile.Policy, error) {
+	switch {
+	case len(st.NotResource) > 0:
+		return nil, errors.New("NotResource is not supported")
+	case len(st.Principal) > 0 || len(st.NotPrincipal) > 0:
+		return nil, errors.New("Principal is not supported, policies are attached to roles")
+	case len(st.Action) > 0 && len(st.NotAction) > 0:
+		return nil, errors.New("only one of Action and NotAction can be given")
+	case len(st.Action) == 0 && len(st.NotAction) == 0:
+		return nil, errors.New("missing Action")
+	case len(st.Resource) == 0:
+		return nil, errors.New("missing Resource")
+	}
+	effect := strings.ToLower(st.Effect)
+	if effect != "allow" && effect != "deny" {
+		return nil, fmt.Errorf("Effect must be Allow or Deny, not %q", st.Effect)
+	}
+	conds, err := conditions(st.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := make([]policyfile.Policy, len(st.Resource))
+	for i, arn := range st.Resource {
+		nrn, err := NRN(arn)
+		if err != nil {
+			return nil, fmt.Errorf("resource %q: %w", arn, err)
+		}
+		ps[i] = policyfile.Policy{
+			Name: name, Effect: effect, Actions: st.Action, NotActions: st.NotAction, Resource: nrn, Conditions: conds,
+		}
+		if len(st.Resource) > 1 {
+			ps[i].Name = fmt.Sprintf("%s-%d", name, i+1)
+		}
+	}
+	return ps, nil
+}
+
+// conditions converts a statement's condition block into conditions
+func conditions(block map[string]map[string]Values) ([]policyfile.Condition, error) {
+	var conds []policyfile.Condition
+	for _, op := range sortedKeys(block) {
+		if op != "StringLike" {
+			return nil, fmt.Errorf("condition operator %s is not supported, only StringLike is", op)
+		}
+		for _, key := range sortedKeys(block[op]) {
+			if key != nameKey {
+				return nil, fmt.Errorf("condition key %s is not supported, only %s is", key, nameKey)
+			}
+			vals := block[op][key]
+			if len(vals) != 1 {
+				return nil, fmt.Errorf("condition %s on %s must have exactly one value", op, key)
+			}
+			// a bare * has an empty suffix, which would make a condition that matches every name
+			suffix := strings.TrimPrefix(vals[0], "*")
+			if suffix == vals[0] || suffix == "" || strings.ContainsAny(suffix, "*?") {
+				return nil, fmt.Errorf("condition value %q is not supported, only suffix patterns such as *.com are", vals[0])
+			}
+			conds = append(conds, policyfile.Condition{Type: "matchSuffix", Value: suffix})
+		}
+	}
+	return conds, nil
+}
+
+// FromPolicies converts policies into a document with a statement for each, identified by the policy's name
+func FromPolicies(ps ...policyfile.Policy) (*Document, error) {
+	d := &Document{Version: Version, Statement: Statements{}}
+	for _, p := range ps {
+		arn, err := ARN(p.Resource)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		effect, ok := map[string]string{"allow": "Allow", "deny": "Deny"}[p.Effect]
+		if !ok {
+			return nil, fmt.Errorf("policy %q: unknown effect %q", p.Name, p.Effect)
+		}
+		// statements have either actions or not actions, and can't exclude resources from the resource they're on
+		if len(p.Actions) > 0 && len(p.NotActions) > 0 {
+			return nil, fmt.Errorf("policy %q: actions and not actions can't both be exported", p.Name)
+		}
+		if len(p.NotResources) > 0 {
+			return nil, fmt.Errorf("policy %q: not resources can't be exported", p.Name)
+		}
+		st := Statement{
+			Sid:       p.Name,
+			Effect:    effect,
+			Action:    p.Actions,
+			NotAction: p.NotActions,
+			Resource:  Values{arn},
+		}
+		for _, c := range p.Conditions {
+			if c.Type != "matchSuffix" {
+				return nil, fmt.Errorf("policy %q: condition type %s can't be exported", p.Name, c.Type)
+			}
+			if st.Condition == nil {
+				st.Condition = map[string]map[string]Values{"StringLike": {}}
+			}
+			if _, ok := st.Condition["StringLike"][nameKey]; ok {
+				return nil, fmt.Errorf("policy %q: only one matchSuffix condition can be exported", p.Name)
+			}
+			st.Condition["StringLike"][nameKey] = Values{"*" + c.Value}
+		}
+		d.Statement = append(d.Statement, st)
+	}
+	return d, nil
+}
+
+// NRN returns the NRN of the resource identified by arn
+func NRN(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] != arnPartition || parts[2] != arnService || parts[3] != "" {
+		return "", errBadARN
+	}
+	nrn := fmt.Sprintf("oso:%s:%s", parts[4], parts[5])
+	if _, err := roles.PolicyResourceName(nrn).GetType(); err != nil {
+		return "", errBadARN
+	}
+	return nrn, nil
+}
+
+// ARN returns the ARN of the resource identified by nrn
+func ARN(nrn string) (string, error) {
+	orgID, rID, err := roles.SplitResourceName(nrn)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("arn:%s:%s::%s:%s", arnPartition, arnService, orgID, rID), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
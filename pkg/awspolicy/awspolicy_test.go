@@ -0,0 +1,222 @@
+package awspolicy
+
+import (
+	"encoding/json"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip_document(t *testing.T) {
+	t.Parallel()
+	doc := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "viewComZones",
+      "Effect": "Allow",
+      "Action": ["view"],
+      "Resource": ["arn:oso:iam::0:zone/*"],
+      "Condition": {"StringLike": {"oso:Name": ["*com"]}}
+    },
+    {
+      "Sid": "denyDeleteReact",
+      "Effect": "Deny",
+      "Action": ["delete", "update"],
+      "Resource": ["arn:oso:iam::0:zone/react.net"]
+    }
+  ]
+}`
+	d, err := Parse(strings.NewReader(doc))
+	assert.NoError(t, err)
+	ps, err := d.Policies("")
+	assert.NoError(t, err)
+	assert.Equal(t, []policyfile.Policy{
+		{
+			Name: "viewComZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*",
+			Conditions: []policyfile.Condition{{Type: "matchSuffix", Value: "com"}},
+		},
+		{Name: "denyDeleteReact", Effect: "deny", Actions: []string{"delete", "update"}, Resource: "oso:0:zone/react.net"},
+	}, ps)
+
+	exported, err := FromPolicies(ps...)
+	assert.NoError(t, err)
+	b, err := json.MarshalIndent(exported, "", "  ")
+	assert.NoError(t, err)
+	assert.JSONEq(t, doc, string(b))
+}
+
+func TestRoundTrip_policies(t *testing.T) {
+	t.Parallel()
+	ps := []policyfile.Policy{
+		{Name: "viewZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*"},
+		{Name: "manageOrg", Effect: "allow", Actions: []string{"*"}, Resource: "oso:1:org/1"},
+		{Name: "denyAllButView", Effect: "deny", NotActions: []string{"view"}, Resource: "oso:0:zone/*"},
+		{
+			Name: "denyNetDeletes", Effect: "deny", Actions: []string{"delete"}, Resource: "oso:0:zone/*",
+			Conditions: []policyfile.Condition{{Type: "matchSuffix", Value: ".net"}},
+		},
+	}
+	d, err := FromPolicies(ps...)
+	assert.NoError(t, err)
+	b, err := json.Marshal(d)
+	assert.NoError(t, err)
+
+	parsed, err := Parse(strings.NewReader(string(b)))
+	assert.NoError(t, err)
+	got, err := parsed.Policies("")
+	assert.NoError(t, err)
+	assert.Equal(t, ps, got)
+}
+
+func TestDocument_Policies(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		doc    string
+		exp    []policyfile.Policy
+		expErr string
+	}{
+		{
+			name: "single statement and values",
+			doc:  `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Action": "view", "Resource": "arn:oso:iam::0:zone/gmail.com"}}`,
+			exp: []policyfile.Policy{
+				{Name: "imported", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/gmail.com"},
+			},
+		},
+		{
+			name: "statements without sid are numbered",
+			doc: `{"Version": "2012-10-17", "Statement": [
+				{"Effect": "Allow", "Action": "view", "Resource": "arn:oso:iam::0:zone/*"},
+				{"Effect": "Allow", "Action": "delete", "Resource": ["arn:oso:iam::0:zone/a.com", "arn:oso:iam::0:zone/b.com"]}
+			]}`,
+			exp: []policyfile.Policy{
+				{Name: "imported-1", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*"},
+				{Name: "imported-2-1", Effect: "allow", Actions: []string{"delete"}, Resource: "oso:0:zone/a.com"},
+				{Name: "imported-2-2", Effect: "allow", Actions: []string{"delete"}, Resource: "oso:0:zone/b.com"},
+			},
+		},
+		{
+			name:   "unsupported version",
+			doc:    `{"Version": "2008-10-17", "Statement": []}`,
+			expErr: `unsupported policy version "2008-10-17"`,
+		},
+		{
+			name:   "no statements",
+			doc:    `{"Version": "2012-10-17", "Statement": []}`,
+			expErr: errNoStatements.Error(),
+		},
+		{
+			name:   "unknown field",
+			doc:    `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Actions": "view"}]}`,
+			expErr: `unknown field "Actions"`,
+		},
+		{
+			name: "NotAction",
+			doc:  `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "NotAction": "delete", "Resource": "arn:oso:iam::0:zone/*"}}`,
+			exp: []policyfile.Policy{
+				{Name: "s", Effect: "allow", NotActions: []string{"delete"}, Resource: "oso:0:zone/*"},
+			},
+		},
+		{
+			name:   "Action and NotAction",
+			doc:    `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "*", "NotAction": "delete", "Resource": "arn:oso:iam::0:zone/*"}}`,
+			expErr: `statement "s": only one of Action and NotAction can be given`,
+		},
+		{
+			name:   "NotResource",
+			doc:    `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "NotResource": "arn:oso:iam::0:zone/*"}}`,
+			expErr: `statement "s": NotResource is not supported`,
+		},
+		{
+			name:   "Principal",
+			doc:    `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Principal": "*", "Action": "view", "Resource": "arn:oso:iam::0:zone/*"}}`,
+			expErr: `statement "s": Principal is not supported`,
+		},
+		{
+			name:   "bad effect",
+			doc:    `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Maybe", "Action": "view", "Resource": "arn:oso:iam::0:zone/*"}}`,
+			expErr: `statement "s": Effect must be Allow or Deny, not "Maybe"`,
+		},
+		{
+			name:   "aws arn",
+			doc:    `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "Resource": "arn:aws:s3:::bucket"}}`,
+			expErr: `statement "s": resource "arn:aws:s3:::bucket": ` + errBadARN.Error(),
+		},
+		{
+			name:   "wildcard resource",
+			doc:    `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "Resource": "*"}}`,
+			expErr: errBadARN.Error(),
+		},
+		{
+			name: "unsupported condition operator",
+			doc: `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "Resource": "arn:oso:iam::0:zone/*",
+				"Condition": {"StringEquals": {"oso:Name": "gmail.com"}}}}`,
+			expErr: "condition operator StringEquals is not supported",
+		},
+		{
+			name: "unsupported condition key",
+			doc: `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "Resource": "arn:oso:iam::0:zone/*",
+				"Condition": {"StringLike": {"aws:SourceIp": "*"}}}}`,
+			expErr: "condition key aws:SourceIp is not supported",
+		},
+		{
+			name: "unsupported condition pattern",
+			doc: `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "Resource": "arn:oso:iam::0:zone/*",
+				"Condition": {"StringLike": {"oso:Name": "gmail*"}}}}`,
+			expErr: `condition value "gmail*" is not supported`,
+		},
+		{
+			name: "condition pattern without suffix",
+			doc: `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "Resource": "arn:oso:iam::0:zone/*",
+				"Condition": {"StringLike": {"oso:Name": "*"}}}}`,
+			expErr: `condition value "*" is not supported`,
+		},
+		{
+			name: "several condition values",
+			doc: `{"Version": "2012-10-17", "Statement": {"Sid": "s", "Effect": "Allow", "Action": "view", "Resource": "arn:oso:iam::0:zone/*",
+				"Condition": {"StringLike": {"oso:Name": ["*com", "*net"]}}}}`,
+			expErr: "must have exactly one value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Parse(strings.NewReader(tt.doc))
+			var ps []policyfile.Policy
+			if err == nil {
+				ps, err = d.Policies("imported")
+			}
+			if tt.expErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, ps)
+		})
+	}
+}
+
+func TestFromPolicies_errors(t *testing.T) {
+	t.Parallel()
+	_, err := FromPolicies(policyfile.Policy{
+		Name: "p", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*",
+		Conditions: []policyfile.Condition{{Type: "matchPrefix", Value: "g"}},
+	})
+	assert.EqualError(t, err, `policy "p": condition type matchPrefix can't be exported`)
+
+	_, err = FromPolicies(policyfile.Policy{Name: "p", Effect: "allow", Actions: []string{"view"}, Resource: "zone/*"})
+	assert.Error(t, err)
+
+	_, err = FromPolicies(policyfile.Policy{
+		Name: "p", Effect: "allow", Actions: []string{"*"}, NotActions: []string{"delete"}, Resource: "oso:0:zone/*",
+	})
+	assert.EqualError(t, err, `policy "p": actions and not actions can't both be exported`)
+
+	_, err = FromPolicies(policyfile.Policy{
+		Name: "p", Effect: "deny", Actions: []string{"*"}, Resource: "oso:0:zone/*", NotResources: []string{"oso:0:zone/gmail.com"},
+	})
+	assert.EqualError(t, err, `policy "p": not resources can't be exported`)
+}
@@ -0,0 +1,163 @@
+// Package catalog defines the actions that can be performed on each type of resource, so policies can be validated
+// against them and actions can imply others.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"sort"
+)
+
+// ErrUnknownAction is returned when an action, or action pattern, matches no action of a resource type
+var ErrUnknownAction = errors.New("unknown action")
+
+// AccessLevel classifies what an action does, like the access levels of AWS IAM
+type AccessLevel string
+
+const (
+	AccessList                  AccessLevel = "list"
+	AccessRead                  AccessLevel = "read"
+	AccessWrite                 AccessLevel = "write"
+	AccessPermissionsManagement AccessLevel = "permissions-management"
+)
+
+// Action is an action that can be performed on a type of resource
+type Action struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	AccessLevel AccessLevel `json:"access_level"`
+	// Implies are the actions on the same resource that an allow policy permitting the action permits too
+	Implies []string `json:"implies,omitempty"`
+	// Aliases are earlier names of the action.  Policies with an alias permit, deny or exclude the action like they do
+	// with its name, and requiring an alias requires the action.
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// Catalog is the actions of each resource type.  Resource types not in a catalog are defined by the apps authorizing
+// them, and actions on them aren't validated.
+type Catalog struct {
+	types map[string][]Action
+	// children is the child resource types of each resource type
+	children map[string][]string
+}
+
+// New returns a Catalog of the actions of each resource type
+func New(types map[string][]Action) *Catalog {
+	return &Catalog{types: types, children: map[string][]string{}}
+}
+
+// Nest makes child a child resource type of parent, whose resources are named under the parent's like records under
+// zones, and returns c.  As policies on a resource cover its children, they may have the actions of child types.
+func (c *Catalog) Nest(parent, child string) *Catalog {
+	c.children[parent] = append(c.children[parent], child)
+	return c
+}
+
+// Types returns the resource types in c in order
+func (c *Catalog) Types() []string {
+	ts := make([]string, 0, len(c.types))
+	for t := range c.types {
+		ts = append(ts, t)
+	}
+	sort.Strings(ts)
+	return ts
+}
+
+// Actions returns the actions of resourceType, or nil if it isn't in c
+func (c *Catalog) Actions(resourceType string) []Action {
+	return c.types[resourceType]
+}
+
+// Match returns the actions of resourceType matched by pattern, by name or alias
+func (c *Catalog) Match(resourceType, pattern string) []Action {
+	var as []Action
+	for _, a := range c.types[resourceType] {
+		for _, name := range a.names() {
+			if roles.MatchAction(pattern, name) {
+				as = append(as, a)
+				break
+			}
+		}
+	}
+	return as
+}
+
+// Names returns the names of action on the resource identified by resourceName: the name of the action named or
+// aliased by action, followed by its aliases.  An action that isn't in c only has the name action.
+func (c *Catalog) Names(resourceName, action string) []string {
+	t, err := roles.PolicyResourceName(resourceName).GetType()
+	if err != nil {
+		return []string{action}
+	}
+	a, ok := c.lookup(t, action)
+	if !ok {
+		return []string{action}
+	}
+	return a.names()
+}
+
+// lookup returns the action of resourceType named or aliased by action
+func (c *Catalog) lookup(resourceType, action string) (Action, bool) {
+	for _, a := range c.types[resourceType] {
+		if contains(a.names(), action) {
+			return a, true
+		}
+	}
+	return Action{}, false
+}
+
+// names returns the name of a followed by its aliases
+func (a Action) names() []string {
+	return append([]string{a.Name}, a.Aliases...)
+}
+
+// Validate returns an error if pattern matches no action of resourceType or its child types.  Actions on resource
+// types that aren't in c, including patterns like *, aren't validated.
+func (c *Catalog) Validate(resourceType, pattern string) error {
+	if _, ok := c.types[resourceType]; !ok {
+		return nil
+	}
+	for queue := []string{resourceType}; len(queue) > 0; queue = queue[1:] {
+		if len(c.Match(queue[0], pattern)) > 0 {
+			return nil
+		}
+		queue = append(queue, c.children[queue[0]]...)
+	}
+	return fmt.Errorf("%w: %q matches no %s action", ErrUnknownAction, pattern, resourceType)
+}
+
+// ImpliedBy returns the names of the actions that imply action, which may be an alias, directly or through other
+// actions, on the resource identified by resourceName
+func (c *Catalog) ImpliedBy(resourceName, action string) []string {
+	t, err := roles.PolicyResourceName(resourceName).GetType()
+	if err != nil {
+		return nil
+	}
+	if a, ok := c.lookup(t, action); ok {
+		action = a.Name
+	}
+	var impliers []string
+	seen := map[string]bool{action: true}
+	for queue := []string{action}; len(queue) > 0; queue = queue[1:] {
+		for _, a := range c.types[t] {
+			if seen[a.Name] || !contains(a.Implies, queue[0]) {
+				continue
+			}
+			seen[a.Name] = true
+			impliers = append(impliers, a.Name)
+			queue = append(queue, a.Name)
+		}
+	}
+	return impliers
+}
+
+// contains returns true if ss contains s
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
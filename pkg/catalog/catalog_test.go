@@ -0,0 +1,99 @@
+package catalog
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCatalog_Validate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		resourceType string
+		pattern      string
+		expErr       bool
+	}{
+		{name: "action", resourceType: "zone", pattern: "zone:GetZone"},
+		{name: "alias", resourceType: "zone", pattern: "view"},
+		{name: "service pattern", resourceType: "zone", pattern: "zone:*"},
+		{name: "pattern", resourceType: "org", pattern: "iam:Get*"},
+		{name: "wildcard", resourceType: "zone", pattern: "*"},
+		{name: "typo", resourceType: "zone", pattern: "veiw", expErr: true},
+		{name: "action of child type", resourceType: "zone", pattern: "zone:UpdateRecord"},
+		{name: "alias of action of child type", resourceType: "zone", pattern: "update"},
+		{name: "action of another type", resourceType: "zone", pattern: "iam:CreateRole", expErr: true},
+		{name: "pattern matching nothing", resourceType: "org", pattern: "iam:Update*", expErr: true},
+		{name: "type not in catalog", resourceType: "incident", pattern: "resolve"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := Default.Validate(tt.resourceType, tt.pattern)
+			if tt.expErr {
+				assert.True(t, errors.Is(err, ErrUnknownAction))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCatalog_ImpliedBy(t *testing.T) {
+	t.Parallel()
+	c := New(map[string][]Action{
+		"zone": {
+			{Name: "view"},
+			{Name: "update", Implies: []string{"view"}},
+			{Name: "delete", Implies: []string{"update"}, Aliases: []string{"remove"}},
+			{Name: "transfer", Implies: []string{"delete", "view"}},
+		},
+	})
+	tests := []struct {
+		name         string
+		resourceName string
+		action       string
+		exp          []string
+	}{
+		{name: "transitively", resourceName: "oso:0:zone/foo.com", action: "view", exp: []string{"update", "transfer", "delete"}},
+		{name: "directly", resourceName: "oso:0:zone/foo.com", action: "delete", exp: []string{"transfer"}},
+		{name: "implied by nothing", resourceName: "oso:0:zone/foo.com", action: "transfer"},
+		{name: "alias", resourceName: "oso:0:zone/foo.com", action: "remove", exp: []string{"transfer"}},
+		{name: "type not in catalog", resourceName: "oso:0:incident/42", action: "view"},
+		{name: "bad resource name", resourceName: "zone/foo.com", action: "view"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.exp, c.ImpliedBy(tt.resourceName, tt.action))
+		})
+	}
+}
+
+func TestCatalog_Names(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		resourceName string
+		action       string
+		exp          []string
+	}{
+		{name: "action", resourceName: "oso:0:zone/foo.com", action: "zone:GetZone", exp: []string{"zone:GetZone", "view"}},
+		{name: "alias", resourceName: "oso:0:zone/foo.com", action: "view", exp: []string{"zone:GetZone", "view"}},
+		{name: "alias of child type", resourceName: "oso:0:zone/foo.com/record/www.foo.com", action: "view",
+			exp: []string{"zone:GetRecord", "view"}},
+		{name: "action without aliases", resourceName: "oso:0:org/0", action: "iam:GetOrg", exp: []string{"iam:GetOrg"}},
+		{name: "unknown action", resourceName: "oso:0:zone/foo.com", action: "transfer", exp: []string{"transfer"}},
+		{name: "type not in catalog", resourceName: "oso:0:incident/42", action: "view", exp: []string{"view"}},
+		{name: "bad resource name", resourceName: "zone/foo.com", action: "view", exp: []string{"view"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.exp, Default.Names(tt.resourceName, tt.action))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package catalog
+
+// accessActions are the actions of just-in-time access, authorized on the role or resource requested
+var accessActions = []Action{
+	{Name: "iam:RequestAccess", Description: "Request temporary access to the role or resource", AccessLevel: AccessWrite},
+	{Name: "iam:ApproveAccess", Description: "Approve or deny requests for access to the role or resource", AccessLevel: AccessPermissionsManagement},
+}
+
+// Default is the catalog of the app's resource types.  Records are nested under their zones.
+var Default = New(map[string][]Action{
+	// IAM actions are authorized on the requester's org
+	"org": {
+		{Name: "iam:GetOrg", Description: "View the org and its organizational units", AccessLevel: AccessRead},
+		{Name: "iam:MoveOrg", Description: "Move an organizational unit of the org under another", AccessLevel: AccessPermissionsManagement, Implies: []string{"iam:GetOrg"}},
+		{Name: "iam:ListUsers", Description: "List the org's users", AccessLevel: AccessList},
+		{Name: "iam:GetUser", Description: "View a user", AccessLevel: AccessRead},
+		{Name: "iam:CreateUser", Description: "Create a user", AccessLevel: AccessWrite},
+		{Name: "iam:DeleteUser", Description: "Delete a user", AccessLevel: AccessWrite, Implies: []string{"iam:GetUser"}},
+		{Name: "iam:ListRoles", Description: "List the org's roles, or the roles bound to a user or org", AccessLevel: AccessList},
+		{Name: "iam:GetRole", Description: "View a role", AccessLevel: AccessRead},
+		{Name: "iam:CreateRole", Description: "Create a role", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:DeleteRole", Description: "Delete a role", AccessLevel: AccessPermissionsManagement, Implies: []string{"iam:GetRole"}},
+		{Name: "iam:ListPolicies", Description: "List policies, and lint them or recommend policies for roles", AccessLevel: AccessList},
+		{Name: "iam:GetPolicy", Description: "View a policy and its versions", AccessLevel: AccessRead},
+		{Name: "iam:CreatePolicy", Description: "Create a policy", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:DeletePolicy", Description: "Delete a policy", AccessLevel: AccessPermissionsManagement, Implies: []string{"iam:GetPolicy"}},
+		{Name: "iam:CreatePolicyVersion", Description: "Create a version of a policy", AccessLevel: AccessPermissionsManagement, Implies: []string{"iam:GetPolicy"}},
+		{Name: "iam:SetDefaultPolicyVersion", Description: "Set or roll back the default version of a policy", AccessLevel: AccessPermissionsManagement, Implies: []string{"iam:GetPolicy"}},
+		{Name: "iam:ListConditions", Description: "List conditions", AccessLevel: AccessList},
+		{Name: "iam:GetCondition", Description: "View a condition", AccessLevel: AccessRead},
+		{Name: "iam:CreateCondition", Description: "Create a condition", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:DeleteCondition", Description: "Delete a condition", AccessLevel: AccessPermissionsManagement, Implies: []string{"iam:GetCondition"}},
+		{Name: "iam:BindRole", Description: "Bind a role to a user, or to an org and its organizational units", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:UnbindRole", Description: "Unbind a role from a user or org", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:AttachPolicy", Description: "Attach a policy to a role", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:DetachPolicy", Description: "Detach a policy from a role", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:AttachCondition", Description: "Attach a condition to a policy", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:DetachCondition", Description: "Detach a condition from a policy", AccessLevel: AccessPermissionsManagement},
+		{Name: "iam:GetPermissions", Description: "View, explain, check and lint a user's permissions, and find who can perform an action", AccessLevel: AccessRead},
+		{Name: "iam:ListAuditEvents", Description: "List audit events, decisions and unused permissions", AccessLevel: AccessList},
+	},
+	"role": accessActions,
+	// zone and record actions were named view, create, update and delete before they were qualified by the zone
+	// service, which policies may still use
+	"zone": append([]Action{
+		{Name: "zone:GetZone", Description: "View a zone", AccessLevel: AccessRead, Aliases: []string{"view"}},
+		{Name: "zone:DeleteZone", Description: "Delete a zone", AccessLevel: AccessWrite, Implies: []string{"zone:GetZone"}, Aliases: []string{"delete"}},
+	}, accessActions...),
+	"record": append([]Action{
+		{Name: "zone:GetRecord", Description: "View a DNS record", AccessLevel: AccessRead, Aliases: []string{"view"}},
+		{Name: "zone:CreateRecord", Description: "Create a DNS record", AccessLevel: AccessWrite, Aliases: []string{"create"}},
+		{Name: "zone:UpdateRecord", Description: "Update a DNS record", AccessLevel: AccessWrite, Implies: []string{"zone:GetRecord"}, Aliases: []string{"update"}},
+		{Name: "zone:DeleteRecord", Description: "Delete a DNS record", AccessLevel: AccessWrite, Implies: []string{"zone:GetRecord"}, Aliases: []string{"delete"}},
+	}, accessActions...),
+}).Nest("zone", "record")
@@ -0,0 +1,143 @@
+package iam
+
+import (
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/matchers"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/osohq/go-oso"
+	"github.com/osohq/go-oso/types"
+	"reflect"
+	"sort"
+)
+
+// Policy effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Authorizer decides whether derived users may perform actions on resources with the IAM model.  A user is allowed
+// when at least one of their allow policies applies and none of their deny policies apply.  A policy applies when its
+// namespace covers the resource, it permits the action and all of its conditions hold.
+type Authorizer interface {
+	// IsAllowed returns true if u may perform action on resource
+	IsAllowed(u *DerivedUser, action string, resource interface{}) (bool, error)
+	// ApplicablePolicies returns u's policies of the given effect that apply to action on resource, ordered by ID
+	ApplicablePolicies(u *DerivedUser, action string, resource interface{}, effect string) ([]*roles.RolePolicy, error)
+	// EvaluatePolicy evaluates p, cached under namespace, against action on resource
+	EvaluatePolicy(namespace string, p *roles.RolePolicy, action string, resource interface{}) (PolicyEvaluation, error)
+}
+
+// PolicyEvaluation is the evaluation of a single policy against an action on a resource
+type PolicyEvaluation struct {
+	Policy         *roles.RolePolicy `json:"policy"`
+	CoversResource bool              `json:"covers_resource"`
+	PermitsAction  bool              `json:"permits_action"`
+	ConditionsHold bool              `json:"conditions_hold"`
+}
+
+// Applies returns true if the policy contributes its effect to the decision
+func (pe PolicyEvaluation) Applies() bool {
+	return pe.CoversResource && pe.PermitsAction && pe.ConditionsHold
+}
+
+// NewOso returns an Oso instance with the IAM model's types registered and the polar policy in policyFiles loaded
+func NewOso(policyFiles ...string) (oso.Oso, error) {
+	o, err := oso.NewOso()
+	if err != nil {
+		return o, err
+	}
+	// distinguish forbidden from not found on whether the requester can view the resource
+	o.SetReadAction(ReadAction)
+
+	// Register custom types with Oso core
+	if err := o.RegisterClass(reflect.TypeOf(roles.PolicyResourceName("foo")), nil); err != nil {
+		return o, err
+	}
+	o.RegisterClass(reflect.TypeOf(models.Zone{}), nil)
+	o.RegisterClass(reflect.TypeOf(models.User{}), nil)
+	o.RegisterClass(reflect.TypeOf(models.Role{}), nil)
+	o.RegisterClass(reflect.TypeOf(models.Policy{}), nil)
+	o.RegisterClass(reflect.TypeOf(roles.RolePolicy{}), nil)
+	o.RegisterClass(reflect.TypeOf(roles.ExternalResource{}), nil)
+	o.RegisterClass(reflect.TypeOf(datastore.EffectivePerms{}), nil)
+	o.RegisterClass(reflect.TypeOf(DerivedUser{}), nil)
+	o.RegisterClass(reflect.TypeOf(matchers.HasSuffix{}), nil)
+	o.RegisterClass(reflect.TypeOf(roles.TypeWildcard{}), nil)
+	o.RegisterClass(reflect.TypeOf(roles.ResourceHierarchy{}), nil)
+	if err := o.RegisterConstant(catalog.Default, "Catalog"); err != nil {
+		return o, err
+	}
+
+	// Load Oso policy
+	if err := o.LoadFiles(policyFiles); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+type osoAuthorizer struct {
+	oso oso.Oso
+}
+
+// NewOsoAuthorizer returns an Authorizer that evaluates the IAM policy loaded in o, such as by NewOso
+func NewOsoAuthorizer(o oso.Oso) Authorizer {
+	return &osoAuthorizer{oso: o}
+}
+
+func (a *osoAuthorizer) IsAllowed(u *DerivedUser, action string, resource interface{}) (bool, error) {
+	return a.oso.IsAllowed(u, action, resource)
+}
+
+func (a *osoAuthorizer) ApplicablePolicies(u *DerivedUser, action string, resource interface{}, effect string) ([]*roles.RolePolicy, error) {
+	q, err := a.oso.NewQueryFromRule("applicable_policy", u, action, resource, types.Variable("policy"), effect)
+	if err != nil {
+		return nil, err
+	}
+	results, err := q.GetAllResults()
+	if err != nil {
+		return nil, err
+	}
+	// a policy is a result once for each way it permits action, e.g. for each action implying it
+	var policies []*roles.RolePolicy
+	seen := map[int]bool{}
+	for _, result := range results {
+		p, ok := result["policy"].(roles.RolePolicy)
+		if !ok || seen[p.ID] {
+			continue
+		}
+		seen[p.ID] = true
+		policies = append(policies, &p)
+	}
+	sortPolicies(policies)
+	return policies, nil
+}
+
+func (a *osoAuthorizer) EvaluatePolicy(namespace string, p *roles.RolePolicy, action string, resource interface{}) (PolicyEvaluation, error) {
+	var err error
+	pe := PolicyEvaluation{Policy: p}
+	if pe.CoversResource, err = a.oso.QueryRuleOnce("namespace_covers_resource", namespace, resource); err != nil {
+		return pe, err
+	}
+	if pe.CoversResource {
+		if pe.CoversResource, err = a.oso.QueryRuleOnce("policy_covers_resource", p, resource); err != nil {
+			return pe, err
+		}
+	}
+	if pe.PermitsAction, err = a.oso.QueryRuleOnce("policy_permits_action", p, action, resource); err != nil {
+		return pe, err
+	}
+	if pe.ConditionsHold, err = a.oso.QueryRuleOnce("conditions_hold", p, resource); err != nil {
+		return pe, err
+	}
+	return pe, nil
+}
+
+// sortPolicies orders policies by ID for stable output
+func sortPolicies(policies []*roles.RolePolicy) {
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+}
@@ -0,0 +1,448 @@
+package iam
+
+import (
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// newTestUser returns a derived user with the given allow and deny policies, cached under their resource names
+func newTestUser(allows, denies []*roles.RolePolicy) *DerivedUser {
+	perms := datastore.NewEffectivePerms()
+	for _, ps := range []struct {
+		cache    datastore.PoliciesByNamespace
+		policies []*roles.RolePolicy
+	}{{perms.AllowPolicies, allows}, {perms.DenyPolicies, denies}} {
+		for _, p := range ps.policies {
+			namespace := string(p.Resource)
+			if ps.cache[namespace] == nil {
+				ps.cache[namespace] = map[int]*roles.RolePolicy{}
+			}
+			ps.cache[namespace][p.ID] = p
+		}
+	}
+	return &DerivedUser{User: &models.User{UserID: 1, Name: "guybrush"}, Permissions: perms}
+}
+
+func TestAuthorizers(t *testing.T) {
+	o, err := NewOso("../../iam.polar")
+	require.NoError(t, err)
+
+	viewAll := &roles.RolePolicy{ID: 1, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*"}
+	anyOnFoo := &roles.RolePolicy{ID: 2, Effect: EffectAllow, Actions: []string{"*"}, Resource: "oso:0:zone/foo.com"}
+	denyDeleteFoo := &roles.RolePolicy{ID: 3, Effect: EffectDeny, Actions: []string{"delete"}, Resource: "oso:0:zone/foo.com"}
+	viewCom := &roles.RolePolicy{ID: 4, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*",
+		Conditions: map[int]*roles.Condition{1: {ID: 1, Type: "matchSuffix", Value: "com"}}}
+	unknownCond := &roles.RolePolicy{ID: 5, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*",
+		Conditions: map[int]*roles.Condition{2: {ID: 2, Type: "matchPrefix", Value: "foo"}}}
+	getZones := &roles.RolePolicy{ID: 6, Effect: EffectAllow, Actions: []string{"zone:Get*"}, Resource: "oso:0:zone/*"}
+	denyZoneService := &roles.RolePolicy{ID: 7, Effect: EffectDeny, Actions: []string{"zone:*"}, Resource: "oso:0:zone/foo.com"}
+	deleteAll := &roles.RolePolicy{ID: 8, Effect: EffectAllow, Actions: []string{"delete"}, Resource: "oso:0:zone/*"}
+	allExceptDelete := &roles.RolePolicy{ID: 9, Effect: EffectAllow, NotActions: []string{"delete"}, Resource: "oso:0:zone/*"}
+	anyOnFooExceptDelete := &roles.RolePolicy{ID: 10, Effect: EffectAllow, Actions: []string{"*"}, NotActions: []string{"delete"},
+		Resource: "oso:0:zone/foo.com"}
+	deleteExceptView := &roles.RolePolicy{ID: 11, Effect: EffectAllow, Actions: []string{"delete"}, NotActions: []string{"view"},
+		Resource: "oso:0:zone/*"}
+	viewAllExceptNet := &roles.RolePolicy{ID: 12, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*",
+		NotResourceNames: []roles.PolicyResourceName{"oso:0:zone/*.net"}}
+	denyAllExceptFoo := &roles.RolePolicy{ID: 13, Effect: EffectDeny, Actions: []string{"*"}, Resource: "oso:0:zone/*",
+		NotResourceNames: []roles.PolicyResourceName{"oso:0:zone/foo.com"}}
+	denyAllExceptView := &roles.RolePolicy{ID: 14, Effect: EffectDeny, NotActions: []string{"view"}, Resource: "oso:0:zone/*"}
+	viewOrg1 := &roles.RolePolicy{ID: 15, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:1:zone/*"}
+	anyOnZones := &roles.RolePolicy{ID: 16, Effect: EffectAllow, Actions: []string{"*"}, Resource: "oso:0:zone/*"}
+	viewComAndNet := &roles.RolePolicy{ID: 17, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*",
+		Conditions: map[int]*roles.Condition{1: {ID: 1, Type: "matchSuffix", Value: "com"}, 3: {ID: 3, Type: "matchSuffix", Value: "net"}}}
+	getZone := &roles.RolePolicy{ID: 18, Effect: EffectAllow, Actions: []string{"zone:GetZone"}, Resource: "oso:0:zone/*"}
+	denyDeleteZoneFoo := &roles.RolePolicy{ID: 19, Effect: EffectDeny, Actions: []string{"zone:DeleteZone"}, Resource: "oso:0:zone/foo.com"}
+
+	foo := &models.Zone{ZoneID: 1, Name: "foo.com", ResourceName: "oso:0:zone/foo.com"}
+	www := &datastore.Record{RecordID: 1, ZoneID: 1, Name: "www.foo.com", ResourceName: "oso:0:zone/foo.com/record/www.foo.com"}
+	bar := &models.Zone{ZoneID: 2, Name: "bar.net", ResourceName: "oso:0:zone/bar.net"}
+	qux := &models.Zone{ZoneID: 3, Name: "qux.com", ResourceName: "oso:1:zone/qux.com", OrgID: 1}
+	external, err := roles.NewExternalResource("oso:0:zone/baz.com", nil)
+	require.NoError(t, err)
+	org, err := roles.NewExternalResource("oso:0:org/0", nil)
+	require.NoError(t, err)
+	role, err := roles.NewExternalResource("oso:0:role/viewZonesRole", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		allows   []*roles.RolePolicy
+		denies   []*roles.RolePolicy
+		action   string
+		resource interface{}
+		expAllow bool
+		expIDs   []int
+	}{
+		{
+			name:     "allowed by wildcard namespace",
+			allows:   []*roles.RolePolicy{viewAll},
+			action:   "view",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{1},
+		},
+		{
+			name:     "action not permitted",
+			allows:   []*roles.RolePolicy{viewAll},
+			action:   "delete",
+			resource: bar,
+		},
+		{
+			name:     "allowed by wildcard action",
+			allows:   []*roles.RolePolicy{anyOnFoo},
+			action:   "delete",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{2},
+		},
+		{
+			name:     "namespace doesn't cover resource",
+			allows:   []*roles.RolePolicy{anyOnFoo},
+			action:   "view",
+			resource: bar,
+		},
+		{
+			name:     "explicit deny overrides allow",
+			allows:   []*roles.RolePolicy{anyOnFoo},
+			denies:   []*roles.RolePolicy{denyDeleteFoo},
+			action:   "delete",
+			resource: foo,
+			expIDs:   []int{2},
+		},
+		{
+			name:     "condition holds",
+			allows:   []*roles.RolePolicy{viewCom},
+			action:   "view",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{4},
+		},
+		{
+			name:     "condition fails",
+			allows:   []*roles.RolePolicy{viewCom},
+			action:   "view",
+			resource: bar,
+		},
+		{
+			name:     "unknown condition type never holds",
+			allows:   []*roles.RolePolicy{unknownCond},
+			action:   "view",
+			resource: foo,
+		},
+		{
+			name:     "allowed by action pattern",
+			allows:   []*roles.RolePolicy{getZones},
+			action:   "zone:GetZone",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{6},
+		},
+		{
+			name:     "action pattern doesn't match",
+			allows:   []*roles.RolePolicy{getZones},
+			action:   "zone:DeleteZone",
+			resource: bar,
+		},
+		{
+			name:     "service pattern denies",
+			allows:   []*roles.RolePolicy{getZones},
+			denies:   []*roles.RolePolicy{denyZoneService},
+			action:   "zone:GetZone",
+			resource: foo,
+			expIDs:   []int{6},
+		},
+		{
+			name:     "allowed by implying action",
+			allows:   []*roles.RolePolicy{deleteAll},
+			action:   "view",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{8},
+		},
+		{
+			name:     "deny of implying action doesn't deny implied action",
+			allows:   []*roles.RolePolicy{deleteAll},
+			denies:   []*roles.RolePolicy{denyDeleteFoo},
+			action:   "view",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{8},
+		},
+		{
+			name:     "implied action doesn't imply implying action",
+			allows:   []*roles.RolePolicy{viewAll},
+			action:   "delete",
+			resource: foo,
+		},
+		{
+			name:     "allowed by not actions",
+			allows:   []*roles.RolePolicy{allExceptDelete},
+			action:   "zone:GetZone",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{9},
+		},
+		{
+			name:     "not action excluded",
+			allows:   []*roles.RolePolicy{allExceptDelete},
+			action:   "delete",
+			resource: bar,
+		},
+		{
+			name:     "wildcard action with not action",
+			allows:   []*roles.RolePolicy{anyOnFooExceptDelete},
+			action:   "view",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{10},
+		},
+		{
+			name:     "not action excluded from wildcard action",
+			allows:   []*roles.RolePolicy{anyOnFooExceptDelete},
+			action:   "delete",
+			resource: foo,
+		},
+		{
+			name:     "not action isn't implied",
+			allows:   []*roles.RolePolicy{deleteExceptView},
+			action:   "view",
+			resource: bar,
+		},
+		{
+			name:     "allowed on resource not excluded",
+			allows:   []*roles.RolePolicy{viewAllExceptNet},
+			action:   "view",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{12},
+		},
+		{
+			name:     "not resource name excluded from wildcard resource",
+			allows:   []*roles.RolePolicy{viewAllExceptNet},
+			action:   "view",
+			resource: bar,
+		},
+		{
+			name:     "deny on every resource except",
+			allows:   []*roles.RolePolicy{viewAll},
+			denies:   []*roles.RolePolicy{denyAllExceptFoo},
+			action:   "view",
+			resource: bar,
+			expIDs:   []int{1},
+		},
+		{
+			name:     "deny doesn't apply to not resource name",
+			allows:   []*roles.RolePolicy{viewAll},
+			denies:   []*roles.RolePolicy{denyAllExceptFoo},
+			action:   "view",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{1},
+		},
+		{
+			name:     "deny every action except",
+			allows:   []*roles.RolePolicy{anyOnFoo},
+			denies:   []*roles.RolePolicy{denyAllExceptView},
+			action:   "delete",
+			resource: foo,
+			expIDs:   []int{2},
+		},
+		{
+			name:     "deny doesn't apply to not action",
+			allows:   []*roles.RolePolicy{anyOnFoo},
+			denies:   []*roles.RolePolicy{denyAllExceptView},
+			action:   "view",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{2},
+		},
+		{
+			name:     "allowed by type wildcard namespace",
+			allows:   []*roles.RolePolicy{viewOrg1},
+			action:   "view",
+			resource: qux,
+			expAllow: true,
+			expIDs:   []int{15},
+		},
+		{
+			name:     "type wildcard namespace doesn't cover other orgs",
+			allows:   []*roles.RolePolicy{viewOrg1},
+			action:   "view",
+			resource: foo,
+		},
+		{
+			name:     "zone wildcard doesn't cover zones of other orgs",
+			allows:   []*roles.RolePolicy{anyOnZones},
+			action:   "view",
+			resource: qux,
+		},
+		{
+			name:     "zone wildcard doesn't cover the org",
+			allows:   []*roles.RolePolicy{anyOnZones},
+			action:   "iam:CreatePolicy",
+			resource: org,
+		},
+		{
+			name:     "zone wildcard doesn't cover roles",
+			allows:   []*roles.RolePolicy{anyOnZones},
+			action:   "iam:ApproveAccess",
+			resource: role,
+		},
+		{
+			name:     "every policy of namespace applies",
+			allows:   []*roles.RolePolicy{viewAll, viewCom, anyOnZones},
+			action:   "view",
+			resource: foo,
+			expAllow: true,
+			expIDs:   []int{1, 4, 16},
+		},
+		{
+			name:     "policy whose condition fails doesn't hide others of namespace",
+			allows:   []*roles.RolePolicy{viewCom, anyOnZones},
+			action:   "view",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{16},
+		},
+		{
+			name:     "every condition must hold",
+			allows:   []*roles.RolePolicy{viewComAndNet},
+			action:   "view",
+			resource: foo,
+		},
+		{
+			name:     "allowed by alias of action",
+			allows:   []*roles.RolePolicy{viewAll},
+			action:   "zone:GetZone",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{1},
+		},
+		{
+			name:     "alias allowed by action",
+			allows:   []*roles.RolePolicy{getZone},
+			action:   "view",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{18},
+		},
+		{
+			name:     "deny of alias denies action",
+			allows:   []*roles.RolePolicy{anyOnFoo},
+			denies:   []*roles.RolePolicy{denyDeleteFoo},
+			action:   "zone:DeleteZone",
+			resource: foo,
+			expIDs:   []int{2},
+		},
+		{
+			name:     "deny of action denies alias",
+			allows:   []*roles.RolePolicy{anyOnFoo},
+			denies:   []*roles.RolePolicy{denyDeleteZoneFoo},
+			action:   "delete",
+			resource: foo,
+			expIDs:   []int{2},
+		},
+		{
+			name:     "not action alias excluded",
+			allows:   []*roles.RolePolicy{allExceptDelete},
+			action:   "zone:DeleteZone",
+			resource: bar,
+		},
+		{
+			name:     "allowed by alias of implying action",
+			allows:   []*roles.RolePolicy{deleteAll},
+			action:   "zone:GetZone",
+			resource: bar,
+			expAllow: true,
+			expIDs:   []int{8},
+		},
+		{
+			name:     "alias of zone and record action covers records",
+			allows:   []*roles.RolePolicy{viewAll},
+			action:   "zone:GetRecord",
+			resource: www,
+			expAllow: true,
+			expIDs:   []int{1},
+		},
+		{
+			name:     "zone action doesn't cover records",
+			allows:   []*roles.RolePolicy{getZone},
+			action:   "zone:GetRecord",
+			resource: www,
+		},
+		{
+			name:     "external resource",
+			allows:   []*roles.RolePolicy{viewCom, anyOnFoo},
+			action:   "view",
+			resource: external,
+			expAllow: true,
+			expIDs:   []int{4},
+		},
+	}
+
+	authorizers := map[string]Authorizer{
+		"oso":    NewOsoAuthorizer(o),
+		"native": NewNativeAuthorizer(),
+	}
+	for name, a := range authorizers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				u := newTestUser(tt.allows, tt.denies)
+				allowed, err := a.IsAllowed(u, tt.action, tt.resource)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expAllow, allowed)
+
+				policies, err := a.ApplicablePolicies(u, tt.action, tt.resource, EffectAllow)
+				require.NoError(t, err)
+				var ids []int
+				for _, p := range policies {
+					ids = append(ids, p.ID)
+				}
+				assert.Equal(t, tt.expIDs, ids)
+			})
+		}
+	}
+}
+
+func TestDifferentialAuthorizer(t *testing.T) {
+	u := newTestUser([]*roles.RolePolicy{{ID: 1, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*"}}, nil)
+	zone := &models.Zone{Name: "foo.com", ResourceName: "oso:0:zone/foo.com"}
+
+	var mismatches []Mismatch
+	a := NewDifferentialAuthorizer(NewNativeAuthorizer(), denyAll{}, func(m Mismatch) {
+		mismatches = append(mismatches, m)
+	})
+
+	allowed, err := a.IsAllowed(u, "view", zone)
+	require.NoError(t, err)
+	assert.True(t, allowed, "primary's decision is returned")
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, "IsAllowed", mismatches[0].Method)
+	assert.Equal(t, "true", mismatches[0].Primary)
+	assert.Equal(t, "false", mismatches[0].Secondary)
+
+	// agreement isn't reported
+	_, err = a.IsAllowed(u, "delete", zone)
+	require.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+}
+
+// denyAll is an Authorizer that never allows anything
+type denyAll struct{}
+
+func (denyAll) IsAllowed(*DerivedUser, string, interface{}) (bool, error) {
+	return false, nil
+}
+
+func (denyAll) ApplicablePolicies(*DerivedUser, string, interface{}, string) ([]*roles.RolePolicy, error) {
+	return nil, nil
+}
+
+func (denyAll) EvaluatePolicy(_ string, p *roles.RolePolicy, _ string, _ interface{}) (PolicyEvaluation, error) {
+	return PolicyEvaluation{Policy: p}, nil
+}
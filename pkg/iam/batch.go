@@ -0,0 +1,76 @@
+package iam
+
+import (
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"sync"
+)
+
+// batchWorkers is the most checks of a batch decided in parallel
+const batchWorkers = 8
+
+// Check is an action on a resource to decide for a user
+type Check struct {
+	Action   string
+	Resource interface{}
+}
+
+// CheckResult is the decision for a Check and the policies of the deciding effect that applied to it, ordered by ID,
+// or the error that prevented deciding it
+type CheckResult struct {
+	Allowed  bool
+	Policies []*roles.RolePolicy
+	Err      error
+}
+
+// Check decides whether u may perform c's action on its resource and explains the decision with the policies of the
+// deciding effect that applied to it.  The decision is recorded like those of Authorize.
+func (e *Enforcer) Check(u *DerivedUser, c Check) CheckResult {
+	allowed, err := e.cfg.Authorizer.IsAllowed(u, c.Action, c.Resource)
+	if err != nil {
+		e.cfg.Logger.Errorw("error checking authorization", "action", c.Action, "error", err)
+		return CheckResult{Err: err}
+	}
+	effect := EffectDeny
+	if allowed {
+		effect = EffectAllow
+	}
+	policies, err := e.cfg.Authorizer.ApplicablePolicies(u, c.Action, c.Resource, effect)
+	if err != nil {
+		e.cfg.Logger.Errorw("error explaining authorization", "action", c.Action, "error", err)
+		return CheckResult{Err: err}
+	}
+	if e.cfg.Record != nil {
+		// the allow policies that applied are already known, so they aren't found again to record the decision
+		var allows []*roles.RolePolicy
+		if allowed {
+			allows = policies
+		}
+		e.record(u, c.Action, c.Resource, allowed, allows)
+	}
+	return CheckResult{Allowed: allowed, Policies: policies}
+}
+
+// AuthorizeBatch decides each of checks for u, deciding up to batchWorkers checks in parallel.  Results are in the
+// same order as checks.  A check that can't be decided has an error result and doesn't affect the others.
+func (e *Enforcer) AuthorizeBatch(u *DerivedUser, checks []Check) []CheckResult {
+	results := make([]CheckResult, len(checks))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < batchWorkers && w < len(checks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = e.Check(u, checks[i])
+			}
+		}()
+	}
+	for i := range checks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,90 @@
+package iam
+
+import (
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestEnforcer_AuthorizeBatch(t *testing.T) {
+	t.Parallel()
+	viewCom := &roles.RolePolicy{
+		ID: 1, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*",
+		Conditions: map[int]*roles.Condition{1: {ID: 1, Type: "matchSuffix", Value: ".com"}},
+	}
+	u := newTestUser([]*roles.RolePolicy{viewCom}, nil)
+
+	var mu sync.Mutex
+	var recorded []*datastore.Decision
+	e := NewEnforcer(EnforcerConfig{Authorizer: NewNativeAuthorizer(), Record: func(d *datastore.Decision) {
+		mu.Lock()
+		defer mu.Unlock()
+		recorded = append(recorded, d)
+	}})
+
+	// more checks than workers, alternating between zones that can and can't be viewed, and a check of a resource
+	// without a resource name, which can't be decided
+	var checks []Check
+	for i := 0; i < batchWorkers*4; i++ {
+		tld := "com"
+		if i%2 == 1 {
+			tld = "net"
+		}
+		r, err := roles.NewExternalResource(fmt.Sprintf("oso:0:zone/zone%d.%s", i, tld), nil)
+		require.NoError(t, err)
+		checks = append(checks, Check{Action: "view", Resource: r})
+	}
+	checks = append(checks, Check{Action: "view", Resource: struct{}{}})
+
+	results := e.AuthorizeBatch(u, checks)
+	require.Len(t, results, len(checks))
+	for i, r := range results[:len(results)-1] {
+		assert.NoError(t, r.Err)
+		if i%2 == 1 {
+			assert.False(t, r.Allowed, i)
+			assert.Empty(t, r.Policies, i)
+		} else {
+			assert.True(t, r.Allowed, i)
+			assert.Equal(t, []*roles.RolePolicy{viewCom}, r.Policies, i)
+		}
+	}
+	assert.Error(t, results[len(results)-1].Err)
+	assert.Len(t, recorded, len(checks)-1)
+}
+
+// countingAuthorizer counts the calls to ApplicablePolicies of the Authorizer it wraps
+type countingAuthorizer struct {
+	Authorizer
+	applicable int
+}
+
+func (a *countingAuthorizer) ApplicablePolicies(u *DerivedUser, action string, resource interface{}, effect string) ([]*roles.RolePolicy, error) {
+	a.applicable++
+	return a.Authorizer.ApplicablePolicies(u, action, resource, effect)
+}
+
+func TestEnforcer_Check(t *testing.T) {
+	t.Parallel()
+	viewAll := &roles.RolePolicy{ID: 1, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*"}
+	u := newTestUser([]*roles.RolePolicy{viewAll}, nil)
+	r, err := roles.NewExternalResource("oso:0:zone/foo.com", nil)
+	require.NoError(t, err)
+
+	a := &countingAuthorizer{Authorizer: NewNativeAuthorizer()}
+	var recorded []*datastore.Decision
+	e := NewEnforcer(EnforcerConfig{Authorizer: a, Record: func(d *datastore.Decision) {
+		recorded = append(recorded, d)
+	}})
+
+	res := e.Check(u, Check{Action: "view", Resource: r})
+	require.NoError(t, res.Err)
+	assert.True(t, res.Allowed)
+	// the policies explaining the decision are recorded with it rather than found again
+	assert.Equal(t, 1, a.applicable)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, []int64{1}, []int64(recorded[0].PolicyIDs))
+}
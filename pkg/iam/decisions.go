@@ -0,0 +1,67 @@
+package iam
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"sync"
+)
+
+// DecisionRecorder records decisions in the decision audit trail.  Recording only appends a decision to those pending
+// in memory, so it's cheap enough for the hot path, and the pending decisions are written in batches by Flush.
+type DecisionRecorder struct {
+	write      func(ctx context.Context, ds []*datastore.Decision) error
+	maxPending int
+	full       chan struct{}
+
+	mu      sync.Mutex
+	pending []*datastore.Decision
+}
+
+// NewDecisionRecorder returns a DecisionRecorder that writes batches of decisions with write, and signals Full when
+// maxPending decisions are pending
+func NewDecisionRecorder(write func(ctx context.Context, ds []*datastore.Decision) error, maxPending int) *DecisionRecorder {
+	return &DecisionRecorder{write: write, maxPending: maxPending, full: make(chan struct{}, 1)}
+}
+
+// Record records decision d
+func (r *DecisionRecorder) Record(d *datastore.Decision) {
+	r.mu.Lock()
+	r.pending = append(r.pending, d)
+	full := len(r.pending) >= r.maxPending
+	r.mu.Unlock()
+	if full {
+		select {
+		case r.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Full receives when the pending decisions should be flushed before the next interval
+func (r *DecisionRecorder) Full() <-chan struct{} {
+	return r.full
+}
+
+// Flush writes the pending decisions in one batch, in the order they were recorded.  If the batch can't be written
+// it's kept pending to be written by the next flush, dropping the oldest decisions beyond maxPending so an unavailable
+// audit trail can't exhaust memory.
+func (r *DecisionRecorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := r.write(ctx, batch)
+	if err != nil {
+		r.mu.Lock()
+		r.pending = append(batch, r.pending...)
+		if over := len(r.pending) - r.maxPending; over > 0 {
+			r.pending = r.pending[over:]
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
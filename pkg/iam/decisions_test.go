@@ -0,0 +1,53 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDecisionRecorder(t *testing.T) {
+	t.Parallel()
+	var written [][]*datastore.Decision
+	fail := true
+	recorder := NewDecisionRecorder(func(_ context.Context, ds []*datastore.Decision) error {
+		if fail {
+			return errors.New("unavailable")
+		}
+		written = append(written, ds)
+		return nil
+	}, 2)
+
+	view := &datastore.Decision{UserID: 1, Action: "view", Allowed: true}
+	del := &datastore.Decision{UserID: 1, Action: "delete"}
+	create := &datastore.Decision{UserID: 2, Action: "create", Allowed: true}
+
+	recorder.Record(view)
+	select {
+	case <-recorder.Full():
+		t.Fatal("recorder full with one decision")
+	default:
+	}
+
+	// decisions that can't be written are kept for the next flush, up to maxPending
+	assert.Error(t, recorder.Flush(context.Background()))
+	recorder.Record(del)
+	select {
+	case <-recorder.Full():
+	default:
+		t.Fatal("recorder not full with two decisions")
+	}
+	assert.Error(t, recorder.Flush(context.Background()))
+	recorder.Record(create)
+	assert.Error(t, recorder.Flush(context.Background()))
+
+	fail = false
+	assert.NoError(t, recorder.Flush(context.Background()))
+	assert.Equal(t, [][]*datastore.Decision{{del, create}}, written)
+
+	// nothing is written when nothing is pending
+	assert.NoError(t, recorder.Flush(context.Background()))
+	assert.Len(t, written, 1)
+}
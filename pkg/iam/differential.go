@@ -0,0 +1,92 @@
+package iam
+
+import (
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+)
+
+// Mismatch is a call on which the authorizers compared by a differential authorizer disagreed
+type Mismatch struct {
+	// Method is the Authorizer method called
+	Method   string
+	User     *DerivedUser
+	Action   string
+	Resource interface{}
+	// Primary and Secondary are the results of each authorizer, formatted for reporting
+	Primary   string
+	Secondary string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s(%q, %v) primary: %s secondary: %s", m.Method, m.Action, m.Resource, m.Primary, m.Secondary)
+}
+
+type differentialAuthorizer struct {
+	primary   Authorizer
+	secondary Authorizer
+	report    func(Mismatch)
+}
+
+// NewDifferentialAuthorizer returns an Authorizer that makes every call on both primary and secondary and reports
+// each call they disagree on with report.  Results, including errors, are always primary's, so secondary can be
+// evaluated against live traffic without affecting decisions.
+func NewDifferentialAuthorizer(primary, secondary Authorizer, report func(Mismatch)) Authorizer {
+	return &differentialAuthorizer{primary: primary, secondary: secondary, report: report}
+}
+
+func (a *differentialAuthorizer) IsAllowed(u *DerivedUser, action string, resource interface{}) (bool, error) {
+	allowed, err := a.primary.IsAllowed(u, action, resource)
+	sAllowed, sErr := a.secondary.IsAllowed(u, action, resource)
+	a.compare("IsAllowed", u, action, resource, result(allowed, err), result(sAllowed, sErr))
+	return allowed, err
+}
+
+func (a *differentialAuthorizer) ApplicablePolicies(u *DerivedUser, action string, resource interface{}, effect string) ([]*roles.RolePolicy, error) {
+	policies, err := a.primary.ApplicablePolicies(u, action, resource, effect)
+	sPolicies, sErr := a.secondary.ApplicablePolicies(u, action, resource, effect)
+	a.compare("ApplicablePolicies", u, action, resource, result(policyIDs(policies), err), result(policyIDs(sPolicies), sErr))
+	return policies, err
+}
+
+func (a *differentialAuthorizer) EvaluatePolicy(namespace string, p *roles.RolePolicy, action string, resource interface{}) (PolicyEvaluation, error) {
+	pe, err := a.primary.EvaluatePolicy(namespace, p, action, resource)
+	sPE, sErr := a.secondary.EvaluatePolicy(namespace, p, action, resource)
+	a.compare("EvaluatePolicy", nil, action, resource, result(evaluationResult(pe), err), result(evaluationResult(sPE), sErr))
+	return pe, err
+}
+
+// compare reports a mismatch if the formatted results differ
+func (a *differentialAuthorizer) compare(method string, u *DerivedUser, action string, resource interface{}, primary, secondary string) {
+	if primary == secondary {
+		return
+	}
+	a.report(Mismatch{
+		Method:    method,
+		User:      u,
+		Action:    action,
+		Resource:  resource,
+		Primary:   primary,
+		Secondary: secondary,
+	})
+}
+
+// result formats the result of a call for comparison.  Errors compare equal to each other whatever their message,
+// since each implementation words them differently.
+func result(v interface{}, err error) string {
+	if err != nil {
+		return "error"
+	}
+	return fmt.Sprint(v)
+}
+
+func policyIDs(policies []*roles.RolePolicy) []int {
+	ids := make([]int, len(policies))
+	for i, p := range policies {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func evaluationResult(pe PolicyEvaluation) [3]bool {
+	return [3]bool{pe.CoversResource, pe.PermitsAction, pe.ConditionsHold}
+}
@@ -0,0 +1,196 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// ReadAction is the action a user must be allowed to perform on a resource to learn that it exists.  The catalog makes
+// it an alias of the read action of zones and records, zone:GetZone and zone:GetRecord.
+const ReadAction = "view"
+
+var (
+	ErrNotFound  = errors.New("resource not found")
+	ErrForbidden = errors.New("action forbidden")
+)
+
+// DisclosurePolicy controls what a user learns about a resource when they fail authorization for it
+type DisclosurePolicy int
+
+const (
+	// ConcealForbidden treats every authorization failure as not found, so forbidden and missing resources are
+	// indistinguishable
+	ConcealForbidden DisclosurePolicy = iota
+	// RevealForbidden treats a failure as not found when the user can't view the resource and as forbidden when
+	// they can view it but aren't allowed to perform the action
+	RevealForbidden
+)
+
+// EnforcerConfig configures an Enforcer
+type EnforcerConfig struct {
+	// Authorizer decides whether users may perform actions on resources
+	Authorizer Authorizer
+	// DisclosurePolicies is the disclosure policy for each resource type.  Types not listed conceal.
+	DisclosurePolicies map[string]DisclosurePolicy
+	// Record, if set, is called with each decision made, for the decision audit trail
+	Record func(*datastore.Decision)
+	Logger *zap.SugaredLogger
+}
+
+// Enforcer authorizes the actions of derived users with the IAM policy.  It's the transport independent core shared
+// by the fiber, net/http and gRPC enforcement middleware, so authorization behaves the same on every transport.
+type Enforcer struct {
+	cfg EnforcerConfig
+}
+
+// NewEnforcer returns an Enforcer configured with cfg
+func NewEnforcer(cfg EnforcerConfig) *Enforcer {
+	if cfg.DisclosurePolicies == nil {
+		cfg.DisclosurePolicies = map[string]DisclosurePolicy{}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop().Sugar()
+	}
+	return &Enforcer{cfg: cfg}
+}
+
+// Authenticate resolves apiKey to a derived user with authenticator and returns a copy of ctx carrying it
+func Authenticate(ctx context.Context, authenticator Authenticator, apiKey string) (context.Context, error) {
+	u, err := authenticator.Authenticate(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return WithDerivedUser(ctx, u), nil
+}
+
+// Authorize returns nil if the derived user in ctx may perform action on resource, which is of type rType.
+// Otherwise returns ErrMissingDerivedUser if ctx carries no user, and ErrNotFound or ErrForbidden according to the
+// disclosure policy of rType.
+func (e *Enforcer) Authorize(ctx context.Context, action, rType string, resource interface{}) error {
+	u, err := DerivedUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := e.cfg.Authorizer.IsAllowed(u, action, resource)
+	if err != nil {
+		e.cfg.Logger.Errorw("error authorizing request", "action", action, "type", rType, "error", err)
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	if e.cfg.Record != nil {
+		e.record(u, action, resource, allowed, nil)
+	}
+	if allowed {
+		return nil
+	}
+
+	// only reveal the resource is forbidden to users who can view it
+	if e.cfg.DisclosurePolicies[rType] == RevealForbidden && action != ReadAction {
+		canRead, err := e.cfg.Authorizer.IsAllowed(u, ReadAction, resource)
+		if err == nil && canRead {
+			return ErrForbidden
+		}
+	}
+	return ErrNotFound
+}
+
+// record records the decision for u to perform action on resource.  allows are the allow policies that applied to it
+// if it's allowed, or nil for them to be found with the Authorizer.
+func (e *Enforcer) record(u *DerivedUser, action string, resource interface{}, allowed bool, allows []*roles.RolePolicy) {
+	if allowed && allows == nil {
+		var err error
+		allows, err = e.cfg.Authorizer.ApplicablePolicies(u, action, resource, EffectAllow)
+		if err != nil {
+			e.cfg.Logger.Errorw("error recording decision", "action", action, "error", err)
+			return
+		}
+	}
+	d, err := NewDecision(u, action, resource, allowed, allows)
+	if err != nil {
+		e.cfg.Logger.Errorw("error recording decision", "action", action, "error", err)
+		return
+	}
+	e.cfg.Record(d)
+}
+
+// NewDecision returns the decision for u to perform action on resource, made at the current time, with the allow
+// policies allows that applied to it if it's allowed.  resource must have a string ResourceName field.
+func NewDecision(u *DerivedUser, action string, resource interface{}, allowed bool, allows []*roles.RolePolicy) (*datastore.Decision, error) {
+	rn, err := resourceAttribute(resource, "ResourceName")
+	if err != nil {
+		return nil, err
+	}
+	d := &datastore.Decision{
+		OccurredAt: time.Now(), OrgID: u.User.OrgID, UserID: u.User.UserID, Action: action, ResourceName: rn,
+		Allowed: allowed, PolicyIDs: types.Int64Array{},
+	}
+	if !allowed {
+		return d, nil
+	}
+	for _, p := range allows {
+		d.PolicyIDs = append(d.PolicyIDs, int64(p.ID))
+	}
+	return d, nil
+}
+
+// HTTPStatus returns the HTTP status code for an authentication or authorization failure.  Failures to load a
+// resource are treated as not found.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrMissingAPIKey), errors.Is(err, ErrUserNotFound), errors.Is(err, ErrMissingDerivedUser):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	}
+	return http.StatusNotFound
+}
+
+// Error is an authentication or authorization failure of a request to one of the HTTP adapters
+type Error struct {
+	// Status is the HTTP status code to respond with
+	Status int
+	// ResourceType is the type of resource that wasn't found or was forbidden, if any
+	ResourceType string
+	Err          error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ResourceLoader loads the resource a request of type R, such as an *http.Request, acts on
+type ResourceLoader[R any] interface {
+	// Type is the type of resource loaded, used to look up its disclosure policy
+	Type() string
+	// Load returns the resource the request acts on, or an error if it doesn't exist
+	Load(req R) (interface{}, error)
+}
+
+type loaderFunc[R any] struct {
+	rType string
+	load  func(req R) (interface{}, error)
+}
+
+func (lf loaderFunc[R]) Type() string {
+	return lf.rType
+}
+
+func (lf loaderFunc[R]) Load(req R) (interface{}, error) {
+	return lf.load(req)
+}
+
+// LoaderFunc returns a ResourceLoader of resources of type rType that loads with load
+func LoaderFunc[R any](rType string, load func(req R) (interface{}, error)) ResourceLoader[R] {
+	return loaderFunc[R]{rType: rType, load: load}
+}
@@ -0,0 +1,41 @@
+package iam
+
+import (
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"sort"
+)
+
+// Explanation is the decision for an action on a resource and the evaluation of each policy that led to it
+type Explanation struct {
+	Decision    string             `json:"decision"`
+	Evaluations []PolicyEvaluation `json:"evaluations"`
+}
+
+// Explain decides with a whether u may perform action on resource and evaluates each of u's policies against it
+func Explain(a Authorizer, u *DerivedUser, action string, resource interface{}) (*Explanation, error) {
+	allowed, err := a.IsAllowed(u, action, resource)
+	if err != nil {
+		return nil, err
+	}
+	exp := &Explanation{Decision: EffectDeny, Evaluations: []PolicyEvaluation{}}
+	if allowed {
+		exp.Decision = EffectAllow
+	}
+
+	for _, cache := range []datastore.PoliciesByNamespace{u.Permissions.AllowPolicies, u.Permissions.DenyPolicies} {
+		for namespace, policies := range cache {
+			for _, p := range policies {
+				pe, err := a.EvaluatePolicy(namespace, p, action, resource)
+				if err != nil {
+					return nil, err
+				}
+				exp.Evaluations = append(exp.Evaluations, pe)
+			}
+		}
+	}
+	// order evaluations for stable output
+	sort.Slice(exp.Evaluations, func(i, j int) bool {
+		return exp.Evaluations[i].Policy.ID < exp.Evaluations[j].Policy.ID
+	})
+	return exp, nil
+}
@@ -0,0 +1,99 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"go.uber.org/zap"
+)
+
+type derivedUserKeyType string
+
+const derivedUserKey derivedUserKeyType = "derivedUserKey"
+
+var (
+	ErrMissingAPIKey      = errors.New("x-api-key value not found in request")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrMissingDerivedUser = errors.New("derived user not found in context")
+)
+
+// DerivedUser is a user and all of its roles and policies, with the policy variables substituted for the user and
+// the policies inherited through the org hierarchy added
+type DerivedUser struct {
+	User        *models.User
+	Tags        map[string]string
+	Permissions datastore.EffectivePerms
+}
+
+// Authenticator resolves the API key presented with a request to the user it belongs to
+type Authenticator interface {
+	Authenticate(ctx context.Context, apiKey string) (*DerivedUser, error)
+}
+
+type datastoreAuthenticator struct {
+	ds     datastore.Datastore
+	logger *zap.SugaredLogger
+}
+
+// NewAuthenticator returns an Authenticator that looks up users and their permissions in ds
+func NewAuthenticator(ds datastore.Datastore, l *zap.SugaredLogger) Authenticator {
+	return &datastoreAuthenticator{ds: ds, logger: l}
+}
+
+func (a *datastoreAuthenticator) Authenticate(ctx context.Context, apiKey string) (*DerivedUser, error) {
+	if apiKey == "" {
+		return nil, ErrMissingAPIKey
+	}
+	u, err := a.ds.FindUserByKey(ctx, apiKey)
+	if err != nil {
+		a.logger.Errorw("error finding user by api key", "error", err)
+		return nil, ErrUserNotFound
+	}
+	du, err := Derive(ctx, a.ds, u)
+	if err != nil {
+		a.logger.Errorw("error finding effective permissions for user", "error", err)
+		return nil, ErrUserNotFound
+	}
+	a.logger.Debugw("found effective permissions for user", "roles", du.Permissions)
+	return du, nil
+}
+
+// Derive loads the roles and policies of u from ds into a DerivedUser
+func Derive(ctx context.Context, ds datastore.Datastore, u *models.User) (*DerivedUser, error) {
+	tree, err := ds.GetOrgTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	perms, err := ds.GetEffectivePerms(ctx, u, tree)
+	if err != nil {
+		return nil, err
+	}
+	return withPrincipal(ctx, ds, u, perms, tree)
+}
+
+// withPrincipal returns a DerivedUser of u with the variables of the policies in perms substituted with u's attributes
+// and tags, and the policies inherited by the descendants in tree of the orgs they're on added
+func withPrincipal(ctx context.Context, ds datastore.Datastore, u *models.User, perms datastore.EffectivePerms, tree roles.OrgTree) (*DerivedUser, error) {
+	tags, err := ds.ListUserTags(ctx, u.UserID)
+	if err != nil {
+		return nil, err
+	}
+	p := roles.Principal{UserID: u.UserID, OrgID: u.OrgID, Name: u.Name, Tags: tags}
+	return &DerivedUser{User: u, Tags: tags, Permissions: perms.ForPrincipal(p).ForOrgTree(tree)}, nil
+}
+
+// WithDerivedUser returns a copy of ctx carrying u
+func WithDerivedUser(ctx context.Context, u *DerivedUser) context.Context {
+	return context.WithValue(ctx, derivedUserKey, u)
+}
+
+// DerivedUserFromContext returns the derived user saved in ctx by WithDerivedUser
+func DerivedUserFromContext(ctx context.Context) (*DerivedUser, error) {
+	u, ok := ctx.Value(derivedUserKey).(*DerivedUser)
+	if !ok || u == nil {
+		return nil, ErrMissingDerivedUser
+	}
+	return u, nil
+}
@@ -0,0 +1,363 @@
+package iam
+
+import (
+	"context"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"sort"
+	"strings"
+)
+
+// severities of lint findings
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// LintRule is a check the linter makes of policies
+type LintRule struct {
+	ID       string `json:"id"`
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+}
+
+var (
+	RuleWildcardAllow     = LintRule{ID: "IAM001", Severity: SeverityError, Summary: "allows all actions on all resources"}
+	RuleShadowedAllow     = LintRule{ID: "IAM002", Severity: SeverityWarning, Summary: "allow is shadowed by a deny"}
+	RuleDuplicatePolicy   = LintRule{ID: "IAM003", Severity: SeverityWarning, Summary: "duplicates another policy of the role"}
+	RuleUnmatchedResource = LintRule{ID: "IAM004", Severity: SeverityWarning, Summary: "matches no zone"}
+	RuleUnknownCondition  = LintRule{ID: "IAM005", Severity: SeverityError, Summary: "condition type is unknown"}
+	RuleUnknownAction     = LintRule{ID: "IAM006", Severity: SeverityError, Summary: "action matches no action in the catalog"}
+
+	// LintRules are the rules checked by Lint
+	LintRules = []LintRule{
+		RuleWildcardAllow, RuleShadowedAllow, RuleDuplicatePolicy, RuleUnmatchedResource, RuleUnknownCondition,
+		RuleUnknownAction,
+	}
+)
+
+// conditionTypes are the condition types the authorizers evaluate
+var conditionTypes = map[string]bool{"matchSuffix": true}
+
+// Finding is a policy of a role that breaks a lint rule
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	RoleID   int    `json:"role_id"`
+	Role     string `json:"role"`
+	PolicyID int    `json:"policy_id"`
+	Message  string `json:"message"`
+}
+
+// RolePolicies is a role and the policies attached to it
+type RolePolicies struct {
+	RoleID   int
+	Role     string
+	Policies []*roles.RolePolicy
+}
+
+// Lint checks the policies of rs against zones, the zones of their org.  rs should be the roles of a single principal,
+// or a single role, as allows are only checked for shadowing by the denies in rs.
+func Lint(rs []*RolePolicies, zones models.ZoneSlice) []Finding {
+	fs := []Finding{}
+	for _, r := range rs {
+		finding := func(rule LintRule, p *roles.RolePolicy, format string, a ...interface{}) {
+			fs = append(fs, Finding{
+				Rule: rule.ID, Severity: rule.Severity, RoleID: r.RoleID, Role: r.Role, PolicyID: p.ID,
+				Message: fmt.Sprintf(format, a...),
+			})
+		}
+		seen := map[string]*roles.RolePolicy{}
+		for _, p := range sortedRolePolicies(r.Policies) {
+			if isWildcardAllow(p) {
+				finding(RuleWildcardAllow, p, "policy %d allows all actions on %s", p.ID, p.Resource)
+			}
+			if d := shadowingDeny(p, rs); d != nil {
+				finding(RuleShadowedAllow, p, "policy %d is shadowed by deny policy %d", p.ID, d.ID)
+			}
+			key := policyKey(p)
+			if dup, ok := seen[key]; ok {
+				finding(RuleDuplicatePolicy, p, "policy %d duplicates policy %d", p.ID, dup.ID)
+			} else {
+				seen[key] = p
+			}
+			rType, _ := p.Resource.GetType()
+			for _, a := range append(append([]string{}, p.Actions...), p.NotActions...) {
+				if catalog.Default.Validate(rType, a) != nil {
+					finding(RuleUnknownAction, p, "action %q of policy %d matches no %s action", a, p.ID, rType)
+				}
+			}
+			unknown := unknownConditions(p)
+			for _, c := range unknown {
+				finding(RuleUnknownCondition, p, "condition %d of policy %d has unknown type %q", c.ID, p.ID, c.Type)
+			}
+			// conditions of unknown types never hold, so they'd match no zone too
+			if len(unknown) == 0 && !matchesZone(p, zones) {
+				finding(RuleUnmatchedResource, p, "policy %d on %s matches no zone", p.ID, p.Resource)
+			}
+		}
+	}
+	sortFindings(fs)
+	return fs
+}
+
+// LintRole lints the policies of role r
+func LintRole(ctx context.Context, ds datastore.Datastore, admin datastore.Admin, r *models.Role) ([]Finding, error) {
+	rp, err := LoadRolePolicies(ctx, admin, r)
+	if err != nil {
+		return nil, err
+	}
+	zs, err := ds.ListZonesByOrgID(ctx, r.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	return Lint([]*RolePolicies{rp}, *zs), nil
+}
+
+// LintUser lints the policies of the roles bound to u together
+func LintUser(ctx context.Context, ds datastore.Datastore, u *models.User) ([]Finding, error) {
+	tree, err := ds.GetOrgTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	drs, err := ds.GetUserRolesAndPolicies(ctx, u, tree)
+	if err != nil {
+		return nil, err
+	}
+	zs, err := ds.ListZonesByOrgID(ctx, u.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(GroupRolePolicies(drs), *zs), nil
+}
+
+// LintOrg lints each role of an org, and the roles bound to each of its users together
+func LintOrg(ctx context.Context, ds datastore.Datastore, admin datastore.Admin, orgID int) ([]Finding, error) {
+	zs, err := ds.ListZonesByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := admin.ListRolesByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	var fs []Finding
+	for _, r := range rs {
+		rp, err := LoadRolePolicies(ctx, admin, r)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, Lint([]*RolePolicies{rp}, *zs)...)
+	}
+	us, err := ds.ListUsersByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := ds.GetOrgTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range *us {
+		drs, err := ds.GetUserRolesAndPolicies(ctx, u, tree)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, Lint(GroupRolePolicies(drs), *zs)...)
+	}
+	return dedupeFindings(fs), nil
+}
+
+// LoadRolePolicies loads the policies attached to r and their conditions from admin
+func LoadRolePolicies(ctx context.Context, admin datastore.Admin, r *models.Role) (*RolePolicies, error) {
+	ps, err := admin.ListPoliciesByRoleID(ctx, r.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	rp := &RolePolicies{RoleID: r.RoleID, Role: r.Name}
+	for _, p := range ps {
+		cs, err := admin.ListConditionsByPolicyID(ctx, p.PolicyID)
+		if err != nil {
+			return nil, err
+		}
+		policy := datastore.ToPolicy(p)
+		for _, c := range cs {
+			policy.Conditions[c.ConditionID] = datastore.ToCondition(*c)
+		}
+		rp.Policies = append(rp.Policies, policy)
+	}
+	return rp, nil
+}
+
+// GroupRolePolicies groups the policies and conditions in drs by role, ordered by role ID
+func GroupRolePolicies(drs []*datastore.DenormalizedRole) []*RolePolicies {
+	byRole := map[int]*RolePolicies{}
+	policies := map[[2]int]*roles.RolePolicy{}
+	for _, dr := range drs {
+		rp, ok := byRole[dr.RoleID]
+		if !ok {
+			rp = &RolePolicies{RoleID: dr.RoleID, Role: dr.Role.Name}
+			byRole[dr.RoleID] = rp
+		}
+		// drs holds a row per condition of each policy
+		p, ok := policies[[2]int{dr.RoleID, dr.PolicyID}]
+		if !ok {
+			p = datastore.ToPolicy(&dr.Policy)
+			policies[[2]int{dr.RoleID, dr.PolicyID}] = p
+			rp.Policies = append(rp.Policies, p)
+		}
+		if c := datastore.ToCondition(dr.Condition); c != nil {
+			p.Conditions[c.ID] = c
+		}
+	}
+	rs := make([]*RolePolicies, 0, len(byRole))
+	for _, rp := range byRole {
+		rs = append(rs, rp)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].RoleID < rs[j].RoleID })
+	return rs
+}
+
+// isWildcardAllow returns true if p unconditionally allows all actions on all resources, or all resources of a type,
+// excluding none of them
+func isWildcardAllow(p *roles.RolePolicy) bool {
+	if p.Effect != EffectAllow || len(p.Conditions) != 0 || len(p.NotResourceNames) != 0 || !permitsAllActions(p) {
+		return false
+	}
+	rID, _ := p.Resource.GetResourceID()
+	return rID == "*" || strings.Count(rID, "/") == 1 && strings.HasSuffix(rID, "/*")
+}
+
+// permitsAllActions returns true if one of p's action patterns, like * or **, matches every action and p has no not
+// actions
+func permitsAllActions(p *roles.RolePolicy) bool {
+	if len(p.NotActions) != 0 {
+		return false
+	}
+	for _, a := range p.Actions {
+		if a != "" && strings.Trim(a, "*") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// shadowingDeny returns the deny policy in rs with the lowest ID that denies every action allow permits wherever it
+// applies, or nil if allow isn't an allow policy or no deny shadows it
+func shadowingDeny(allow *roles.RolePolicy, rs []*RolePolicies) *roles.RolePolicy {
+	if allow.Effect != EffectAllow || len(allow.Actions) == 0 {
+		return nil
+	}
+	var shadow *roles.RolePolicy
+	for _, r := range rs {
+		for _, d := range r.Policies {
+			// denies excluding resources may exclude those allow applies to
+			if d.Effect != EffectDeny || len(d.Conditions) != 0 || len(d.NotResourceNames) != 0 {
+				continue
+			}
+			if d.Resource != allow.Resource && !(roles.TypeWildcard{}).Covers(string(d.Resource), string(allow.Resource)) {
+				continue
+			}
+			// a deny pattern that matches an allow pattern, like zone:* and zone:Get*, denies everything it allows
+			// but not actions of the deny may match only some of the actions an allow pattern matches
+			denied := true
+			for _, a := range allow.Actions {
+				denied = denied && d.PermitsAction(a) && (len(d.NotActions) == 0 || !roles.IsActionPattern(a))
+			}
+			if denied && (shadow == nil || d.ID < shadow.ID) {
+				shadow = d
+			}
+		}
+	}
+	return shadow
+}
+
+// policyKey identifies what p allows or denies, so policies with equal keys are duplicates
+func policyKey(p *roles.RolePolicy) string {
+	actions := append([]string{}, p.Actions...)
+	sort.Strings(actions)
+	notActions := append([]string{}, p.NotActions...)
+	sort.Strings(notActions)
+	notResources := make([]string, len(p.NotResourceNames))
+	for i, nrn := range p.NotResourceNames {
+		notResources[i] = string(nrn)
+	}
+	sort.Strings(notResources)
+	conds := make([]string, 0, len(p.Conditions))
+	for _, c := range p.Conditions {
+		conds = append(conds, fmt.Sprintf("%s=%v", c.Type, c.Value))
+	}
+	sort.Strings(conds)
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%s", p.Effect, p.Resource, strings.Join(actions, ","), strings.Join(conds, ","),
+		strings.Join(notActions, ","), strings.Join(notResources, ","))
+}
+
+// unknownConditions returns the conditions of p with types the authorizers don't evaluate, ordered by ID
+func unknownConditions(p *roles.RolePolicy) []*roles.Condition {
+	var cs []*roles.Condition
+	for _, c := range p.Conditions {
+		if !conditionTypes[c.Type] {
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].ID < cs[j].ID })
+	return cs
+}
+
+// matchesZone returns true if p applies to one of zones, or isn't a policy on zones.  Policies with variables are
+// assumed to, as what they match depends on the user.
+func matchesZone(p *roles.RolePolicy, zones models.ZoneSlice) bool {
+	if !p.Resource.IsType("zone") || p.HasVariables() {
+		return true
+	}
+	for _, z := range zones {
+		covers, err := policyCoversResource(string(p.Resource), p, z)
+		if err != nil || !covers {
+			continue
+		}
+		if hold, err := conditionsHold(p, z); err == nil && hold {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedRolePolicies returns a copy of ps ordered by ID
+func sortedRolePolicies(ps []*roles.RolePolicy) []*roles.RolePolicy {
+	sorted := append([]*roles.RolePolicy{}, ps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+// dedupeFindings returns fs without repeated findings, ordered by sortFindings
+func dedupeFindings(fs []Finding) []Finding {
+	seen := map[Finding]bool{}
+	deduped := []Finding{}
+	for _, f := range fs {
+		if !seen[f] {
+			seen[f] = true
+			deduped = append(deduped, f)
+		}
+	}
+	sortFindings(deduped)
+	return deduped
+}
+
+// sortFindings orders fs by role, policy, rule and message
+func sortFindings(fs []Finding) {
+	sort.SliceStable(fs, func(i, j int) bool {
+		a, b := fs[i], fs[j]
+		if a.RoleID != b.RoleID {
+			return a.RoleID < b.RoleID
+		}
+		if a.PolicyID != b.PolicyID {
+			return a.PolicyID < b.PolicyID
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Message < b.Message
+	})
+}
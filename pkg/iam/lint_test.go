@@ -0,0 +1,189 @@
+package iam
+
+import (
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+	zones := models.ZoneSlice{
+		{ZoneID: 1, Name: "foo.com", ResourceName: "oso:0:zone/foo.com"},
+		{ZoneID: 2, Name: "bar.net", ResourceName: "oso:0:zone/bar.net"},
+	}
+	policy := func(id int, effect, resource string, actions ...string) *roles.RolePolicy {
+		return &roles.RolePolicy{
+			ID: id, Effect: effect, Actions: actions, Resource: roles.PolicyResourceName(resource),
+			Conditions: map[int]*roles.Condition{},
+		}
+	}
+	withCondition := func(p *roles.RolePolicy, c *roles.Condition) *roles.RolePolicy {
+		p.Conditions[c.ID] = c
+		return p
+	}
+	except := func(p *roles.RolePolicy, notActions []string, notResourceNames ...roles.PolicyResourceName) *roles.RolePolicy {
+		p.NotActions, p.NotResourceNames = notActions, notResourceNames
+		return p
+	}
+
+	tests := []struct {
+		name string
+		rs   []*RolePolicies
+		exp  []Finding
+	}{
+		{
+			name: "clean",
+			rs: []*RolePolicies{{RoleID: 1, Role: "viewers", Policies: []*roles.RolePolicy{
+				policy(1, EffectAllow, "oso:0:zone/*", "view"),
+				policy(2, EffectDeny, "oso:0:zone/foo.com", "delete"),
+				policy(3, EffectAllow, "oso:0:org/0", "*"),
+			}}},
+			exp: []Finding{},
+		},
+		{
+			name: "wildcard allow",
+			rs: []*RolePolicies{{RoleID: 1, Role: "admins", Policies: []*roles.RolePolicy{
+				policy(1, EffectAllow, "oso:0:zone/*", "*"),
+				policy(2, EffectAllow, "oso:0:*", "view", "*"),
+				withCondition(policy(3, EffectAllow, "oso:0:zone/*", "*"), &roles.Condition{ID: 1, Type: "matchSuffix", Value: "com"}),
+			}}},
+			exp: []Finding{
+				{Rule: "IAM001", Severity: "error", RoleID: 1, Role: "admins", PolicyID: 1, Message: "policy 1 allows all actions on oso:0:zone/*"},
+				{Rule: "IAM001", Severity: "error", RoleID: 1, Role: "admins", PolicyID: 2, Message: "policy 2 allows all actions on oso:0:*"},
+			},
+		},
+		{
+			name: "shadowed across roles",
+			rs: []*RolePolicies{
+				{RoleID: 1, Role: "editors", Policies: []*roles.RolePolicy{
+					policy(1, EffectAllow, "oso:0:zone/foo.com", "view", "delete"),
+					policy(2, EffectAllow, "oso:0:zone/bar.net", "view", "delete"),
+				}},
+				{RoleID: 2, Role: "restricted", Policies: []*roles.RolePolicy{
+					policy(3, EffectDeny, "oso:0:zone/foo.com", "*"),
+					policy(4, EffectDeny, "oso:0:zone/*", "delete"),
+					withCondition(policy(5, EffectDeny, "oso:0:zone/*", "*"), &roles.Condition{ID: 1, Type: "matchSuffix", Value: "net"}),
+				}},
+			},
+			exp: []Finding{
+				{Rule: "IAM002", Severity: "warning", RoleID: 1, Role: "editors", PolicyID: 1, Message: "policy 1 is shadowed by deny policy 3"},
+			},
+		},
+		{
+			name: "shadowed by action pattern",
+			rs: []*RolePolicies{{RoleID: 1, Role: "editors", Policies: []*roles.RolePolicy{
+				policy(1, EffectAllow, "oso:0:zone/foo.com", "delete"),
+				policy(2, EffectAllow, "oso:0:zone/foo.com", "de*"),
+				policy(3, EffectAllow, "oso:0:zone/foo.com", "d*"),
+				policy(4, EffectDeny, "oso:0:zone/foo.com", "de*"),
+			}}},
+			exp: []Finding{
+				{Rule: "IAM002", Severity: "warning", RoleID: 1, Role: "editors", PolicyID: 1, Message: "policy 1 is shadowed by deny policy 4"},
+				{Rule: "IAM002", Severity: "warning", RoleID: 1, Role: "editors", PolicyID: 2, Message: "policy 2 is shadowed by deny policy 4"},
+			},
+		},
+		{
+			name: "duplicates",
+			rs: []*RolePolicies{{RoleID: 1, Role: "viewers", Policies: []*roles.RolePolicy{
+				policy(2, EffectAllow, "oso:0:zone/foo.com", "view", "delete"),
+				policy(1, EffectAllow, "oso:0:zone/foo.com", "delete", "view"),
+				policy(3, EffectDeny, "oso:0:zone/foo.com", "delete", "view"),
+				withCondition(policy(4, EffectAllow, "oso:0:zone/foo.com", "delete", "view"), &roles.Condition{ID: 1, Type: "matchSuffix", Value: "com"}),
+			}}},
+			exp: []Finding{
+				{Rule: "IAM002", Severity: "warning", RoleID: 1, Role: "viewers", PolicyID: 1, Message: "policy 1 is shadowed by deny policy 3"},
+				{Rule: "IAM002", Severity: "warning", RoleID: 1, Role: "viewers", PolicyID: 2, Message: "policy 2 is shadowed by deny policy 3"},
+				{Rule: "IAM003", Severity: "warning", RoleID: 1, Role: "viewers", PolicyID: 2, Message: "policy 2 duplicates policy 1"},
+				{Rule: "IAM002", Severity: "warning", RoleID: 1, Role: "viewers", PolicyID: 4, Message: "policy 4 is shadowed by deny policy 3"},
+			},
+		},
+		{
+			name: "unmatched zones",
+			rs: []*RolePolicies{{RoleID: 1, Role: "viewers", Policies: []*roles.RolePolicy{
+				policy(1, EffectAllow, "oso:0:zone/baz.org", "view"),
+				policy(2, EffectAllow, "oso:0:zone/*.com", "view"),
+				withCondition(policy(3, EffectAllow, "oso:0:zone/*", "view"), &roles.Condition{ID: 1, Type: "matchSuffix", Value: "org"}),
+				withCondition(policy(4, EffectAllow, "oso:0:zone/*", "view"), &roles.Condition{ID: 2, Type: "matchSuffix", Value: "net"}),
+			}}},
+			exp: []Finding{
+				{Rule: "IAM004", Severity: "warning", RoleID: 1, Role: "viewers", PolicyID: 1, Message: "policy 1 on oso:0:zone/baz.org matches no zone"},
+				{Rule: "IAM004", Severity: "warning", RoleID: 1, Role: "viewers", PolicyID: 2, Message: "policy 2 on oso:0:zone/*.com matches no zone"},
+				{Rule: "IAM004", Severity: "warning", RoleID: 1, Role: "viewers", PolicyID: 3, Message: "policy 3 on oso:0:zone/* matches no zone"},
+			},
+		},
+		{
+			name: "unknown condition",
+			rs: []*RolePolicies{{RoleID: 1, Role: "viewers", Policies: []*roles.RolePolicy{
+				withCondition(policy(1, EffectAllow, "oso:0:zone/*", "view"), &roles.Condition{ID: 1, Type: "matchPrefix", Value: "foo"}),
+			}}},
+			exp: []Finding{
+				{Rule: "IAM005", Severity: "error", RoleID: 1, Role: "viewers", PolicyID: 1, Message: `condition 1 of policy 1 has unknown type "matchPrefix"`},
+			},
+		},
+		{
+			name: "unknown actions",
+			rs: []*RolePolicies{{RoleID: 1, Role: "viewers", Policies: []*roles.RolePolicy{
+				policy(1, EffectAllow, "oso:0:zone/foo.com", "veiw", "view", "iam:Get*"),
+				policy(2, EffectAllow, "oso:0:incident/42", "resolve"),
+			}}},
+			exp: []Finding{
+				{Rule: "IAM006", Severity: "error", RoleID: 1, Role: "viewers", PolicyID: 1, Message: `action "iam:Get*" of policy 1 matches no zone action`},
+				{Rule: "IAM006", Severity: "error", RoleID: 1, Role: "viewers", PolicyID: 1, Message: `action "veiw" of policy 1 matches no zone action`},
+			},
+		},
+		{
+			name: "not actions and not resources",
+			rs: []*RolePolicies{{RoleID: 1, Role: "editors", Policies: []*roles.RolePolicy{
+				except(policy(1, EffectAllow, "oso:0:zone/*", "*"), []string{"delete"}),
+				except(policy(2, EffectAllow, "oso:0:zone/*", "*"), nil, "oso:0:zone/foo.com"),
+				policy(3, EffectAllow, "oso:0:zone/foo.com", "iam:*Access"),
+				except(policy(4, EffectDeny, "oso:0:zone/foo.com"), []string{"iam:ApproveAccess"}),
+				policy(5, EffectAllow, "oso:0:zone/foo.com", "view"),
+				except(policy(6, EffectDeny, "oso:0:zone/*", "*"), nil, "oso:0:zone/foo.com"),
+				policy(7, EffectAllow, "oso:0:zone/foo.com", "iam:ApproveAccess"),
+				except(policy(8, EffectAllow, "oso:0:zone/*", "view"), nil, "oso:0:zone/*.com", "oso:0:zone/*.net"),
+				except(policy(9, EffectAllow, "oso:0:zone/bar.net", "view"), []string{"veiw"}),
+			}}},
+			exp: []Finding{
+				{Rule: "IAM002", Severity: "warning", RoleID: 1, Role: "editors", PolicyID: 5, Message: "policy 5 is shadowed by deny policy 4"},
+				{Rule: "IAM004", Severity: "warning", RoleID: 1, Role: "editors", PolicyID: 8, Message: "policy 8 on oso:0:zone/* matches no zone"},
+				{Rule: "IAM006", Severity: "error", RoleID: 1, Role: "editors", PolicyID: 9, Message: `action "veiw" of policy 9 matches no zone action`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.exp, Lint(tt.rs, zones))
+		})
+	}
+}
+
+func TestGroupRolePolicies(t *testing.T) {
+	t.Parallel()
+	viewers := models.Role{RoleID: 2, Name: "viewers"}
+	admins := models.Role{RoleID: 1, Name: "admins"}
+	view := models.Policy{PolicyID: 1, Effect: EffectAllow, Actions: []string{"view"}, ResourceName: "oso:0:zone/*"}
+	drs := []*datastore.DenormalizedRole{
+		{Role: viewers, Policy: view, Condition: models.Condition{ConditionID: 1, Type: "matchSuffix", Value: "com"}},
+		{Role: viewers, Policy: view, Condition: models.Condition{ConditionID: 2, Type: "matchSuffix", Value: "net"}},
+		{Role: admins, Policy: view},
+	}
+
+	exp := []*RolePolicies{
+		{RoleID: 1, Role: "admins", Policies: []*roles.RolePolicy{
+			{ID: 1, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*", Conditions: map[int]*roles.Condition{}},
+		}},
+		{RoleID: 2, Role: "viewers", Policies: []*roles.RolePolicy{
+			{ID: 1, Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*", Conditions: map[int]*roles.Condition{
+				1: {ID: 1, Type: "matchSuffix", Value: "com"},
+				2: {ID: 2, Type: "matchSuffix", Value: "net"},
+			}},
+		}},
+	}
+	assert.Equal(t, exp, GroupRolePolicies(drs))
+}
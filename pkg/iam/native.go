@@ -0,0 +1,166 @@
+package iam
+
+import (
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/matchers"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"reflect"
+)
+
+type nativeAuthorizer struct{}
+
+// NewNativeAuthorizer returns an Authorizer that evaluates effective permissions in Go with the same semantics as
+// iam.polar, without a Polar VM.  Resources must be structs, or pointers to structs, with string ResourceName and Name
+// fields.
+func NewNativeAuthorizer() Authorizer {
+	return nativeAuthorizer{}
+}
+
+func (a nativeAuthorizer) IsAllowed(u *DerivedUser, action string, resource interface{}) (bool, error) {
+	allows, err := a.ApplicablePolicies(u, action, resource, EffectAllow)
+	if err != nil || len(allows) == 0 {
+		return false, err
+	}
+	denies, err := a.ApplicablePolicies(u, action, resource, EffectDeny)
+	if err != nil {
+		return false, err
+	}
+	return len(denies) == 0, nil
+}
+
+func (a nativeAuthorizer) ApplicablePolicies(u *DerivedUser, action string, resource interface{}, effect string) ([]*roles.RolePolicy, error) {
+	var cache datastore.PoliciesByNamespace
+	switch effect {
+	case EffectAllow:
+		cache = u.Permissions.AllowPolicies
+	case EffectDeny:
+		cache = u.Permissions.DenyPolicies
+	default:
+		return nil, nil
+	}
+
+	var policies []*roles.RolePolicy
+	for namespace, ps := range cache {
+		for _, p := range ps {
+			pe, err := a.EvaluatePolicy(namespace, p, action, resource)
+			if err != nil {
+				return nil, err
+			}
+			if pe.Applies() {
+				policies = append(policies, p)
+			}
+		}
+	}
+	sortPolicies(policies)
+	return policies, nil
+}
+
+func (a nativeAuthorizer) EvaluatePolicy(namespace string, p *roles.RolePolicy, action string, resource interface{}) (PolicyEvaluation, error) {
+	var err error
+	pe := PolicyEvaluation{Policy: p}
+	if pe.CoversResource, err = policyCoversResource(namespace, p, resource); err != nil {
+		return pe, err
+	}
+	if pe.PermitsAction, err = policyPermitsAction(p, action, resource); err != nil {
+		return pe, err
+	}
+	if pe.ConditionsHold, err = conditionsHold(p, resource); err != nil {
+		return pe, err
+	}
+	return pe, nil
+}
+
+// namespaceCoversResource returns true if policies in namespace apply to resource
+func namespaceCoversResource(namespace string, resource interface{}) (bool, error) {
+	rn, err := resourceAttribute(resource, "ResourceName")
+	if err != nil {
+		return false, err
+	}
+	return namespace == rn || roles.TypeWildcard{}.Covers(namespace, rn) || roles.ResourceHierarchy{}.Covers(namespace, rn), nil
+}
+
+// policyCoversResource returns true if policies in namespace apply to resource and p doesn't exclude it
+func policyCoversResource(namespace string, p *roles.RolePolicy, resource interface{}) (bool, error) {
+	covers, err := namespaceCoversResource(namespace, resource)
+	if err != nil || !covers {
+		return false, err
+	}
+	rn, err := resourceAttribute(resource, "ResourceName")
+	if err != nil {
+		return false, err
+	}
+	return !p.ExcludesResource(rn), nil
+}
+
+// policyPermitsAction returns true if p permits action, by name or alias, or if p is an allow policy, an action
+// implying action on resource.  A not action matching any name of action excludes it.
+func policyPermitsAction(p *roles.RolePolicy, action string, resource interface{}) (bool, error) {
+	rn, err := resourceAttribute(resource, "ResourceName")
+	if err != nil {
+		return false, err
+	}
+	names := catalog.Default.Names(rn, action)
+	for _, name := range names {
+		if p.ExcludesAction(name) {
+			return false, nil
+		}
+	}
+	if permitsAny(p, names) {
+		return true, nil
+	}
+	if p.Effect != EffectAllow {
+		return false, nil
+	}
+	for _, a := range catalog.Default.ImpliedBy(rn, action) {
+		if permitsAny(p, catalog.Default.Names(rn, a)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// permitsAny returns true if p permits any of names
+func permitsAny(p *roles.RolePolicy, names []string) bool {
+	for _, name := range names {
+		if p.PermitsAction(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionsHold returns true if all of p's conditions hold for resource.  Conditions of unknown types never hold.
+func conditionsHold(p *roles.RolePolicy, resource interface{}) (bool, error) {
+	for _, c := range p.Conditions {
+		if c.Type != "matchSuffix" {
+			return false, nil
+		}
+		suffix, ok := c.Value.(string)
+		if !ok {
+			return false, nil
+		}
+		name, err := resourceAttribute(resource, "Name")
+		if err != nil {
+			return false, err
+		}
+		if !(matchers.HasSuffix{}).Match(name, suffix) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// resourceAttribute returns the string field named attr of resource
+func resourceAttribute(resource interface{}, attr string) (string, error) {
+	v := reflect.Indirect(reflect.ValueOf(resource))
+	if v.Kind() != reflect.Struct {
+		return "", fmt.Errorf("resource of type %T has no attribute %s", resource, attr)
+	}
+	f := v.FieldByName(attr)
+	if !f.IsValid() || f.Kind() != reflect.String {
+		return "", fmt.Errorf("resource of type %T has no attribute %s", resource, attr)
+	}
+	return f.String(), nil
+}
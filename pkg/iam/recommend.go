@@ -0,0 +1,282 @@
+package iam
+
+import (
+	"context"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Access is an action a principal was allowed to perform on a resource
+type Access struct {
+	Action       string `json:"action"`
+	ResourceName string `json:"resource_name"`
+}
+
+// Recommendation is the least privilege allow policies for the access a user or role used over a window, and how
+// they differ from its current allow policies.  Deny policies are left as they are.
+type Recommendation struct {
+	Since time.Time `json:"since"`
+	// Used is the access used since Since
+	Used     []Access            `json:"used"`
+	Policies []policyfile.Policy `json:"policies"`
+	// Added are the recommended policies that aren't current policies, and Removed the current policies that aren't
+	// recommended
+	Added   []policyfile.Policy `json:"added"`
+	Removed []policyfile.Policy `json:"removed"`
+}
+
+// Recommend returns the least privilege allow policies granting used, to replace the allow policies in current, and
+// names the policies it adds after name.  Zones of the org orgID used with an action are collapsed to all of the
+// org's zones, oso:<orgID>:zone/*, when they're all of its zones, or to all of its zones with a matchSuffix
+// condition when exactly the zones with that suffix were used, so collapsing never grants an action on a zone that
+// wasn't used.  Other resources are never collapsed.
+func Recommend(name string, orgID int, current []policyfile.Policy, used []Access, zones models.ZoneSlice) *Recommendation {
+	rec := &Recommendation{Used: sortedAccess(used), Policies: []policyfile.Policy{}}
+
+	// resources each action was used on
+	byAction := map[string]map[string]bool{}
+	for _, a := range used {
+		if byAction[a.Action] == nil {
+			byAction[a.Action] = map[string]bool{}
+		}
+		byAction[a.Action][a.ResourceName] = true
+	}
+	// merge the actions allowed on the same resource and conditions
+	scopes := map[string]*policyfile.Policy{}
+	for action, rns := range byAction {
+		for _, s := range collapse(orgID, rns, zones) {
+			key := recommendedKey(s)
+			if scopes[key] == nil {
+				scope := s
+				scopes[key] = &scope
+			}
+			scopes[key].Actions = append(scopes[key].Actions, action)
+		}
+	}
+	for _, s := range scopes {
+		sort.Strings(s.Actions)
+		rec.Policies = append(rec.Policies, *s)
+	}
+	sortRecommended(rec.Policies)
+
+	// keep the names of current policies that are recommended as they are
+	allows := map[string]policyfile.Policy{}
+	for _, p := range current {
+		if p.Effect == EffectAllow {
+			allows[recommendedKey(p)] = p
+		}
+	}
+	recommended := map[string]bool{}
+	for i, p := range rec.Policies {
+		key := recommendedKey(p)
+		recommended[key] = true
+		if c, ok := allows[key]; ok {
+			rec.Policies[i] = c
+			continue
+		}
+		rec.Policies[i].Name = fmt.Sprintf("%s-least-privilege-%d", name, len(rec.Added)+1)
+		rec.Added = append(rec.Added, rec.Policies[i])
+	}
+	for _, p := range current {
+		if p.Effect == EffectAllow && !recommended[recommendedKey(p)] {
+			rec.Removed = append(rec.Removed, p)
+		}
+	}
+	if rec.Added == nil {
+		rec.Added = []policyfile.Policy{}
+	}
+	if rec.Removed == nil {
+		rec.Removed = []policyfile.Policy{}
+	}
+	return rec
+}
+
+// RecommendForUser recommends least privilege policies for u from the decisions allowed for u since since
+func RecommendForUser(ctx context.Context, ds datastore.Datastore, admin datastore.Admin, u *models.User, since time.Time) (*Recommendation, error) {
+	tree, err := ds.GetOrgTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	drs, err := ds.GetUserRolesAndPolicies(ctx, u, tree)
+	if err != nil {
+		return nil, err
+	}
+	var current []policyfile.Policy
+	seen := map[int]bool{}
+	for _, dr := range drs {
+		if seen[dr.PolicyID] {
+			continue
+		}
+		seen[dr.PolicyID] = true
+		p, err := loadPolicy(ctx, admin, &dr.Policy)
+		if err != nil {
+			return nil, err
+		}
+		current = append(current, p)
+	}
+	return recommend(ctx, ds, admin, u.Name, current, datastore.DecisionFilter{OrgID: u.OrgID, UserID: u.UserID, Since: since})
+}
+
+// RecommendForRole recommends least privilege policies for r from the decisions its allow policies applied to since
+// since
+func RecommendForRole(ctx context.Context, ds datastore.Datastore, admin datastore.Admin, r *models.Role, since time.Time) (*Recommendation, error) {
+	ps, err := admin.ListPoliciesByRoleID(ctx, r.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	var current []policyfile.Policy
+	f := datastore.DecisionFilter{OrgID: r.OrgID, Since: since}
+	for _, mp := range ps {
+		p, err := loadPolicy(ctx, admin, mp)
+		if err != nil {
+			return nil, err
+		}
+		current = append(current, p)
+		if p.Effect == EffectAllow {
+			f.PolicyIDs = append(f.PolicyIDs, p.ID)
+		}
+	}
+	if len(f.PolicyIDs) == 0 {
+		// without allow policies the role was used for nothing, but an empty filter would select every decision
+		return Recommend(r.Name, r.OrgID, current, nil, nil), nil
+	}
+	return recommend(ctx, ds, admin, r.Name, current, f)
+}
+
+// recommend recommends policies replacing current from the allowed decisions selected by f
+func recommend(ctx context.Context, ds datastore.Datastore, admin datastore.Admin, name string, current []policyfile.Policy, f datastore.DecisionFilter) (*Recommendation, error) {
+	decisions, err := admin.ListDecisions(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	zs, err := ds.ListZonesByOrgID(ctx, f.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	var used []Access
+	seen := map[Access]bool{}
+	for _, d := range decisions {
+		a := Access{Action: d.Action, ResourceName: d.ResourceName}
+		if d.Allowed && !seen[a] {
+			seen[a] = true
+			used = append(used, a)
+		}
+	}
+	rec := Recommend(name, f.OrgID, current, used, *zs)
+	rec.Since = f.Since
+	return rec, nil
+}
+
+// loadPolicy loads the conditions of p from admin
+func loadPolicy(ctx context.Context, admin datastore.Admin, p *models.Policy) (policyfile.Policy, error) {
+	cs, err := admin.ListConditionsByPolicyID(ctx, p.PolicyID)
+	if err != nil {
+		return policyfile.Policy{}, err
+	}
+	return policyfile.PolicyFromModel(p, cs), nil
+}
+
+// collapse returns the scopes, policies without actions, that cover exactly rns.  Zones of the org orgID are collapsed
+// to the org's zone wildcard when that doesn't cover any other zone.
+func collapse(orgID int, rns map[string]bool, zones models.ZoneSlice) []policyfile.Policy {
+	var orgZones, used []*models.Zone
+	for _, z := range zones {
+		if z.OrgID != orgID {
+			continue
+		}
+		orgZones = append(orgZones, z)
+		if rns[z.ResourceName] {
+			used = append(used, z)
+		}
+	}
+	wildcard := fmt.Sprintf("oso:%d:zone/*", orgID)
+	if len(used) > 1 {
+		if len(used) == len(orgZones) {
+			return append(exactScopes(rns, used), policyfile.Policy{Effect: EffectAllow, Resource: wildcard})
+		}
+		if suffix := commonSuffix(used, orgZones); suffix != "" {
+			return append(exactScopes(rns, used), policyfile.Policy{
+				Effect: EffectAllow, Resource: wildcard,
+				Conditions: []policyfile.Condition{{Type: "matchSuffix", Value: suffix}},
+			})
+		}
+	}
+	return exactScopes(rns, nil)
+}
+
+// exactScopes returns a scope for each of rns other than the resource names of collapsed
+func exactScopes(rns map[string]bool, collapsed []*models.Zone) []policyfile.Policy {
+	skip := map[string]bool{}
+	for _, z := range collapsed {
+		skip[z.ResourceName] = true
+	}
+	var scopes []policyfile.Policy
+	for rn := range rns {
+		if !skip[rn] {
+			scopes = append(scopes, policyfile.Policy{Effect: EffectAllow, Resource: rn})
+		}
+	}
+	return scopes
+}
+
+// commonSuffix returns the longest domain suffix, e.g. ".example.com", shared by the names of used and no other zone,
+// or "" if there's none
+func commonSuffix(used, zones []*models.Zone) string {
+	name := used[0].Name
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		suffix := name[i:]
+		matches := 0
+		for _, z := range zones {
+			if strings.HasSuffix(z.Name, suffix) {
+				matches++
+			}
+		}
+		shared := true
+		for _, z := range used {
+			shared = shared && strings.HasSuffix(z.Name, suffix)
+		}
+		if shared && matches == len(used) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// recommendedKey identifies what an allow policy allows, whatever its name
+func recommendedKey(p policyfile.Policy) string {
+	actions := append([]string{}, p.Actions...)
+	sort.Strings(actions)
+	conds := make([]string, len(p.Conditions))
+	for i, c := range p.Conditions {
+		conds[i] = c.Type + "=" + c.Value
+	}
+	sort.Strings(conds)
+	return fmt.Sprintf("%s|%s|%s", p.Resource, strings.Join(actions, ","), strings.Join(conds, ","))
+}
+
+// sortRecommended orders ps by resource, conditions and actions
+func sortRecommended(ps []policyfile.Policy) {
+	sort.Slice(ps, func(i, j int) bool {
+		return recommendedKey(ps[i]) < recommendedKey(ps[j])
+	})
+}
+
+// sortedAccess returns used ordered by resource and action
+func sortedAccess(used []Access) []Access {
+	sorted := append([]Access{}, used...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ResourceName != sorted[j].ResourceName {
+			return sorted[i].ResourceName < sorted[j].ResourceName
+		}
+		return sorted[i].Action < sorted[j].Action
+	})
+	return sorted
+}
@@ -0,0 +1,124 @@
+package iam
+
+import (
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRecommend(t *testing.T) {
+	t.Parallel()
+	zones := models.ZoneSlice{
+		{ZoneID: 1, Name: "foo.com", ResourceName: "oso:0:zone/foo.com"},
+		{ZoneID: 2, Name: "bar.com", ResourceName: "oso:0:zone/bar.com"},
+		{ZoneID: 3, Name: "baz.net", ResourceName: "oso:0:zone/baz.net"},
+		{ZoneID: 4, Name: "qux.com", OrgID: 1, ResourceName: "oso:1:zone/qux.com"},
+		{ZoneID: 5, Name: "lambda.com", OrgID: 1, ResourceName: "oso:1:zone/lambda.com"},
+	}
+	viewAll := policyfile.Policy{ID: 1, Name: "viewAll", Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*"}
+	deleteFoo := policyfile.Policy{ID: 2, Name: "deleteFoo", Effect: EffectAllow, Actions: []string{"delete"}, Resource: "oso:0:zone/foo.com"}
+	denyBaz := policyfile.Policy{ID: 3, Name: "denyBaz", Effect: EffectDeny, Actions: []string{"delete"}, Resource: "oso:0:zone/baz.net"}
+	anything := policyfile.Policy{ID: 4, Name: "anything", Effect: EffectAllow, Actions: []string{"*"}, Resource: "oso:0:zone/*"}
+
+	tests := []struct {
+		name        string
+		orgID       int
+		current     []policyfile.Policy
+		used        []Access
+		expPolicies []policyfile.Policy
+		expAdded    []policyfile.Policy
+		expRemoved  []policyfile.Policy
+	}{
+		{
+			name:    "all used",
+			current: []policyfile.Policy{viewAll, deleteFoo, denyBaz},
+			used: []Access{
+				{Action: "view", ResourceName: "oso:0:zone/foo.com"},
+				{Action: "view", ResourceName: "oso:0:zone/bar.com"},
+				{Action: "view", ResourceName: "oso:0:zone/baz.net"},
+				{Action: "delete", ResourceName: "oso:0:zone/foo.com"},
+			},
+			expPolicies: []policyfile.Policy{viewAll, deleteFoo},
+			expAdded:    []policyfile.Policy{},
+			expRemoved:  []policyfile.Policy{},
+		},
+		{
+			name:    "narrowed to used zones",
+			current: []policyfile.Policy{viewAll, deleteFoo},
+			used:    []Access{{Action: "view", ResourceName: "oso:0:zone/baz.net"}},
+			expPolicies: []policyfile.Policy{
+				{Name: "ops-least-privilege-1", Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/baz.net"},
+			},
+			expAdded: []policyfile.Policy{
+				{Name: "ops-least-privilege-1", Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/baz.net"},
+			},
+			expRemoved: []policyfile.Policy{viewAll, deleteFoo},
+		},
+		{
+			name:    "collapsed to suffix",
+			current: []policyfile.Policy{anything},
+			used: []Access{
+				{Action: "view", ResourceName: "oso:0:zone/foo.com"},
+				{Action: "view", ResourceName: "oso:0:zone/bar.com"},
+				{Action: "delete", ResourceName: "oso:0:zone/foo.com"},
+				{Action: "delete", ResourceName: "oso:0:zone/baz.net"},
+				{Action: "resolve", ResourceName: "oso:0:incident/42"},
+			},
+			expPolicies: []policyfile.Policy{
+				{Name: "ops-least-privilege-1", Effect: EffectAllow, Actions: []string{"resolve"}, Resource: "oso:0:incident/42"},
+				{Name: "ops-least-privilege-2", Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*",
+					Conditions: []policyfile.Condition{{Type: "matchSuffix", Value: ".com"}}},
+				{Name: "ops-least-privilege-3", Effect: EffectAllow, Actions: []string{"delete"}, Resource: "oso:0:zone/baz.net"},
+				{Name: "ops-least-privilege-4", Effect: EffectAllow, Actions: []string{"delete"}, Resource: "oso:0:zone/foo.com"},
+			},
+			expAdded: []policyfile.Policy{
+				{Name: "ops-least-privilege-1", Effect: EffectAllow, Actions: []string{"resolve"}, Resource: "oso:0:incident/42"},
+				{Name: "ops-least-privilege-2", Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:0:zone/*",
+					Conditions: []policyfile.Condition{{Type: "matchSuffix", Value: ".com"}}},
+				{Name: "ops-least-privilege-3", Effect: EffectAllow, Actions: []string{"delete"}, Resource: "oso:0:zone/baz.net"},
+				{Name: "ops-least-privilege-4", Effect: EffectAllow, Actions: []string{"delete"}, Resource: "oso:0:zone/foo.com"},
+			},
+			expRemoved: []policyfile.Policy{anything},
+		},
+		{
+			name:    "collapsed to zones of org",
+			orgID:   1,
+			current: []policyfile.Policy{},
+			used: []Access{
+				{Action: "view", ResourceName: "oso:1:zone/qux.com"},
+				{Action: "view", ResourceName: "oso:1:zone/lambda.com"},
+			},
+			expPolicies: []policyfile.Policy{
+				{Name: "ops-least-privilege-1", Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:1:zone/*"},
+			},
+			expAdded: []policyfile.Policy{
+				{Name: "ops-least-privilege-1", Effect: EffectAllow, Actions: []string{"view"}, Resource: "oso:1:zone/*"},
+			},
+			expRemoved: []policyfile.Policy{},
+		},
+		{
+			name:        "nothing used",
+			current:     []policyfile.Policy{viewAll, denyBaz},
+			expPolicies: []policyfile.Policy{},
+			expAdded:    []policyfile.Policy{},
+			expRemoved:  []policyfile.Policy{viewAll},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := Recommend("ops", tt.orgID, tt.current, tt.used, zones)
+			assert.Equal(t, tt.expPolicies, rec.Policies)
+			assert.Equal(t, tt.expAdded, rec.Added)
+			assert.Equal(t, tt.expRemoved, rec.Removed)
+			assert.Len(t, rec.Used, len(tt.used))
+			for _, p := range rec.Policies {
+				assert.True(t, strings.HasPrefix(p.Resource, fmt.Sprintf("oso:%d:", tt.orgID)))
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package iam
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"sort"
+	"sync"
+)
+
+// UsageTracker tracks the allow policies, and the roles and API keys they were used through, that contribute to allowed
+// decisions.  Tracking only merges a decision into the usage pending in memory, so it's cheap enough for the hot path,
+// and the pending usage is written in batches by Flush.
+type UsageTracker struct {
+	write      func(ctx context.Context, us []*datastore.Usage) error
+	maxPending int
+	full       chan struct{}
+
+	mu      sync.Mutex
+	pending map[int]*datastore.Usage
+}
+
+// NewUsageTracker returns a UsageTracker that writes batches of usage with write, and signals Full when the usage of
+// maxPending users is pending
+func NewUsageTracker(write func(ctx context.Context, us []*datastore.Usage) error, maxPending int) *UsageTracker {
+	return &UsageTracker{
+		write: write, maxPending: maxPending, full: make(chan struct{}, 1), pending: map[int]*datastore.Usage{},
+	}
+}
+
+// Track tracks the usage of decision d if it was allowed
+func (t *UsageTracker) Track(d *datastore.Decision) {
+	if !d.Allowed {
+		return
+	}
+	ids := make([]int, len(d.PolicyIDs))
+	for i, id := range d.PolicyIDs {
+		ids[i] = int(id)
+	}
+	t.mu.Lock()
+	t.merge(&datastore.Usage{UserID: d.UserID, OrgID: d.OrgID, PolicyIDs: ids, UsedAt: d.OccurredAt})
+	full := len(t.pending) >= t.maxPending
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Full receives when the pending usage should be flushed before the next interval
+func (t *UsageTracker) Full() <-chan struct{} {
+	return t.full
+}
+
+// Flush writes the pending usage in one batch, ordered by user ID.  If the batch can't be written it's kept pending to
+// be written by the next flush.
+func (t *UsageTracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	batch := make([]*datastore.Usage, 0, len(t.pending))
+	for _, u := range t.pending {
+		batch = append(batch, u)
+	}
+	t.pending = map[int]*datastore.Usage{}
+	t.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		return batch[i].UserID < batch[j].UserID
+	})
+
+	err := t.write(ctx, batch)
+	if err != nil {
+		t.mu.Lock()
+		for _, u := range batch {
+			t.merge(u)
+		}
+		t.mu.Unlock()
+	}
+	return err
+}
+
+// merge merges u into the usage pending for its user.  t.mu must be held.
+func (t *UsageTracker) merge(u *datastore.Usage) {
+	p, ok := t.pending[u.UserID]
+	if !ok {
+		t.pending[u.UserID] = &datastore.Usage{
+			UserID: u.UserID, OrgID: u.OrgID, PolicyIDs: append([]int{}, u.PolicyIDs...), UsedAt: u.UsedAt,
+		}
+		return
+	}
+	if u.UsedAt.After(p.UsedAt) {
+		p.UsedAt = u.UsedAt
+	}
+	for _, id := range u.PolicyIDs {
+		if !containsInt(p.PolicyIDs, id) {
+			p.PolicyIDs = append(p.PolicyIDs, id)
+		}
+	}
+}
+
+// containsInt returns true if ids contains id
+func containsInt(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"testing"
+	"time"
+)
+
+func TestUsageTracker(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var written [][]*datastore.Usage
+	fail := true
+	tracker := NewUsageTracker(func(_ context.Context, us []*datastore.Usage) error {
+		if fail {
+			return errors.New("unavailable")
+		}
+		written = append(written, us)
+		return nil
+	}, 2)
+
+	tracker.Track(&datastore.Decision{UserID: 1, OrgID: 1, Allowed: true, PolicyIDs: types.Int64Array{1}, OccurredAt: now})
+	tracker.Track(&datastore.Decision{UserID: 1, OrgID: 1, Allowed: true, PolicyIDs: types.Int64Array{1, 2}, OccurredAt: now.Add(-time.Hour)})
+	tracker.Track(&datastore.Decision{UserID: 1, OrgID: 1, Allowed: false, PolicyIDs: types.Int64Array{}, OccurredAt: now.Add(time.Hour)})
+	select {
+	case <-tracker.Full():
+		t.Fatal("tracker full with the usage of one user")
+	default:
+	}
+
+	// usage that can't be written is kept for the next flush
+	assert.Error(t, tracker.Flush(context.Background()))
+	tracker.Track(&datastore.Decision{UserID: 2, OrgID: 2, Allowed: true, PolicyIDs: types.Int64Array{3}, OccurredAt: now})
+	select {
+	case <-tracker.Full():
+	default:
+		t.Fatal("tracker not full with the usage of two users")
+	}
+
+	fail = false
+	assert.NoError(t, tracker.Flush(context.Background()))
+	assert.Equal(t, [][]*datastore.Usage{{
+		{UserID: 1, OrgID: 1, PolicyIDs: []int{1, 2}, UsedAt: now},
+		{UserID: 2, OrgID: 2, PolicyIDs: []int{3}, UsedAt: now},
+	}}, written)
+
+	// nothing is written when nothing is pending
+	assert.NoError(t, tracker.Flush(context.Background()))
+	assert.Len(t, written, 1)
+}
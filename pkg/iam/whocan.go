@@ -0,0 +1,83 @@
+package iam
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"sort"
+)
+
+// Grant is a role bound to a user and the policy of it that allows an action
+type Grant struct {
+	RoleID   int    `json:"role_id"`
+	Role     string `json:"role"`
+	PolicyID int    `json:"policy_id"`
+	Policy   string `json:"policy"`
+}
+
+// Principal is a user allowed to perform an action and the grants that allow it
+type Principal struct {
+	UserID int     `json:"user_id"`
+	Name   string  `json:"name"`
+	Grants []Grant `json:"grants"`
+}
+
+// WhoCan decides with a which of us may perform action on resource, and returns them with the roles and policies
+// allowing each.  Users are only returned if a allows them, so conditions and deny policies apply as they would to a
+// request.
+func WhoCan(ctx context.Context, a Authorizer, ds datastore.Datastore, us models.UserSlice, action string, resource interface{}) ([]*Principal, error) {
+	tree, err := ds.GetOrgTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ps := []*Principal{}
+	for _, u := range us {
+		drs, err := ds.GetUserRolesAndPolicies(ctx, u, tree)
+		if err != nil {
+			return nil, err
+		}
+		du, err := withPrincipal(ctx, ds, u, datastore.ToEffectivePerms(drs), tree)
+		if err != nil {
+			return nil, err
+		}
+		allowed, err := a.IsAllowed(du, action, resource)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		allows, err := a.ApplicablePolicies(du, action, resource, EffectAllow)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, &Principal{UserID: u.UserID, Name: u.Name, Grants: grants(drs, allows)})
+	}
+	return ps, nil
+}
+
+// grants returns the roles in drs with one of the policies in ps, ordered by role and policy ID
+func grants(drs []*datastore.DenormalizedRole, ps []*roles.RolePolicy) []Grant {
+	ids := map[int]bool{}
+	for _, p := range ps {
+		ids[p.ID] = true
+	}
+	// drs holds a row per condition of each policy
+	seen := map[Grant]bool{}
+	gs := []Grant{}
+	for _, dr := range drs {
+		g := Grant{RoleID: dr.RoleID, Role: dr.Role.Name, PolicyID: dr.PolicyID, Policy: dr.Policy.Name}
+		if ids[dr.PolicyID] && !seen[g] {
+			seen[g] = true
+			gs = append(gs, g)
+		}
+	}
+	sort.Slice(gs, func(i, j int) bool {
+		if gs[i].RoleID != gs[j].RoleID {
+			return gs[i].RoleID < gs[j].RoleID
+		}
+		return gs[i].PolicyID < gs[j].PolicyID
+	})
+	return gs
+}
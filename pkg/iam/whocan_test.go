@@ -0,0 +1,180 @@
+package iam
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"testing"
+)
+
+// rolesDatastore is a datastore.Datastore that only knows the roles, policies and tags of each user and the org tree
+type rolesDatastore struct {
+	datastore.Datastore
+	roles map[int][]*datastore.DenormalizedRole
+	tags  map[int]map[string]string
+	tree  roles.OrgTree
+}
+
+func (ds *rolesDatastore) GetUserRolesAndPolicies(_ context.Context, user *models.User, _ roles.OrgTree) ([]*datastore.DenormalizedRole, error) {
+	return ds.roles[user.UserID], nil
+}
+
+func (ds *rolesDatastore) ListUserTags(_ context.Context, userID int) (map[string]string, error) {
+	return ds.tags[userID], nil
+}
+
+func (ds *rolesDatastore) GetOrgTree(_ context.Context) (roles.OrgTree, error) {
+	return ds.tree, nil
+}
+
+func TestWhoCan(t *testing.T) {
+	o, err := NewOso("../../iam.polar")
+	require.NoError(t, err)
+
+	viewers := models.Role{RoleID: 1, Name: "viewers"}
+	zoneAdmins := models.Role{RoleID: 2, Name: "zoneAdmins"}
+	auditors := models.Role{RoleID: 3, Name: "auditors"}
+	restricted := models.Role{RoleID: 4, Name: "restricted"}
+	teams := models.Role{RoleID: 5, Name: "teams"}
+	viewAll := models.Policy{PolicyID: 1, Name: "viewAll", Effect: EffectAllow, Actions: types.StringArray{"view"}, ResourceName: "oso:0:zone/*"}
+	anyOnFoo := models.Policy{PolicyID: 2, Name: "anyOnFoo", Effect: EffectAllow, Actions: types.StringArray{"*"}, ResourceName: "oso:0:zone/foo.com"}
+	denyDeleteFoo := models.Policy{PolicyID: 3, Name: "denyDeleteFoo", Effect: EffectDeny, Actions: types.StringArray{"delete"}, ResourceName: "oso:0:zone/foo.com"}
+	viewCom := models.Policy{PolicyID: 4, Name: "viewCom", Effect: EffectAllow, Actions: types.StringArray{"view"}, ResourceName: "oso:0:zone/*"}
+	viewTeam := models.Policy{PolicyID: 5, Name: "viewTeam", Effect: EffectAllow, Actions: types.StringArray{"view"},
+		ResourceName: "oso:0:zone/${principal.tag/team}.net"}
+	com := models.Condition{ConditionID: 1, Type: "matchSuffix", Value: "com"}
+
+	ds := &rolesDatastore{
+		roles: map[int][]*datastore.DenormalizedRole{
+			1: {{Role: viewers, Policy: viewAll}},
+			2: {{Role: zoneAdmins, Policy: anyOnFoo}, {Role: auditors, Policy: viewCom, Condition: com}},
+			3: {{Role: zoneAdmins, Policy: anyOnFoo}, {Role: restricted, Policy: denyDeleteFoo}},
+			// otis has no team tag, so the policy matches nothing
+			4: {{Role: teams, Policy: viewTeam}},
+			5: {{Role: teams, Policy: viewTeam}},
+		},
+		tags: map[int]map[string]string{4: {"team": "bar"}},
+	}
+	us := models.UserSlice{
+		{UserID: 1, Name: "guybrush"}, {UserID: 2, Name: "elaine"}, {UserID: 3, Name: "lechuck"}, {UserID: 4, Name: "stan"},
+		{UserID: 5, Name: "otis"},
+	}
+	foo, err := roles.NewExternalResource("oso:0:zone/foo.com", nil)
+	require.NoError(t, err)
+	bar, err := roles.NewExternalResource("oso:0:zone/bar.net", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		action   string
+		resource interface{}
+		exp      []*Principal
+	}{
+		{
+			name:     "grants of each allowed user",
+			action:   "view",
+			resource: foo,
+			exp: []*Principal{
+				{UserID: 1, Name: "guybrush", Grants: []Grant{{RoleID: 1, Role: "viewers", PolicyID: 1, Policy: "viewAll"}}},
+				{UserID: 2, Name: "elaine", Grants: []Grant{
+					{RoleID: 2, Role: "zoneAdmins", PolicyID: 2, Policy: "anyOnFoo"},
+					{RoleID: 3, Role: "auditors", PolicyID: 4, Policy: "viewCom"},
+				}},
+				{UserID: 3, Name: "lechuck", Grants: []Grant{{RoleID: 2, Role: "zoneAdmins", PolicyID: 2, Policy: "anyOnFoo"}}},
+			},
+		},
+		{
+			name:     "deny overrides",
+			action:   "delete",
+			resource: foo,
+			exp: []*Principal{
+				{UserID: 2, Name: "elaine", Grants: []Grant{{RoleID: 2, Role: "zoneAdmins", PolicyID: 2, Policy: "anyOnFoo"}}},
+			},
+		},
+		{
+			name:     "conditions evaluated and variables substituted",
+			action:   "view",
+			resource: bar,
+			exp: []*Principal{
+				{UserID: 1, Name: "guybrush", Grants: []Grant{{RoleID: 1, Role: "viewers", PolicyID: 1, Policy: "viewAll"}}},
+				{UserID: 4, Name: "stan", Grants: []Grant{{RoleID: 5, Role: "teams", PolicyID: 5, Policy: "viewTeam"}}},
+			},
+		},
+		{
+			name:     "nobody",
+			action:   "create",
+			resource: bar,
+			exp:      []*Principal{},
+		},
+	}
+
+	authorizers := map[string]Authorizer{
+		"oso":    NewOsoAuthorizer(o),
+		"native": NewNativeAuthorizer(),
+	}
+	for name, a := range authorizers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				ps, err := WhoCan(context.Background(), a, ds, us, tt.action, tt.resource)
+				require.NoError(t, err)
+				assert.Equal(t, tt.exp, ps)
+			})
+		}
+	}
+}
+
+func TestWhoCan_orgHierarchy(t *testing.T) {
+	o, err := NewOso("../../iam.polar")
+	require.NoError(t, err)
+
+	// the zone admins of org 1 may do anything to its zones, but a guardrail bound to org 2 denies deleting them
+	zoneAdmins := models.Role{RoleID: 1, Name: "zoneAdmins", OrgID: 1}
+	guardrails := models.Role{RoleID: 2, Name: "guardrails", OrgID: 2}
+	anyZone := models.Policy{PolicyID: 1, Name: "anyZone", Effect: EffectAllow, Actions: types.StringArray{"*"}, ResourceName: "oso:1:zone/*"}
+	denyDelete := models.Policy{PolicyID: 2, Name: "denyDelete", Effect: EffectDeny, Actions: types.StringArray{"delete"},
+		ResourceName: "oso:2:zone/*"}
+	ds := &rolesDatastore{
+		roles: map[int][]*datastore.DenormalizedRole{
+			1: {{Role: zoneAdmins, Policy: anyZone}},
+			2: {{Role: zoneAdmins, Policy: anyZone}, {Role: guardrails, Policy: denyDelete}},
+		},
+		// the OU 3 is under 2, which is under 1.  4 is a root.
+		tree: roles.OrgTree{2: 1, 3: 2},
+	}
+	us := models.UserSlice{{UserID: 1, Name: "guybrush", OrgID: 1}, {UserID: 2, Name: "elaine", OrgID: 3}}
+	foo, err := roles.NewExternalResource("oso:3:zone/foo.com", nil)
+	require.NoError(t, err)
+	guybrush := []*Principal{{UserID: 1, Name: "guybrush", Grants: []Grant{{RoleID: 1, Role: "zoneAdmins", PolicyID: 1, Policy: "anyZone"}}}}
+	both := append(guybrush, &Principal{UserID: 2, Name: "elaine", Grants: []Grant{{RoleID: 1, Role: "zoneAdmins", PolicyID: 1, Policy: "anyZone"}}})
+
+	tests := []struct {
+		name   string
+		tree   roles.OrgTree
+		action string
+		exp    []*Principal
+	}{
+		{name: "policies flow down to grandchild", tree: ds.tree, action: "view", exp: both},
+		{name: "guardrails flow down to child", tree: ds.tree, action: "delete", exp: guybrush},
+		{name: "OU moved from under 2 to under 1", tree: roles.OrgTree{2: 1, 3: 1}, action: "delete", exp: both},
+		{name: "OU moved to another root", tree: roles.OrgTree{2: 1, 3: 4}, action: "view", exp: []*Principal{}},
+	}
+
+	authorizers := map[string]Authorizer{
+		"oso":    NewOsoAuthorizer(o),
+		"native": NewNativeAuthorizer(),
+	}
+	for name, a := range authorizers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				ds.tree = tt.tree
+				ps, err := WhoCan(context.Background(), a, ds, us, tt.action, foo)
+				require.NoError(t, err)
+				assert.Equal(t, tt.exp, ps)
+			})
+		}
+	}
+}
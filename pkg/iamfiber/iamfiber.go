@@ -0,0 +1,89 @@
+package iamfiber
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+)
+
+// APIKeyHeader is the request header holding the requester's API key
+const APIKeyHeader = "x-api-key"
+
+const resourceKey = "iamfiber.resource"
+
+var errMissingResource = errors.New("resource not found in request context")
+
+// Config configures the enforcement middleware
+type Config struct {
+	// Enforcer authorizes requests with the IAM policy
+	Enforcer *iam.Enforcer
+	// ErrorHandler responds to a request that failed authentication or authorization.  Defaults to responding with
+	// the error's status code and message.
+	ErrorHandler func(c *fiber.Ctx, err *iam.Error) error
+}
+
+// Middleware enforces IAM permissions on fiber routes
+type Middleware struct {
+	cfg Config
+}
+
+// New returns enforcement middleware configured with cfg
+func New(cfg Config) *Middleware {
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = func(c *fiber.Ctx, err *iam.Error) error {
+			return c.Status(err.Status).SendString(err.Error())
+		}
+	}
+	return &Middleware{cfg: cfg}
+}
+
+// Authenticate resolves the API key in the request's x-api-key header to a derived user with authenticator and
+// saves it in the request's user context.  Responds 401 if the user can't be found.
+func (m *Middleware) Authenticate(authenticator iam.Authenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		u, err := authenticator.Authenticate(c.UserContext(), c.Get(APIKeyHeader, ""))
+		if err != nil {
+			return m.cfg.ErrorHandler(c, &iam.Error{Status: fiber.StatusUnauthorized, Err: err})
+		}
+		c.SetUserContext(iam.WithDerivedUser(c.UserContext(), u))
+		return c.Next()
+	}
+}
+
+// Require loads the resource the request acts on with loader and only continues if the authenticated user may
+// perform action on it.  The loaded resource is available to later handlers with Resource.  Responds 404 if the
+// resource doesn't exist or the user can't view it, and 403 if the user can view it but not perform action and the
+// resource type's disclosure policy reveals forbidden resources.
+func (m *Middleware) Require(action string, loader iam.ResourceLoader[*fiber.Ctx]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := User(c); err != nil {
+			return m.cfg.ErrorHandler(c, &iam.Error{Status: fiber.StatusUnauthorized, Err: err})
+		}
+
+		r, err := loader.Load(c)
+		if err != nil {
+			return m.cfg.ErrorHandler(c, &iam.Error{Status: fiber.StatusNotFound, ResourceType: loader.Type(), Err: err})
+		}
+
+		if err := m.cfg.Enforcer.Authorize(c.UserContext(), action, loader.Type(), r); err != nil {
+			return m.cfg.ErrorHandler(c, &iam.Error{Status: iam.HTTPStatus(err), ResourceType: loader.Type(), Err: err})
+		}
+
+		c.Locals(resourceKey, r)
+		return c.Next()
+	}
+}
+
+// User returns the derived user saved in the request's user context by Authenticate
+func User(c *fiber.Ctx) (*iam.DerivedUser, error) {
+	return iam.DerivedUserFromContext(c.UserContext())
+}
+
+// Resource returns the resource loaded by Require
+func Resource(c *fiber.Ctx) (interface{}, error) {
+	r := c.Locals(resourceKey)
+	if r == nil {
+		return nil, errMissingResource
+	}
+	return r, nil
+}
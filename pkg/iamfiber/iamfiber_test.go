@@ -0,0 +1,173 @@
+package iamfiber
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/osohq/go-oso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// Doc is a resource for testing
+type Doc struct {
+	Name      string
+	Viewable  bool
+	Deletable bool
+}
+
+var docs = map[string]*Doc{
+	"public":   {Name: "public", Viewable: true, Deletable: true},
+	"readonly": {Name: "readonly", Viewable: true},
+	"secret":   {Name: "secret"},
+}
+
+const testPolicy = `
+allow(_user: DerivedUser, "view", doc: Doc) if doc.Viewable;
+allow(_user: DerivedUser, "delete", doc: Doc) if doc.Deletable;
+`
+
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Authenticate(_ context.Context, apiKey string) (*iam.DerivedUser, error) {
+	if apiKey == "" {
+		return nil, iam.ErrMissingAPIKey
+	}
+	if apiKey != "guybrush" {
+		return nil, iam.ErrUserNotFound
+	}
+	return &iam.DerivedUser{User: &models.User{UserID: 1, Name: apiKey}}, nil
+}
+
+func newTestOso(t *testing.T) oso.Oso {
+	o, err := oso.NewOso()
+	require.NoError(t, err)
+	o.SetReadAction(iam.ReadAction)
+	require.NoError(t, o.RegisterClass(reflect.TypeOf(iam.DerivedUser{}), nil))
+	require.NoError(t, o.RegisterClass(reflect.TypeOf(Doc{}), nil))
+	require.NoError(t, o.LoadString(testPolicy))
+	return o
+}
+
+var docLoader = iam.LoaderFunc("doc", func(c *fiber.Ctx) (interface{}, error) {
+	if d, ok := docs[c.Params("name")]; ok {
+		return d, nil
+	}
+	return nil, errors.New("doc not found")
+})
+
+func newTestApp(t *testing.T, policy iam.DisclosurePolicy) *fiber.App {
+	mw := New(Config{
+		Enforcer: iam.NewEnforcer(iam.EnforcerConfig{
+			Authorizer:         iam.NewOsoAuthorizer(newTestOso(t)),
+			DisclosurePolicies: map[string]iam.DisclosurePolicy{"doc": policy},
+		}),
+	})
+	app := fiber.New()
+	app.Use(mw.Authenticate(fakeAuthenticator{}))
+	handler := func(c *fiber.Ctx) error {
+		u, err := User(c)
+		if err != nil {
+			return err
+		}
+		r, err := Resource(c)
+		if err != nil {
+			return err
+		}
+		return c.SendString(u.User.Name + ":" + r.(*Doc).Name)
+	}
+	app.Get("/doc/:name", mw.Require("view", docLoader), handler)
+	app.Delete("/doc/:name", mw.Require("delete", docLoader), handler)
+	return app
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  iam.DisclosurePolicy
+		method  string
+		route   string
+		apiKey  string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "allowed",
+			method:  "GET",
+			route:   "/doc/readonly",
+			apiKey:  "guybrush",
+			expCode: 200,
+			expBody: "guybrush:readonly",
+		},
+		{
+			name:    "missing api key",
+			method:  "GET",
+			route:   "/doc/readonly",
+			expCode: 401,
+			expBody: iam.ErrMissingAPIKey.Error(),
+		},
+		{
+			name:    "unknown api key",
+			method:  "GET",
+			route:   "/doc/readonly",
+			apiKey:  "lechuck",
+			expCode: 401,
+			expBody: iam.ErrUserNotFound.Error(),
+		},
+		{
+			name:    "missing resource",
+			method:  "GET",
+			route:   "/doc/missing",
+			apiKey:  "guybrush",
+			expCode: 404,
+			expBody: "doc not found",
+		},
+		{
+			name:    "not viewable",
+			policy:  iam.RevealForbidden,
+			method:  "DELETE",
+			route:   "/doc/secret",
+			apiKey:  "guybrush",
+			expCode: 404,
+		},
+		{
+			name:    "viewable but forbidden revealed",
+			policy:  iam.RevealForbidden,
+			method:  "DELETE",
+			route:   "/doc/readonly",
+			apiKey:  "guybrush",
+			expCode: 403,
+		},
+		{
+			name:    "viewable but forbidden concealed",
+			policy:  iam.ConcealForbidden,
+			method:  "DELETE",
+			route:   "/doc/readonly",
+			apiKey:  "guybrush",
+			expCode: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, tt.policy)
+			req, _ := http.NewRequest(tt.method, tt.route, nil)
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			if tt.expBody != "" {
+				body, err := ioutil.ReadAll(res.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expBody, string(body))
+			}
+		})
+	}
+}
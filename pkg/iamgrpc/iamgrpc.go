@@ -0,0 +1,163 @@
+package iamgrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyMetadataKey is the gRPC metadata key holding the caller's API key
+const APIKeyMetadataKey = "x-api-key"
+
+type resourceKeyType string
+
+const resourceKey resourceKeyType = "iamgrpc.resource"
+
+var errMissingResource = errors.New("resource not found in context")
+
+// Config configures the enforcement interceptors
+type Config struct {
+	// Enforcer authorizes calls with the IAM policy
+	Enforcer *iam.Enforcer
+	// Rules is the authorization rule for each full method name, such as "/authz.v1.AuthzService/Check".  Methods
+	// without a rule only require authentication.
+	Rules map[string]Rule
+}
+
+// Rule requires the caller of a method be allowed to perform Action on the resource loaded by Loader
+type Rule struct {
+	Action string
+	Loader ResourceLoader
+}
+
+// ResourceLoader loads the resource a call acts on
+type ResourceLoader interface {
+	// Type is the type of resource loaded, used to look up its disclosure policy
+	Type() string
+	// Load returns the resource the call with request message req acts on, or an error if it doesn't exist.  req is
+	// nil for streaming calls, which are authorized before any message is received.
+	Load(ctx context.Context, req interface{}) (interface{}, error)
+}
+
+type loaderFunc struct {
+	rType string
+	load  func(ctx context.Context, req interface{}) (interface{}, error)
+}
+
+func (lf loaderFunc) Type() string {
+	return lf.rType
+}
+
+func (lf loaderFunc) Load(ctx context.Context, req interface{}) (interface{}, error) {
+	return lf.load(ctx, req)
+}
+
+// LoaderFunc returns a ResourceLoader of resources of type rType that loads with load
+func LoaderFunc(rType string, load func(ctx context.Context, req interface{}) (interface{}, error)) ResourceLoader {
+	return loaderFunc{rType: rType, load: load}
+}
+
+// Middleware enforces IAM permissions on gRPC methods
+type Middleware struct {
+	cfg Config
+}
+
+// New returns enforcement middleware configured with cfg
+func New(cfg Config) *Middleware {
+	if cfg.Rules == nil {
+		cfg.Rules = map[string]Rule{}
+	}
+	return &Middleware{cfg: cfg}
+}
+
+// UnaryServerInterceptor returns an interceptor that resolves the API key in the call's x-api-key metadata to a
+// derived user with authenticator, then enforces the rule for the method, if any.  Fails with Unauthenticated if the
+// user can't be found, NotFound if the resource doesn't exist or the user can't view it, and PermissionDenied if the
+// user can view it but not perform the action and the resource type's disclosure policy reveals forbidden resources.
+func (m *Middleware) UnaryServerInterceptor(authenticator iam.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := m.enforce(ctx, authenticator, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns the streaming equivalent of UnaryServerInterceptor.  The rule for the method is
+// enforced before any message is received, so its loader is called with a nil request.
+func (m *Middleware) StreamServerInterceptor(authenticator iam.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := m.enforce(ss.Context(), authenticator, info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// enforce authenticates the caller of method and enforces the method's rule, returning a copy of ctx carrying the
+// derived user and any loaded resource
+func (m *Middleware) enforce(ctx context.Context, authenticator iam.Authenticator, method string, req interface{}) (context.Context, error) {
+	var apiKey string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(APIKeyMetadataKey); len(keys) > 0 {
+		apiKey = keys[0]
+	}
+	ctx, err := iam.Authenticate(ctx, authenticator, apiKey)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	rule, ok := m.cfg.Rules[method]
+	if !ok {
+		return ctx, nil
+	}
+	r, err := rule.Loader.Load(ctx, req)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err := m.cfg.Enforcer.Authorize(ctx, rule.Action, rule.Loader.Type(), r); err != nil {
+		return nil, status.Error(code(err), err.Error())
+	}
+	return context.WithValue(ctx, resourceKey, r), nil
+}
+
+// code returns the gRPC status code for an authentication or authorization failure
+func code(err error) codes.Code {
+	switch {
+	case errors.Is(err, iam.ErrMissingAPIKey), errors.Is(err, iam.ErrUserNotFound), errors.Is(err, iam.ErrMissingDerivedUser):
+		return codes.Unauthenticated
+	case errors.Is(err, iam.ErrForbidden):
+		return codes.PermissionDenied
+	}
+	return codes.NotFound
+}
+
+// serverStream is a grpc.ServerStream with the context set by enforcement
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// User returns the derived user saved in ctx by the interceptors
+func User(ctx context.Context) (*iam.DerivedUser, error) {
+	return iam.DerivedUserFromContext(ctx)
+}
+
+// Resource returns the resource loaded by the method's rule
+func Resource(ctx context.Context) (interface{}, error) {
+	r := ctx.Value(resourceKey)
+	if r == nil {
+		return nil, errMissingResource
+	}
+	return r, nil
+}
@@ -0,0 +1,179 @@
+package iamgrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/osohq/go-oso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"testing"
+)
+
+// Doc is a resource for testing
+type Doc struct {
+	Name      string
+	Viewable  bool
+	Deletable bool
+}
+
+var docs = map[string]*Doc{
+	"public":   {Name: "public", Viewable: true, Deletable: true},
+	"readonly": {Name: "readonly", Viewable: true},
+	"secret":   {Name: "secret"},
+}
+
+const testPolicy = `
+allow(_user: DerivedUser, "view", doc: Doc) if doc.Viewable;
+allow(_user: DerivedUser, "delete", doc: Doc) if doc.Deletable;
+`
+
+const (
+	getDocMethod    = "/docs.v1.DocService/GetDoc"
+	deleteDocMethod = "/docs.v1.DocService/DeleteDoc"
+	pingMethod      = "/docs.v1.DocService/Ping"
+)
+
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Authenticate(_ context.Context, apiKey string) (*iam.DerivedUser, error) {
+	if apiKey == "" {
+		return nil, iam.ErrMissingAPIKey
+	}
+	if apiKey != "guybrush" {
+		return nil, iam.ErrUserNotFound
+	}
+	return &iam.DerivedUser{User: &models.User{UserID: 1, Name: apiKey}}, nil
+}
+
+func newTestOso(t *testing.T) oso.Oso {
+	o, err := oso.NewOso()
+	require.NoError(t, err)
+	o.SetReadAction(iam.ReadAction)
+	require.NoError(t, o.RegisterClass(reflect.TypeOf(iam.DerivedUser{}), nil))
+	require.NoError(t, o.RegisterClass(reflect.TypeOf(Doc{}), nil))
+	require.NoError(t, o.LoadString(testPolicy))
+	return o
+}
+
+// docLoader loads the doc named by the request message, which is the doc's name
+var docLoader = LoaderFunc("doc", func(_ context.Context, req interface{}) (interface{}, error) {
+	name, _ := req.(string)
+	if d, ok := docs[name]; ok {
+		return d, nil
+	}
+	return nil, errors.New("doc not found")
+})
+
+func newTestInterceptor(t *testing.T, policy iam.DisclosurePolicy) grpc.UnaryServerInterceptor {
+	mw := New(Config{
+		Enforcer: iam.NewEnforcer(iam.EnforcerConfig{
+			Authorizer:         iam.NewOsoAuthorizer(newTestOso(t)),
+			DisclosurePolicies: map[string]iam.DisclosurePolicy{"doc": policy},
+		}),
+		Rules: map[string]Rule{
+			getDocMethod:    {Action: "view", Loader: docLoader},
+			deleteDocMethod: {Action: "delete", Loader: docLoader},
+		},
+	})
+	return mw.UnaryServerInterceptor(fakeAuthenticator{})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  iam.DisclosurePolicy
+		method  string
+		req     string
+		apiKey  string
+		expCode codes.Code
+		expRes  string
+	}{
+		{
+			name:   "allowed",
+			method: getDocMethod,
+			req:    "readonly",
+			apiKey: "guybrush",
+			expRes: "guybrush:readonly",
+		},
+		{
+			name:   "authenticated only",
+			method: pingMethod,
+			apiKey: "guybrush",
+			expRes: "guybrush",
+		},
+		{
+			name:    "missing api key",
+			method:  getDocMethod,
+			req:     "readonly",
+			expCode: codes.Unauthenticated,
+		},
+		{
+			name:    "unknown api key",
+			method:  pingMethod,
+			apiKey:  "lechuck",
+			expCode: codes.Unauthenticated,
+		},
+		{
+			name:    "missing resource",
+			method:  getDocMethod,
+			req:     "missing",
+			apiKey:  "guybrush",
+			expCode: codes.NotFound,
+		},
+		{
+			name:    "not viewable",
+			policy:  iam.RevealForbidden,
+			method:  deleteDocMethod,
+			req:     "secret",
+			apiKey:  "guybrush",
+			expCode: codes.NotFound,
+		},
+		{
+			name:    "viewable but forbidden revealed",
+			policy:  iam.RevealForbidden,
+			method:  deleteDocMethod,
+			req:     "readonly",
+			apiKey:  "guybrush",
+			expCode: codes.PermissionDenied,
+		},
+		{
+			name:    "viewable but forbidden concealed",
+			policy:  iam.ConcealForbidden,
+			method:  deleteDocMethod,
+			req:     "readonly",
+			apiKey:  "guybrush",
+			expCode: codes.NotFound,
+		},
+	}
+
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		u, err := User(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if r, err := Resource(ctx); err == nil {
+			return u.User.Name + ":" + r.(*Doc).Name, nil
+		}
+		return u.User.Name, nil
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := newTestInterceptor(t, tt.policy)
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(APIKeyMetadataKey, tt.apiKey))
+			res, err := interceptor(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+
+			assert.Equal(t, tt.expCode, status.Code(err))
+			if tt.expCode == codes.OK {
+				assert.Equal(t, tt.expRes, res)
+			}
+		})
+	}
+}
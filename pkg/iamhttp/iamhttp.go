@@ -0,0 +1,98 @@
+package iamhttp
+
+import (
+	"context"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"net/http"
+)
+
+// APIKeyHeader is the request header holding the requester's API key
+const APIKeyHeader = "x-api-key"
+
+type resourceKeyType string
+
+const resourceKey resourceKeyType = "iamhttp.resource"
+
+var errMissingResource = errors.New("resource not found in request context")
+
+// Config configures the enforcement middleware
+type Config struct {
+	// Enforcer authorizes requests with the IAM policy
+	Enforcer *iam.Enforcer
+	// ErrorHandler responds to a request that failed authentication or authorization.  Defaults to responding with
+	// the error's status code and message.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err *iam.Error)
+}
+
+// Middleware enforces IAM permissions on net/http handlers
+type Middleware struct {
+	cfg Config
+}
+
+// New returns enforcement middleware configured with cfg
+func New(cfg Config) *Middleware {
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err *iam.Error) {
+			http.Error(w, err.Error(), err.Status)
+		}
+	}
+	return &Middleware{cfg: cfg}
+}
+
+// Authenticate resolves the API key in the request's x-api-key header to a derived user with authenticator and
+// saves it in the request's context.  Responds 401 if the user can't be found.
+func (m *Middleware) Authenticate(authenticator iam.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := iam.Authenticate(r.Context(), authenticator, r.Header.Get(APIKeyHeader))
+			if err != nil {
+				m.cfg.ErrorHandler(w, r, &iam.Error{Status: http.StatusUnauthorized, Err: err})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Require loads the resource the request acts on with loader and only continues if the authenticated user may
+// perform action on it.  The loaded resource is available to later handlers with Resource.  Responds 404 if the
+// resource doesn't exist or the user can't view it, and 403 if the user can view it but not perform action and the
+// resource type's disclosure policy reveals forbidden resources.
+func (m *Middleware) Require(action string, loader iam.ResourceLoader[*http.Request]) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := User(r); err != nil {
+				m.cfg.ErrorHandler(w, r, &iam.Error{Status: http.StatusUnauthorized, Err: err})
+				return
+			}
+
+			res, err := loader.Load(r)
+			if err != nil {
+				m.cfg.ErrorHandler(w, r, &iam.Error{Status: http.StatusNotFound, ResourceType: loader.Type(), Err: err})
+				return
+			}
+
+			if err := m.cfg.Enforcer.Authorize(r.Context(), action, loader.Type(), res); err != nil {
+				m.cfg.ErrorHandler(w, r, &iam.Error{Status: iam.HTTPStatus(err), ResourceType: loader.Type(), Err: err})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resourceKey, res)))
+		})
+	}
+}
+
+// User returns the derived user saved in the request's context by Authenticate
+func User(r *http.Request) (*iam.DerivedUser, error) {
+	return iam.DerivedUserFromContext(r.Context())
+}
+
+// Resource returns the resource loaded by Require
+func Resource(r *http.Request) (interface{}, error) {
+	res := r.Context().Value(resourceKey)
+	if res == nil {
+		return nil, errMissingResource
+	}
+	return res, nil
+}
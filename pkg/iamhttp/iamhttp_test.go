@@ -0,0 +1,171 @@
+package iamhttp
+
+import (
+	"context"
+	"errors"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/osohq/go-oso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Doc is a resource for testing
+type Doc struct {
+	Name      string
+	Viewable  bool
+	Deletable bool
+}
+
+var docs = map[string]*Doc{
+	"public":   {Name: "public", Viewable: true, Deletable: true},
+	"readonly": {Name: "readonly", Viewable: true},
+	"secret":   {Name: "secret"},
+}
+
+const testPolicy = `
+allow(_user: DerivedUser, "view", doc: Doc) if doc.Viewable;
+allow(_user: DerivedUser, "delete", doc: Doc) if doc.Deletable;
+`
+
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Authenticate(_ context.Context, apiKey string) (*iam.DerivedUser, error) {
+	if apiKey == "" {
+		return nil, iam.ErrMissingAPIKey
+	}
+	if apiKey != "guybrush" {
+		return nil, iam.ErrUserNotFound
+	}
+	return &iam.DerivedUser{User: &models.User{UserID: 1, Name: apiKey}}, nil
+}
+
+func newTestOso(t *testing.T) oso.Oso {
+	o, err := oso.NewOso()
+	require.NoError(t, err)
+	o.SetReadAction(iam.ReadAction)
+	require.NoError(t, o.RegisterClass(reflect.TypeOf(iam.DerivedUser{}), nil))
+	require.NoError(t, o.RegisterClass(reflect.TypeOf(Doc{}), nil))
+	require.NoError(t, o.LoadString(testPolicy))
+	return o
+}
+
+var docLoader = iam.LoaderFunc("doc", func(r *http.Request) (interface{}, error) {
+	if d, ok := docs[strings.TrimPrefix(r.URL.Path, "/doc/")]; ok {
+		return d, nil
+	}
+	return nil, errors.New("doc not found")
+})
+
+func newTestHandler(t *testing.T, policy iam.DisclosurePolicy) http.Handler {
+	mw := New(Config{
+		Enforcer: iam.NewEnforcer(iam.EnforcerConfig{
+			Authorizer:         iam.NewOsoAuthorizer(newTestOso(t)),
+			DisclosurePolicies: map[string]iam.DisclosurePolicy{"doc": policy},
+		}),
+	})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := User(r)
+		require.NoError(t, err)
+		res, err := Resource(r)
+		require.NoError(t, err)
+		_, _ = w.Write([]byte(u.User.Name + ":" + res.(*Doc).Name))
+	})
+	view := mw.Require("view", docLoader)(handler)
+	del := mw.Require("delete", docLoader)(handler)
+	return mw.Authenticate(fakeAuthenticator{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			del.ServeHTTP(w, r)
+			return
+		}
+		view.ServeHTTP(w, r)
+	}))
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  iam.DisclosurePolicy
+		method  string
+		route   string
+		apiKey  string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "allowed",
+			method:  "GET",
+			route:   "/doc/readonly",
+			apiKey:  "guybrush",
+			expCode: 200,
+			expBody: "guybrush:readonly",
+		},
+		{
+			name:    "missing api key",
+			method:  "GET",
+			route:   "/doc/readonly",
+			expCode: 401,
+			expBody: iam.ErrMissingAPIKey.Error() + "\n",
+		},
+		{
+			name:    "unknown api key",
+			method:  "GET",
+			route:   "/doc/readonly",
+			apiKey:  "lechuck",
+			expCode: 401,
+			expBody: iam.ErrUserNotFound.Error() + "\n",
+		},
+		{
+			name:    "missing resource",
+			method:  "GET",
+			route:   "/doc/missing",
+			apiKey:  "guybrush",
+			expCode: 404,
+			expBody: "doc not found\n",
+		},
+		{
+			name:    "not viewable",
+			policy:  iam.RevealForbidden,
+			method:  "DELETE",
+			route:   "/doc/secret",
+			apiKey:  "guybrush",
+			expCode: 404,
+		},
+		{
+			name:    "viewable but forbidden revealed",
+			policy:  iam.RevealForbidden,
+			method:  "DELETE",
+			route:   "/doc/readonly",
+			apiKey:  "guybrush",
+			expCode: 403,
+		},
+		{
+			name:    "viewable but forbidden concealed",
+			policy:  iam.ConcealForbidden,
+			method:  "DELETE",
+			route:   "/doc/readonly",
+			apiKey:  "guybrush",
+			expCode: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.policy)
+			req := httptest.NewRequest(tt.method, tt.route, nil)
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expCode, rec.Code)
+			if tt.expBody != "" {
+				assert.Equal(t, tt.expBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package policyfile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Op is the operation a change makes
+type Op string
+
+const (
+	Create Op = "create"
+	Update Op = "update"
+	Delete Op = "delete"
+	Bind   Op = "bind"
+	Unbind Op = "unbind"
+)
+
+// Kind is the kind of object a change is made to
+type Kind string
+
+const (
+	KindOrg    Kind = "org"
+	KindPolicy Kind = "policy"
+	KindRole   Kind = "role"
+	KindUser   Kind = "user"
+)
+
+// Change is a single change to an object, or to the binding of an object to another
+type Change struct {
+	Op   Op   `json:"op"`
+	Kind Kind `json:"kind"`
+	// Name is the name of the object changed, or bound for Bind and Unbind
+	Name string `json:"name"`
+	// ID is the ID of the object in the database, or 0 if it's created by the plan
+	ID int `json:"id,omitempty"`
+	// Target and TargetID identify the object a policy or role is bound to or unbound from.  A policy is bound to a role
+	// and a role to a user.
+	Target   string `json:"target,omitempty"`
+	TargetID int    `json:"target_id,omitempty"`
+	// Policy and User are the desired state of a policy or user that's created or updated
+	Policy *Policy `json:"policy,omitempty"`
+	User   *User   `json:"-"`
+	// Diff describes the fields changed by an update
+	Diff []string `json:"diff,omitempty"`
+	// Managed is true for the binding of a managed policy, which is found by name when the plan is applied
+	Managed bool `json:"managed,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Op {
+	case Create:
+		return fmt.Sprintf("+ %s %s", c.Kind, c.Name)
+	case Update:
+		return fmt.Sprintf("~ %s %s (%s)", c.Kind, c.Name, strings.Join(c.Diff, ", "))
+	case Delete:
+		return fmt.Sprintf("- %s %s", c.Kind, c.Name)
+	case Bind:
+		return fmt.Sprintf("+ %s %s bound to %s %s", c.kindName(), c.Name, c.TargetKind(), c.Target)
+	default:
+		return fmt.Sprintf("- %s %s unbound from %s %s", c.kindName(), c.Name, c.TargetKind(), c.Target)
+	}
+}
+
+func (c Change) kindName() string {
+	if c.Managed {
+		return "managed " + string(c.Kind)
+	}
+	return string(c.Kind)
+}
+
+// TargetKind returns the kind of object bound to by a Bind or Unbind
+func (c Change) TargetKind() Kind {
+	if c.Kind == KindPolicy {
+		return KindRole
+	}
+	return KindUser
+}
+
+// Plan is the changes that make the IAM data of an org in the database match a document
+type Plan struct {
+	Org string `json:"org"`
+	// OrgID is the ID of the org, or 0 if it's created by the plan
+	OrgID   int      `json:"org_id,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// Empty returns true if the database already matches the document
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "org %s:\n", p.Org)
+	if p.Empty() {
+		b.WriteString("  no changes\n")
+	}
+	for _, c := range p.Changes {
+		fmt.Fprintf(&b, "  %s\n", c)
+	}
+	return b.String()
+}
+
+// NewPlan returns the changes that make current match desired.  current is the org's data loaded from the database,
+// or nil if the org doesn't exist.  The policies and roles of objects in desired replace those in current.  Objects
+// in current that aren't in desired are left as they are, unless prune is true, in which case they're deleted.
+func NewPlan(current, desired *Document, prune bool) (*Plan, error) {
+	if current == nil {
+		current = &Document{Org: desired.Org}
+	}
+	p := &Plan{Org: desired.Org, OrgID: current.OrgID}
+	if current.OrgID == 0 {
+		p.Changes = append(p.Changes, Change{Op: Create, Kind: KindOrg, Name: desired.Org})
+	}
+
+	curPolicies := map[string]Policy{}
+	for _, cp := range current.Policies {
+		curPolicies[cp.Name] = cp
+	}
+	curRoles := map[string]Role{}
+	for _, cr := range current.Roles {
+		curRoles[cr.Name] = cr
+	}
+	curUsers := map[string]User{}
+	for _, cu := range current.Users {
+		curUsers[cu.Name] = cu
+	}
+
+	// objects, then bindings, then deletions, so each change only depends on the changes before it
+	var binds, unbinds, deletes []Change
+	for i := range desired.Policies {
+		dp := &desired.Policies[i]
+		cp, ok := curPolicies[dp.Name]
+		if !ok {
+			p.Changes = append(p.Changes, Change{Op: Create, Kind: KindPolicy, Name: dp.Name, Policy: dp})
+			continue
+		}
+		dp.ID = cp.ID
+		if diff := Diff(cp, *dp); len(diff) > 0 {
+			p.Changes = append(p.Changes, Change{Op: Update, Kind: KindPolicy, Name: dp.Name, ID: cp.ID, Policy: dp, Diff: diff})
+		}
+	}
+
+	for i := range desired.Roles {
+		dr := &desired.Roles[i]
+		cr, ok := curRoles[dr.Name]
+		if ok {
+			dr.ID = cr.ID
+		} else {
+			p.Changes = append(p.Changes, Change{Op: Create, Kind: KindRole, Name: dr.Name})
+		}
+		add, remove := diffNames(cr.Policies, dr.Policies)
+		for _, name := range add {
+			binds = append(binds, Change{
+				Op: Bind, Kind: KindPolicy, Name: name, ID: curPolicies[name].ID, Target: dr.Name, TargetID: dr.ID,
+			})
+		}
+		for _, name := range remove {
+			unbinds = append(unbinds, Change{
+				Op: Unbind, Kind: KindPolicy, Name: name, ID: curPolicies[name].ID, Target: dr.Name, TargetID: dr.ID,
+			})
+		}
+		add, remove = diffNames(cr.ManagedPolicies, dr.ManagedPolicies)
+		for _, name := range add {
+			binds = append(binds, Change{Op: Bind, Kind: KindPolicy, Name: name, Target: dr.Name, TargetID: dr.ID, Managed: true})
+		}
+		for _, name := range remove {
+			unbinds = append(unbinds, Change{Op: Unbind, Kind: KindPolicy, Name: name, Target: dr.Name, TargetID: dr.ID, Managed: true})
+		}
+	}
+
+	for i := range desired.Users {
+		du := &desired.Users[i]
+		cu, ok := curUsers[du.Name]
+		if ok {
+			du.ID = cu.ID
+			// an omitted api key or tags leaves the user's as they are
+			var diff []string
+			if du.APIKey != "" && du.APIKey != cu.APIKey {
+				diff = append(diff, "api_key")
+			}
+			if du.Tags != nil && !sameTags(cu.Tags, du.Tags) {
+				diff = append(diff, "tags")
+			}
+			if len(diff) > 0 {
+				p.Changes = append(p.Changes, Change{Op: Update, Kind: KindUser, Name: du.Name, ID: cu.ID, User: du, Diff: diff})
+			}
+		} else {
+			if du.APIKey == "" {
+				return nil, fmt.Errorf("user %q: api_key is required to create a user", du.Name)
+			}
+			p.Changes = append(p.Changes, Change{Op: Create, Kind: KindUser, Name: du.Name, User: du})
+		}
+		add, remove := diffNames(cu.Roles, du.Roles)
+		for _, name := range add {
+			binds = append(binds, Change{
+				Op: Bind, Kind: KindRole, Name: name, ID: curRoles[name].ID, Target: du.Name, TargetID: du.ID,
+			})
+		}
+		for _, name := range remove {
+			unbinds = append(unbinds, Change{
+				Op: Unbind, Kind: KindRole, Name: name, ID: curRoles[name].ID, Target: du.Name, TargetID: du.ID,
+			})
+		}
+	}
+
+	if prune {
+		deletes = append(deletes, unmanaged(KindUser, current.Users, desired.Users, func(u User) (string, int) {
+			return u.Name, u.ID
+		})...)
+		deletes = append(deletes, unmanaged(KindRole, current.Roles, desired.Roles, func(r Role) (string, int) {
+			return r.Name, r.ID
+		})...)
+		deletes = append(deletes, unmanaged(KindPolicy, current.Policies, desired.Policies, func(p Policy) (string, int) {
+			return p.Name, p.ID
+		})...)
+		// bindings to deleted objects are removed with them
+		unbinds = withoutDeleted(unbinds, deletes)
+	}
+
+	p.Changes = append(p.Changes, unbinds...)
+	p.Changes = append(p.Changes, binds...)
+	p.Changes = append(p.Changes, deletes...)
+	return p, nil
+}
+
+// Diff describes the changes to the effect, actions, resource, exclusions and conditions of policy a made by policy b
+func Diff(a, b Policy) []string {
+	var diff []string
+	if a.Effect != b.Effect {
+		diff = append(diff, fmt.Sprintf("effect: %s -> %s", a.Effect, b.Effect))
+	}
+	if !sameSet(a.Actions, b.Actions) {
+		diff = append(diff, fmt.Sprintf("actions: %v -> %v", a.Actions, b.Actions))
+	}
+	if a.Resource != b.Resource {
+		diff = append(diff, fmt.Sprintf("resource: %s -> %s", a.Resource, b.Resource))
+	}
+	if !sameSet(a.NotActions, b.NotActions) {
+		diff = append(diff, fmt.Sprintf("not_actions: %v -> %v", a.NotActions, b.NotActions))
+	}
+	if !sameSet(a.NotResources, b.NotResources) {
+		diff = append(diff, fmt.Sprintf("not_resources: %v -> %v", a.NotResources, b.NotResources))
+	}
+	if ac, bc := conditionStrings(a.Conditions), conditionStrings(b.Conditions); !sameSet(ac, bc) {
+		diff = append(diff, fmt.Sprintf("conditions: %v -> %v", ac, bc))
+	}
+	return diff
+}
+
+func conditionStrings(cs []Condition) []string {
+	s := make([]string, len(cs))
+	for i, c := range cs {
+		s[i] = c.String()
+	}
+	return s
+}
+
+// diffNames returns the names in b that aren't in a, and those in a that aren't in b
+func diffNames(a, b []string) (add, remove []string) {
+	inA, inB := set(a), set(b)
+	for _, n := range b {
+		if !inA[n] {
+			add = append(add, n)
+		}
+	}
+	for _, n := range a {
+		if !inB[n] {
+			remove = append(remove, n)
+		}
+	}
+	return add, remove
+}
+
+func sameSet(a, b []string) bool {
+	add, remove := diffNames(a, b)
+	return len(add) == 0 && len(remove) == 0
+}
+
+func sameTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func set(names []string) map[string]bool {
+	s := make(map[string]bool, len(names))
+	for _, n := range names {
+		s[n] = true
+	}
+	return s
+}
+
+// unmanaged returns deletions of the objects in current that aren't in desired.  ref returns an object's name and ID.
+func unmanaged[T any](kind Kind, current, desired []T, ref func(T) (string, int)) []Change {
+	managed := map[string]bool{}
+	for _, d := range desired {
+		name, _ := ref(d)
+		managed[name] = true
+	}
+	var deletes []Change
+	for _, c := range current {
+		if name, id := ref(c); !managed[name] {
+			deletes = append(deletes, Change{Op: Delete, Kind: kind, Name: name, ID: id})
+		}
+	}
+	sort.SliceStable(deletes, func(i, j int) bool { return deletes[i].Name < deletes[j].Name })
+	return deletes
+}
+
+// withoutDeleted returns the unbinds that don't involve a deleted object
+func withoutDeleted(unbinds, deletes []Change) []Change {
+	deleted := map[Kind]map[string]bool{KindPolicy: {}, KindRole: {}, KindUser: {}}
+	for _, d := range deletes {
+		deleted[d.Kind][d.Name] = true
+	}
+	var kept []Change
+	for _, u := range unbinds {
+		if !(deleted[u.Kind][u.Name] && !u.Managed) && !deleted[u.TargetKind()][u.Target] {
+			kept = append(kept, u)
+		}
+	}
+	return kept
+}
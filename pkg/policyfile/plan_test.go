@@ -0,0 +1,212 @@
+package policyfile
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewPlan(t *testing.T) {
+	t.Parallel()
+	viewZones := Policy{ID: 1, Name: "viewZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*"}
+	viewComZones := Policy{
+		ID: 2, Name: "viewComZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*",
+		Conditions: []Condition{{Type: "matchSuffix", Value: "com"}},
+	}
+	current := func() *Document {
+		return &Document{
+			OrgID:    1,
+			Org:      "Aperture Science",
+			Policies: []Policy{viewZones, viewComZones},
+			Roles: []Role{
+				{ID: 1, Name: "viewer", Policies: []string{"viewZones"}},
+				{ID: 2, Name: "comViewer", Policies: []string{"viewComZones"}},
+			},
+			Users: []User{
+				{ID: 1, Name: "bob", APIKey: "bob", Roles: []string{"viewer"}},
+				{ID: 2, Name: "joe", APIKey: "joe", Roles: []string{"comViewer"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		current *Document
+		desired *Document
+		prune   bool
+		exp     []string
+		expErr  string
+	}{
+		{
+			name:    "no changes",
+			current: current(),
+			desired: current(),
+		},
+		{
+			name:    "new org",
+			desired: current(),
+			exp: []string{
+				"+ org Aperture Science",
+				"+ policy viewZones",
+				"+ policy viewComZones",
+				"+ role viewer",
+				"+ role comViewer",
+				"+ user bob",
+				"+ user joe",
+				"+ policy viewZones bound to role viewer",
+				"+ policy viewComZones bound to role comViewer",
+				"+ role viewer bound to user bob",
+				"+ role comViewer bound to user joe",
+			},
+		},
+		{
+			name:    "updates and rebinding",
+			current: current(),
+			desired: &Document{
+				Org: "Aperture Science",
+				Policies: []Policy{
+					{Name: "viewZones", Effect: "allow", Actions: []string{"view", "list"}, Resource: "oso:0:zone/*"},
+					{Name: "viewComZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*"},
+				},
+				Roles: []Role{
+					{Name: "viewer", Policies: []string{"viewZones", "viewComZones"}},
+					{Name: "comViewer", Policies: []string{"viewComZones"}},
+				},
+				Users: []User{
+					{Name: "bob", APIKey: "bob2", Roles: []string{"comViewer"}},
+					{Name: "joe", Roles: []string{"comViewer"}},
+				},
+			},
+			exp: []string{
+				"~ policy viewZones (actions: [view] -> [view list])",
+				"~ policy viewComZones (conditions: [matchSuffix=com] -> [])",
+				"~ user bob (api_key)",
+				"- role viewer unbound from user bob",
+				"+ policy viewComZones bound to role viewer",
+				"+ role comViewer bound to user bob",
+			},
+		},
+		{
+			name:    "exclusions",
+			current: current(),
+			desired: &Document{
+				Org: "Aperture Science",
+				Policies: []Policy{
+					{Name: "viewZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*", NotResources: []string{"oso:0:zone/gmail.com"}},
+					{Name: "viewComZones", Effect: "allow", NotActions: []string{"delete"}, Resource: "oso:0:zone/*", Conditions: viewComZones.Conditions},
+				},
+			},
+			exp: []string{
+				"~ policy viewZones (not_resources: [] -> [oso:0:zone/gmail.com])",
+				"~ policy viewComZones (actions: [view] -> [], not_actions: [] -> [delete])",
+			},
+		},
+		{
+			name:    "tags",
+			current: current(),
+			desired: &Document{
+				Org: "Aperture Science",
+				Users: []User{
+					{Name: "bob", Roles: []string{"viewer"}, Tags: map[string]string{"team": "testing"}},
+					{Name: "joe", Roles: []string{"comViewer"}},
+				},
+			},
+			exp: []string{"~ user bob (tags)"},
+		},
+		{
+			name: "managed policies",
+			current: func() *Document {
+				d := current()
+				d.Roles[1].ManagedPolicies = []string{"ZoneFullAccess"}
+				return d
+			}(),
+			desired: &Document{
+				Org:      "Aperture Science",
+				Policies: []Policy{viewZones, viewComZones},
+				Roles: []Role{
+					{Name: "viewer", Policies: []string{"viewZones"}, ManagedPolicies: []string{"ZoneReadOnly"}},
+					{Name: "comViewer", Policies: []string{"viewComZones"}},
+				},
+			},
+			exp: []string{
+				"- managed policy ZoneFullAccess unbound from role comViewer",
+				"+ managed policy ZoneReadOnly bound to role viewer",
+			},
+		},
+		{
+			name:    "unmanaged objects are kept without prune",
+			current: current(),
+			desired: &Document{
+				Org:      "Aperture Science",
+				Policies: []Policy{viewZones},
+				Roles:    []Role{{Name: "viewer", Policies: []string{"viewZones"}}},
+				Users:    []User{{Name: "bob", Roles: []string{"viewer"}}},
+			},
+		},
+		{
+			name:    "unmanaged objects are deleted with prune",
+			current: current(),
+			desired: &Document{
+				Org:      "Aperture Science",
+				Policies: []Policy{viewComZones},
+				Roles:    []Role{{Name: "comViewer", Policies: []string{"viewComZones"}}},
+				Users:    []User{{Name: "bob", Roles: []string{"comViewer"}}},
+			},
+			prune: true,
+			exp: []string{
+				"+ role comViewer bound to user bob",
+				"- user joe",
+				"- role viewer",
+				"- policy viewZones",
+			},
+		},
+		{
+			name:    "new user without api key",
+			current: current(),
+			desired: &Document{Org: "Aperture Science", Users: []User{{Name: "ada"}}},
+			expErr:  `user "ada": api_key is required to create a user`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPlan(tt.current, tt.desired, tt.prune)
+			if tt.expErr != "" {
+				assert.EqualError(t, err, tt.expErr)
+				return
+			}
+			assert.NoError(t, err)
+			var got []string
+			for _, c := range p.Changes {
+				got = append(got, c.String())
+			}
+			assert.Equal(t, tt.exp, got)
+			assert.Equal(t, len(tt.exp) == 0, p.Empty())
+		})
+	}
+}
+
+func TestNewPlan_ids(t *testing.T) {
+	t.Parallel()
+	current := &Document{
+		OrgID:    1,
+		Org:      "Aperture Science",
+		Policies: []Policy{{ID: 7, Name: "viewZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*"}},
+		Users:    []User{{ID: 3, Name: "bob"}},
+	}
+	desired := &Document{
+		Org:      "Aperture Science",
+		Policies: []Policy{{Name: "viewZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*"}},
+		Roles:    []Role{{Name: "viewer", Policies: []string{"viewZones"}}},
+		Users:    []User{{Name: "bob", Roles: []string{"viewer"}}},
+	}
+
+	p, err := NewPlan(current, desired, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.OrgID)
+	assert.Equal(t, []Change{
+		{Op: Create, Kind: KindRole, Name: "viewer"},
+		// existing objects are bound by ID, those created by the plan by name
+		{Op: Bind, Kind: KindPolicy, Name: "viewZones", ID: 7, Target: "viewer"},
+		{Op: Bind, Kind: KindRole, Name: "viewer", Target: "bob", TargetID: 3},
+	}, p.Changes)
+}
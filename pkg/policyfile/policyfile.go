@@ -0,0 +1,344 @@
+// Package policyfile loads the roles, policies, conditions and user bindings of an org from version controlled YAML
+// documents and plans the changes needed to make the database match them.
+package policyfile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/catalog"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/volatiletech/sqlboiler/v4/types"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var (
+	errMissingOrg  = errors.New("document is missing org")
+	errMissingName = errors.New("missing name")
+)
+
+// Document is the desired IAM data of an org.  Objects are identified by name within the org.
+type Document struct {
+	// OrgID is the ID of the org in the database, if it's been loaded from there
+	OrgID    int      `yaml:"-"`
+	Org      string   `yaml:"org"`
+	Policies []Policy `yaml:"policies,omitempty"`
+	Roles    []Role   `yaml:"roles,omitempty"`
+	Users    []User   `yaml:"users,omitempty"`
+}
+
+// Policy is a policy and the conditions it's subject to
+type Policy struct {
+	// ID is the ID of the policy in the database, if it's been loaded from there
+	ID         int         `yaml:"-" json:"-"`
+	Name       string      `yaml:"name" json:"name"`
+	Effect     string      `yaml:"effect" json:"effect"`
+	Actions    []string    `yaml:"actions" json:"actions"`
+	Resource   string      `yaml:"resource" json:"resource"`
+	Conditions []Condition `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+	// NotActions and NotResources are the actions and resource names excluded from the policy
+	NotActions   []string `yaml:"not_actions,omitempty" json:"not_actions,omitempty"`
+	NotResources []string `yaml:"not_resources,omitempty" json:"not_resources,omitempty"`
+}
+
+// Condition is a condition a policy is subject to, identified by its type and value
+type Condition struct {
+	Type  string `yaml:"type" json:"type"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// Role is a role and the names of the policies attached to it
+type Role struct {
+	ID       int      `yaml:"-"`
+	Name     string   `yaml:"name"`
+	Policies []string `yaml:"policies,omitempty"`
+	// ManagedPolicies are the names of managed policies, which are shared by every org rather than defined in documents
+	ManagedPolicies []string `yaml:"managed_policies,omitempty"`
+}
+
+// User is a user and the names of the roles bound to it.  APIKey is only required to create the user.
+type User struct {
+	ID     int      `yaml:"-"`
+	Name   string   `yaml:"name"`
+	APIKey string   `yaml:"api_key,omitempty"`
+	Roles  []string `yaml:"roles,omitempty"`
+	// Tags are substituted for policy variables like ${principal.tag/team}
+	Tags map[string]string `yaml:"tags,omitempty"`
+}
+
+// Model returns the policy as a model, without its conditions
+func (p Policy) Model() *models.Policy {
+	return &models.Policy{
+		PolicyID:         p.ID,
+		Name:             p.Name,
+		Effect:           p.Effect,
+		Actions:          types.StringArray(p.Actions),
+		ResourceName:     p.Resource,
+		NotActions:       stringArray(p.NotActions),
+		NotResourceNames: stringArray(p.NotResources),
+	}
+}
+
+// stringArray returns s as an array, empty rather than nil for the database's not null array columns
+func stringArray(s []string) types.StringArray {
+	if s == nil {
+		return types.StringArray{}
+	}
+	return types.StringArray(s)
+}
+
+// PolicyFromModel returns the policy p subject to conditions cs
+func PolicyFromModel(p *models.Policy, cs models.ConditionSlice) Policy {
+	fp := Policy{
+		ID:       p.PolicyID,
+		Name:     p.Name,
+		Effect:   p.Effect,
+		Actions:  p.Actions,
+		Resource: p.ResourceName,
+	}
+	if len(p.NotActions) > 0 {
+		fp.NotActions = p.NotActions
+	}
+	if len(p.NotResourceNames) > 0 {
+		fp.NotResources = p.NotResourceNames
+	}
+	for _, c := range cs {
+		fp.Conditions = append(fp.Conditions, Condition{Type: c.Type, Value: c.Value})
+	}
+	return fp
+}
+
+// RolePolicy returns the policy as it's evaluated by the authorizer
+func (p Policy) RolePolicy() roles.RolePolicy {
+	rp := roles.RolePolicy{
+		ID:         p.ID,
+		Effect:     p.Effect,
+		Actions:    p.Actions,
+		Resource:   roles.PolicyResourceName(p.Resource),
+		Conditions: map[int]*roles.Condition{},
+		NotActions: p.NotActions,
+	}
+	for _, nrn := range p.NotResources {
+		rp.NotResourceNames = append(rp.NotResourceNames, roles.PolicyResourceName(nrn))
+	}
+	for i, c := range p.Conditions {
+		rp.Conditions[i] = &roles.Condition{ID: i, Type: c.Type, Value: c.Value}
+	}
+	return rp
+}
+
+// Model returns the condition as a model
+func (c Condition) Model() *models.Condition {
+	return &models.Condition{Type: c.Type, Value: c.Value}
+}
+
+func (c Condition) String() string {
+	return c.Type + "=" + c.Value
+}
+
+// Model returns the role as a model in the org with the given ID
+func (r Role) Model(orgID int) *models.Role {
+	return &models.Role{RoleID: r.ID, Name: r.Name, OrgID: orgID}
+}
+
+// Model returns the user as a model in the org with the given ID
+func (u User) Model(orgID int) *models.User {
+	return &models.User{UserID: u.ID, Name: u.Name, APIKey: u.APIKey, OrgID: orgID}
+}
+
+// Load parses the YAML documents in r and merges those for the same org.  Documents are returned in order of org name.
+func Load(r io.Reader) ([]*Document, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var docs []*Document
+	for {
+		var d Document
+		err := dec.Decode(&d)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, &d)
+	}
+	return merge(docs)
+}
+
+// LoadFiles loads the documents in each path.  Directories are searched for .yaml and .yml files.
+func LoadFiles(paths ...string) ([]*Document, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(path); !info.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var docs []*Document
+	for _, f := range files {
+		fd, err := os.Open(f)
+		if err != nil {
+			return nil, err
+		}
+		ds, err := Load(fd)
+		fd.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		docs = append(docs, ds...)
+	}
+	return merge(docs)
+}
+
+// merge merges documents for the same org and validates the result
+func merge(docs []*Document) ([]*Document, error) {
+	byOrg := map[string]*Document{}
+	var orgs []string
+	for _, d := range docs {
+		if d.Org == "" {
+			return nil, errMissingOrg
+		}
+		m, ok := byOrg[d.Org]
+		if !ok {
+			byOrg[d.Org] = d
+			orgs = append(orgs, d.Org)
+			continue
+		}
+		m.Policies = append(m.Policies, d.Policies...)
+		m.Roles = append(m.Roles, d.Roles...)
+		m.Users = append(m.Users, d.Users...)
+	}
+
+	sort.Strings(orgs)
+	merged := make([]*Document, len(orgs))
+	for i, o := range orgs {
+		if err := byOrg[o].Validate(); err != nil {
+			return nil, fmt.Errorf("org %q: %w", o, err)
+		}
+		merged[i] = byOrg[o]
+	}
+	return merged, nil
+}
+
+// Validate checks that each object is well formed and named uniquely, and that bindings refer to objects in d
+func (d *Document) Validate() error {
+	if d.Org == "" {
+		return errMissingOrg
+	}
+	policies := map[string]bool{}
+	for _, p := range d.Policies {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		if policies[p.Name] {
+			return fmt.Errorf("policy %q is defined more than once", p.Name)
+		}
+		policies[p.Name] = true
+	}
+
+	rs := map[string]bool{}
+	for _, r := range d.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("role: %w", errMissingName)
+		}
+		if rs[r.Name] {
+			return fmt.Errorf("role %q is defined more than once", r.Name)
+		}
+		rs[r.Name] = true
+		for _, p := range r.Policies {
+			if !policies[p] {
+				return fmt.Errorf("role %q: unknown policy %q", r.Name, p)
+			}
+		}
+		for _, p := range r.ManagedPolicies {
+			if p == "" {
+				return fmt.Errorf("role %q: managed policy: %w", r.Name, errMissingName)
+			}
+		}
+	}
+
+	us := map[string]bool{}
+	for _, u := range d.Users {
+		if u.Name == "" {
+			return fmt.Errorf("user: %w", errMissingName)
+		}
+		if us[u.Name] {
+			return fmt.Errorf("user %q is defined more than once", u.Name)
+		}
+		us[u.Name] = true
+		for _, r := range u.Roles {
+			if !rs[r] {
+				return fmt.Errorf("user %q: unknown role %q", u.Name, r)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that p is named and well formed, with known actions and variables, as the admin API does
+func (p Policy) Validate() error {
+	if p.Name == "" {
+		return errMissingName
+	}
+	rp := p.RolePolicy()
+	if rp.Effect != "allow" && rp.Effect != "deny" {
+		return fmt.Errorf("effect must be allow or deny, not %q", rp.Effect)
+	}
+	if len(rp.Actions) == 0 && len(rp.NotActions) == 0 {
+		return errors.New("missing actions")
+	}
+	rType, _ := rp.Resource.GetType()
+	for _, a := range append(append([]string{}, rp.Actions...), rp.NotActions...) {
+		if err := roles.ValidateAction(a); err != nil {
+			return fmt.Errorf("bad action %q: %w", a, err)
+		}
+		if err := catalog.Default.Validate(rType, a); err != nil {
+			return err
+		}
+	}
+	if _, err := rp.Resource.GetType(); err != nil {
+		return fmt.Errorf("bad resource %q: %w", rp.Resource, err)
+	}
+	for _, nrn := range rp.NotResourceNames {
+		if _, err := nrn.GetType(); err != nil {
+			return fmt.Errorf("bad not resource %q: %w", nrn, err)
+		}
+	}
+	for _, nrn := range append([]roles.PolicyResourceName{rp.Resource}, rp.NotResourceNames...) {
+		if err := roles.ValidateVariables(string(nrn)); err != nil {
+			return fmt.Errorf("bad resource %q: %w", nrn, err)
+		}
+	}
+	for _, c := range rp.Conditions {
+		if c.Type == "" {
+			return errors.New("condition is missing type")
+		}
+		if v, ok := c.Value.(string); ok {
+			if err := roles.ValidateVariables(v); err != nil {
+				return fmt.Errorf("bad condition value %q: %w", v, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package policyfile
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		yaml   string
+		exp    []*Document
+		expErr string
+	}{
+		{
+			name: "documents for the same org are merged",
+			yaml: `
+org: Aperture Science
+policies:
+  - {name: viewZones, effect: allow, actions: [view], resource: "oso:0:zone/*"}
+roles:
+  - {name: viewer, policies: [viewZones]}
+---
+org: Black Mesa
+---
+org: Aperture Science
+users:
+  - {name: bob, api_key: bob, roles: [viewer]}
+`,
+			exp: []*Document{
+				{
+					Org:      "Aperture Science",
+					Policies: []Policy{{Name: "viewZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/*"}},
+					Roles:    []Role{{Name: "viewer", Policies: []string{"viewZones"}}},
+					Users:    []User{{Name: "bob", APIKey: "bob", Roles: []string{"viewer"}}},
+				},
+				{Org: "Black Mesa"},
+			},
+		},
+		{
+			name: "not actions and not resources",
+			yaml: `
+org: Aperture Science
+policies:
+  - {name: allButDelete, effect: allow, not_actions: [delete], resource: "oso:0:zone/*"}
+  - {name: denyAllButGmail, effect: deny, actions: ["*"], resource: "oso:0:zone/*", not_resources: ["oso:0:zone/gmail.com"]}
+`,
+			exp: []*Document{{
+				Org: "Aperture Science",
+				Policies: []Policy{
+					{Name: "allButDelete", Effect: "allow", NotActions: []string{"delete"}, Resource: "oso:0:zone/*"},
+					{
+						Name: "denyAllButGmail", Effect: "deny", Actions: []string{"*"}, Resource: "oso:0:zone/*",
+						NotResources: []string{"oso:0:zone/gmail.com"},
+					},
+				},
+			}},
+		},
+		{
+			name:   "missing org",
+			yaml:   `roles: [{name: viewer}]`,
+			expErr: errMissingOrg.Error(),
+		},
+		{
+			name:   "unknown field",
+			yaml:   "org: Aperture Science\ngroups: []",
+			expErr: "field groups not found",
+		},
+		{
+			name:   "bad effect",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: maybe, actions: [view], resource: "oso:0:zone/*"}]}`,
+			expErr: `org "Aperture Science": policy "p": effect must be allow or deny, not "maybe"`,
+		},
+		{
+			name:   "bad resource",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: allow, actions: [view], resource: "zone/*"}]}`,
+			expErr: `policy "p": bad resource "zone/*"`,
+		},
+		{
+			name:   "missing actions",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: allow, resource: "oso:0:zone/*"}]}`,
+			expErr: `policy "p": missing actions`,
+		},
+		{
+			name:   "bad action",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: allow, actions: ["zone:"], resource: "oso:0:zone/*"}]}`,
+			expErr: `policy "p": bad action "zone:": improperly formatted action`,
+		},
+		{
+			name:   "unknown action",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: allow, actions: ["dns:*"], resource: "oso:0:zone/*"}]}`,
+			expErr: `policy "p": unknown action: "dns:*" matches no zone action`,
+		},
+		{
+			name:   "unknown not action",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: allow, not_actions: [veiw], resource: "oso:0:zone/*"}]}`,
+			expErr: `policy "p": unknown action: "veiw" matches no zone action`,
+		},
+		{
+			name:   "bad not resource",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: allow, actions: [view], resource: "oso:0:zone/*", not_resources: [gmail.com]}]}`,
+			expErr: `policy "p": bad not resource "gmail.com"`,
+		},
+		{
+			name:   "bad variable",
+			yaml:   `{org: Aperture Science, policies: [{name: p, effect: allow, actions: [view], resource: "oso:${principal.org}:zone/*"}]}`,
+			expErr: `policy "p": bad resource "oso:${principal.org}:zone/*"`,
+		},
+		{
+			name:   "duplicate role across documents",
+			yaml:   "org: Aperture Science\nroles: [{name: viewer}]\n---\norg: Aperture Science\nroles: [{name: viewer}]",
+			expErr: `role "viewer" is defined more than once`,
+		},
+		{
+			name:   "unknown policy",
+			yaml:   `{org: Aperture Science, roles: [{name: viewer, policies: [viewZones]}]}`,
+			expErr: `role "viewer": unknown policy "viewZones"`,
+		},
+		{
+			name:   "unknown role",
+			yaml:   `{org: Aperture Science, users: [{name: bob, roles: [viewer]}]}`,
+			expErr: `user "bob": unknown role "viewer"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := Load(strings.NewReader(tt.yaml))
+			if tt.expErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, docs)
+		})
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	t.Parallel()
+	docs, err := LoadFiles("../../policies")
+	assert.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, "Aperture Science", docs[0].Org)
+	assert.Len(t, docs[0].Policies, 10)
+	assert.Len(t, docs[0].Roles, 6)
+	assert.Len(t, docs[0].Users, 4)
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		policy Policy
+		expErr string
+	}{
+		{
+			name:   "valid",
+			policy: Policy{Name: "viewOwnZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:${principal.org_id}:zone/*"},
+		},
+		{
+			name:   "unknown action",
+			policy: Policy{Name: "viewZones", Effect: "allow", Actions: []string{"veiw"}, Resource: "oso:0:zone/*"},
+			expErr: `unknown action: "veiw" matches no zone action`,
+		},
+		{
+			name:   "unknown variable",
+			policy: Policy{Name: "viewZones", Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/${principal.email}"},
+			expErr: `bad resource "oso:0:zone/${principal.email}"`,
+		},
+		{
+			name:   "bad effect",
+			policy: Policy{Name: "viewZones", Effect: "permit", Actions: []string{"view"}, Resource: "oso:0:zone/*"},
+			expErr: `effect must be allow or deny, not "permit"`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.policy.Validate()
+			if tt.expErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
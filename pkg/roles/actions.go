@@ -0,0 +1,81 @@
+package roles
+
+import (
+	"fmt"
+	"github.com/gobwas/glob"
+	"strings"
+)
+
+var errBadAction = fmt.Errorf("improperly formatted action")
+
+// globChars are the characters with special meaning in action patterns
+const globChars = `*?[]{}\`
+
+// PermitsAction returns true if one of the actions of rp, which may be glob patterns like zone:Get*, matches action
+// and none of its not actions do.  A policy with only not actions permits every action they don't match.
+func (rp RolePolicy) PermitsAction(action string) bool {
+	if rp.ExcludesAction(action) {
+		return false
+	}
+	if len(rp.Actions) == 0 {
+		return len(rp.NotActions) > 0
+	}
+	for _, a := range rp.Actions {
+		if MatchAction(a, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludesAction returns true if one of the not actions of rp matches action
+func (rp RolePolicy) ExcludesAction(action string) bool {
+	for _, a := range rp.NotActions {
+		if MatchAction(a, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAction returns true if the action pattern matches action.  Patterns are globs where * matches any characters,
+// including the : separating an action's service, so * alone matches every action.  Matching is case sensitive.
+func MatchAction(pattern, action string) bool {
+	if !IsActionPattern(pattern) {
+		return pattern == action
+	}
+	g, err := glob.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return g.Match(action)
+}
+
+// IsActionPattern returns true if action is a glob pattern rather than a single action
+func IsActionPattern(action string) bool {
+	return strings.ContainsAny(action, globChars)
+}
+
+// SplitAction splits an action, or action pattern, of the form service:Action into its service and name.  Actions
+// without a service, like view, have an empty service.
+func SplitAction(action string) (service string, name string, err error) {
+	s := strings.Split(action, ":")
+	switch {
+	case len(s) == 1 && s[0] != "":
+		return "", s[0], nil
+	case len(s) == 2 && s[0] != "" && s[1] != "" && !IsActionPattern(s[0]):
+		return s[0], s[1], nil
+	}
+	return "", "", errBadAction
+}
+
+// ValidateAction returns an error if action isn't an action or a valid action pattern.  Services can't be patterns.
+func ValidateAction(action string) error {
+	if _, _, err := SplitAction(action); err != nil {
+		return err
+	}
+	if _, err := glob.Compile(action); err != nil {
+		return errBadAction
+	}
+	return nil
+}
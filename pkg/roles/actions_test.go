@@ -0,0 +1,83 @@
+package roles
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatchAction(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		action  string
+		exp     bool
+	}{
+		{name: "exact match", pattern: "view", action: "view", exp: true},
+		{name: "no match", pattern: "view", action: "delete", exp: false},
+		{name: "wildcard matches any action", pattern: "*", action: "iam:CreateRole", exp: true},
+		{name: "service wildcard", pattern: "iam:*", action: "iam:CreateRole", exp: true},
+		{name: "service wildcard of another service", pattern: "iam:*", action: "zone:ListZones", exp: false},
+		{name: "prefix", pattern: "zone:List*", action: "zone:ListZones", exp: true},
+		{name: "prefix of another action", pattern: "zone:List*", action: "zone:GetZone", exp: false},
+		{name: "single character", pattern: "zone:Get?one", action: "zone:GetZone", exp: true},
+		{name: "case sensitive", pattern: "zone:list*", action: "zone:ListZones", exp: false},
+		{name: "pattern isn't an action", pattern: "zone:List*", action: "zone:List*x", exp: true},
+		{name: "bad pattern", pattern: "zone:[List", action: "zone:[List", exp: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, MatchAction(tt.pattern, tt.action), tt.name)
+	}
+}
+
+func TestValidateAction(t *testing.T) {
+	tests := []struct {
+		action string
+		expErr bool
+	}{
+		{action: "view"},
+		{action: "*"},
+		{action: "iam:CreateRole"},
+		{action: "zone:Get*"},
+		{action: "", expErr: true},
+		{action: "iam:", expErr: true},
+		{action: ":CreateRole", expErr: true},
+		{action: "*:CreateRole", expErr: true},
+		{action: "iam:role:Create", expErr: true},
+		{action: "zone:[Get", expErr: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateAction(tt.action)
+		if tt.expErr {
+			assert.Error(t, err, tt.action)
+		} else {
+			assert.NoError(t, err, tt.action)
+		}
+	}
+}
+
+func TestRolePolicy_PermitsAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		actions    []string
+		notActions []string
+		action     string
+		exp        bool
+	}{
+		{name: "action", actions: []string{"view"}, action: "view", exp: true},
+		{name: "no actions", action: "view", exp: false},
+		{name: "everything except", notActions: []string{"delete"}, action: "view", exp: true},
+		{name: "excepted action", notActions: []string{"delete"}, action: "delete", exp: false},
+		{name: "excepted by pattern", notActions: []string{"iam:*"}, action: "iam:CreateRole", exp: false},
+		{name: "wildcard except", actions: []string{"*"}, notActions: []string{"delete"}, action: "delete", exp: false},
+		{name: "wildcard except other action", actions: []string{"*"}, notActions: []string{"delete"}, action: "view", exp: true},
+		{name: "pattern except", actions: []string{"iam:*"}, notActions: []string{"iam:Delete*"}, action: "iam:DeleteRole", exp: false},
+		{name: "not action outside actions", actions: []string{"view"}, notActions: []string{"delete"}, action: "iam:GetOrg", exp: false},
+	}
+
+	for _, tt := range tests {
+		rp := RolePolicy{Actions: tt.actions, NotActions: tt.notActions}
+		assert.Equal(t, tt.exp, rp.PermitsAction(tt.action), tt.name)
+	}
+}
@@ -0,0 +1,39 @@
+package roles
+
+import "strings"
+
+// leafIndex returns the index of the type of the resource a resource ID split on / identifies.  Each pair of
+// segments is a type and name, the last pair naming the resource and the others its ancestors, and a trailing odd
+// segment is part of the resource's name.
+func leafIndex(segments []string) int {
+	return (len(segments) - 2) / 2 * 2
+}
+
+// ParentResourceName returns the resource name of the parent of the resource named rn, e.g. oso:0:zone/foo.com for the
+// record oso:0:zone/foo.com/record/www.foo.com, and false if the resource has no parent
+func ParentResourceName(rn string) (string, bool) {
+	s := strings.SplitN(rn, ":", 3)
+	if len(s) != 3 {
+		return "", false
+	}
+	t := strings.Split(s[2], "/")
+	if len(t) < 4 {
+		return "", false
+	}
+	s[2] = strings.Join(t[:leafIndex(t)], "/")
+	return strings.Join(s, ":"), true
+}
+
+// ResourceHierarchy matches namespaces that name an ancestor of a resource, so policies on a zone like
+// oso:0:zone/foo.com also cover its records, like oso:0:zone/foo.com/record/www.foo.com
+type ResourceHierarchy struct{}
+
+// Covers returns true if namespace is the resource name of one of the ancestors of the resource named rn
+func (ResourceHierarchy) Covers(namespace, rn string) bool {
+	for p, ok := ParentResourceName(rn); ok; p, ok = ParentResourceName(p) {
+		if p == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package roles
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParentResourceName(t *testing.T) {
+	tests := []struct {
+		name  string
+		rn    string
+		exp   string
+		expOK bool
+	}{
+		{name: "record", rn: "oso:0:zone/foo.com/record/www.foo.com", exp: "oso:0:zone/foo.com", expOK: true},
+		{name: "records of zone", rn: "oso:0:zone/foo.com/record/*", exp: "oso:0:zone/foo.com", expOK: true},
+		{name: "zone", rn: "oso:0:zone/foo.com"},
+		{name: "zone with trailing segment", rn: "oso:0:zone/foo.com/record"},
+		{name: "bad resource name", rn: "zone/foo.com/record/www.foo.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParentResourceName(tt.rn)
+			assert.Equal(t, tt.expOK, ok)
+			assert.Equal(t, tt.exp, got)
+		})
+	}
+}
+
+func TestResourceHierarchy_Covers(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		rn        string
+		exp       bool
+	}{
+		{name: "record of zone", namespace: "oso:0:zone/foo.com", rn: "oso:0:zone/foo.com/record/www.foo.com", exp: true},
+		{name: "record of other zone", namespace: "oso:0:zone/bar.net", rn: "oso:0:zone/foo.com/record/www.foo.com"},
+		{name: "zone of other org", namespace: "oso:1:zone/foo.com", rn: "oso:0:zone/foo.com/record/www.foo.com"},
+		{name: "zone itself", namespace: "oso:0:zone/foo.com", rn: "oso:0:zone/foo.com"},
+		{name: "zone of record", namespace: "oso:0:zone/foo.com/record/www.foo.com", rn: "oso:0:zone/foo.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.exp, ResourceHierarchy{}.Covers(tt.namespace, tt.rn))
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package roles
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrOrgCycle is returned when an org would be moved under itself or one of its descendants
+var ErrOrgCycle = errors.New("an org can't be moved under itself or one of its descendants")
+
+// OrgTree is the hierarchy of orgs, mapping the ID of each org with a parent to the ID of its parent.  Orgs that
+// aren't in the tree are roots.
+type OrgTree map[int]int
+
+// Ancestors returns the IDs of the ancestors of the org with the given ID, nearest first
+func (t OrgTree) Ancestors(id int) []int {
+	var as []int
+	for p, ok := t[id]; ok; p, ok = t[p] {
+		as = append(as, p)
+		// a cycle can only come from a corrupt tree, but shouldn't loop forever
+		if len(as) > len(t) {
+			break
+		}
+	}
+	return as
+}
+
+// IsAncestor returns true if the org ancestor is the parent of the org id, or an ancestor of its parent
+func (t OrgTree) IsAncestor(ancestor, id int) bool {
+	for _, a := range t.Ancestors(id) {
+		if a == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// Descendants returns the IDs of the descendants of the org with the given ID in ascending order.  Use an OrgIndex to
+// find the descendants of many orgs.
+func (t OrgTree) Descendants(id int) []int {
+	return t.Index().Descendants(id)
+}
+
+// Index returns the children of each org in t
+func (t OrgTree) Index() OrgIndex {
+	i := OrgIndex{}
+	for child, parent := range t {
+		i[parent] = append(i[parent], child)
+	}
+	return i
+}
+
+// OrgIndex maps the ID of each org with children to the IDs of its children
+type OrgIndex map[int][]int
+
+// Descendants returns the IDs of the descendants of the org with the given ID in ascending order
+func (i OrgIndex) Descendants(id int) []int {
+	var ds []int
+	seen := map[int]bool{id: true}
+	for next := []int{id}; len(next) > 0; {
+		var children []int
+		for _, p := range next {
+			for _, c := range i[p] {
+				// a cycle can only come from a corrupt tree, but shouldn't loop forever
+				if seen[c] {
+					continue
+				}
+				seen[c] = true
+				children = append(children, c)
+			}
+		}
+		ds = append(ds, children...)
+		next = children
+	}
+	sort.Ints(ds)
+	return ds
+}
+
+// CheckMove returns ErrOrgCycle if making parent the parent of the org id would create a cycle
+func (t OrgTree) CheckMove(id, parent int) error {
+	if id == parent || t.IsAncestor(id, parent) {
+		return ErrOrgCycle
+	}
+	return nil
+}
+
+// WithOrg returns prn with its org ID replaced by to if it's from, and as it is otherwise
+func (prn PolicyResourceName) WithOrg(from, to int) PolicyResourceName {
+	s := strings.SplitN(string(prn), ":", 3)
+	if len(s) != 3 || s[1] != strconv.Itoa(from) {
+		return prn
+	}
+	s[1] = strconv.Itoa(to)
+	return PolicyResourceName(strings.Join(s, ":"))
+}
+
+// Inherited returns a copy of rp for each descendant in i of the org rp's resource name belongs to, with the org ID of
+// its resource name and not resource names replaced by the descendant's, so policies on the resources of an org
+// apply to the same resources of its descendants.  Policies on every org, or whose variables haven't been
+// substituted, aren't inherited.
+func (rp RolePolicy) Inherited(i OrgIndex) []*RolePolicy {
+	org, _, err := SplitResourceName(string(rp.Resource))
+	if err != nil {
+		return nil
+	}
+	id, err := strconv.Atoi(org)
+	if err != nil {
+		return nil
+	}
+	var ps []*RolePolicy
+	for _, d := range i.Descendants(id) {
+		p := rp
+		p.Resource = rp.Resource.WithOrg(id, d)
+		p.NotResourceNames = nil
+		for _, nrn := range rp.NotResourceNames {
+			p.NotResourceNames = append(p.NotResourceNames, nrn.WithOrg(id, d))
+		}
+		ps = append(ps, &p)
+	}
+	return ps
+}
@@ -0,0 +1,87 @@
+package roles
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// newTestOrgTree returns a tree with the OUs 2 and 3 under 1, 4 under 2 and 5 under 4.  6 is a root.
+func newTestOrgTree() OrgTree {
+	return OrgTree{2: 1, 3: 1, 4: 2, 5: 4}
+}
+
+func TestOrgTree(t *testing.T) {
+	tree := newTestOrgTree()
+	assert.Equal(t, []int{4, 2, 1}, tree.Ancestors(5))
+	assert.Nil(t, tree.Ancestors(1))
+	assert.True(t, tree.IsAncestor(1, 5))
+	assert.False(t, tree.IsAncestor(3, 5))
+	assert.False(t, tree.IsAncestor(5, 5))
+	assert.Equal(t, []int{2, 3, 4, 5}, tree.Descendants(1))
+	assert.Equal(t, []int{4, 5}, tree.Descendants(2))
+	assert.Nil(t, tree.Descendants(6))
+}
+
+func TestOrgIndex_Descendants(t *testing.T) {
+	i := newTestOrgTree().Index()
+	assert.Equal(t, []int{2, 3, 4, 5}, i.Descendants(1))
+	assert.Equal(t, []int{5}, i.Descendants(4))
+	assert.Nil(t, i.Descendants(6))
+
+	// a corrupt tree with a cycle doesn't loop forever
+	assert.Equal(t, []int{2}, OrgTree{1: 2, 2: 1}.Index().Descendants(1))
+}
+
+func TestOrgTree_CheckMove(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     int
+		parent int
+		expErr error
+	}{
+		{name: "between parents", id: 4, parent: 3},
+		{name: "under other root", id: 2, parent: 6},
+		{name: "under itself", id: 2, parent: 2, expErr: ErrOrgCycle},
+		{name: "under child", id: 2, parent: 4, expErr: ErrOrgCycle},
+		{name: "under grandchild", id: 1, parent: 5, expErr: ErrOrgCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expErr, newTestOrgTree().CheckMove(tt.id, tt.parent))
+		})
+	}
+}
+
+func TestRolePolicy_Inherited(t *testing.T) {
+	rp := RolePolicy{
+		ID: 1, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:2:zone/*",
+		NotResourceNames: []PolicyResourceName{"oso:2:zone/gmail.com", "oso:*:zone/oso.com"},
+	}
+	names := func(ps []*RolePolicy) []string {
+		var ns []string
+		for _, p := range ps {
+			ns = append(ns, string(p.Resource))
+			for _, nrn := range p.NotResourceNames {
+				ns = append(ns, "!"+string(nrn))
+			}
+		}
+		return ns
+	}
+
+	tree := newTestOrgTree()
+	assert.Equal(t, []string{
+		"oso:4:zone/*", "!oso:4:zone/gmail.com", "!oso:*:zone/oso.com",
+		"oso:5:zone/*", "!oso:5:zone/gmail.com", "!oso:*:zone/oso.com",
+	}, names(rp.Inherited(tree.Index())))
+
+	// moving the OU 4 from 2 to 3 moves the policies it inherits with it
+	tree[4] = 3
+	assert.Nil(t, rp.Inherited(tree.Index()))
+	rp.Resource, rp.NotResourceNames = "oso:3:zone/*", nil
+	assert.Equal(t, []string{"oso:4:zone/*", "oso:5:zone/*"}, names(rp.Inherited(tree.Index())))
+
+	rp.Resource = "oso:*:zone/*"
+	assert.Nil(t, rp.Inherited(tree.Index()))
+	rp.Resource = "oso:${principal.org_id}:zone/*"
+	assert.Nil(t, rp.Inherited(tree.Index()))
+}
@@ -3,6 +3,7 @@ package roles
 import (
 	"fmt"
 	"github.com/gobwas/glob"
+	"sort"
 	"strings"
 )
 
@@ -18,14 +19,42 @@ type RolePolicy struct {
 	Actions    []string
 	Resource   PolicyResourceName
 	Conditions map[int]*Condition
+	// NotActions are the actions, or action patterns, the policy never applies to
+	NotActions []string `json:",omitempty"`
+	// NotResourceNames are the resource names, or resource name patterns, the policy never applies to
+	NotResourceNames []PolicyResourceName `json:",omitempty"`
 }
 
 func (rp RolePolicy) String() string {
-	return fmt.Sprintf("ID: %d Effect: %s Actions: %v Resource: %v Conditions: %v",
-		rp.ID, rp.Effect, rp.Actions, rp.Resource, rp.Conditions,
+	return fmt.Sprintf("ID: %d Effect: %s Actions: %v Resource: %v Conditions: %v NotActions: %v NotResourceNames: %v",
+		rp.ID, rp.Effect, rp.Actions, rp.Resource, rp.Conditions, rp.NotActions, rp.NotResourceNames,
 	)
 }
 
+// ConditionList returns the conditions of rp ordered by ID.  Polar iterates these rather than Conditions, as Oso
+// collapses maps with integer keys to one of their values.
+func (rp RolePolicy) ConditionList() []*Condition {
+	cs := make([]*Condition, 0, len(rp.Conditions))
+	for _, c := range rp.Conditions {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].ID < cs[j].ID })
+	return cs
+}
+
+// ExcludesResource returns true if one of the not resource names of rp contains the resource name rn, or the name of
+// one of its ancestors, so excluding a zone excludes its records too
+func (rp RolePolicy) ExcludesResource(rn string) bool {
+	for name, ok := rn, true; ok; name, ok = ParentResourceName(name) {
+		for _, nrn := range rp.NotResourceNames {
+			if nrn.ContainsResourceName(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Condition modifier for policies
 type Condition struct {
 	Type  string
@@ -54,7 +83,8 @@ func (prn PolicyResourceName) ContainsResourceName(rn string) bool {
 	return g.Match(rIDinRN)
 }
 
-// GetType returns resource type in resource's NRN
+// GetType returns resource type in resource's NRN.  The NRNs of child resources, like records, are nested in their
+// parent's as <type>/<name>/<child type>/<child name>, and have the child's type.
 func (prn PolicyResourceName) GetType() (string, error) {
 	rID, err := prn.GetResourceID()
 	if err != nil {
@@ -64,7 +94,7 @@ func (prn PolicyResourceName) GetType() (string, error) {
 	if len(t) < 2 {
 		return "", errBadResourceID
 	}
-	return t[0], nil
+	return t[leafIndex(t)], nil
 }
 
 // IsType returns true if resource is given type t
@@ -92,3 +122,48 @@ func SplitResourceName(nrn string) (orgID string, rID string, err error) {
 	}
 	return s[1], s[2], nil
 }
+
+// ExternalResource is a resource known only by its NRN, for authorizing resources that aren't stored locally
+type ExternalResource struct {
+	// Name is the handle of the resource, i.e. the portion of its resource ID following the type
+	Name         string
+	ResourceName string
+	// Attributes are arbitrary caller supplied attributes of the resource
+	Attributes map[string]string
+}
+
+// NewExternalResource returns the resource identified by nrn with the given attributes
+func NewExternalResource(nrn string, attrs map[string]string) (*ExternalResource, error) {
+	rID, err := PolicyResourceName(nrn).GetResourceID()
+	if err != nil {
+		return nil, err
+	}
+	t := strings.Split(rID, "/")
+	if len(t) < 2 {
+		return nil, errBadResourceID
+	}
+	i := leafIndex(t)
+	name := strings.Join(t[i+1:], "/")
+	if t[i] == "" || name == "" {
+		return nil, errBadResourceID
+	}
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	return &ExternalResource{Name: name, ResourceName: nrn, Attributes: attrs}, nil
+}
+
+// TypeWildcard matches namespaces of the form oso:<org>:<type>/*, which cover every resource of a type in an org
+type TypeWildcard struct{}
+
+// Covers returns true if namespace is a type wildcard covering the resource name rn
+func (TypeWildcard) Covers(namespace, rn string) bool {
+	prefix := strings.TrimSuffix(namespace, "*")
+	if prefix == namespace || !strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix, globChars) {
+		return false
+	}
+	if _, err := PolicyResourceName(namespace).GetType(); err != nil {
+		return false
+	}
+	return strings.HasPrefix(rn, prefix) && len(rn) > len(prefix)
+}
@@ -79,6 +79,11 @@ func TestPolicyResourceName_GetType(t *testing.T) {
 			policyResourceName: "oso:2000:user/bloblaw",
 			expType:            "user",
 		},
+		{
+			name:               "record type",
+			policyResourceName: "oso:2000:zone/example.com/record/www.example.com",
+			expType:            "record",
+		},
 		{
 			name:               "bad policyResourceName",
 			policyResourceName: "foobar",
@@ -99,3 +104,123 @@ func TestPolicyResourceName_GetType(t *testing.T) {
 		assert.Equal(t, tt.expType, gotType)
 	}
 }
+
+func TestNewExternalResource(t *testing.T) {
+	tests := []struct {
+		name   string
+		nrn    string
+		attrs  map[string]string
+		exp    *ExternalResource
+		expErr error
+	}{
+		{
+			name: "zone",
+			nrn:  "oso:0:zone/example.com",
+			exp: &ExternalResource{
+				Name:         "example.com",
+				ResourceName: "oso:0:zone/example.com",
+				Attributes:   map[string]string{},
+			},
+		},
+		{
+			name:  "zone with attributes",
+			nrn:   "oso:0:zone/example.com",
+			attrs: map[string]string{"env": "prod"},
+			exp: &ExternalResource{
+				Name:         "example.com",
+				ResourceName: "oso:0:zone/example.com",
+				Attributes:   map[string]string{"env": "prod"},
+			},
+		},
+		{
+			name: "record",
+			nrn:  "oso:0:zone/example.com/record/www.example.com",
+			exp: &ExternalResource{
+				Name:         "www.example.com",
+				ResourceName: "oso:0:zone/example.com/record/www.example.com",
+				Attributes:   map[string]string{},
+			},
+		},
+		{
+			name:   "bad resource name",
+			nrn:    "foobar",
+			expErr: errBadResourceName,
+		},
+		{
+			name:   "bad resource id",
+			nrn:    "oso:0:zone",
+			expErr: errBadResourceID,
+		},
+		{
+			name:   "empty handle",
+			nrn:    "oso:0:zone/",
+			expErr: errBadResourceID,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := NewExternalResource(tt.nrn, tt.attrs)
+		if tt.expErr != nil {
+			assert.ErrorIs(t, err, tt.expErr)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.exp, got)
+	}
+}
+
+func TestRolePolicy_ExcludesResource(t *testing.T) {
+	tests := []struct {
+		name             string
+		notResourceNames []PolicyResourceName
+		resourceName     string
+		exp              bool
+	}{
+		{
+			name:         "no not resource names",
+			resourceName: "oso:0:zone/gmail.com",
+			exp:          false,
+		},
+		{
+			name:             "excluded",
+			notResourceNames: []PolicyResourceName{"oso:0:zone/gmail.com"},
+			resourceName:     "oso:0:zone/gmail.com",
+			exp:              true,
+		},
+		{
+			name:             "not excluded",
+			notResourceNames: []PolicyResourceName{"oso:0:zone/gmail.com"},
+			resourceName:     "oso:0:zone/oso.com",
+			exp:              false,
+		},
+		{
+			name:             "excluded by pattern",
+			notResourceNames: []PolicyResourceName{"oso:0:zone/*.net", "oso:0:zone/gmail.com"},
+			resourceName:     "oso:0:zone/react.net",
+			exp:              true,
+		},
+		{
+			name:             "record of excluded zone",
+			notResourceNames: []PolicyResourceName{"oso:0:zone/gmail.com"},
+			resourceName:     "oso:0:zone/gmail.com/record/www.gmail.com",
+			exp:              true,
+		},
+		{
+			name:             "zone of excluded record",
+			notResourceNames: []PolicyResourceName{"oso:0:zone/gmail.com/record/www.gmail.com"},
+			resourceName:     "oso:0:zone/gmail.com",
+			exp:              false,
+		},
+		{
+			name:             "excluded in another org",
+			notResourceNames: []PolicyResourceName{"oso:1:zone/gmail.com"},
+			resourceName:     "oso:0:zone/gmail.com",
+			exp:              false,
+		},
+	}
+
+	for _, tt := range tests {
+		rp := RolePolicy{NotResourceNames: tt.notResourceNames}
+		assert.Equal(t, tt.exp, rp.ExcludesResource(tt.resourceName), tt.name)
+	}
+}
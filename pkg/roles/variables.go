@@ -0,0 +1,133 @@
+package roles
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var errBadVariable = fmt.Errorf("unknown or improperly formatted policy variable")
+
+// variablePattern matches the policy variables of a resource name or condition value, like ${principal.org_id}
+var variablePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// tagPrefix prefixes the variables of a principal's tags, like ${principal.tag/team}
+const tagPrefix = "principal.tag/"
+
+// Principal is the attributes of the user a policy is evaluated for, substituted for the policy's variables
+type Principal struct {
+	UserID int
+	OrgID  int
+	Name   string
+	Tags   map[string]string
+}
+
+// HasVariables returns true if s contains a policy variable
+func HasVariables(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+// ValidateVariables returns an error if s has a variable other than ${principal.user_id}, ${principal.org_id},
+// ${principal.name} or ${principal.tag/<key>}, or an unterminated one
+func ValidateVariables(s string) error {
+	for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+		switch name := m[1]; {
+		case name == "principal.user_id", name == "principal.org_id", name == "principal.name":
+		case strings.HasPrefix(name, tagPrefix) && len(name) > len(tagPrefix):
+		default:
+			return fmt.Errorf("%w: %s", errBadVariable, m[0])
+		}
+	}
+	if HasVariables(variablePattern.ReplaceAllString(s, "")) {
+		return errBadVariable
+	}
+	return nil
+}
+
+// Substitute replaces the variables in s with p's attributes.  It returns false if a variable is unknown, p has no
+// such tag or the value contains characters that would change what a resource name matches, like * or :.
+func (p Principal) Substitute(s string) (string, bool) {
+	if !HasVariables(s) {
+		return s, true
+	}
+	ok := ValidateVariables(s) == nil
+	sub := variablePattern.ReplaceAllStringFunc(s, func(v string) string {
+		var val string
+		switch name := v[2 : len(v)-1]; {
+		case name == "principal.user_id":
+			val = strconv.Itoa(p.UserID)
+		case name == "principal.org_id":
+			val = strconv.Itoa(p.OrgID)
+		case name == "principal.name":
+			val = p.Name
+		case strings.HasPrefix(name, tagPrefix):
+			var found bool
+			if val, found = p.Tags[strings.TrimPrefix(name, tagPrefix)]; !found {
+				ok = false
+			}
+		}
+		if val == "" || strings.ContainsAny(val, globChars+":/") {
+			ok = false
+		}
+		return val
+	})
+	return sub, ok
+}
+
+// HasVariables returns true if rp's resource name, not resource names or condition values contain a policy variable
+func (rp RolePolicy) HasVariables() bool {
+	if HasVariables(string(rp.Resource)) {
+		return true
+	}
+	for _, nrn := range rp.NotResourceNames {
+		if HasVariables(string(nrn)) {
+			return true
+		}
+	}
+	for _, c := range rp.Conditions {
+		if v, ok := c.Value.(string); ok && HasVariables(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForPrincipal returns a copy of rp with the variables of its resource name, not resource names and condition values
+// substituted with p's attributes, or false if one of them can't be.  A deny policy is only dropped when its resource
+// name can't be substituted, as its not resource names and conditions only exclude from it: those that can't be
+// substituted are left out, excluding nothing, so the deny still applies.
+func (rp RolePolicy) ForPrincipal(p Principal) (*RolePolicy, bool) {
+	sub := rp
+	resource, ok := p.Substitute(string(rp.Resource))
+	if !ok {
+		return nil, false
+	}
+	deny := rp.Effect == "deny"
+	sub.Resource = PolicyResourceName(resource)
+	sub.NotResourceNames = nil
+	for _, nrn := range rp.NotResourceNames {
+		s, ok := p.Substitute(string(nrn))
+		if !ok {
+			if deny {
+				continue
+			}
+			return nil, false
+		}
+		sub.NotResourceNames = append(sub.NotResourceNames, PolicyResourceName(s))
+	}
+	sub.Conditions = make(map[int]*Condition, len(rp.Conditions))
+	for id, c := range rp.Conditions {
+		sc := *c
+		if v, isString := c.Value.(string); isString {
+			if sc.Value, ok = p.Substitute(v); !ok {
+				if deny {
+					continue
+				}
+				return nil, false
+			}
+		}
+		sub.Conditions[id] = &sc
+	}
+	return &sub, true
+}
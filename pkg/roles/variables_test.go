@@ -0,0 +1,119 @@
+package roles
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateVariables(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		expErr bool
+	}{
+		{name: "no variables", s: "oso:0:zone/*"},
+		{name: "org id", s: "oso:${principal.org_id}:zone/*"},
+		{name: "name and tag", s: "oso:0:zone/${principal.name}.${principal.tag/team}.com"},
+		{name: "user id", s: "${principal.user_id}"},
+		{name: "unknown variable", s: "oso:${principal.email}:zone/*", expErr: true},
+		{name: "tag without key", s: "oso:0:zone/${principal.tag/}", expErr: true},
+		{name: "unterminated", s: "oso:${principal.org_id:zone/*", expErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVariables(tt.s)
+			if tt.expErr {
+				assert.ErrorIs(t, err, errBadVariable)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPrincipal_Substitute(t *testing.T) {
+	p := Principal{UserID: 7, OrgID: 2, Name: "guybrush", Tags: map[string]string{"team": "pirates", "bad": "*"}}
+	tests := []struct {
+		name  string
+		s     string
+		exp   string
+		expOK bool
+	}{
+		{name: "no variables", s: "oso:0:zone/*", exp: "oso:0:zone/*", expOK: true},
+		{name: "org id", s: "oso:${principal.org_id}:zone/*", exp: "oso:2:zone/*", expOK: true},
+		{
+			name:  "user id, name and tag",
+			s:     "oso:0:zone/${principal.user_id}.${principal.name}.${principal.tag/team}.com",
+			exp:   "oso:0:zone/7.guybrush.pirates.com",
+			expOK: true,
+		},
+		{name: "missing tag", s: "oso:0:zone/${principal.tag/ship}.com"},
+		{name: "tag with glob", s: "oso:0:zone/${principal.tag/bad}.com"},
+		{name: "unknown variable", s: "oso:0:zone/${principal.email}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := p.Substitute(tt.s)
+			assert.Equal(t, tt.expOK, ok)
+			if tt.expOK {
+				assert.Equal(t, tt.exp, got)
+			}
+		})
+	}
+}
+
+func TestRolePolicy_ForPrincipal(t *testing.T) {
+	p := Principal{UserID: 7, OrgID: 2, Name: "guybrush", Tags: map[string]string{"team": "pirates"}}
+	rp := RolePolicy{
+		ID:               1,
+		Effect:           "allow",
+		Actions:          []string{"view"},
+		Resource:         "oso:${principal.org_id}:zone/*",
+		NotResourceNames: []PolicyResourceName{"oso:${principal.org_id}:zone/${principal.name}.com"},
+		Conditions:       map[int]*Condition{1: {ID: 1, Type: "matchSuffix", Value: "${principal.tag/team}.com"}},
+	}
+	require.True(t, rp.HasVariables())
+
+	sub, ok := rp.ForPrincipal(p)
+	require.True(t, ok)
+	assert.Equal(t, PolicyResourceName("oso:2:zone/*"), sub.Resource)
+	assert.Equal(t, []PolicyResourceName{"oso:2:zone/guybrush.com"}, sub.NotResourceNames)
+	assert.Equal(t, "pirates.com", sub.Conditions[1].Value)
+	assert.False(t, sub.HasVariables())
+	// the original is left as it was
+	assert.Equal(t, "${principal.tag/team}.com", rp.Conditions[1].Value)
+
+	_, ok = rp.ForPrincipal(Principal{UserID: 8, OrgID: 2, Name: "lechuck"})
+	assert.False(t, ok)
+
+	// a deny still applies without the exclusions that can't be substituted
+	deny := rp
+	deny.Effect = "deny"
+	deny.NotResourceNames = []PolicyResourceName{"oso:${principal.org_id}:zone/${principal.tag/team}.com"}
+	sub, ok = deny.ForPrincipal(Principal{UserID: 8, OrgID: 2, Name: "lechuck"})
+	require.True(t, ok)
+	assert.Equal(t, PolicyResourceName("oso:2:zone/*"), sub.Resource)
+	assert.Empty(t, sub.NotResourceNames)
+	assert.Empty(t, sub.Conditions)
+}
+
+func TestTypeWildcard_Covers(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		rn        string
+		exp       bool
+	}{
+		{name: "resource of type", namespace: "oso:1:zone/*", rn: "oso:1:zone/foo.com", exp: true},
+		{name: "other org", namespace: "oso:1:zone/*", rn: "oso:0:zone/foo.com"},
+		{name: "other type", namespace: "oso:1:zone/*", rn: "oso:1:role/admin"},
+		{name: "exact name", namespace: "oso:1:zone/foo.com", rn: "oso:1:zone/foo.com"},
+		{name: "other globs", namespace: "oso:*:zone/*", rn: "oso:1:zone/foo.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.exp, TypeWildcard{}.Covers(tt.namespace, tt.rn))
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamfiber"
+	"strconv"
+	"strings"
+)
+
+// newRecordKey is the key of the record parsed from a create request, before it's authorized
+const newRecordKey = "newRecord"
+
+var (
+	errHTMLRecordNotFound = "<h1>Whoops!</h1><p>That record was not found</p>"
+	errMissingRecordId    = errors.New("recordId not found in request params")
+)
+
+// listRecordsRoute lists the records of the zone the requester may view, which may be all of them through a policy on
+// the zone, or only some through policies on the records.  A requester that can view neither the zone nor any of its
+// records gets the same 404 as for a zone that doesn't exist, so zones of other orgs can't be discovered.
+func (s *Server) listRecordsRoute(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	z, err := s.getReqZone(c)
+	if err != nil {
+		return c.Status(404).SendString(errHTMLZoneNotFound)
+	}
+	rs, err := s.viewableRecords(c, z)
+	if err != nil {
+		return errorHandler(c, &iam.Error{Status: iam.HTTPStatus(err), ResourceType: "zone", Err: err})
+	}
+
+	var records []string
+	for _, r := range rs {
+		records = append(records, fmt.Sprintf("%s %s %s", r.Name, r.Type, r.Value))
+	}
+	return c.Status(200).SendString(fmt.Sprintf("<h1>Records</h1><p>%s</p>", strings.Join(records, ",")))
+}
+
+// viewableRecords returns the records of zone z the requester may view.  A requester that can view neither the zone
+// nor any of its records gets the Enforcer's error for viewing the zone, so the zone is concealed like one that
+// doesn't exist.  Failures to list or authorize the records are treated as not found, like the Enforcer does.
+func (s *Server) viewableRecords(c *fiber.Ctx, z *models.Zone) ([]*datastore.Record, error) {
+	reqUser, err := iamfiber.User(c)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := s.ds.ListRecordsByZoneID(context.Background(), z.ZoneID)
+	if err != nil {
+		s.logger.Errorw("error listing records for zone", "zoneID", z.ZoneID, "error", err)
+		return nil, fmt.Errorf("%w: %v", iam.ErrNotFound, err)
+	}
+
+	var viewable []*datastore.Record
+	for _, r := range rs {
+		allowed, err := s.authz.IsAllowed(reqUser, actionGetRecord, r)
+		if err != nil {
+			s.logger.Errorw("error authorizing record", "record", r.ResourceName, "error", err)
+			return nil, fmt.Errorf("%w: %v", iam.ErrNotFound, err)
+		}
+		if allowed {
+			viewable = append(viewable, r)
+		}
+	}
+	if len(viewable) == 0 {
+		if err := s.newEnforcer().Authorize(c.UserContext(), actionGetZone, "zone", z); err != nil {
+			return nil, err
+		}
+	}
+	return viewable, nil
+}
+
+func (s *Server) getRecordRoute(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	// get record authorized by middleware
+	r, err := getAuthorizedRecord(c)
+	if err != nil {
+		return c.Status(404).SendString(errHTMLRecordNotFound)
+	}
+	return c.Status(200).SendString(fmt.Sprintf("<h1>A Repo</h1><p>Record %s %s %s</p>", r.Name, r.Type, r.Value))
+}
+
+// parseNewRecord parses the record to create from the body as a record of the zone in zoneId param, so its resource
+// name can be authorized.  The zone is concealed before the body is validated, so requesters that can't see the zone
+// or any of its records can't tell it from a zone that doesn't exist by sending an invalid record.
+func (s *Server) parseNewRecord(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	z, err := s.getReqZone(c)
+	if err != nil {
+		return c.Status(404).SendString(errHTMLZoneNotFound)
+	}
+	if _, err := s.viewableRecords(c, z); err != nil {
+		return errorHandler(c, &iam.Error{Status: iam.HTTPStatus(err), ResourceType: "zone", Err: err})
+	}
+	var r datastore.Record
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(400).SendString(fmt.Sprintf("<h1>Whoops!</h1><p>%s</p>", err))
+	}
+	if err := r.InZone(z); err != nil {
+		return c.Status(400).SendString(fmt.Sprintf("<h1>Whoops!</h1><p>%s</p>", err))
+	}
+	c.Locals(newRecordKey, &r)
+	return c.Next()
+}
+
+func (s *Server) createRecordRoute(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	r, err := getAuthorizedRecord(c)
+	if err != nil {
+		return c.Status(404).SendString(errHTMLRecordNotFound)
+	}
+	if err := s.ds.CreateRecord(context.Background(), r); err != nil {
+		s.logger.Errorw("error creating record", "record", r.ResourceName, "error", err)
+		return c.Status(500).SendString(fmt.Sprintf("<h1>Whoops!</h1><p>%s</p>", err))
+	}
+	return c.Status(201).SendString(fmt.Sprintf("<h1>A Repo</h1><p>Created record %s</p>", r.Name))
+}
+
+// updateRecordRoute updates the type, value and TTL of the record to those in the body
+func (s *Server) updateRecordRoute(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	r, err := getAuthorizedRecord(c)
+	if err != nil {
+		return c.Status(404).SendString(errHTMLRecordNotFound)
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+		TTL   int    `json:"ttl"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).SendString(fmt.Sprintf("<h1>Whoops!</h1><p>%s</p>", err))
+	}
+	updated := *r
+	updated.Type, updated.Value, updated.TTL = body.Type, body.Value, body.TTL
+	if err := updated.Validate(); err != nil {
+		return c.Status(400).SendString(fmt.Sprintf("<h1>Whoops!</h1><p>%s</p>", err))
+	}
+	if err := s.ds.UpdateRecord(context.Background(), &updated); err != nil {
+		s.logger.Errorw("error updating record", "record", r.ResourceName, "error", err)
+		return c.Status(500).SendString(fmt.Sprintf("<h1>Whoops!</h1><p>%s</p>", err))
+	}
+	return c.Status(200).SendString(fmt.Sprintf("<h1>A Repo</h1><p>Updated record %s</p>", r.Name))
+}
+
+func (s *Server) deleteRecordRoute(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	r, err := getAuthorizedRecord(c)
+	if err != nil {
+		return c.Status(404).SendString(errHTMLRecordNotFound)
+	}
+	if err := s.ds.DeleteRecordByID(context.Background(), r.RecordID); err != nil {
+		s.logger.Errorw("error deleting record", "record", r.ResourceName, "error", err)
+		return c.Status(500).SendString(fmt.Sprintf("<h1>Whoops!</h1><p>%s</p>", err))
+	}
+	return c.Status(200).SendString(fmt.Sprintf("<h1>A Repo</h1><p>Deleted record %s</p>", r.Name))
+}
+
+// gets the record requested in recordId param, which must be a record of the zone in zoneId param
+func (s *Server) getReqRecord(c *fiber.Ctx) (*datastore.Record, error) {
+	z, err := s.getReqZone(c)
+	if err != nil {
+		return nil, err
+	}
+	recordId, err := strconv.Atoi(c.Params("recordId"))
+	if err != nil {
+		return nil, errMissingRecordId
+	}
+	r, err := s.ds.FindRecordByID(context.Background(), recordId)
+	if err != nil {
+		s.logger.Errorw("error finding record by ID", "error", err)
+		return nil, err
+	}
+	if r.ZoneID != z.ZoneID {
+		return nil, errNotFound
+	}
+	return r, nil
+}
+
+// recordLoader loads the record requested in recordId param for authorization
+func (s *Server) recordLoader() iam.ResourceLoader[*fiber.Ctx] {
+	return iam.LoaderFunc("record", func(c *fiber.Ctx) (interface{}, error) {
+		return s.getReqRecord(c)
+	})
+}
+
+// newRecordLoader loads the record parsed by parseNewRecord for authorization
+func (s *Server) newRecordLoader() iam.ResourceLoader[*fiber.Ctx] {
+	return iam.LoaderFunc("record", func(c *fiber.Ctx) (interface{}, error) {
+		r, ok := c.Locals(newRecordKey).(*datastore.Record)
+		if !ok {
+			return nil, errNotFound
+		}
+		return r, nil
+	})
+}
+
+// gets the record loaded and authorized by middleware
+func getAuthorizedRecord(c *fiber.Ctx) (*datastore.Record, error) {
+	r, err := iamfiber.Resource(c)
+	if err != nil {
+		return nil, err
+	}
+	rec, ok := r.(*datastore.Record)
+	if !ok {
+		return nil, errors.New("authorized resource is not a record")
+	}
+	return rec, nil
+}
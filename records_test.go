@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// recordsDatastore is a mockDatastore that stores the records of its zones and the policies of each user
+type recordsDatastore struct {
+	mockDatastore
+	records  map[int]*datastore.Record
+	nextID   int
+	policies map[int][]*roles.RolePolicy
+}
+
+func newRecordsDatastore(policies map[int][]*roles.RolePolicy) *recordsDatastore {
+	return &recordsDatastore{
+		records: map[int]*datastore.Record{
+			1: {RecordID: 1, ZoneID: 1, Name: "foo.com", Type: "MX", Value: "10 mail.foo.com", TTL: 300,
+				ResourceName: "oso:0:zone/foo.com/record/foo.com"},
+			2: {RecordID: 2, ZoneID: 1, Name: "www.foo.com", Type: "A", Value: "192.0.2.10", TTL: 300,
+				ResourceName: "oso:0:zone/foo.com/record/www.foo.com"},
+			3: {RecordID: 3, ZoneID: 1, Name: "mail.foo.com", Type: "A", Value: "192.0.2.20", TTL: 300,
+				ResourceName: "oso:0:zone/foo.com/record/mail.foo.com"},
+			4: {RecordID: 4, ZoneID: 2, Name: "www.bar.net", Type: "A", Value: "192.0.2.30", TTL: 300,
+				ResourceName: "oso:0:zone/bar.net/record/www.bar.net"},
+		},
+		nextID:   100,
+		policies: policies,
+	}
+}
+
+func (ds *recordsDatastore) ListRecordsByZoneID(_ context.Context, zoneID int) ([]*datastore.Record, error) {
+	var rs []*datastore.Record
+	for _, r := range ds.records {
+		if r.ZoneID == zoneID {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].RecordID < rs[j].RecordID })
+	return rs, nil
+}
+
+func (ds *recordsDatastore) FindRecordByID(_ context.Context, id int) (*datastore.Record, error) {
+	r, ok := ds.records[id]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	copied := *r
+	return &copied, nil
+}
+
+func (ds *recordsDatastore) CreateRecord(_ context.Context, r *datastore.Record) error {
+	ds.nextID++
+	r.RecordID = ds.nextID
+	copied := *r
+	ds.records[r.RecordID] = &copied
+	return nil
+}
+
+func (ds *recordsDatastore) UpdateRecord(_ context.Context, r *datastore.Record) error {
+	copied := *r
+	ds.records[r.RecordID] = &copied
+	return nil
+}
+
+func (ds *recordsDatastore) DeleteRecordByID(_ context.Context, id int) error {
+	delete(ds.records, id)
+	return nil
+}
+
+func (ds *recordsDatastore) GetEffectivePerms(_ context.Context, user *models.User, _ roles.OrgTree) (datastore.EffectivePerms, error) {
+	perms := datastore.NewEffectivePerms()
+	for _, p := range ds.policies[user.UserID] {
+		byNamespace := perms.AllowPolicies
+		if p.Effect == "deny" {
+			byNamespace = perms.DenyPolicies
+		}
+		if byNamespace[string(p.Resource)] == nil {
+			byNamespace[string(p.Resource)] = map[int]*roles.RolePolicy{}
+		}
+		byNamespace[string(p.Resource)][p.ID] = p
+	}
+	return perms, nil
+}
+
+func Test_recordRoutes(t *testing.T) {
+	ds := newRecordsDatastore(map[int][]*roles.RolePolicy{
+		// john manages every record of foo.com through a policy on the zone
+		1: {{ID: 1, Effect: "allow", Actions: []string{"view", "update"}, Resource: "oso:0:zone/foo.com"}},
+		// bob manages every zone, except deleting mail.foo.com
+		2: {
+			{ID: 2, Effect: "allow", Actions: []string{"*"}, Resource: "oso:0:zone/*"},
+			{ID: 3, Effect: "deny", Actions: []string{"delete"}, Resource: "oso:0:zone/foo.com/record/mail.foo.com"},
+		},
+		// tom may only view www.foo.com
+		3: {{ID: 4, Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/foo.com/record/www.foo.com"}},
+		// jim views every record of foo.com but its apex
+		4: {{ID: 5, Effect: "allow", Actions: []string{"view"}, Resource: "oso:0:zone/foo.com",
+			NotResourceNames: []roles.PolicyResourceName{"oso:0:zone/foo.com/record/foo.com"}}},
+	})
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		apiKey  string
+		body    string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "list records covered by zone policy",
+			method:  "GET",
+			route:   "/zone/0/record",
+			apiKey:  "john",
+			expCode: 200,
+			expBody: "<h1>Records</h1><p>foo.com MX 10 mail.foo.com,www.foo.com A 192.0.2.10,mail.foo.com A 192.0.2.20</p>",
+		},
+		{
+			name:    "list records narrowed to record policy",
+			method:  "GET",
+			route:   "/zone/0/record",
+			apiKey:  "tom",
+			expCode: 200,
+			expBody: "<h1>Records</h1><p>www.foo.com A 192.0.2.10</p>",
+		},
+		{
+			name:    "list records except not resource",
+			method:  "GET",
+			route:   "/zone/0/record",
+			apiKey:  "jim",
+			expCode: 200,
+			expBody: "<h1>Records</h1><p>www.foo.com A 192.0.2.10,mail.foo.com A 192.0.2.20</p>",
+		},
+		{
+			name:    "list records of zone that can't be viewed",
+			method:  "GET",
+			route:   "/zone/0/record",
+			apiKey:  "ada",
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "list records of zone that doesn't exist",
+			method:  "GET",
+			route:   "/zone/5/record",
+			apiKey:  "john",
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "view record covered by zone policy",
+			method:  "GET",
+			route:   "/zone/0/record/1",
+			apiKey:  "john",
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Record foo.com MX 10 mail.foo.com</p>",
+		},
+		{
+			name:    "view record covered by zone wildcard",
+			method:  "GET",
+			route:   "/zone/0/record/3",
+			apiKey:  "bob",
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Record mail.foo.com A 192.0.2.20</p>",
+		},
+		{
+			name:    "view record of record policy",
+			method:  "GET",
+			route:   "/zone/0/record/2",
+			apiKey:  "tom",
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Record www.foo.com A 192.0.2.10</p>",
+		},
+		{
+			name:    "view other record without authz",
+			method:  "GET",
+			route:   "/zone/0/record/1",
+			apiKey:  "tom",
+			expCode: 404,
+			expBody: errHTMLRecordNotFound,
+		},
+		{
+			name:    "record policy doesn't cover zone",
+			method:  "GET",
+			route:   "/zone/0",
+			apiKey:  "tom",
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "view excluded record",
+			method:  "GET",
+			route:   "/zone/0/record/1",
+			apiKey:  "jim",
+			expCode: 404,
+			expBody: errHTMLRecordNotFound,
+		},
+		{
+			name:    "view record of other zone",
+			method:  "GET",
+			route:   "/zone/0/record/4",
+			apiKey:  "bob",
+			expCode: 404,
+			expBody: errHTMLRecordNotFound,
+		},
+		{
+			name:    "update record covered by zone policy",
+			method:  "PUT",
+			route:   "/zone/0/record/2",
+			apiKey:  "john",
+			body:    `{"type": "A", "value": "192.0.2.11"}`,
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Updated record www.foo.com</p>",
+		},
+		{
+			name:    "view updated record",
+			method:  "GET",
+			route:   "/zone/0/record/2",
+			apiKey:  "tom",
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Record www.foo.com A 192.0.2.11</p>",
+		},
+		{
+			name:    "update record with bad type",
+			method:  "PUT",
+			route:   "/zone/0/record/2",
+			apiKey:  "john",
+			body:    `{"type": "SRV", "value": "0 5 5060 sip.foo.com"}`,
+			expCode: 400,
+			expBody: "<h1>Whoops!</h1><p>record type must be one of A, AAAA, CNAME, MX, NS or TXT</p>",
+		},
+		{
+			name:    "update record without authz",
+			method:  "PUT",
+			route:   "/zone/0/record/2",
+			apiKey:  "tom",
+			body:    `{"type": "A", "value": "192.0.2.12"}`,
+			expCode: 403,
+			expBody: errHTMLForbidden,
+		},
+		{
+			name:    "delete record without authz",
+			method:  "DELETE",
+			route:   "/zone/0/record/2",
+			apiKey:  "john",
+			expCode: 403,
+			expBody: errHTMLForbidden,
+		},
+		{
+			name:    "delete record denied by record policy",
+			method:  "DELETE",
+			route:   "/zone/0/record/3",
+			apiKey:  "bob",
+			expCode: 403,
+			expBody: errHTMLForbidden,
+		},
+		{
+			name:    "delete record",
+			method:  "DELETE",
+			route:   "/zone/0/record/2",
+			apiKey:  "bob",
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Deleted record www.foo.com</p>",
+		},
+		{
+			name:    "view deleted record",
+			method:  "GET",
+			route:   "/zone/0/record/2",
+			apiKey:  "bob",
+			expCode: 404,
+			expBody: errHTMLRecordNotFound,
+		},
+		{
+			name:    "create record",
+			method:  "POST",
+			route:   "/zone/0/record",
+			apiKey:  "bob",
+			body:    `{"name": "api.foo.com", "type": "cname", "value": "www.foo.com"}`,
+			expCode: 201,
+			expBody: "<h1>A Repo</h1><p>Created record api.foo.com</p>",
+		},
+		{
+			name:    "view created record",
+			method:  "GET",
+			route:   "/zone/0/record/101",
+			apiKey:  "john",
+			expCode: 200,
+			expBody: "<h1>A Repo</h1><p>Record api.foo.com CNAME www.foo.com</p>",
+		},
+		{
+			name:    "create viewable record without authz",
+			method:  "POST",
+			route:   "/zone/0/record",
+			apiKey:  "john",
+			body:    `{"name": "ftp.foo.com", "type": "A", "value": "192.0.2.40"}`,
+			expCode: 403,
+			expBody: errHTMLForbidden,
+		},
+		{
+			name:    "create record in zone that can't be viewed",
+			method:  "POST",
+			route:   "/zone/0/record",
+			apiKey:  "tom",
+			body:    `{"name": "ftp.foo.com", "type": "A", "value": "192.0.2.40"}`,
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "create invalid record in zone that can't be viewed",
+			method:  "POST",
+			route:   "/zone/0/record",
+			apiKey:  "tom",
+			body:    `{"name": "www.bar.net", "type": "A", "value": "192.0.2.40"}`,
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "create unparseable record in zone that can't be viewed",
+			method:  "POST",
+			route:   "/zone/0/record",
+			apiKey:  "tom",
+			body:    `{"name": `,
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+		{
+			name:    "create record outside zone",
+			method:  "POST",
+			route:   "/zone/0/record",
+			apiKey:  "bob",
+			body:    `{"name": "www.bar.net", "type": "A", "value": "192.0.2.40"}`,
+			expCode: 400,
+			expBody: "<h1>Whoops!</h1><p>record name must be the zone's name or a subdomain of it</p>",
+		},
+		{
+			name:    "create record in nonexistant zone",
+			method:  "POST",
+			route:   "/zone/5/record",
+			apiKey:  "bob",
+			body:    `{"name": "www.foo.com", "type": "A", "value": "192.0.2.40"}`,
+			expCode: 404,
+			expBody: errHTMLZoneNotFound,
+		},
+	}
+	app := newTestServer(t, ds, defaultConfig()).setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", tt.apiKey)
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, string(body))
+		})
+	}
+}
@@ -2,73 +2,81 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"github.com/mburtless/oso-rbac-iam/datastore"
 	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/iam"
+	"github.com/mburtless/oso-rbac-iam/pkg/iamfiber"
 	"strconv"
 	"strings"
 )
 
+// zone service actions, authorized on zones and their records
+const (
+	actionGetZone      = "zone:GetZone"
+	actionDeleteZone   = "zone:DeleteZone"
+	actionGetRecord    = "zone:GetRecord"
+	actionCreateRecord = "zone:CreateRecord"
+	actionUpdateRecord = "zone:UpdateRecord"
+	actionDeleteRecord = "zone:DeleteRecord"
+)
+
 var (
 	errHTMLZoneNotFound  = "<h1>Whoops!</h1><p>That zone was not found</p>"
 	errHTMLZonesNotFound = "<h1>Whoops!</h1><p>No zones found in org</p>"
 	errHTMLUserNotFound  = "<h1>Whoops!<h1><p>User not found</p>"
+	errHTMLForbidden     = "<h1>Whoops!</h1><p>You are not allowed to do that</p>"
 )
 
-// doesn't actually delete zone from DS, just simulates to test authz call
-func deleteZoneRoute(c *fiber.Ctx, ds datastore.Datastore) error {
-	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
-	// get zone
-	z, err := getReqZone(c, ds)
-	if err != nil {
-		return c.Status(404).SendString("<h1>Whoops!</h1><p>That zone was not found</p>")
+// defaultDisclosurePolicies returns the disclosure policy for each resource type served by the app.  Types not
+// listed conceal.
+func defaultDisclosurePolicies() map[string]iam.DisclosurePolicy {
+	return map[string]iam.DisclosurePolicy{
+		"zone":   iam.RevealForbidden,
+		"record": iam.RevealForbidden,
 	}
+}
 
-	// get requester from user context
-	reqUser, err := getReqMeta(c)
+// doesn't actually delete zone from DS, just simulates to test authz call
+func (s *Server) deleteZoneRoute(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+	// get zone authorized by middleware
+	z, err := getAuthorizedZone(c)
 	if err != nil {
-		return c.Status(401).SendString("<h1>Whoops!<h1><p>User not found</p>")
-	}
-
-	if err := authorizeZoneRoute(reqUser, "delete", z); err != nil {
-		return c.Status(404).SendString("<h1>Whoops!</h1><p>That zone was not found</p>")
+		return c.Status(404).SendString(errHTMLZoneNotFound)
 	}
 	return c.Status(200).SendString(fmt.Sprintf("<h1>A Repo</h1><p>Deleted zone %s</p>", z.Name))
 }
 
-func getZoneRoute(c *fiber.Ctx, ds datastore.Datastore) error {
+func (s *Server) getZoneRoute(c *fiber.Ctx) error {
 	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
-	// get zone
-	z, err := getReqZone(c, ds)
+	// get zone authorized by middleware
+	z, err := getAuthorizedZone(c)
 	if err != nil {
 		return c.Status(404).SendString(errHTMLZoneNotFound)
 	}
 
 	// get requester from user context
-	reqUser, err := getReqMeta(c)
+	reqUser, err := iamfiber.User(c)
 	if err != nil {
 		return c.Status(401).SendString(errHTMLUserNotFound)
 	}
-
-	if err := authorizeZoneRoute(reqUser, "view", z); err != nil {
-		return c.Status(404).SendString(errHTMLZoneNotFound)
-	}
 	return c.Status(200).SendString(fmt.Sprintf("<h1>A Repo</h1><p>Welcome %s to zone %s</p>", reqUser.User.Name, z.Name))
 }
 
 // unauthed
-func listZonesRoute(c *fiber.Ctx, ds datastore.Datastore) error {
+func (s *Server) listZonesRoute(c *fiber.Ctx) error {
 	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
-	reqUser, err := getReqMeta(c)
+	reqUser, err := iamfiber.User(c)
 	if err != nil {
 		return c.Status(401).SendString(errHTMLUserNotFound)
 	}
 
 	// get all zones in org
-	zs, err := ds.ListZonesByOrgID(context.Background(), reqUser.User.OrgID)
+	zs, err := s.ds.ListZonesByOrgID(context.Background(), reqUser.User.OrgID)
 	if err != nil {
-		logger.Errorw("error listing zones for org", "orgID", reqUser.User.OrgID, "error", err)
+		s.logger.Errorw("error listing zones for org", "orgID", reqUser.User.OrgID, "error", err)
 		return c.Status(404).SendString(errHTMLZonesNotFound)
 	}
 
@@ -82,17 +90,17 @@ func listZonesRoute(c *fiber.Ctx, ds datastore.Datastore) error {
 }
 
 // unauthed
-func listUsersRoute(c *fiber.Ctx, ds datastore.Datastore) error {
+func (s *Server) listUsersRoute(c *fiber.Ctx) error {
 	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
-	reqUser, err := getReqMeta(c)
+	reqUser, err := iamfiber.User(c)
 	if err != nil {
 		return c.Status(401).SendString(errHTMLUserNotFound)
 	}
 
 	// get all users in org
-	us, err := ds.ListUsersByOrgID(context.Background(), reqUser.User.OrgID)
+	us, err := s.ds.ListUsersByOrgID(context.Background(), reqUser.User.OrgID)
 	if err != nil {
-		logger.Errorw("error listing users for org", "orgID", reqUser.User.OrgID, "error", err)
+		s.logger.Errorw("error listing users for org", "orgID", reqUser.User.OrgID, "error", err)
 		return c.Status(404).SendString(errHTMLZonesNotFound)
 	}
 
@@ -106,25 +114,35 @@ func listUsersRoute(c *fiber.Ctx, ds datastore.Datastore) error {
 }
 
 // gets the zone requested in zoneId param
-func getReqZone(c *fiber.Ctx, ds datastore.Datastore) (*models.Zone, error) {
+func (s *Server) getReqZone(c *fiber.Ctx) (*models.Zone, error) {
 	zoneId, err := strconv.Atoi(c.Params("zoneId"))
 	if err != nil {
 		return nil, errMissingZoneId
 	}
-	z, err := ds.FindZoneByID(context.Background(), zoneId)
+	z, err := s.ds.FindZoneByID(context.Background(), zoneId)
 	if err != nil {
-		logger.Errorw("error finding zone by ID", "error", err)
+		s.logger.Errorw("error finding zone by ID", "error", err)
 		return nil, err
 	}
 	return z, nil
 }
 
-func authorizeZoneRoute(u *DerivedUser, action string, z *models.Zone) error {
-	err := osoClient.Authorize(u, action, z)
+// zoneLoader loads the zone requested in zoneId param for authorization
+func (s *Server) zoneLoader() iam.ResourceLoader[*fiber.Ctx] {
+	return iam.LoaderFunc("zone", func(c *fiber.Ctx) (interface{}, error) {
+		return s.getReqZone(c)
+	})
+}
+
+// gets the zone loaded and authorized by middleware
+func getAuthorizedZone(c *fiber.Ctx) (*models.Zone, error) {
+	r, err := iamfiber.Resource(c)
 	if err != nil {
-		logger.Errorw("error authorizing request", "error", err)
-		return err
+		return nil, err
 	}
-
-	return nil
+	z, ok := r.(*models.Zone)
+	if !ok {
+		return nil, errors.New("authorized resource is not a zone")
+	}
+	return z, nil
 }
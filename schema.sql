@@ -3,7 +3,9 @@ create table org
 	org_id serial not null
 		constraint org_pkey
 			primary key,
-	name varchar(50) not null
+	name varchar(50) not null,
+	-- orgs form a hierarchy of organizational units, whose roles bound to the org and policies flow down to children
+	parent_id INT REFERENCES org(org_id) CHECK (parent_id <> org_id)
 );
 
 create table condition (
@@ -18,7 +20,30 @@ create table policy
     name text NOT NULL,
     effect text NOT NULL,
     actions text[],
-    resource_name text NOT NULL
+    resource_name text NOT NULL,
+    -- actions and resource names excluded from the policy, applying it to everything else
+    not_actions text[] NOT NULL DEFAULT '{}',
+    not_resource_names text[] NOT NULL DEFAULT '{}',
+    -- the policy's effect, actions, resource and conditions are always those of its default version
+    default_version INT NOT NULL DEFAULT 1,
+    -- managed policies are shared by every org and read-only, org policies belong to owner_org_id and inline policies
+    -- to the role owner_role_id of owner_org_id, which they're deleted with
+    kind text NOT NULL DEFAULT 'org',
+    owner_org_id INT NOT NULL DEFAULT 0,
+    owner_role_id INT NOT NULL DEFAULT 0
+);
+
+create table policy_version (
+    policy_id INT references policy(policy_id) NOT NULL,
+    version INT NOT NULL,
+    effect text NOT NULL,
+    actions text[] NOT NULL,
+    resource_name text NOT NULL,
+    not_actions text[] NOT NULL DEFAULT '{}',
+    not_resource_names text[] NOT NULL DEFAULT '{}',
+    conditions jsonb NOT NULL DEFAULT '[]',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY(policy_id, version)
 );
 
 create table condition_policies (
@@ -49,9 +74,88 @@ create table "user" (
 create table user_roles (
     user_id INT references "user"(user_id),
     role_id INT references role(role_id),
+    -- the binding is only effective from not_before until expires_at, when either is set
+    not_before timestamptz,
+    expires_at timestamptz,
     PRIMARY KEY(user_id, role_id)
 );
 
+-- roles bound to an org apply to every user of the org and of its descendants
+create table org_roles (
+    org_id INT references org(org_id),
+    role_id INT references role(role_id),
+    PRIMARY KEY(org_id, role_id)
+);
+
+-- tags are substituted for policy variables like ${principal.tag/team}
+create table user_tag (
+    user_id INT references "user"(user_id),
+    key text NOT NULL,
+    value text NOT NULL,
+    PRIMARY KEY(user_id, key)
+);
+
+create table audit_event (
+    event_id serial PRIMARY KEY NOT NULL,
+    occurred_at timestamptz NOT NULL DEFAULT now(),
+    type text NOT NULL,
+    org_id INT NOT NULL,
+    -- events outlive the users and roles they refer to, so these aren't references
+    user_id INT NOT NULL DEFAULT 0,
+    role_id INT NOT NULL DEFAULT 0,
+    detail text NOT NULL DEFAULT ''
+);
+
+create table decision (
+    decision_id serial PRIMARY KEY NOT NULL,
+    occurred_at timestamptz NOT NULL DEFAULT now(),
+    org_id INT NOT NULL,
+    -- decisions outlive the users and policies they refer to, so these aren't references
+    user_id INT NOT NULL,
+    action text NOT NULL,
+    resource_name text NOT NULL,
+    allowed boolean NOT NULL,
+    policy_ids INT[] NOT NULL DEFAULT '{}'
+);
+
+create index decision_org_occurred_at on decision (org_id, occurred_at);
+
+create table last_used (
+    -- api_key, policy or role.  API keys are identified by the ID of their user.
+    kind text NOT NULL,
+    id INT NOT NULL,
+    used_at timestamptz NOT NULL,
+    PRIMARY KEY(kind, id)
+);
+
+create table access_request (
+    request_id serial PRIMARY KEY NOT NULL,
+    org_id INT REFERENCES org(org_id) NOT NULL,
+    user_id INT NOT NULL,
+    -- either role_id is requested, or action on resource_name
+    role_id INT NOT NULL DEFAULT 0,
+    action text NOT NULL DEFAULT '',
+    resource_name text NOT NULL DEFAULT '',
+    duration_seconds INT NOT NULL,
+    justification text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    decided_at timestamptz,
+    decider_id INT NOT NULL DEFAULT 0,
+    reason text NOT NULL DEFAULT '',
+    expires_at timestamptz,
+    -- the role bound to the user on approval
+    grant_role_id INT NOT NULL DEFAULT 0
+);
+
+create table access_approval (
+    request_id INT REFERENCES access_request(request_id) NOT NULL,
+    approver_id INT NOT NULL,
+    decision text NOT NULL,
+    reason text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
 create table zone (
     zone_id serial PRIMARY KEY NOT NULL,
     name text NOT NULL,
@@ -59,51 +163,42 @@ create table zone (
     org_id INT REFERENCES org(org_id) NOT NULL
 );
 
+/* DNS records of zones, named under their zone as oso:<org>:zone/<zone>/record/<name> */
+create table record (
+    record_id serial PRIMARY KEY NOT NULL,
+    zone_id INT REFERENCES zone(zone_id) NOT NULL,
+    name text NOT NULL,
+    type text NOT NULL,
+    value text NOT NULL,
+    ttl INT NOT NULL DEFAULT 300,
+    resource_name text NOT NULL,
+    UNIQUE (zone_id, name, type)
+);
+
 /* TEST DATA */
 /* org */
 INSERT INTO org (name) VALUES ('Aperture Science');
 
 /* zones */
-INSERT INTO zone (name, resource_name, org_id) VALUES ('gmail.com', 'oso:0:zone/gmail.com', 1);
-INSERT INTO zone (name, resource_name, org_id) VALUES ('react.net', 'oso:0:zone/react.net', 1);
-INSERT INTO zone (name, resource_name, org_id) VALUES ('oso.com', 'oso:0:zone/oso.com', 1);
-INSERT INTO zone (name, resource_name, org_id) VALUES ('authz.net', 'oso:0:zone/authz.net', 1);
-
-/* conditions */
-INSERT INTO condition (type, value) VALUES ('matchSuffix', 'com');
-
-/* policies */
-INSERT INTO policy (name, effect, actions, resource_name) VALUES ('viewZones', 'allow', '{"view"}', 'oso:0:zone/*');
-INSERT INTO policy (name, effect, actions, resource_name) VALUES ('deleteOneZone', 'allow', '{"delete"}', 'oso:0:zone/react.net');
-INSERT INTO policy (name, effect, actions, resource_name) VALUES ('viewOneZone', 'allow', '{"view"}', 'oso:0:zone/gmail.com');
-INSERT INTO policy (name, effect, actions, resource_name) VALUES ('deleteZones', 'allow', '{"delete"}', 'oso:0:zone/*');
-INSERT INTO policy (name, effect, actions, resource_name) VALUES ('viewComZones', 'allow', '{"view"}', 'oso:0:zone/*');
-
-/* join conditions to policies */
-INSERT INTO condition_policies (condition_id, policy_id) VALUES (1, 5);
-
-/* roles */
-INSERT INTO role (name, org_id) VALUES ('viewZonesAndDeleteOne', 1);
-INSERT INTO role (name, org_id) VALUES ('deleteZonesAndViewOne', 1);
-INSERT INTO role (name, org_id) VALUES ('viewComZones', 1);
-
-/* join policies to roles */
-INSERT INTO role_policies (role_id, policy_id) VALUES (1, 1);
-INSERT INTO role_policies (role_id, policy_id) VALUES (1, 2);
-INSERT INTO role_policies (role_id, policy_id) VALUES (2, 3);
-INSERT INTO role_policies (role_id, policy_id) VALUES (2, 4);
-INSERT INTO role_policies (role_id, policy_id) VALUES (3, 5);
-
-/* users */
-/* bob can view all zones and delete react.net */
-INSERT INTO "user" (name, api_key, org_id) VALUES ('bob', 'bob', 1);
-/* tom can delete all zones and view gmail.com */
-INSERT INTO "user" (name, api_key, org_id) VALUES ('tom', 'tom', 1);
-/* joe can view zones with com suffix */
-INSERT INTO "user" (name, api_key, org_id) VALUES ('joe', 'joe', 1);
-
-
-/* join users to roles */
-INSERT INTO user_roles (user_id, role_id) VALUES (1, 1);
-INSERT INTO user_roles (user_id, role_id) VALUES (2, 2);
-INSERT INTO user_roles (user_id, role_id) VALUES (3, 3);
+INSERT INTO zone (name, resource_name, org_id) VALUES ('gmail.com', 'oso:1:zone/gmail.com', 1);
+INSERT INTO zone (name, resource_name, org_id) VALUES ('react.net', 'oso:1:zone/react.net', 1);
+INSERT INTO zone (name, resource_name, org_id) VALUES ('oso.com', 'oso:1:zone/oso.com', 1);
+INSERT INTO zone (name, resource_name, org_id) VALUES ('authz.net', 'oso:1:zone/authz.net', 1);
+
+/* records */
+INSERT INTO record (zone_id, name, type, value, resource_name)
+    VALUES (1, 'gmail.com', 'MX', '10 mx.gmail.com', 'oso:1:zone/gmail.com/record/gmail.com');
+INSERT INTO record (zone_id, name, type, value, resource_name)
+    VALUES (1, 'www.gmail.com', 'A', '192.0.2.10', 'oso:1:zone/gmail.com/record/www.gmail.com');
+INSERT INTO record (zone_id, name, type, value, resource_name)
+    VALUES (3, 'www.oso.com', 'CNAME', 'oso.com', 'oso:1:zone/oso.com/record/www.oso.com');
+
+/* managed policies, shared by every org */
+INSERT INTO policy (name, effect, actions, resource_name, kind)
+    VALUES ('ZoneReadOnly', 'allow', '{zone:Get*}', 'oso:${principal.org_id}:zone/*', 'managed');
+INSERT INTO policy (name, effect, actions, resource_name, kind)
+    VALUES ('ZoneFullAccess', 'allow', '{*}', 'oso:${principal.org_id}:zone/*', 'managed');
+INSERT INTO policy_version (policy_id, version, effect, actions, resource_name)
+    SELECT policy_id, 1, effect, actions, resource_name FROM policy WHERE kind = 'managed';
+
+/* roles, policies, conditions and users are applied from policies/ with `iamctl apply` */
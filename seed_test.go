@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/mburtless/oso-rbac-iam/pkg/policyfile"
+	"github.com/mburtless/oso-rbac-iam/pkg/roles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	seedOrg    = regexp.MustCompile(`INSERT INTO org \(name\) VALUES \('([^']+)'\);`)
+	seedZone   = regexp.MustCompile(`INSERT INTO zone \(name, resource_name, org_id\) VALUES \('([^']+)', '([^']+)', (\d+)\);`)
+	seedRecord = regexp.MustCompile(`INSERT INTO record \(zone_id, name, type, value, resource_name\)\s+` +
+		`VALUES \((\d+), '([^']+)', '([^']+)', '([^']+)', '([^']+)'\);`)
+	seedManaged = regexp.MustCompile(`INSERT INTO policy \(name, effect, actions, resource_name, kind\)\s+` +
+		`VALUES \('([^']+)', '([^']+)', '\{([^}]*)\}', '([^']+)', 'managed'\);`)
+)
+
+// seedDatastore is a mockDatastore with the org, zones, records and managed policies seeded by schema.sql and the
+// policies, roles and users applied from policies/, so routes can be tested against the data the app is seeded with
+type seedDatastore struct {
+	mockDatastore
+	orgID    int
+	doc      *policyfile.Document
+	zones    models.ZoneSlice
+	records  []*datastore.Record
+	policies map[string]policyfile.Policy
+}
+
+func newSeedDatastore(t *testing.T) *seedDatastore {
+	schema, err := os.ReadFile("schema.sql")
+	require.NoError(t, err)
+	docs, err := policyfile.LoadFiles("policies")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	ds := &seedDatastore{doc: docs[0], policies: map[string]policyfile.Policy{}}
+	// IDs are assigned in the order rows are inserted
+	for i, m := range seedOrg.FindAllStringSubmatch(string(schema), -1) {
+		if m[1] == ds.doc.Org {
+			ds.orgID = i + 1
+		}
+	}
+	require.NotZero(t, ds.orgID, "org of policies/ isn't seeded")
+	for i, m := range seedZone.FindAllStringSubmatch(string(schema), -1) {
+		orgID, _ := strconv.Atoi(m[3])
+		ds.zones = append(ds.zones, &models.Zone{ZoneID: i + 1, Name: m[1], ResourceName: m[2], OrgID: orgID})
+	}
+	for i, m := range seedRecord.FindAllStringSubmatch(string(schema), -1) {
+		zoneID, _ := strconv.Atoi(m[1])
+		ds.records = append(ds.records, &datastore.Record{
+			RecordID: i + 1, ZoneID: zoneID, Name: m[2], Type: m[3], Value: m[4], ResourceName: m[5],
+		})
+	}
+	// managed policies are inserted by schema.sql before the org's policies are applied
+	id := 0
+	for _, m := range seedManaged.FindAllStringSubmatch(string(schema), -1) {
+		id++
+		ds.policies[m[1]] = policyfile.Policy{ID: id, Name: m[1], Effect: m[2], Actions: strings.Split(m[3], ","), Resource: m[4]}
+	}
+	for _, p := range ds.doc.Policies {
+		id++
+		p.ID = id
+		ds.policies[p.Name] = p
+	}
+	for i := range ds.doc.Users {
+		ds.doc.Users[i].ID = i + 1
+	}
+	require.NotEmpty(t, ds.zones)
+	require.NotEmpty(t, ds.records)
+	return ds
+}
+
+func (ds *seedDatastore) FindZoneByID(_ context.Context, id int) (*models.Zone, error) {
+	if id < 1 || id > len(ds.zones) {
+		return nil, fmt.Errorf("zone not found")
+	}
+	return ds.zones[id-1], nil
+}
+
+func (ds *seedDatastore) ListZonesByOrgID(_ context.Context, orgID int) (*models.ZoneSlice, error) {
+	var zs models.ZoneSlice
+	for _, z := range ds.zones {
+		if z.OrgID == orgID {
+			zs = append(zs, z)
+		}
+	}
+	return &zs, nil
+}
+
+func (ds *seedDatastore) ListRecordsByZoneID(_ context.Context, zoneID int) ([]*datastore.Record, error) {
+	var rs []*datastore.Record
+	for _, r := range ds.records {
+		if r.ZoneID == zoneID {
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
+
+func (ds *seedDatastore) FindRecordByID(_ context.Context, id int) (*datastore.Record, error) {
+	if id < 1 || id > len(ds.records) {
+		return nil, fmt.Errorf("record not found")
+	}
+	return ds.records[id-1], nil
+}
+
+func (ds *seedDatastore) FindUserByKey(_ context.Context, key string) (*models.User, error) {
+	for _, u := range ds.doc.Users {
+		if u.APIKey == key {
+			return u.Model(ds.orgID), nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (ds *seedDatastore) FindUserByID(_ context.Context, id int) (*models.User, error) {
+	for _, u := range ds.doc.Users {
+		if u.ID == id {
+			return u.Model(ds.orgID), nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+// GetEffectivePerms returns the policies and managed policies of the roles of the user with the given ID
+func (ds *seedDatastore) GetEffectivePerms(_ context.Context, user *models.User, _ roles.OrgTree) (datastore.EffectivePerms, error) {
+	perms := datastore.NewEffectivePerms()
+	for _, u := range ds.doc.Users {
+		if u.ID != user.UserID {
+			continue
+		}
+		for _, r := range ds.doc.Roles {
+			if !contains(u.Roles, r.Name) {
+				continue
+			}
+			for _, name := range append(append([]string{}, r.Policies...), r.ManagedPolicies...) {
+				p := ds.policies[name].RolePolicy()
+				byNamespace := perms.AllowPolicies
+				if p.Effect == "deny" {
+					byNamespace = perms.DenyPolicies
+				}
+				if byNamespace[string(p.Resource)] == nil {
+					byNamespace[string(p.Resource)] = map[int]*roles.RolePolicy{}
+				}
+				byNamespace[string(p.Resource)][p.ID] = &p
+			}
+		}
+		return perms, nil
+	}
+	return datastore.EffectivePerms{}, fmt.Errorf("user not found")
+}
+
+// contains returns true if names contains name
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// seedStep is a request to the app served with the seed data, made in order with the other steps of its test
+type seedStep struct {
+	name    string
+	method  string
+	route   string
+	apiKey  string
+	body    string
+	expCode int
+	expBody string
+}
+
+// runSeedSteps makes each of steps in order against an app serving ds, with an empty admin datastore
+func runSeedSteps(t *testing.T, ds *seedDatastore, steps []seedStep) {
+	app := NewServer(newTestAuthorizer(t), ds, newMemAdmin(), newNopLog(), defaultConfig()).setup()
+	for _, tt := range steps {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("x-api-key", tt.apiKey)
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			if tt.expBody != "" {
+				body, err := ioutil.ReadAll(res.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expBody, timestamps.ReplaceAllString(string(body), `"<time>"`))
+			}
+		})
+	}
+}
+
+func Test_seedResourceNames(t *testing.T) {
+	ds := newSeedDatastore(t)
+
+	// the org of a resource's NRN is the org that owns it
+	zones := map[int]*models.Zone{}
+	for _, z := range ds.zones {
+		org, _, err := roles.SplitResourceName(z.ResourceName)
+		assert.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(z.OrgID), org, z.Name)
+		zones[z.ZoneID] = z
+	}
+	for _, r := range ds.records {
+		z, ok := zones[r.ZoneID]
+		require.True(t, ok, r.Name)
+		assert.Equal(t, z.ResourceName+"/record/"+r.Name, r.ResourceName)
+	}
+}
+
+func Test_seedAccessRequests(t *testing.T) {
+	runSeedSteps(t, newSeedDatastore(t), []seedStep{
+		{
+			name:    "request action on zone of org",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "joe",
+			body:    `{"action": "zone:DeleteZone", "resource_name": "oso:1:zone/gmail.com", "justification": "cleanup"}`,
+			expCode: 201,
+		},
+		{
+			name:    "request action on zone of other org",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "joe",
+			body:    `{"action": "zone:DeleteZone", "resource_name": "oso:0:zone/gmail.com", "justification": "cleanup"}`,
+			expCode: 400,
+			expBody: `{"error":"resource_name must be in the requester's org"}`,
+		},
+		{
+			name:    "request action without policy",
+			method:  "POST",
+			route:   "/iam/access-requests",
+			apiKey:  "tom",
+			body:    `{"action": "zone:DeleteZone", "resource_name": "oso:1:zone/gmail.com", "justification": "cleanup"}`,
+			expCode: 403,
+		},
+		{
+			name:    "approve request",
+			method:  "POST",
+			route:   "/iam/access-requests/101/approve",
+			apiKey:  "admin",
+			body:    `{}`,
+			expCode: 200,
+		},
+	})
+}
+
+func Test_seedZoneActions(t *testing.T) {
+	// the seeded zone:Get* and zone:Delete* policies on zones cover the zones' records too
+	runSeedSteps(t, newSeedDatastore(t), []seedStep{
+		{name: "view zone", method: "GET", route: "/zone/2", apiKey: "bob", expCode: 200},
+		{name: "view record of zone", method: "GET", route: "/zone/1/record/2", apiKey: "bob", expCode: 200},
+		{name: "delete viewable record without policy", method: "DELETE", route: "/zone/1/record/2", apiKey: "bob", expCode: 403},
+		{name: "view zone implied by delete", method: "GET", route: "/zone/3", apiKey: "tom", expCode: 200},
+		{name: "delete record of zone", method: "DELETE", route: "/zone/3/record/3", apiKey: "tom", expCode: 200},
+		{name: "list records of zone by condition", method: "GET", route: "/zone/1/record", apiKey: "joe", expCode: 200},
+		{name: "view zone failing condition", method: "GET", route: "/zone/4", apiKey: "joe", expCode: 404},
+	})
+}
+
+func Test_seedPolicies(t *testing.T) {
+	ds := newSeedDatastore(t)
+
+	// every seeded policy can be written by the org
+	for _, p := range ds.doc.Policies {
+		assert.NoError(t, validatePolicy(p.Model(), ds.orgID), p.Name)
+	}
+
+	runSeedSteps(t, ds, []seedStep{
+		{
+			name:    "create policy on zones of org",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "admin",
+			body:    `{"name": "viewNetZones", "effect": "allow", "actions": ["zone:GetZone"], "resource_name": "oso:1:zone/*"}`,
+			expCode: 201,
+		},
+		{
+			name:    "create policy on zones of other org",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "admin",
+			body:    `{"name": "viewNetZones", "effect": "allow", "actions": ["zone:GetZone"], "resource_name": "oso:0:zone/*"}`,
+			expCode: 400,
+			expBody: `{"error":"resource_name and not_resource_names must be in the requester's org or ${principal.org_id}"}`,
+		},
+		{
+			name:    "create policy without iam policy",
+			method:  "POST",
+			route:   "/iam/policies",
+			apiKey:  "bob",
+			body:    `{"name": "viewNetZones", "effect": "allow", "actions": ["zone:GetZone"], "resource_name": "oso:1:zone/*"}`,
+			expCode: 404,
+		},
+	})
+}
+
+func Test_seedManagedPolicies(t *testing.T) {
+	// joe views the seeded com zones, and the net zones too once a managed zone policy is attached to one of its roles
+	viewNetZones := func(expCode int) []seedStep {
+		return []seedStep{
+			{name: "view react.net", method: "GET", route: "/zone/2", apiKey: "joe", expCode: expCode},
+			{name: "view authz.net", method: "GET", route: "/zone/4", apiKey: "joe", expCode: expCode},
+		}
+	}
+	for _, name := range []string{"ZoneReadOnly", "ZoneFullAccess"} {
+		t.Run(name, func(t *testing.T) {
+			ds := newSeedDatastore(t)
+			require.Contains(t, ds.policies, name)
+			runSeedSteps(t, ds, viewNetZones(404))
+
+			ds.doc.Roles = append(ds.doc.Roles, policyfile.Role{Name: "managed", ManagedPolicies: []string{name}})
+			for i, u := range ds.doc.Users {
+				if u.Name == "joe" {
+					ds.doc.Users[i].Roles = append(ds.doc.Users[i].Roles, "managed")
+				}
+			}
+			runSeedSteps(t, ds, viewNetZones(200))
+		})
+	}
+}
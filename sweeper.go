@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// defaultSweepInterval is how often expired role bindings, access requests and decisions are swept
+const defaultSweepInterval = time.Minute
+
+// sweepBindings sweeps expired role bindings and access requests, and decisions older than the configured retention if
+// they're recorded, every interval until ctx is done
+func (s *Server) sweepBindings(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.sweepExpiredBindings(ctx, now)
+			s.expireAccessRequests(ctx, now)
+			if s.decisions != nil && s.cfg.DecisionRetention > 0 {
+				s.pruneDecisions(ctx, now)
+			}
+		}
+	}
+}
+
+// sweepExpiredBindings deletes the role bindings that expired at or before now and logs the audit events recorded
+func (s *Server) sweepExpiredBindings(ctx context.Context, now time.Time) {
+	events, err := s.admin.SweepExpiredBindings(ctx, now)
+	if err != nil {
+		s.logger.Errorw("error sweeping expired role bindings", "error", err)
+		return
+	}
+	for _, e := range events {
+		s.logger.Infow("role binding expired", "event", e.EventID, "org", e.OrgID, "user", e.UserID, "role", e.RoleID)
+	}
+}
+
+// expireAccessRequests expires the approved access requests that expired at or before now and logs the audit events
+// recorded
+func (s *Server) expireAccessRequests(ctx context.Context, now time.Time) {
+	events, err := s.admin.ExpireAccessRequests(ctx, now)
+	if err != nil {
+		s.logger.Errorw("error expiring access requests", "error", err)
+		return
+	}
+	for _, e := range events {
+		s.logger.Infow("access request expired", "event", e.EventID, "org", e.OrgID, "user", e.UserID, "role", e.RoleID)
+	}
+}
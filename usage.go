@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultUsageFlushInterval is how often the usage tracked is written
+	defaultUsageFlushInterval = 10 * time.Second
+	// maxPendingUsage is how many users' usage is tracked before it's written early
+	maxPendingUsage = 1000
+	// defaultUnusedDays is how many days roles, policies and API keys must be unused for to be reported by default
+	defaultUnusedDays = 90
+)
+
+var errBadDays = errors.New("days must be a positive integer")
+
+// flushUsage writes the usage tracked every interval, or sooner when enough is pending, until ctx is done, and then
+// writes what's left
+func (s *Server) flushUsage(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.writeUsage(context.Background())
+			return
+		case <-t.C:
+			s.writeUsage(ctx)
+		case <-s.usage.Full():
+			s.writeUsage(ctx)
+		}
+	}
+}
+
+// writeUsage writes the usage tracked.  Usage that can't be written is logged and kept to be written next time.
+func (s *Server) writeUsage(ctx context.Context) {
+	if err := s.usage.Flush(ctx); err != nil {
+		s.logger.Errorw("error writing usage", "error", err)
+	}
+}
+
+// listUnusedRoute lists the roles, policies and API keys of the requester's org unused for the days query param
+func (s *Server) listUnusedRoute(c *fiber.Ctx) error {
+	days := defaultUnusedDays
+	if d := c.Query("days"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n <= 0 {
+			return s.adminError(c, errBadDays)
+		}
+		days = n
+	}
+	unused, err := s.admin.ListUnused(context.Background(), reqOrgID(c), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return s.adminError(c, err)
+	}
+	if unused == nil {
+		unused = []*datastore.Unused{}
+	}
+	return c.JSON(unused)
+}
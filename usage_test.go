@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"github.com/mburtless/oso-rbac-iam/datastore"
+	"github.com/mburtless/oso-rbac-iam/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/volatiletech/null/v8"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func Test_listUnusedRoute(t *testing.T) {
+	t.Parallel()
+
+	// steps run in order against the same server, writing the usage tracked first if flush is set
+	tests := []struct {
+		name    string
+		route   string
+		apiKey  string
+		flush   bool
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "view zone",
+			route:   "/zone/0",
+			apiKey:  "john",
+			expCode: 200,
+		},
+		{
+			name:    "nothing written",
+			route:   "/iam/unused",
+			apiKey:  "ada",
+			expCode: 200,
+			expBody: `[{"kind":"api_key","id":1,"name":"john"},{"kind":"api_key","id":2,"name":"bob"},` +
+				`{"kind":"api_key","id":3,"name":"tom"},{"kind":"api_key","id":4,"name":"jim"},` +
+				`{"kind":"api_key","id":6,"name":"ada"},{"kind":"api_key","id":7,"name":"chell"},` +
+				`{"kind":"api_key","id":8,"name":"glados"},{"kind":"policy","id":1,"name":"viewZones"},` +
+				`{"kind":"role","id":1,"name":"viewZonesRole"}]`,
+		},
+		{
+			name:    "used since written",
+			route:   "/iam/unused?days=1",
+			apiKey:  "ada",
+			flush:   true,
+			expCode: 200,
+			expBody: `[{"kind":"api_key","id":2,"name":"bob"},{"kind":"api_key","id":3,"name":"tom"},` +
+				`{"kind":"api_key","id":4,"name":"jim"},{"kind":"api_key","id":7,"name":"chell"},` +
+				`{"kind":"api_key","id":8,"name":"glados"}]`,
+		},
+		{
+			name:    "bad days",
+			route:   "/iam/unused?days=0",
+			apiKey:  "ada",
+			expCode: 400,
+			expBody: `{"error":"days must be a positive integer"}`,
+		},
+		{
+			name:    "org concealed",
+			route:   "/iam/unused",
+			apiKey:  "john",
+			expCode: 404,
+		},
+	}
+
+	s := NewServer(newTestAuthorizer(t), &mockDatastore{}, newMemAdmin(), newNopLog(), defaultConfig())
+	app := s.setup()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.flush {
+				require.NoError(t, s.usage.Flush(context.Background()))
+			}
+			req, _ := http.NewRequest("GET", tt.route, nil)
+			req.Header.Set("x-api-key", tt.apiKey)
+			res, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expCode, res.StatusCode)
+			if tt.expBody == "" {
+				return
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expBody, string(body))
+		})
+	}
+}
+
+func Test_orgRoleUsage(t *testing.T) {
+	t.Parallel()
+	// viewZonesRole is bound to the parent of john's org rather than to john
+	admin := newMemAdmin()
+	admin.orgs[2] = &models.Org{OrgID: 2, Name: "Enrichment Center"}
+	admin.orgs[0].ParentID = null.IntFrom(2)
+	delete(admin.userRoles, [2]int{1, 1})
+	admin.orgRoles[[2]int{2, 1}] = true
+
+	s := NewServer(newTestAuthorizer(t), &mockDatastore{}, admin, newNopLog(), defaultConfig())
+	req, _ := http.NewRequest("GET", "/zone/0", nil)
+	req.Header.Set("x-api-key", "john")
+	res, err := s.setup().Test(req, -1)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	require.NoError(t, s.usage.Flush(context.Background()))
+
+	assert.Contains(t, admin.lastUsed[datastore.UsageKindRole], 1)
+}